@@ -0,0 +1,19 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"fmt"
+)
+
+// applyAccessEntities runs the configured access-entity DDL (CREATE ROLE/USER, GRANT,
+// CREATE ROW POLICY, ...) in order against the server on httpPort, stopping at the
+// first failure.
+func applyAccessEntities(ctx context.Context, httpPort uint32, statements []string) error {
+	for i, stmt := range statements {
+		if _, err := execHTTP(ctx, httpPort, stmt); err != nil {
+			return fmt.Errorf("embedded-clickhouse: access entity %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
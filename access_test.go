@@ -0,0 +1,180 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyAccessEntities_InOrder(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+
+	port := fakeQueryServer(t, func(_ http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		got = append(got, query)
+	})
+
+	stmts := []string{
+		"CREATE ROLE reader",
+		"GRANT SELECT ON *.* TO reader",
+		"CREATE USER alice IDENTIFIED BY 'pw' DEFAULT ROLE reader",
+	}
+
+	require.NoError(t, applyAccessEntities(context.Background(), port, stmts))
+	assert.Equal(t, stmts, got)
+}
+
+func TestApplyAccessEntities_StopsAtFirstFailure(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		calls++
+
+		if strings.HasPrefix(query, "GRANT") {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "Code: 511. DB::Exception: There is no role `nobody`")
+		}
+	})
+
+	stmts := []string{"CREATE ROLE reader", "GRANT SELECT ON *.* TO nobody", "CREATE USER alice"}
+
+	err := applyAccessEntities(context.Background(), port, stmts)
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "access entity 1")
+	assert.Equal(t, 2, calls, "statements after the failing one must not run")
+}
+
+func TestStart_AccessEntitiesWithoutAccessManagement(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().AccessManagement(false).AccessEntities([]string{"CREATE ROLE reader"})
+
+	require.ErrorIs(t, NewServer(cfg).Start(), ErrAccessManagementDisabled)
+	require.ErrorIs(t, NewCluster(2, cfg).Start(), ErrAccessManagementDisabled)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_AccessEntities(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().
+		Version(V25_3).
+		AccessEntities([]string{
+			"CREATE ROLE reader",
+			"GRANT SELECT ON system.one TO reader",
+			"CREATE USER alice IDENTIFIED WITH no_password DEFAULT ROLE reader",
+			"GRANT reader TO alice",
+		}).
+		Logger(io.Discard))
+
+	body, err := s.ExecHTTP(context.Background(), "SELECT name FROM system.users WHERE name = 'alice'")
+	require.NoError(t, err)
+	assert.Equal(t, "alice\n", body)
+
+	body, err = s.ExecHTTP(context.Background(), "SHOW GRANTS FOR reader")
+	require.NoError(t, err)
+	assert.Contains(t, body, "GRANT SELECT ON system.one TO reader")
+}
+
+func TestIntegration_AccessManagementDisabled(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().
+		Version(V25_3).
+		AccessManagement(false).
+		Logger(io.Discard))
+
+	_, err := s.ExecHTTP(context.Background(), "CREATE USER mallory IDENTIFIED WITH no_password")
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "ACCESS_DENIED")
+
+	body, err := s.ExecHTTP(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", body)
+}
+
+func TestIntegration_UsersConfig(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	users := `<clickhouse>
+    <users>
+        <default>
+            <password></password>
+            <networks><ip>::1</ip><ip>127.0.0.1</ip></networks>
+            <profile>default</profile>
+            <quota>default</quota>
+        </default>
+        <alice>
+            <password>secret</password>
+            <networks><ip>::1</ip><ip>127.0.0.1</ip></networks>
+            <profile>readonly</profile>
+            <quota>default</quota>
+        </alice>
+    </users>
+    <profiles>
+        <default/>
+        <readonly><readonly>1</readonly></readonly>
+    </profiles>
+    <quotas>
+        <default/>
+    </quotas>
+</clickhouse>`
+
+	s := NewServerForTest(t, DefaultConfig().
+		Version(V25_3).
+		UsersConfig([]byte(users)).
+		ProfileSettings(map[string]string{"max_threads": "3"}).
+		Logger(io.Discard))
+
+	ctx := context.Background()
+
+	body, err := s.ExecHTTP(ctx, "SELECT name FROM system.users ORDER BY name")
+	require.NoError(t, err)
+	assert.Equal(t, "alice\ndefault\n", body)
+
+	// ProfileSettings still reach the default profile through users.d.
+	body, err = s.ExecHTTP(ctx, "SELECT getSetting('max_threads')")
+	require.NoError(t, err)
+	assert.Equal(t, "3\n", body)
+
+	db, err := sql.Open("clickhouse", fmt.Sprintf("clickhouse://alice:secret@%s/default", s.TCPAddr()))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	var one int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT 1").Scan(&one))
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE t (id UInt64) ENGINE = Memory")
+	require.ErrorContains(t, err, "readonly")
+}
@@ -0,0 +1,98 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+// resetStatementsQuery returns, as one JSON array, the statements that drop every table,
+// view and dictionary in the default database and then every other non-system database.
+const resetStatementsQuery = `SELECT toJSONString(groupArray(stmt)) FROM (
+    SELECT stmt FROM (
+        SELECT if(engine = 'Dictionary', 'DROP DICTIONARY IF EXISTS default.', 'DROP TABLE IF EXISTS default.')
+            || backQuote(name) || ' SYNC' AS stmt, 0 AS ord
+        FROM system.tables WHERE database = 'default' AND NOT is_temporary
+        UNION ALL
+        SELECT 'DROP DATABASE IF EXISTS ' || backQuote(name) || ' SYNC', 1
+        FROM system.databases WHERE name NOT IN ('default', 'system', 'information_schema', 'INFORMATION_SCHEMA')
+    )
+    ORDER BY ord
+)`
+
+// BenchServer starts a server for a benchmark and registers b.Cleanup(server.Stop), with
+// the timer stopped while the binary is resolved and the server starts, so neither counts
+// towards the measurement. Call it before the timed loop and Reset the server wherever
+// iterations must not see each other's data:
+//
+//	func BenchmarkInsert(b *testing.B) {
+//		ch := embeddedclickhouse.BenchServer(b)
+//		for b.Loop() {
+//			// ...
+//		}
+//	}
+//
+// With b.Loop the benchmark function runs once, so the server starts once. A classic
+// for range b.N loop runs the function again for every b.N it tries, and the cleanup stops
+// the server after each run; that startup is excluded from the timing too. Calls b.Fatal
+// on error.
+func BenchServer(b *testing.B, config ...Config) *EmbeddedClickHouse {
+	b.Helper()
+
+	b.StopTimer()
+	defer b.StartTimer()
+
+	return NewServerForTest(b, config...)
+}
+
+// Reset returns the server to an empty state without restarting it: it drops every
+// database other than default and the system ones, and every table, view and dictionary
+// in default. Users, roles and other access entities are kept. It is much cheaper than
+// Restore, so it suits resetting between benchmark iterations or test cases (stop the
+// benchmark timer around it if its cost should not count).
+func (e *EmbeddedClickHouse) Reset(ctx context.Context) error {
+	e.mu.RLock()
+	clusterManaged, shared := e.clusterManaged, e.shared
+	e.mu.RUnlock()
+
+	if clusterManaged {
+		return ErrClusterManaged
+	}
+
+	if shared {
+		return ErrSharedInstance
+	}
+
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return err
+	}
+
+	body, err := execHTTP(ctx, httpPort, resetStatementsQuery)
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: reset: %w", err)
+	}
+
+	value, err := parseScalar(body)
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: reset: %w", err)
+	}
+
+	var stmts []string
+	if err := json.Unmarshal([]byte(value), &stmts); err != nil {
+		return fmt.Errorf("embedded-clickhouse: reset: parse statements: %w", err)
+	}
+
+	// Dictionaries and views may still reference the tables being dropped.
+	settings := url.Values{"check_table_dependencies": {"0"}, "check_referential_table_dependencies": {"0"}}
+
+	for _, stmt := range stmts {
+		if _, err := execHTTPWithSettings(ctx, httpPort, stmt, settings); err != nil {
+			return fmt.Errorf("embedded-clickhouse: reset: %s: %w", statementPreview(stmt), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReset_Guards(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	require.ErrorIs(t, NewServer().Reset(ctx), ErrServerNotStarted)
+	require.ErrorIs(t, (&EmbeddedClickHouse{started: true, clusterManaged: true}).Reset(ctx), ErrClusterManaged)
+	require.ErrorIs(t, (&EmbeddedClickHouse{started: true, shared: true}).Reset(ctx), ErrSharedInstance)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_Reset(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+	ctx := context.Background()
+
+	require.NoError(t, s.ExecMulti(ctx, `
+		CREATE TABLE default.events (id UInt64) ENGINE = MergeTree ORDER BY id;
+		CREATE DICTIONARY default.lookup (id UInt64) PRIMARY KEY id
+			SOURCE(CLICKHOUSE(TABLE 'events')) LAYOUT(FLAT()) LIFETIME(0);
+		CREATE VIEW default.recent AS SELECT id FROM default.events;
+		CREATE DATABASE fixtures;
+		CREATE TABLE fixtures.t (x String) ENGINE = Memory;
+		INSERT INTO default.events VALUES (1), (2);
+	`))
+
+	require.NoError(t, s.Reset(ctx))
+
+	tables, err := s.ScalarInt(ctx, "SELECT count() FROM system.tables WHERE database = 'default'")
+	require.NoError(t, err)
+	assert.Zero(t, tables)
+
+	databases, err := s.ScalarInt(ctx, "SELECT count() FROM system.databases WHERE name = 'fixtures'")
+	require.NoError(t, err)
+	assert.Zero(t, databases)
+
+	// The default database itself survives and accepts new tables.
+	_, err = s.ExecHTTP(ctx, "CREATE TABLE default.events (id UInt64) ENGINE = MergeTree ORDER BY id")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Reset(ctx))
+
+	// Resetting an already empty server is a no-op.
+	require.NoError(t, s.Reset(ctx))
+}
+
+func BenchmarkIntegration_BenchServer(b *testing.B) {
+	if testing.Short() {
+		b.Skip("skipping integration benchmark in short mode")
+	}
+
+	s := BenchServer(b, DefaultConfig().Version(V25_3).Logger(io.Discard))
+	ctx := context.Background()
+
+	for b.Loop() {
+		if _, err := s.ExecHTTP(ctx, "SELECT 1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
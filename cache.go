@@ -31,7 +31,49 @@ func cacheDir(override string) (string, error) {
 	return filepath.Join(home, ".cache", cacheSubdir), nil
 }
 
+// sharedCachedBinary returns the counterpart of binPath (a path in the writable cache)
+// in cfg's SharedCachePath, if one is configured and holds the binary.
+func sharedCachedBinary(cfg Config, binPath string) (string, bool) {
+	if cfg.sharedCachePath == "" {
+		return "", false
+	}
+
+	path := filepath.Join(cfg.sharedCachePath, filepath.Base(binPath))
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// ensureCacheDir creates the cache directory and checks that files can be created in
+// it, so an unwritable location (e.g. a read-only $XDG_CACHE_HOME) fails up front with a
+// hint rather than deep inside a download. Only the download path calls it: a binary
+// already cached in a read-only directory is still used.
+func ensureCacheDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return cacheDirError(dir, err)
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return cacheDirError(dir, err)
+	}
+
+	f.Close()
+	os.Remove(f.Name())
+
+	return nil
+}
+
+func cacheDirError(dir string, err error) error {
+	return fmt.Errorf("%w: %s: %w (set CachePath or %s to a writable directory)",
+		ErrCacheDirUnwritable, dir, err, EnvCachePath)
+}
+
 // cachedBinaryPath returns the full path to a cached ClickHouse binary for the given version and platform.
+// The archive and raw-binary assets (Config.LinuxAsset) hold the same executable, so both
+// land in this one file: whichever is downloaded first serves the other.
 func cachedBinaryPath(cacheDir string, version ClickHouseVersion) string {
 	// Replace path separators in the version string to prevent directory traversal in cache filenames.
 	safeVersion := strings.ReplaceAll(string(version), string(filepath.Separator), "_")
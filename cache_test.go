@@ -1,6 +1,9 @@
 package embeddedclickhouse
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -82,3 +85,127 @@ func TestCustomCachedBinaryPath(t *testing.T) {
 		t.Errorf("different inputs produced same key: %q", path)
 	}
 }
+
+func TestEnsureCacheDir(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "nested", cacheSubdir)
+	if err := ensureCacheDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("write check left files behind: %v", entries)
+	}
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestEnsureBinary_ReadOnlyXDGCache(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+
+	xdg := t.TempDir()
+	if err := os.Chmod(xdg, 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.Chmod(xdg, 0o755) }) //nolint:errcheck
+
+	t.Setenv("XDG_CACHE_HOME", xdg)
+
+	_, _, err := ensureBinary(context.Background(), DefaultConfig().Logger(io.Discard))
+	if !errors.Is(err, ErrCacheDirUnwritable) {
+		t.Fatalf("ensureBinary = %v, want ErrCacheDirUnwritable", err)
+	}
+
+	if !strings.Contains(err.Error(), "CachePath") {
+		t.Errorf("error %q should suggest CachePath", err)
+	}
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestEnsureBinary_XDGCacheNotADirectory(t *testing.T) {
+	// A regular file in place of the cache root cannot be created into, even by root.
+	xdg := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(xdg, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("XDG_CACHE_HOME", xdg)
+
+	_, _, err := ensureBinary(context.Background(), DefaultConfig().Logger(io.Discard))
+	if !errors.Is(err, ErrCacheDirUnwritable) {
+		t.Fatalf("ensureBinary = %v, want ErrCacheDirUnwritable", err)
+	}
+}
+
+func TestEnsureBinary_ReadOnlyCacheWithBinary(t *testing.T) {
+	t.Parallel()
+
+	// A pre-populated read-only cache is still usable: the write check is download-only.
+	dir := t.TempDir()
+	binPath := cachedBinaryPath(dir, DefaultVersion)
+
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.Chmod(dir, 0o755) }) //nolint:errcheck
+
+	got, _, err := ensureBinary(context.Background(), DefaultConfig().CachePath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != binPath {
+		t.Errorf("ensureBinary = %q, want %q", got, binPath)
+	}
+}
+
+func TestEnsureBinary_SharedCachePath(t *testing.T) {
+	t.Parallel()
+
+	shared := t.TempDir()
+	writable := t.TempDir()
+	cfg := DefaultConfig().SharedCachePath(shared).CachePath(writable)
+
+	// Miss in the shared cache: the writable cache is used.
+	inWritable := cachedBinaryPath(writable, DefaultVersion)
+	if err := os.WriteFile(inWritable, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := ensureBinary(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != inWritable {
+		t.Errorf("ensureBinary = %q, want writable cache %q", got, inWritable)
+	}
+
+	// Hit in the shared cache: it wins over the writable one.
+	inShared := cachedBinaryPath(shared, DefaultVersion)
+	if err := os.WriteFile(inShared, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err = ensureBinary(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != inShared {
+		t.Errorf("ensureBinary = %q, want shared cache %q", got, inShared)
+	}
+}
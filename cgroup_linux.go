@@ -0,0 +1,183 @@
+//go:build linux
+
+package embeddedclickhouse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupRoot is where the unified (v2) cgroup hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUPeriod is the cpu.max period, in microseconds, the CPU quota is expressed in.
+const cgroupCPUPeriod = 100_000
+
+// cgroupRemoveAttempts bounds how long remove waits for the kernel to release a cgroup
+// whose last process has just exited.
+const cgroupRemoveAttempts = 50
+
+// cgroup is a cgroup created for one server process. Its directory is opened so the
+// process can be started inside it (clone3 CLONE_INTO_CGROUP), rather than moved there
+// after it has already begun allocating.
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// createCgroup creates a cgroup enforcing limits next to the calling process's own
+// cgroup: as a sibling, since cgroup v2 only lets a cgroup without processes of its own
+// hand controllers down to children. In the root cgroup, which is exempt, it is a child.
+func createCgroup(limits cgroupLimits) (*cgroup, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(cgroupRoot, &st); err != nil || st.Type != unix.CGROUP2_SUPER_MAGIC {
+		return nil, fmt.Errorf("%w: %s is not a cgroup v2 mount", ErrCgroupUnavailable, cgroupRoot)
+	}
+
+	own, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	parent := filepath.Join(cgroupRoot, filepath.Dir(own))
+
+	if err := checkControllers(parent, limits); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(parent, "embedded-clickhouse-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: create cgroup: %w", ErrCgroupUnavailable, err)
+	}
+
+	cg := &cgroup{dir: dir, fd: nil}
+
+	if err := cg.setLimits(limits); err != nil {
+		cg.remove()
+		return nil, err
+	}
+
+	if cg.fd, err = os.Open(dir); err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("%w: open cgroup: %w", ErrCgroupUnavailable, err)
+	}
+
+	return cg, nil
+}
+
+// ownCgroup returns the calling process's cgroup v2 path, e.g. "/user.slice/x.scope".
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCgroupUnavailable, err)
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if path, ok := strings.CutPrefix(sc.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: process is not in a cgroup v2 hierarchy", ErrCgroupUnavailable)
+}
+
+// checkControllers makes sure parent already hands the controllers limits needs down to
+// its children. Missing ones are not enabled here: that would change the parent cgroup
+// for every other process under it, so delegating them is left to the administrator.
+func checkControllers(parent string, limits cgroupLimits) error {
+	control := filepath.Join(parent, "cgroup.subtree_control")
+
+	data, err := os.ReadFile(control)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCgroupUnavailable, err)
+	}
+
+	enabled := strings.Fields(string(data))
+
+	var missing []string
+
+	for controller, needed := range map[string]bool{"memory": limits.memBytes > 0, "cpu": limits.cpus > 0} {
+		if needed && !slices.Contains(enabled, controller) {
+			missing = append(missing, controller)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	slices.Sort(missing)
+
+	return fmt.Errorf("%w: %s does not delegate %s to its children (add them to %s, or run under "+
+		"systemd-run --user -p Delegate=yes)", ErrCgroupUnavailable, parent, strings.Join(missing, " "), control)
+}
+
+// setLimits writes limits to the cgroup's interface files. Swap is disabled along with
+// a memory limit when the kernel has swap accounting, so the limit cannot be dodged.
+func (c *cgroup) setLimits(limits cgroupLimits) error {
+	files := map[string]string{}
+
+	if limits.memBytes > 0 {
+		files["memory.max"] = strconv.FormatInt(limits.memBytes, 10)
+		files["memory.swap.max"] = "0"
+	}
+
+	if limits.cpus > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(limits.cpus*cgroupCPUPeriod), cgroupCPUPeriod)
+	}
+
+	for name, value := range files {
+		err := os.WriteFile(filepath.Join(c.dir, name), []byte(value), 0)
+		if err != nil && !(name == "memory.swap.max" && errors.Is(err, os.ErrNotExist)) {
+			return fmt.Errorf("%w: set %s: %w", ErrCgroupUnavailable, name, err)
+		}
+	}
+
+	return nil
+}
+
+// attach makes the process started with attr begin inside the cgroup.
+func (c *cgroup) attach(attr *syscall.SysProcAttr) {
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(c.fd.Fd()) //nolint:gosec // file descriptors fit in an int
+}
+
+// closeFD closes the cgroup directory once the process has been started.
+func (c *cgroup) closeFD() {
+	if c == nil || c.fd == nil {
+		return
+	}
+
+	c.fd.Close()
+	c.fd = nil
+}
+
+// remove deletes the cgroup, waiting briefly for the kernel to release it after its last
+// process exits. A cgroup that still cannot be removed is left behind.
+func (c *cgroup) remove() {
+	if c == nil {
+		return
+	}
+
+	c.closeFD()
+
+	for range cgroupRemoveAttempts {
+		if err := unix.Rmdir(c.dir); !errors.Is(err, unix.EBUSY) {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package embeddedclickhouse
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckControllers(t *testing.T) {
+	t.Parallel()
+
+	parent := t.TempDir()
+	control := filepath.Join(parent, "cgroup.subtree_control")
+
+	if err := os.WriteFile(control, []byte("cpuset cpu\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkControllers(parent, cgroupLimits{cpus: 1}); err != nil {
+		t.Errorf("cpu delegated: %v", err)
+	}
+
+	err := checkControllers(parent, cgroupLimits{memBytes: 1 << 30, cpus: 1})
+	if !errors.Is(err, ErrCgroupUnavailable) {
+		t.Fatalf("memory not delegated: err = %v, want ErrCgroupUnavailable", err)
+	}
+
+	// The parent is left as it was rather than changed for its other processes.
+	if got, _ := os.ReadFile(control); string(got) != "cpuset cpu\n" {
+		t.Errorf("subtree_control = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package embeddedclickhouse
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// cgroup stands in for the Linux cgroup of a server process; cgroups exist only on Linux.
+type cgroup struct{}
+
+// createCgroup reports that Cgroup is not supported on this platform.
+func createCgroup(cgroupLimits) (*cgroup, error) {
+	return nil, fmt.Errorf("%w: cgroups need Linux, not %s", ErrCgroupUnavailable, runtime.GOOS)
+}
+
+func (c *cgroup) attach(*syscall.SysProcAttr) {}
+
+func (c *cgroup) closeFD() {}
+
+func (c *cgroup) remove() {}
@@ -8,9 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"slices"
 	"sync"
 	"testing"
+	"time"
 )
 
 // ErrServerNotStarted is returned by Stop when the server has not been started.
@@ -19,12 +21,21 @@ var ErrServerNotStarted = errors.New("embedded-clickhouse: server has not been s
 // ErrServerAlreadyStarted is returned by Start when the server is already running.
 var ErrServerAlreadyStarted = errors.New("embedded-clickhouse: server is already started")
 
-// ErrUnsupportedPlatform is returned when the current OS/architecture has no ClickHouse release asset.
+// ErrUnsupportedPlatform is returned when the current OS/architecture has no ClickHouse release
+// asset, or when the binary to run was built for another one ("exec format error").
 var ErrUnsupportedPlatform = errors.New("embedded-clickhouse: unsupported platform")
 
 // ErrStopTimeout is returned when the server does not stop within the configured StopTimeout; the process is killed.
 var ErrStopTimeout = errors.New("embedded-clickhouse: server did not stop within timeout, killed")
 
+// ErrUncleanShutdown is returned by Stop when the server exited abnormally (non-zero status or
+// a crash signal) in response to SIGTERM. The wrapping error carries the exit status.
+var ErrUncleanShutdown = errors.New("embedded-clickhouse: server exited abnormally during shutdown")
+
+// ErrServerCrashed is returned by Stop when the server process had already died before it was
+// asked to stop. The wrapping error carries the exit status; check the server log for the cause.
+var ErrServerCrashed = errors.New("embedded-clickhouse: server process exited before Stop")
+
 // ErrDownloadFailed is returned when the HTTP download of a ClickHouse asset returns a non-200 status.
 var ErrDownloadFailed = errors.New("embedded-clickhouse: download failed")
 
@@ -35,32 +46,110 @@ var ErrSHA256Mismatch = errors.New("embedded-clickhouse: SHA256 mismatch")
 var ErrSHA512Mismatch = errors.New("embedded-clickhouse: SHA512 mismatch")
 
 // ErrSHA512NotFound is returned when the SHA512 checksum file does not contain a hash for the expected filename.
+// Under Config.RequireChecksum it is also returned, wrapping ErrSHA512Unavailable, for a missing checksum file.
 var ErrSHA512NotFound = errors.New("embedded-clickhouse: SHA512 hash not found")
 
 // ErrSHA512Unavailable is returned when the SHA512 checksum file cannot be fetched (non-200)
-// and AllowMissingChecksum has not been enabled.
+// and AllowMissingChecksum has not been enabled, or RequireChecksum has.
 var ErrSHA512Unavailable = errors.New("embedded-clickhouse: SHA512 checksum unavailable")
 
+// ErrChecksumRequired is returned when RequireChecksum is set and a custom archive has
+// neither SHA256 nor SHA512 configured.
+var ErrChecksumRequired = errors.New("embedded-clickhouse: checksum required but none configured for custom archive")
+
 // ErrBinaryNotFound is returned when the ClickHouse binary cannot be located inside a downloaded archive.
 var ErrBinaryNotFound = errors.New("embedded-clickhouse: binary not found in archive")
 
 // ErrInvalidPath is returned when a destination path contains a path traversal sequence ("..").
 var ErrInvalidPath = errors.New("embedded-clickhouse: invalid destination path")
 
+// ErrInvalidVersion is returned when the configured version is empty or not a release version string.
+var ErrInvalidVersion = errors.New("embedded-clickhouse: invalid version")
+
+// ErrInvalidCgroupLimits is returned by Start when a Cgroup limit is negative or the CPU
+// quota is below 0.01.
+var ErrInvalidCgroupLimits = errors.New("embedded-clickhouse: invalid cgroup limits")
+
+// ErrCgroupUnavailable is returned by Start when Cgroup is set but the server cannot be
+// placed in a cgroup: the platform is not Linux, /sys/fs/cgroup is not a cgroup v2
+// mount, the process lacks the permissions to create one, or its parent cgroup does not
+// delegate the needed controllers.
+var ErrCgroupUnavailable = errors.New("embedded-clickhouse: cgroup unavailable")
+
+// ErrCgroupWithShared is returned by Start and Cluster.Start when both Cgroup and Shared
+// are set: a Shared server outlives the process that started it, which could then not
+// remove the server's cgroup.
+var ErrCgroupWithShared = errors.New("embedded-clickhouse: Cgroup cannot be combined with Shared")
+
+// ErrInvalidPortRange is returned by Start when PortRange is inverted or outside 1-65535.
+var ErrInvalidPortRange = errors.New("embedded-clickhouse: invalid port range")
+
+// ErrNoFreePort is returned by Start when every port of the configured PortRange is in use.
+var ErrNoFreePort = errors.New("embedded-clickhouse: no free port in range")
+
+// ErrPortInUse is returned by Cluster.Start when a port recorded under its DataPath by a
+// previous Start is now taken, by another server of this process or by any other process.
+var ErrPortInUse = errors.New("embedded-clickhouse: port already in use")
+
+// ErrCacheDirUnwritable is returned when the binary must be downloaded but the cache
+// directory cannot be created or written to.
+var ErrCacheDirUnwritable = errors.New("embedded-clickhouse: cache directory is not writable")
+
+// ErrBinaryTooLarge is returned when the binary in an archive exceeds the MaxBinarySize limit.
+var ErrBinaryTooLarge = errors.New("embedded-clickhouse: binary exceeds maximum size")
+
+// ErrBinaryNotExecutable is returned with VerifyBinaryRuns when the resolved binary fails
+// to run `clickhouse --version`, e.g. a truncated extract or an incompatible host.
+var ErrBinaryNotExecutable = errors.New("embedded-clickhouse: binary present but not executable on this host")
+
 // ErrUnexpectedAddrType is returned when the listener address is not the expected *net.TCPAddr type.
 var ErrUnexpectedAddrType = errors.New("embedded-clickhouse: unexpected listener address type")
 
 // ErrUnknownAssetType is returned when an unrecognised platform asset type is encountered.
 var ErrUnknownAssetType = errors.New("embedded-clickhouse: unknown asset type")
 
+// ErrInvalidExtraArgs is returned by Start when ExtraArgs repeats a flag the package
+// sets itself.
+var ErrInvalidExtraArgs = errors.New("embedded-clickhouse: invalid extra args")
+
 // ErrInvalidSettingKey is returned when a settings key contains characters that are unsafe in an XML element name.
 var ErrInvalidSettingKey = errors.New("embedded-clickhouse: invalid setting key")
 
+// ErrInvalidUsersConfig is returned by Start and Cluster.Start when UsersConfig is not a
+// well-formed XML document.
+var ErrInvalidUsersConfig = errors.New("embedded-clickhouse: invalid users config")
+
+// ErrInvalidFormatSchemaName is returned when a FormatSchemas name is not a relative path
+// inside the format schema directory.
+var ErrInvalidFormatSchemaName = errors.New("embedded-clickhouse: invalid format schema name")
+
+// ErrInvalidConfigTemplate is returned by Start when the ConfigTemplate does not parse.
+var ErrInvalidConfigTemplate = errors.New("embedded-clickhouse: invalid config template")
+
+// ErrInvalidMacroKey is returned when a macro name contains characters that are unsafe in an XML element name.
+var ErrInvalidMacroKey = errors.New("embedded-clickhouse: invalid macro key")
+
 // ErrClusterManaged is returned when Start or Stop is called on a node owned by a Cluster.
 var ErrClusterManaged = errors.New("embedded-clickhouse: node is managed by a cluster; use Cluster.Start/Stop")
 
-// ErrServerExited is returned when the ClickHouse process exits during startup before becoming ready.
-var ErrServerExited = errors.New("embedded-clickhouse: server process exited during startup")
+// ErrServerExited is returned when the ClickHouse process exits during startup before becoming ready,
+// and sent by Monitor when it exits while running.
+var ErrServerExited = errors.New("embedded-clickhouse: server process exited")
+
+// ErrIPv4LoopbackNotReady wraps the startup timeout when the server answered /ping on the IPv6
+// loopback ([::1]) but never on 127.0.0.1, the address the DSN and accessors use.
+var ErrIPv4LoopbackNotReady = errors.New("embedded-clickhouse: server answers on [::1] but not on 127.0.0.1")
+
+// ErrEphemeralWithDataPath is returned by Start and Cluster.Start when both Ephemeral and
+// DataPath are set.
+var ErrEphemeralWithDataPath = errors.New("embedded-clickhouse: Ephemeral cannot be combined with DataPath")
+
+// ErrAccessManagementDisabled is returned by Start and Cluster.Start when AccessEntities
+// are set with AccessManagement(false): the default user could not run them.
+var ErrAccessManagementDisabled = errors.New("embedded-clickhouse: AccessEntities need AccessManagement enabled")
+
+// ErrTemplateWithDataPath is returned by Start when both TemplateDataPath and DataPath are set.
+var ErrTemplateWithDataPath = errors.New("embedded-clickhouse: TemplateDataPath cannot be combined with DataPath")
 
 // ErrLockingUnsupported is returned when cross-process file locking is not supported on the current platform.
 var ErrLockingUnsupported = errors.New("embedded-clickhouse: file locking not supported on this platform")
@@ -73,13 +162,31 @@ type EmbeddedClickHouse struct {
 	started bool
 	proc    *process
 	tmpDir  string
+	binPath string
+	// version is the ClickHouse version of binPath, see Version.
+	version ClickHouseVersion
+	// downloaded is set when binPath was downloaded in this process, see DownloadedThisRun.
+	downloaded bool
+	// startDuration is how long the last successful Start took, see RuntimeInfo.
+	startDuration time.Duration
 
 	tcpPort         uint32
 	httpPort        uint32
+	grpcPort        uint32
 	interserverPort uint32
 	keeperPort      uint32
 	keeperRaftPort  uint32
-	clusterManaged  bool
+	// claimedPorts are the auto-allocated ports Stop releases, see portClaims.
+	claimedPorts   []uint32
+	clusterManaged bool
+	// shared is set while the server is attached to a Shared instance, which is
+	// reference-counted across processes instead of owned by this handle.
+	shared bool
+	// output keeps the recent output of the process started by the last Start; it
+	// outlives Stop so a failed or finished run can still be inspected.
+	output *outputBuffer
+	// cleanups are the functions registered with WithCleanup, run by the next Stop.
+	cleanups []func()
 }
 
 // NewServer creates a new EmbeddedClickHouse with the given config.
@@ -96,17 +203,30 @@ func NewServer(config ...Config) *EmbeddedClickHouse {
 }
 
 // NewServerForTest creates a server, starts it, and registers t.Cleanup(server.Stop).
-// Calls t.Fatal on Start() error.
+// The binary is resolved through the same per-process memo as Prepare, so only the
+// first call for a given config pays for resolution. Calls t.Fatal on Start() error.
+// The cleanup runs BreakpointWait first, so EMBEDDED_CLICKHOUSE_BREAKPOINT pauses the
+// test with the server still up.
 func NewServerForTest(tb testing.TB, config ...Config) *EmbeddedClickHouse {
 	tb.Helper()
 
 	s := NewServer(config...)
 
+	binPath, downloaded, err := prepareBinary(s.config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s.config.resolvedBinaryPath = binPath
+	s.config.resolvedDownloaded = downloaded
+
 	if err := s.Start(); err != nil {
 		tb.Fatal(err)
 	}
 
 	tb.Cleanup(func() {
+		s.BreakpointWait()
+
 		if err := s.Stop(); err != nil {
 			tb.Errorf("embedded-clickhouse: stop failed: %v", err)
 		}
@@ -116,7 +236,13 @@ func NewServerForTest(tb testing.TB, config ...Config) *EmbeddedClickHouse {
 }
 
 // Start downloads the ClickHouse binary (if needed), generates config, and starts the server.
-func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard adds one branch
+func (e *EmbeddedClickHouse) Start() error {
+	return e.StartContext(context.Background())
+}
+
+// StartContext is like Start, but cancelling ctx aborts an in-flight binary download
+// (removing its partial file) or readiness wait, and stops the half-started server.
+func (e *EmbeddedClickHouse) StartContext(ctx context.Context) error { //nolint:cyclop // cluster guard adds one branch
 	e.mu.Lock() // write lock: modifies started, cmd, ports
 	defer e.mu.Unlock()
 
@@ -128,6 +254,62 @@ func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard ad
 		return ErrServerAlreadyStarted
 	}
 
+	if e.config.templateDataPath != "" && e.config.dataPath != "" {
+		return ErrTemplateWithDataPath
+	}
+
+	if e.config.ephemeral && e.config.dataPath != "" {
+		return ErrEphemeralWithDataPath
+	}
+
+	if e.config.cgroup.isSet() && e.config.sharedName != "" {
+		return ErrCgroupWithShared
+	}
+
+	if e.config.noAccessManagement && len(e.config.accessEntities) > 0 {
+		return ErrAccessManagementDisabled
+	}
+
+	if err := e.config.portRange.validate(); err != nil {
+		return err
+	}
+
+	if err := e.config.cgroup.validate(); err != nil {
+		return err
+	}
+
+	if err := validateExtraArgs(e.config.extraArgs); err != nil {
+		return err
+	}
+
+	if err := validateUsersConfig(e.config.usersConfig); err != nil {
+		return err
+	}
+
+	began := time.Now()
+
+	ctx, span := e.config.rootSpan(ctx, "embedded-clickhouse.Start", attrVersion.String(string(e.config.version)))
+	ctx = withTiming(ctx, e.config.onTiming)
+
+	var err error
+	if e.config.sharedName != "" {
+		err = e.startShared(ctx)
+	} else {
+		err = e.startLocked(ctx)
+	}
+
+	if err == nil {
+		e.startDuration = time.Since(began)
+	}
+
+	endSpan(span, err)
+
+	return err
+}
+
+// startLocked resolves the binary, allocates ports, writes the config, and starts the
+// server process. Caller must hold e.mu.
+func (e *EmbeddedClickHouse) startLocked(ctx context.Context) error { //nolint:funlen // sequential setup steps
 	cleanups := make([]func(), 0)
 	cleanup := func() {
 		for _, fn := range slices.Backward(cleanups) {
@@ -137,6 +319,8 @@ func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard ad
 
 	success := false
 
+	// A deferred call also runs while a panic unwinds, so whatever was allocated before
+	// a panic in config writing, process start or readiness is torn down too.
 	defer func() {
 		if !success {
 			cleanup()
@@ -144,30 +328,47 @@ func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard ad
 	}()
 
 	// Resolve binary.
-	binPath, err := ensureBinary(e.config)
+	binPath, downloaded, err := ensureBinary(ctx, e.config)
 	if err != nil {
 		return err
 	}
 
-	// Allocate ports.
-	//
-	// Known limitation: these two allocatePort calls share the flaw fixed for
-	// clusters (see allocatePorts) — allocating sequentially can hand back the
-	// same just-freed ephemeral port, so tcpPort could equal httpPort. The risk
-	// is far smaller here (two ports, and either may be pre-set from config), so
-	// it is intentionally left out of the cluster fix.
-	tcpPort := e.config.tcpPort
-	if tcpPort == 0 {
-		tcpPort, err = allocatePort()
+	downloaded = downloaded || e.config.resolvedDownloaded
+
+	version := binaryVersion(ctx, e.config, binPath)
+
+	// Allocate ports. Each stays claimed (see portClaims) until Stop or a failed start,
+	// so allocating them one by one cannot hand back the same just-freed port twice.
+	var claimed []uint32
+
+	cleanups = append(cleanups, func() { claimedPorts.release(claimed...) })
+
+	allocate := func(port *uint32) error {
+		p, err := allocatePort(e.config.portRange)
 		if err != nil {
 			return err
 		}
+
+		*port = p
+		claimed = append(claimed, p)
+
+		return nil
 	}
 
-	httpPort := e.config.httpPort
-	if httpPort == 0 {
-		httpPort, err = allocatePort()
-		if err != nil {
+	cfg := e.config
+	tcpPort := cfg.tcpPort
+	httpPort := cfg.httpPort
+
+	for _, port := range []*uint32{&tcpPort, &httpPort} {
+		if *port == 0 {
+			if err := allocate(port); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfg.grpc && cfg.grpcPort == 0 {
+		if err := allocate(&cfg.grpcPort); err != nil {
 			return err
 		}
 	}
@@ -181,7 +382,7 @@ func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard ad
 			return fmt.Errorf("embedded-clickhouse: create data dir: %w", err)
 		}
 	} else {
-		tmpDir, err = os.MkdirTemp("", "embedded-clickhouse-*")
+		tmpDir, err = makeTempDir(e.config, "embedded-clickhouse-*")
 		if err != nil {
 			return fmt.Errorf("embedded-clickhouse: create temp dir: %w", err)
 		}
@@ -190,18 +391,27 @@ func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard ad
 	}
 
 	// Write server config.
-	configPath, err := writeServerConfig(tmpDir, tcpPort, httpPort, e.config.settings)
+	configDone := timePhase(ctx, "config")
+
+	configPath, err := writeServerConfig(tmpDir, tcpPort, httpPort, cfg)
+
+	configDone()
+
 	if err != nil {
 		return err
 	}
 
-	// Start process with configured logger for stdout/stderr.
-	logger := e.config.logger
-	if logger == nil {
-		logger = os.Stdout
+	// Seed the fresh data dir from the template, if configured.
+	if e.config.templateDataPath != "" {
+		if err := copyDir(filepath.Join(e.config.templateDataPath, "data"), filepath.Join(tmpDir, "data")); err != nil {
+			return err
+		}
 	}
 
-	proc, err := startProcess(binPath, configPath, logger)
+	// Start the process and wait for it to become ready (startAndWait stops it on failure).
+	e.output = outputBufferFor(e.config)
+
+	proc, err := startAndWait(ctx, binPath, configPath, httpPort, tcpPort, e.config, e.output)
 	if err != nil {
 		return err
 	}
@@ -210,56 +420,210 @@ func (e *EmbeddedClickHouse) Start() error { //nolint:cyclop // cluster guard ad
 		stopProcess(proc, e.config.stopTimeout) //nolint:errcheck
 	})
 
-	// Wait for server to be ready, or abort early if the process exits.
-	ctx, cancel := context.WithTimeout(context.Background(), e.config.startTimeout)
-	defer cancel()
+	if err := writeMetadata(e.config, tmpDir, proc, tcpPort, httpPort, version, ""); err != nil {
+		return err
+	}
 
-	if err := waitForReadyOrExit(ctx, httpPort, proc); err != nil {
+	if err := e.provisionAccess(ctx, httpPort); err != nil {
 		return err
 	}
 
 	e.proc = proc
 	e.tmpDir = tmpDir
+	e.binPath = binPath
+	e.version = version
+	e.downloaded = downloaded
 	e.tcpPort = tcpPort
 	e.httpPort = httpPort
+	e.grpcPort = cfg.grpcPort
+	e.claimedPorts = claimed
 	e.started = true
 	success = true
 
 	return nil
 }
 
-// Stop gracefully shuts down the ClickHouse server and cleans up resources.
+// startAndWait launches the server process with the configured logger for stdout/stderr
+// and waits for it to become ready (HTTP /ping, then a native-protocol handshake), or
+// aborts early if the process exits. On failure or panic the process is stopped before
+// returning.
+func startAndWait(
+	ctx context.Context, binPath, configPath string, httpPort, tcpPort uint32, cfg Config, output *outputBuffer,
+) (*process, error) {
+	logger := cfg.logger
+	if logger == nil {
+		logger = os.Stdout
+	}
+
+	_, span := startSpan(ctx, "embedded-clickhouse.startProcess", portAttrs(tcpPort, httpPort)...)
+	startDone := timePhase(ctx, "process-start")
+
+	proc, err := startProcess(binPath, configPath, cfg.extraArgs, cfg.cgroup, logger, output)
+
+	ready := false
+
+	// Deferred rather than called on the error path, so the process is also stopped
+	// when a panic (e.g. from an OnTiming callback) unwinds through the wait.
+	defer func() {
+		if proc != nil && !ready {
+			stopProcess(proc, cfg.stopTimeout) //nolint:errcheck
+		}
+	}()
+
+	startDone()
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.startTimeout)
+	defer cancel()
+
+	ctx, span = startSpan(ctx, "embedded-clickhouse.waitForReady", portAttrs(tcpPort, httpPort)...)
+	readyDone := timePhase(ctx, "wait-ready")
+
+	err = waitForServerReady(ctx, httpPort, tcpPort, proc, cfg)
+
+	readyDone()
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ready = true
+
+	return proc, nil
+}
+
+// provisionAccess applies the configured access entities within the start timeout.
+func (e *EmbeddedClickHouse) provisionAccess(ctx context.Context, httpPort uint32) error {
+	if len(e.config.accessEntities) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.config.startTimeout)
+	defer cancel()
+
+	return applyAccessEntities(ctx, httpPort, e.config.accessEntities)
+}
+
+// Stop gracefully shuts down the ClickHouse server and cleans up resources. Functions
+// registered with WithCleanup run afterwards, most recently registered first, even if
+// stopping reported an error.
 func (e *EmbeddedClickHouse) Stop() error {
+	cleanups, err := e.stop()
+
+	for _, fn := range slices.Backward(cleanups) {
+		fn()
+	}
+
+	return err
+}
+
+// Close implements io.Closer: it calls Stop but returns nil instead of
+// ErrServerNotStarted when the server is not running, so it is idempotent and safe in a
+// deferred cleanup loop.
+func (e *EmbeddedClickHouse) Close() error {
+	if err := e.Stop(); !errors.Is(err, ErrServerNotStarted) {
+		return err
+	}
+
+	return nil
+}
+
+// WithCleanup registers fn to run when Stop next stops the server, after the process
+// has exited and the temp dir has been removed: the same teardown t.Cleanup gives
+// NewServerForTest, for tools and benchmarks without a testing.TB. Functions run in
+// reverse registration order, without the server's lock held, so they may call its
+// methods.
+func (e *EmbeddedClickHouse) WithCleanup(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cleanups = append(e.cleanups, fn)
+}
+
+// stop implements Stop. It returns the WithCleanup functions for Stop to run once e.mu
+// is released.
+func (e *EmbeddedClickHouse) stop() ([]func(), error) {
 	e.mu.Lock() // write lock: resets started, cmd, ports
 	defer e.mu.Unlock()
 
 	if e.clusterManaged {
-		return ErrClusterManaged
+		return nil, ErrClusterManaged
 	}
 
 	if !e.started {
-		return ErrServerNotStarted
+		if e.config.idempotentStop {
+			return nil, nil
+		}
+
+		return nil, ErrServerNotStarted
+	}
+
+	cleanups := e.cleanups
+	e.cleanups = nil
+
+	if e.shared {
+		return cleanups, e.stopShared()
 	}
 
 	var errs []error
 
+	if err := beforeStop(e.httpPort, e.config); err != nil {
+		errs = append(errs, err)
+	}
+
 	if err := stopProcess(e.proc, e.config.stopTimeout); err != nil {
 		errs = append(errs, err)
 	}
 
-	// Only remove temp dir if no explicit data path was set.
-	if e.config.dataPath == "" && e.tmpDir != "" {
-		if err := os.RemoveAll(e.tmpDir); err != nil {
-			errs = append(errs, fmt.Errorf("embedded-clickhouse: remove temp dir: %w", err))
-		}
+	if err := e.removeTmpDir(); err != nil {
+		errs = append(errs, err)
 	}
 
+	claimedPorts.release(e.claimedPorts...)
+
 	e.started = false
 	e.proc = nil
 	e.tcpPort = 0
 	e.httpPort = 0
+	e.grpcPort = 0
+	e.claimedPorts = nil
+
+	return cleanups, errors.Join(errs...)
+}
+
+// makeTempDir creates a fresh working directory named after pattern (as in os.MkdirTemp)
+// under the TempDirRoot, creating the root if needed, or under os.TempDir when unset.
+func makeTempDir(cfg Config, pattern string) (string, error) {
+	root := cfg.tempDirRoot
+	if root == "" && cfg.ephemeral {
+		root = memoryTempRoot()
+	}
+
+	if root != "" {
+		if err := os.MkdirAll(root, 0o755); err != nil {
+			return "", err //nolint:wrapcheck // wrapped by the callers
+		}
+	}
+
+	return os.MkdirTemp(root, pattern) //nolint:wrapcheck // wrapped by the callers
+}
 
-	return errors.Join(errs...)
+// removeTmpDir removes the server's temp directory unless an explicit data path was set.
+func (e *EmbeddedClickHouse) removeTmpDir() error {
+	if e.config.dataPath != "" || e.tmpDir == "" {
+		return nil
+	}
+
+	if err := os.RemoveAll(e.tmpDir); err != nil {
+		return fmt.Errorf("embedded-clickhouse: remove temp dir: %w", err)
+	}
+
+	return nil
 }
 
 // TCPAddr returns the TCP address for the ClickHouse native protocol (e.g., "127.0.0.1:19000").
@@ -278,12 +642,58 @@ func (e *EmbeddedClickHouse) HTTPAddr() string {
 	return fmt.Sprintf("127.0.0.1:%d", e.httpPort)
 }
 
+// GRPCAddr returns the address of the ClickHouse gRPC interface (e.g.,
+// "127.0.0.1:9100"), or "" unless the server was started with GRPCPort.
+func (e *EmbeddedClickHouse) GRPCAddr() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.grpcPort == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("127.0.0.1:%d", e.grpcPort)
+}
+
 // DSN returns a ClickHouse DSN for use with clickhouse-go (e.g., "clickhouse://127.0.0.1:19000/default").
 func (e *EmbeddedClickHouse) DSN() string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	return fmt.Sprintf("clickhouse://127.0.0.1:%d/default", e.tcpPort)
+	return dsnFor(e.tcpPort, nil)
+}
+
+// BinaryPath returns the path of the ClickHouse binary the last Start ran, as resolved
+// from the config (download cache, BinaryPath, custom archive or system binary). It is
+// empty before the first Start.
+func (e *EmbeddedClickHouse) BinaryPath() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.binPath
+}
+
+// DownloadedThisRun reports whether the binary the last Start ran was downloaded by this
+// process, rather than found in the cache, the shared cache or at a configured path. For
+// servers sharing a Prepare resolution (NewServerForTest, NewClusterForTest) it reports
+// that resolution, so every server started from a cold cache in this run returns true.
+// CI can assert it is false to check that a warm binary cache is being used. It is
+// false before the first Start.
+func (e *EmbeddedClickHouse) DownloadedThisRun() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.downloaded
+}
+
+// Version returns the ClickHouse version the last Start ran. For UseSystemBinary and
+// BinaryPath it is the version reported by `clickhouse --version`, otherwise the
+// configured one. It is empty before the first Start.
+func (e *EmbeddedClickHouse) Version() ClickHouseVersion {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.version
 }
 
 // HTTPURL returns the base HTTP URL (e.g., "http://127.0.0.1:18123").
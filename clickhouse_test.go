@@ -1,11 +1,17 @@
 package embeddedclickhouse
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"io"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -39,6 +45,24 @@ func TestEmbeddedClickHouse_StopBeforeStart(t *testing.T) {
 	assert.ErrorIs(t, err, ErrServerNotStarted)
 }
 
+func TestEmbeddedClickHouse_InvalidPortRange(t *testing.T) {
+	t.Parallel()
+
+	// Rejected before any binary download, so this test stays hermetic.
+	s := NewServer(DefaultConfig().PortRange(0, 100))
+	err := s.Start()
+	assert.ErrorIs(t, err, ErrInvalidPortRange)
+}
+
+func TestEmbeddedClickHouse_InvalidExtraArgs(t *testing.T) {
+	t.Parallel()
+
+	// Rejected before any binary download, so this test stays hermetic.
+	s := NewServer(DefaultConfig().ExtraArgs("--config-file=/etc/clickhouse-server/config.xml"))
+	err := s.Start()
+	assert.ErrorIs(t, err, ErrInvalidExtraArgs)
+}
+
 func TestEmbeddedClickHouse_Accessors(t *testing.T) {
 	t.Parallel()
 
@@ -119,6 +143,95 @@ func TestStart_ChildDiesImmediately(t *testing.T) {
 	assert.ErrorIs(t, s.Stop(), ErrServerNotStarted)
 }
 
+// TestStart_PanicTearsDown proves that a panic while the process runs (here from the
+// OnTiming callback reporting the failed readiness wait) still stops the process and removes the temp dir, and leaves the
+// server unlocked and not started.
+//
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestStart_PanicTearsDown(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	fake := writeFakeScript(t, "echo $$ > "+pidFile+"\nexec sleep 60\n")
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	s := NewServer(
+		DefaultConfig().
+			BinaryPath(fake).
+			Logger(io.Discard).
+			StartTimeout(500 * time.Millisecond).
+			OnTiming(func(phase string, _ time.Duration) {
+				if phase == "wait-ready" {
+					panic("boom")
+				}
+			}),
+	)
+
+	require.PanicsWithValue(t, "boom", func() { s.Start() }) //nolint:errcheck
+
+	pidText, err := os.ReadFile(pidFile)
+	require.NoError(t, err, "fake server never ran")
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidText)))
+	require.NoError(t, err)
+
+	proc, err := os.FindProcess(pid)
+	require.NoError(t, err)
+	require.Error(t, proc.Signal(syscall.Signal(0)), "server process outlived the panic")
+
+	dirs, err := filepath.Glob(filepath.Join(tmp, "embedded-clickhouse-*"))
+	require.NoError(t, err)
+	assert.Empty(t, dirs, "temp dir outlived the panic")
+
+	assert.ErrorIs(t, s.Stop(), ErrServerNotStarted)
+}
+
+func TestEmbeddedClickHouse_WithCleanup(t *testing.T) {
+	t.Parallel()
+
+	proc, err := startProcess(writeFakeScript(t, "exec sleep 30\n"), "", nil, cgroupLimits{}, io.Discard, nil)
+	require.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	s := &EmbeddedClickHouse{config: DefaultConfig().StopTimeout(5 * time.Second), started: true, proc: proc, tmpDir: tmpDir}
+
+	var order []string
+
+	s.WithCleanup(func() { order = append(order, "first") })
+	s.WithCleanup(func() {
+		// Runs after teardown and without the lock held.
+		assert.NoDirExists(t, tmpDir)
+		assert.Equal(t, "http://127.0.0.1:0", s.HTTPURL()) // would deadlock under the lock
+
+		order = append(order, "second")
+	})
+
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"second", "first"}, order)
+
+	// Cleanups run once; a second Stop reports the server is not started.
+	require.ErrorIs(t, s.Stop(), ErrServerNotStarted)
+	assert.Len(t, order, 2)
+}
+
+func TestEmbeddedClickHouse_IdempotentStop(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, NewServer(DefaultConfig().IdempotentStop(true)).Stop())
+	require.ErrorIs(t, NewServer(DefaultConfig().IdempotentStop(false)).Stop(), ErrServerNotStarted)
+}
+
+func TestEmbeddedClickHouse_CloseIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	var closer io.Closer = NewServer()
+
+	require.NoError(t, closer.Close(), "Close before Start")
+	require.NoError(t, closer.Close(), "second Close")
+
+	require.ErrorIs(t, (&EmbeddedClickHouse{clusterManaged: true}).Close(), ErrClusterManaged)
+}
+
 // --- Integration tests (skipped in short mode) ---
 
 func TestIntegration_StartStop(t *testing.T) {
@@ -309,3 +422,221 @@ func TestIntegration_HTTPInterface(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.Equal(t, "1\n", string(body))
 }
+
+func TestIntegration_ExecutableUDF(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	scripts := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(scripts, "double.sh"),
+		[]byte("#!/bin/sh\nwhile read x; do echo $((x * 2)); done\n"), 0o755))
+
+	definition := []byte(`<functions>
+    <function>
+        <type>executable</type>
+        <name>double</name>
+        <return_type>UInt64</return_type>
+        <argument><type>UInt64</type></argument>
+        <format>TabSeparated</format>
+        <command>double.sh</command>
+    </function>
+</functions>`)
+
+	s := NewServerForTest(t, DefaultConfig().
+		Version(V25_3).
+		UDFConfig(definition).
+		UserScriptsPath(scripts).
+		Logger(io.Discard))
+
+	body, err := s.ExecHTTP(context.Background(), "SELECT double(21)")
+	require.NoError(t, err)
+	assert.Equal(t, "42\n", body)
+}
+
+func TestIntegration_FileDictionary(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	userFiles := t.TempDir()
+	csvPath := filepath.Join(userFiles, "countries.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("1,France\n2,Japan\n"), 0o644))
+
+	definition := []byte(`<dictionaries>
+    <dictionary>
+        <name>countries</name>
+        <source><file><path>` + csvPath + `</path><format>CSV</format></file></source>
+        <layout><flat/></layout>
+        <lifetime>0</lifetime>
+        <structure>
+            <id><name>id</name></id>
+            <attribute><name>name</name><type>String</type><null_value></null_value></attribute>
+        </structure>
+    </dictionary>
+</dictionaries>`)
+
+	s := NewServerForTest(t, DefaultConfig().
+		Version(V25_3).
+		Dictionaries(definition).
+		UserFilesPath(userFiles).
+		Logger(io.Discard))
+
+	body, err := s.ExecHTTP(context.Background(), "SELECT dictGet('countries', 'name', toUInt64(2))")
+	require.NoError(t, err)
+	assert.Equal(t, "Japan\n", body)
+}
+
+func TestIntegration_FormatSchemas(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().
+		Version(V25_3).
+		FormatSchemas(map[string][]byte{
+			"message.proto": []byte(`syntax = "proto3"; message Msg { uint64 id = 1; }`),
+		}).
+		Logger(io.Discard))
+
+	body, err := s.ExecHTTP(context.Background(),
+		"SELECT toUInt64(42) AS id FORMAT Protobuf SETTINGS format_schema = 'message:Msg'")
+	require.NoError(t, err)
+	// One length-delimited message: field 1, varint 42.
+	assert.Equal(t, "\x02\x08\x2a", body)
+}
+
+func TestIntegration_LowMemory(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).LowMemory().Logger(io.Discard))
+
+	ctx := context.Background()
+
+	limit, err := s.ScalarInt(ctx, "SELECT toInt64(value) FROM system.server_settings WHERE name = 'max_server_memory_usage'")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<30), limit)
+
+	// MergeTree must stay usable with the reduced background pools.
+	_, err = s.ExecHTTP(ctx, "CREATE TABLE low_memory (id UInt64) ENGINE = MergeTree ORDER BY id")
+	require.NoError(t, err)
+
+	_, err = s.ExecHTTP(ctx, "INSERT INTO low_memory SELECT number FROM numbers(1000)")
+	require.NoError(t, err)
+
+	n, err := s.ScalarInt(ctx, "SELECT count() FROM low_memory")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), n)
+}
+
+func TestEmbeddedClickHouse_BinaryPathAndVersionBeforeStart(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer()
+	assert.Empty(t, s.BinaryPath())
+	assert.Empty(t, s.Version())
+}
+
+func TestIntegration_BinaryPathAndVersion(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	assert.FileExists(t, s.BinaryPath())
+	assert.Equal(t, V25_3, s.Version())
+
+	v, err := s.ScalarHTTP(context.Background(), "SELECT version()")
+	require.NoError(t, err)
+	assert.Equal(t, numericVersion(V25_3), v)
+}
+
+func TestIntegration_GRPCPort(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard).GRPCPort(0))
+
+	addr := s.GRPCAddr()
+	require.NotEmpty(t, addr)
+	assert.NotEqual(t, s.TCPAddr(), addr)
+	assert.NotEqual(t, s.HTTPAddr(), addr)
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestEmbeddedClickHouse_GRPCAddrWithoutGRPC(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, NewServer().GRPCAddr())
+}
+
+func TestMakeTempDir(t *testing.T) {
+	t.Parallel()
+
+	// The root is created when missing.
+	root := filepath.Join(t.TempDir(), "a", "b")
+
+	dir, err := makeTempDir(DefaultConfig().TempDirRoot(root), "embedded-clickhouse-*")
+	require.NoError(t, err)
+	assert.Equal(t, root, filepath.Dir(dir))
+	assert.DirExists(t, dir)
+
+	dir, err = makeTempDir(DefaultConfig(), "embedded-clickhouse-*")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	assert.Equal(t, filepath.Clean(os.TempDir()), filepath.Dir(dir))
+}
+
+func TestMakeTempDir_Ephemeral(t *testing.T) {
+	t.Parallel()
+
+	// An explicit TempDirRoot wins over the memory-backed directory.
+	root := t.TempDir()
+
+	dir, err := makeTempDir(DefaultConfig().Ephemeral(true).TempDirRoot(root), "embedded-clickhouse-*")
+	require.NoError(t, err)
+	assert.Equal(t, root, filepath.Dir(dir))
+
+	dir, err = makeTempDir(DefaultConfig().Ephemeral(true), "embedded-clickhouse-*")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	assert.Equal(t, filepath.Clean(cmp.Or(memoryTempRoot(), os.TempDir())), filepath.Dir(dir))
+}
+
+func TestStart_CgroupWithShared(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().Cgroup(1<<30, 0).Shared("suite")
+
+	require.ErrorIs(t, NewServer(cfg).Start(), ErrCgroupWithShared)
+	require.ErrorIs(t, NewCluster(2, cfg).Start(), ErrCgroupWithShared)
+}
+
+func TestStart_EphemeralWithDataPath(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(DefaultConfig().Ephemeral(true).DataPath(t.TempDir()))
+	require.ErrorIs(t, s.Start(), ErrEphemeralWithDataPath)
+
+	cl := NewCluster(2, DefaultConfig().Ephemeral(true).DataPath(t.TempDir()))
+	require.ErrorIs(t, cl.Start(), ErrEphemeralWithDataPath)
+}
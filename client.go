@@ -0,0 +1,61 @@
+package embeddedclickhouse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ClientExec runs `clickhouse client --multiquery` against the server with stdin
+// connected, using the same binary as the server. It is the CLI route for loading
+// large SQL dumps and fixture scripts. Client output goes to the configured Logger.
+// If the client exits non-zero the returned error wraps ErrQueryFailed and carries
+// the client's stderr (the ClickHouse exception text).
+func (e *EmbeddedClickHouse) ClientExec(ctx context.Context, stdin io.Reader) error {
+	e.mu.RLock()
+	started, binPath, tcpPort, logger := e.started, e.binPath, e.tcpPort, e.config.logger
+	e.mu.RUnlock()
+
+	if !started {
+		return ErrServerNotStarted
+	}
+
+	if logger == nil {
+		logger = os.Stdout
+	}
+
+	return runClient(ctx, binPath, tcpPort, stdin, logger)
+}
+
+// runClient invokes the clickhouse client subcommand of binPath against tcpPort.
+func runClient(ctx context.Context, binPath string, tcpPort uint32, stdin io.Reader, stdout io.Writer) error {
+	cmd := exec.CommandContext(ctx, binPath, "client",
+		"--host", "127.0.0.1",
+		"--port", strconv.FormatUint(uint64(tcpPort), 10),
+		"--multiquery",
+	)
+
+	var stderr bytes.Buffer
+
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return fmt.Errorf("%w: clickhouse client: %w: %s", ErrQueryFailed, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return fmt.Errorf("embedded-clickhouse: run clickhouse client: %w", errors.Join(err, ctx.Err()))
+}
@@ -0,0 +1,97 @@
+package embeddedclickhouse
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunClient_PassesArgsAndStdin(t *testing.T) {
+	t.Parallel()
+
+	out := filepath.Join(t.TempDir(), "out")
+	fake := writeFakeScript(t, `echo "$@" > `+out+`.args
+cat > `+out+`.stdin
+echo done
+`)
+
+	var stdout bytes.Buffer
+
+	err := runClient(context.Background(), fake, 19000, strings.NewReader("CREATE TABLE t (id UInt8) ENGINE = Memory;\nINSERT INTO t VALUES (1);\n"), &stdout)
+	require.NoError(t, err)
+
+	args, err := os.ReadFile(out + ".args")
+	require.NoError(t, err)
+	assert.Equal(t, "client --host 127.0.0.1 --port 19000 --multiquery\n", string(args))
+
+	stdin, err := os.ReadFile(out + ".stdin")
+	require.NoError(t, err)
+	assert.Contains(t, string(stdin), "INSERT INTO t VALUES (1);")
+
+	assert.Equal(t, "done\n", stdout.String())
+}
+
+func TestRunClient_FailureCarriesStderr(t *testing.T) {
+	t.Parallel()
+
+	fake := writeFakeScript(t, "echo 'Code: 62. DB::Exception: Syntax error' >&2\nexit 62\n")
+
+	err := runClient(context.Background(), fake, 19000, strings.NewReader("SELEC 1"), io.Discard)
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "Syntax error")
+}
+
+func TestRunClient_ContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	fake := writeFakeScript(t, "exec sleep 30\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := runClient(ctx, fake, 19000, strings.NewReader(""), io.Discard)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrQueryFailed)
+}
+
+func TestClientExec_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	err := NewServer().ClientExec(context.Background(), strings.NewReader("SELECT 1"))
+	require.ErrorIs(t, err, ErrServerNotStarted)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_ClientExec(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	ctx := context.Background()
+
+	dump := `CREATE TABLE dump (id UInt64, name String) ENGINE = MergeTree ORDER BY id;
+INSERT INTO dump VALUES (1, 'a'), (2, 'b;c');
+INSERT INTO dump VALUES (3, 'd');
+`
+	require.NoError(t, s.ClientExec(ctx, strings.NewReader(dump)))
+
+	body, err := s.ExecHTTP(ctx, "SELECT count() FROM dump")
+	require.NoError(t, err)
+	assert.Equal(t, "3\n", body)
+
+	err = s.ClientExec(ctx, strings.NewReader("SELECT * FROM no_such_table;"))
+	require.ErrorIs(t, err, ErrQueryFailed)
+}
@@ -0,0 +1,20 @@
+//go:build darwin
+
+package embeddedclickhouse
+
+import (
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile creates dst as a copy-on-write clone of src via clonefile(2), which APFS
+// supports. It fails on other filesystems so the caller can fall back to a byte copy.
+func reflinkFile(src, dst string, perm fs.FileMode) error {
+	if err := unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW); err != nil {
+		return err //nolint:wrapcheck // caller falls back to copyFile
+	}
+
+	return os.Chmod(dst, perm) //nolint:wrapcheck // wrapped by copyDir
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package embeddedclickhouse
+
+import (
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile creates dst as a copy-on-write clone of src via the FICLONE ioctl, which
+// btrfs and XFS (with reflink=1) support. It fails, leaving no dst behind, on filesystems
+// without reflink support so the caller can fall back to a byte copy.
+func reflinkFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by copyDir
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by copyDir
+	}
+
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		os.Remove(dst)
+
+		return err //nolint:wrapcheck // caller falls back to copyFile
+	}
+
+	return out.Close() //nolint:wrapcheck // wrapped by copyDir
+}
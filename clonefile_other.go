@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package embeddedclickhouse
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// errReflinkUnsupported makes cloneFile fall back to a byte copy on this platform.
+var errReflinkUnsupported = errors.New("embedded-clickhouse: reflink not supported on this platform")
+
+// reflinkFile is unsupported on this platform and always fails.
+func reflinkFile(_, _ string, _ fs.FileMode) error {
+	return errReflinkUnsupported
+}
@@ -1,17 +1,23 @@
 package embeddedclickhouse
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
 )
 
 const (
@@ -35,22 +41,84 @@ var ErrKeeperNotReady = errors.New("embedded-clickhouse: keeper quorum not ready
 // ErrNodeOutOfRange is returned when Node() is called with an index outside [0, replicas).
 var ErrNodeOutOfRange = errors.New("embedded-clickhouse: node index out of range")
 
-// ErrClusterUnsupportedOption is returned by Cluster.Start when the config sets a data
-// path or explicit port; in cluster mode these are auto-managed and cannot be honored.
+// ErrInvalidReplicaName is returned by Cluster.Start when the ReplicaNamer yields an empty or duplicate name.
+var ErrInvalidReplicaName = errors.New("embedded-clickhouse: invalid replica name")
+
+// ErrInvalidKeeperTimeout is returned by Cluster.Start when KeeperSessionTimeout or
+// KeeperOperationTimeout is out of range, or the operation timeout exceeds the session timeout.
+var ErrInvalidKeeperTimeout = errors.New("embedded-clickhouse: invalid keeper timeout")
+
+// ErrClusterUnsupportedOption is returned by Cluster.Start when the config sets a
+// template data path or explicit port; in cluster mode these are auto-managed and
+// cannot be honored.
 var ErrClusterUnsupportedOption = errors.New(
-	"embedded-clickhouse: ports and data path are auto-managed in cluster mode",
+	"embedded-clickhouse: ports and template data path are auto-managed in cluster mode",
+)
+
+// Phases of a cluster node's bring-up, as reported by ClusterStartError.
+const (
+	// ClusterPhaseConfig covers creating the node's directory and writing its config.
+	ClusterPhaseConfig = "config"
+	// ClusterPhaseProcess covers launching the node's ClickHouse process.
+	ClusterPhaseProcess = "process"
+	// ClusterPhaseReady covers waiting for the node's /ping and native port.
+	ClusterPhaseReady = "ready"
+	// ClusterPhaseKeeper covers waiting for the node to join the Keeper ensemble.
+	ClusterPhaseKeeper = "keeper"
+	// ClusterPhaseAccess covers applying AccessEntities on the node.
+	ClusterPhaseAccess = "access"
 )
 
+// ClusterStartError is returned by Cluster.Start when a node fails to come up. It names
+// the node and the phase that failed, so callers can branch with errors.As; sentinels
+// such as ErrServerExited or ErrKeeperNotReady remain reachable through Unwrap. When
+// several nodes fail, one is reported: the lowest-indexed at launch, the first to fail
+// while waiting for readiness, and the lowest-indexed of the nodes still pending (all
+// of which Err lists) for Keeper. Creating the KeeperRoot, which any node's Keeper can
+// do, tries every node in turn; if none succeeds, the last one tried is reported.
+type ClusterStartError struct {
+	// Node is the 0-based index of the failing node.
+	Node int
+	// Phase is one of the ClusterPhase constants.
+	Phase string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *ClusterStartError) Error() string {
+	return fmt.Sprintf("embedded-clickhouse: node %d (%s): %v", e.Node, e.Phase, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ClusterStartError) Unwrap() error {
+	return e.Err
+}
+
 // Cluster manages a multi-replica ClickHouse cluster using embedded Keeper for coordination.
 // All replicas run on localhost with auto-allocated ports. The cluster presents a single
 // shard with N replicas, suitable for testing ReplicatedMergeTree tables with ON CLUSTER queries.
+//
+// Nodes use temp directories removed by Stop unless DataPath is set: each node then lives
+// in DataPath/node-<i>, and the allocated ports are recorded in the base directory so a
+// later Start with the same replica count reattaches to the Keeper logs and replicated data.
 type Cluster struct {
 	config   Config
 	replicas int
 
 	mu      sync.RWMutex
 	started bool
+	shared  bool // attached to a Shared instance, see Config.Shared
 	nodes   []*EmbeddedClickHouse
+	binPath string // resolved once per Start and run by every node
+	// runtimeProfile holds the settings SetProfileSetting applied since Start.
+	runtimeProfile map[string]string
+	// claimedPorts are the freshly allocated ports Stop releases, see portClaims.
+	claimedPorts []uint32
+
+	// dbMu guards dbs, the pools opened by NodeDB, indexed by node. It is taken after mu.
+	dbMu sync.Mutex
+	dbs  []*sql.DB
 }
 
 // NewCluster creates a new Cluster with the given number of replicas.
@@ -74,27 +142,48 @@ func NewCluster(replicas int, config ...Config) *Cluster {
 }
 
 // NewClusterForTest creates a cluster, starts it, and registers tb.Cleanup(cluster.Stop).
-// Calls tb.Fatal on Start() error.
+// Like NewServerForTest, it resolves the binary through the Prepare memo. To run a binary
+// resolved elsewhere, such as another cluster's BinaryPath() passed between processes,
+// set it with Config.BinaryPath: resolution then only checks that the file exists.
+// Calls tb.Fatal on Start() error; a failed Start leaves no processes or temp dirs behind.
 func NewClusterForTest(tb testing.TB, replicas int, config ...Config) *Cluster {
 	tb.Helper()
 
 	cl := NewCluster(replicas, config...)
 
-	if err := cl.Start(); err != nil {
+	binPath, downloaded, err := prepareBinary(cl.config)
+	if err != nil {
 		tb.Fatal(err)
 	}
 
+	cl.config.resolvedBinaryPath = binPath
+	cl.config.resolvedDownloaded = downloaded
+
+	// The cleanup is registered before Start, so it is in place however Start returns.
+	// After a failed Start there is nothing left to stop: Start itself stops the nodes it
+	// launched and removes their temp dirs before returning the error.
+	var startErr error
+
 	tb.Cleanup(func() {
-		if err := cl.Stop(); err != nil {
+		err := cl.Stop()
+		if startErr != nil && errors.Is(err, ErrClusterNotStarted) {
+			return
+		}
+
+		if err != nil {
 			tb.Errorf("embedded-clickhouse: cluster stop failed: %v", err)
 		}
 	})
 
+	if startErr = cl.Start(); startErr != nil {
+		tb.Fatal(startErr)
+	}
+
 	return cl
 }
 
 // Start launches all cluster nodes and waits for Keeper quorum.
-func (c *Cluster) Start() error { //nolint:funlen,cyclop // multi-phase orchestrator with config-guard branches
+func (c *Cluster) Start() error { //nolint:cyclop // config-guard branches
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -106,14 +195,84 @@ func (c *Cluster) Start() error { //nolint:funlen,cyclop // multi-phase orchestr
 		return fmt.Errorf("%w: got %d", ErrInvalidReplicaCount, c.replicas)
 	}
 
-	// Cluster mode auto-allocates all ports and uses temp data dirs per node. The
-	// single-node DataPath/TCPPort/HTTPPort options cannot be honored here (a node
-	// needs five ports, and Stop assumes ephemeral temp dirs), so reject them rather
-	// than silently ignore them.
-	if c.config.dataPath != "" || c.config.tcpPort != 0 || c.config.httpPort != 0 {
+	// Cluster mode auto-allocates all ports and lays out one data dir per node. The
+	// single-node TemplateDataPath/TCPPort/HTTPPort/GRPCPort options cannot be honored
+	// here (a node needs five ports, and templates hold a single node's data), so reject
+	// them rather than silently ignore them.
+	if c.config.templateDataPath != "" || c.config.tcpPort != 0 || c.config.httpPort != 0 || c.config.grpc {
 		return ErrClusterUnsupportedOption
 	}
 
+	if c.config.ephemeral && c.config.dataPath != "" {
+		return ErrEphemeralWithDataPath
+	}
+
+	if c.config.cgroup.isSet() && c.config.sharedName != "" {
+		return ErrCgroupWithShared
+	}
+
+	if c.config.noAccessManagement && len(c.config.accessEntities) > 0 {
+		return ErrAccessManagementDisabled
+	}
+
+	if err := validateReplicaNames(replicaNamesFor(c.config, c.replicas)); err != nil {
+		return err
+	}
+
+	if err := validateKeeperTimeouts(c.config); err != nil {
+		return err
+	}
+
+	if err := validateKeeperRoot(c.config.keeperRoot); err != nil {
+		return err
+	}
+
+	if err := c.config.portRange.validate(); err != nil {
+		return err
+	}
+
+	if err := c.config.cgroup.validate(); err != nil {
+		return err
+	}
+
+	if err := validateExtraArgs(c.config.extraArgs); err != nil {
+		return err
+	}
+
+	if err := validateUsersConfig(c.config.usersConfig); err != nil {
+		return err
+	}
+
+	began := time.Now()
+
+	ctx, span := c.config.rootSpan(context.Background(), "embedded-clickhouse.Cluster.Start", attrVersion.String(string(c.config.version)))
+	ctx = withTiming(ctx, c.config.onTiming)
+
+	var err error
+	if c.config.sharedName != "" {
+		err = c.startShared(ctx)
+	} else {
+		err = c.startLocked(ctx)
+	}
+
+	if err == nil {
+		took := time.Since(began)
+
+		for _, node := range c.nodes {
+			node.mu.Lock()
+			node.startDuration = took
+			node.mu.Unlock()
+		}
+	}
+
+	endSpan(span, err)
+
+	return err
+}
+
+// startLocked resolves the binary, allocates ports, launches every node, and waits for
+// the cluster to be ready. Caller must hold c.mu.
+func (c *Cluster) startLocked(ctx context.Context) error { //nolint:funlen // multi-phase orchestrator
 	cleanups := make([]func(), 0)
 	cleanup := func() {
 		for _, fn := range slices.Backward(cleanups) {
@@ -130,83 +289,118 @@ func (c *Cluster) Start() error { //nolint:funlen,cyclop // multi-phase orchestr
 	}()
 
 	// Resolve binary once (shared across all nodes).
-	binPath, err := ensureBinary(c.config)
+	binPath, downloaded, err := ensureBinary(ctx, c.config)
 	if err != nil {
 		return err
 	}
 
-	// Allocate all ports upfront.
-	ports := make([]clusterNodePorts, c.replicas)
+	c.binPath = binPath
+	downloaded = downloaded || c.config.resolvedDownloaded
 
-	for i := range c.replicas {
-		np, allocErr := allocateClusterNodePorts()
-		if allocErr != nil {
-			return allocErr
-		}
+	version := binaryVersion(ctx, c.config, binPath)
 
-		ports[i] = np
+	// Allocate all ports upfront, or reuse those of a persistent cluster.
+	ports, releasePorts, err := c.allocatePorts()
+	if err != nil {
+		return err
 	}
 
-	// Build shared topology.
-	topo := buildClusterTopology(ports, c.config.settings)
+	cleanups = append(cleanups, c.releaseClaimedPorts)
 
-	// Start each node.
-	nodes := make([]*EmbeddedClickHouse, c.replicas)
+	// Build shared topology.
+	topo := buildClusterTopology(ports, c.config)
 
 	logger := c.config.logger
 	if logger == nil {
 		logger = os.Stdout
 	}
 
-	for i := range c.replicas {
-		tmpDir, mkErr := os.MkdirTemp("", fmt.Sprintf("embedded-clickhouse-cluster-%d-*", i))
-		if mkErr != nil {
-			return fmt.Errorf("embedded-clickhouse: create temp dir for node %d: %w", i, mkErr)
-		}
+	// Free the reserved ports only now, so nothing else can take them in the meantime.
+	releasePorts()
 
-		cleanups = append(cleanups, func() { os.RemoveAll(tmpDir) })
+	// Launch every node concurrently. Cleanups are registered in node order once all
+	// launches return, so the reverse-order teardown on failure matches a sequential start.
+	launchDone := timePhase(ctx, "launch")
+	nodes, launchErr := launchClusterNodes(ctx, c.config, binPath, topo, logger)
 
-		configPath, cfgErr := writeClusterNodeConfig(tmpDir, i, topo)
-		if cfgErr != nil {
-			return cfgErr
+	launchDone()
+
+	for _, node := range nodes {
+		if node == nil {
+			continue
 		}
 
-		proc, startErr := startProcess(binPath, configPath, logger)
-		if startErr != nil {
-			return fmt.Errorf("embedded-clickhouse: start node %d: %w", i, startErr)
+		node.version = version
+		node.downloaded = downloaded
+
+		if c.config.dataPath == "" {
+			cleanups = append(cleanups, func() { os.RemoveAll(node.tmpDir) })
 		}
 
 		cleanups = append(cleanups, func() {
-			stopProcess(proc, c.config.stopTimeout) //nolint:errcheck
+			stopProcess(node.proc, c.config.stopTimeout) //nolint:errcheck
 		})
+	}
+
+	if launchErr != nil {
+		return launchErr
+	}
 
-		nodes[i] = &EmbeddedClickHouse{
-			config:          c.config,
-			started:         true,
-			proc:            proc,
-			tmpDir:          tmpDir,
-			tcpPort:         ports[i].TCP,
-			httpPort:        ports[i].HTTP,
-			interserverPort: ports[i].Interserver,
-			keeperPort:      ports[i].Keeper,
-			keeperRaftPort:  ports[i].KeeperRaft,
-			clusterManaged:  true,
+	for i, node := range nodes {
+		err := writeMetadata(c.config, node.tmpDir, node.proc, node.tcpPort, node.httpPort, version, c.ClusterName())
+		if err != nil {
+			return &ClusterStartError{Node: i, Phase: ClusterPhaseProcess, Err: err}
 		}
 	}
 
 	// Wait for all nodes to respond to /ping.
-	ctx, cancel := context.WithTimeout(context.Background(), c.config.startTimeout)
+	ctx, cancel := context.WithTimeout(ctx, c.config.startTimeout)
 	defer cancel()
 
-	if err := waitForAllNodesReady(ctx, nodes); err != nil {
+	readyCtx, span := startSpan(ctx, "embedded-clickhouse.waitForReady")
+	readyDone := timePhase(ctx, "wait-ready")
+
+	err = waitForAllNodesReady(readyCtx, nodes, c.config.clusterEvents)
+
+	readyDone()
+	endSpan(span, err)
+
+	if err != nil {
 		return err
 	}
 
 	// Wait for Keeper quorum.
-	if err := waitForKeeperQuorum(ctx, nodes[0].httpPort); err != nil {
+	quorumDone := timePhase(ctx, "keeper-quorum")
+
+	if c.config.keeperRoot != "" {
+		if err := ensureKeeperRoot(
+			ctx, nodeKeeperPorts(nodes), c.config.keeperRoot, c.config.healthPollBackoff,
+		); err != nil {
+			quorumDone()
+
+			// Every node was tried; the error is the last one's.
+			return &ClusterStartError{Node: len(nodes) - 1, Phase: ClusterPhaseKeeper, Err: err}
+		}
+	}
+
+	probe := cmp.Or(c.config.keeperReadinessQuery, defaultKeeperReadinessQuery)
+	err = waitForKeeperQuorum(
+		ctx, nodeHTTPPorts(nodes), probe, c.config.healthPollBackoff, c.config.clusterEvents,
+	)
+
+	quorumDone()
+
+	if err != nil {
 		return err
 	}
 
+	// Access entities live in each node's local access storage, so provision every node.
+	for i, node := range nodes {
+		if err := applyAccessEntities(ctx, node.httpPort, c.config.accessEntities); err != nil {
+			return &ClusterStartError{Node: i, Phase: ClusterPhaseAccess, Err: err}
+		}
+	}
+
 	c.nodes = nodes
 	c.started = true
 	success = true
@@ -220,23 +414,49 @@ func (c *Cluster) Stop() error {
 	defer c.mu.Unlock()
 
 	if !c.started {
+		if c.config.idempotentStop {
+			return nil
+		}
+
 		return ErrClusterNotStarted
 	}
 
+	if c.shared {
+		return c.stopShared()
+	}
+
+	return c.stopLocked()
+}
+
+// stopLocked stops every node this process started and removes their temp dirs.
+// Caller must hold c.mu.
+func (c *Cluster) stopLocked() error {
 	var errs []error
 
+	if err := c.closeNodeDBs(); err != nil {
+		errs = append(errs, err)
+	}
+
 	// Stop in reverse order.
 	for i, node := range slices.Backward(c.nodes) {
 		node.mu.Lock()
 
+		if err := beforeStop(node.httpPort, c.config); err != nil {
+			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+		}
+
 		if err := stopProcess(node.proc, c.config.stopTimeout); err != nil {
 			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
 		}
 
-		if node.tmpDir != "" {
+		if c.config.dataPath == "" && node.tmpDir != "" {
 			if err := os.RemoveAll(node.tmpDir); err != nil {
 				errs = append(errs, fmt.Errorf("node %d: remove temp dir: %w", i, err))
 			}
+		} else if c.runtimeProfile != nil {
+			if err := removeRuntimeProfile(node.tmpDir, c.config); err != nil {
+				errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+			}
 		}
 
 		node.started = false
@@ -246,10 +466,23 @@ func (c *Cluster) Stop() error {
 
 	c.started = false
 	c.nodes = nil
+	c.runtimeProfile = nil
+	c.releaseClaimedPorts()
 
 	return errors.Join(errs...)
 }
 
+// Close implements io.Closer: it calls Stop but returns nil instead of
+// ErrClusterNotStarted when the cluster is not running, so it is idempotent and safe in
+// a deferred cleanup loop.
+func (c *Cluster) Close() error {
+	if err := c.Stop(); !errors.Is(err, ErrClusterNotStarted) {
+		return err
+	}
+
+	return nil
+}
+
 // Node returns the i-th node (0-indexed). Panics if the cluster is not started or index is out of range.
 func (c *Cluster) Node(index int) *EmbeddedClickHouse {
 	c.mu.RLock()
@@ -279,43 +512,321 @@ func (c *Cluster) DSN() string {
 	return c.Node(0).DSN()
 }
 
+// ClusterDSNs returns the DSN of every node, in node order. Returns nil if the cluster is
+// not started.
+func (c *Cluster) ClusterDSNs() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.started {
+		return nil
+	}
+
+	dsns := make([]string, len(c.nodes))
+	for i, node := range c.nodes {
+		dsns[i] = node.DSN()
+	}
+
+	return dsns
+}
+
+// LoadBalancedDSN returns a clickhouse-go DSN listing every node's native address, e.g.
+// "clickhouse://127.0.0.1:p1,127.0.0.1:p2/default?connection_open_strategy=round_robin",
+// so each new connection goes to the next node. Panics if the cluster is not started.
+func (c *Cluster) LoadBalancedDSN() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.started {
+		panic(ErrClusterNotStarted)
+	}
+
+	addrs := make([]string, len(c.nodes))
+	for i, node := range c.nodes {
+		addrs[i] = node.TCPAddr()
+	}
+
+	return "clickhouse://" + strings.Join(addrs, ",") + "/default?connection_open_strategy=round_robin"
+}
+
+// NodeDB returns a database/sql pool connected to node index over the native protocol.
+// The pool is opened on first use and cached, so every call for the same node returns
+// the same *sql.DB; like any *sql.DB it is safe for concurrent use, and NodeDB itself may
+// be called from parallel tests. Stop closes the pools, so callers must not close them.
+func (c *Cluster) NodeDB(index int) (*sql.DB, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.started {
+		return nil, ErrClusterNotStarted
+	}
+
+	if index < 0 || index >= len(c.nodes) {
+		return nil, fmt.Errorf("%w: %d (replicas: %d)", ErrNodeOutOfRange, index, len(c.nodes))
+	}
+
+	c.dbMu.Lock()
+	defer c.dbMu.Unlock()
+
+	if c.dbs == nil {
+		c.dbs = make([]*sql.DB, len(c.nodes))
+	}
+
+	if c.dbs[index] == nil {
+		opts, err := clickhouse.ParseDSN(c.nodes[index].DSN())
+		if err != nil {
+			return nil, fmt.Errorf("embedded-clickhouse: node %d DSN: %w", index, err)
+		}
+
+		c.dbs[index] = clickhouse.OpenDB(opts)
+	}
+
+	return c.dbs[index], nil
+}
+
+// closeNodeDBs closes the pools opened by NodeDB. Caller must hold c.mu.
+func (c *Cluster) closeNodeDBs() error {
+	c.dbMu.Lock()
+	defer c.dbMu.Unlock()
+
+	var errs []error
+
+	for i, db := range c.dbs {
+		if db == nil {
+			continue
+		}
+
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("node %d: close NodeDB pool: %w", i, err))
+		}
+	}
+
+	c.dbs = nil
+
+	return errors.Join(errs...)
+}
+
+// BinaryPath returns the path of the ClickHouse binary the last Start resolved and ran on
+// every node; for a cluster attached through Shared, the one its first user started. It
+// is set once resolution succeeds, even if the nodes then fail to come up, and is empty
+// before the first Start. Pass it to Config.BinaryPath to run the same build elsewhere.
+func (c *Cluster) BinaryPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.binPath
+}
+
 // ClusterName returns the cluster name used in ON CLUSTER queries.
 func (c *Cluster) ClusterName() string {
 	return "test_cluster"
 }
 
+// allocatePorts returns the ports of every node: freshly reserved, or, with DataPath,
+// the ones recorded by a previous Start, which must still be free (see claimPorts).
+// Fresh ports stay bound until the returned release func is called, which must happen
+// right before the nodes are launched. Either way the ports stay claimed (see portClaims)
+// until releaseClaimedPorts.
+func (c *Cluster) allocatePorts() ([]ClusterNodePorts, func(), error) {
+	release := func() {}
+	alloc := func() ([]ClusterNodePorts, error) {
+		ports, rel, err := reserveClusterPorts(c.replicas, c.config.portRange)
+		if err != nil {
+			return nil, err
+		}
+
+		release = rel
+		c.claimedPorts = append(c.claimedPorts, flattenClusterPorts(ports)...)
+
+		return ports, nil
+	}
+
+	reuse := func(ports []ClusterNodePorts) error {
+		flat := flattenClusterPorts(ports)
+		if err := claimPorts(flat); err != nil {
+			return err
+		}
+
+		c.claimedPorts = append(c.claimedPorts, flat...)
+
+		return nil
+	}
+
+	var (
+		ports []ClusterNodePorts
+		err   error
+	)
+
+	if c.config.dataPath == "" {
+		ports, err = alloc()
+	} else {
+		ports, err = persistentClusterPorts(c.config.dataPath, c.replicas, alloc, reuse)
+	}
+
+	if err != nil {
+		release()
+		c.releaseClaimedPorts()
+
+		return nil, nil, err
+	}
+
+	return ports, release, nil
+}
+
+// releaseClaimedPorts releases the ports claimed by allocatePorts. Caller must hold c.mu.
+func (c *Cluster) releaseClaimedPorts() {
+	claimedPorts.release(c.claimedPorts...)
+	c.claimedPorts = nil
+}
+
 // portsPerClusterNode is the number of distinct ports each cluster node needs:
 // TCP, HTTP, interserver, Keeper, and Keeper Raft.
 const portsPerClusterNode = 5
 
-// allocateClusterNodePorts allocates the distinct ports needed for a single
-// cluster node. The ports must not collide with one another, so they are
-// allocated as a batch with allocatePorts (which holds all listeners open at
-// once); allocating them via separate allocatePort calls could hand back the
-// same just-freed ephemeral port twice.
-func allocateClusterNodePorts() (clusterNodePorts, error) {
-	ports, err := allocatePorts(portsPerClusterNode)
+// flattenClusterPorts returns every port of ports, node by node.
+func flattenClusterPorts(ports []ClusterNodePorts) []uint32 {
+	flat := make([]uint32, 0, len(ports)*portsPerClusterNode)
+	for _, p := range ports {
+		flat = append(flat, p.TCP, p.HTTP, p.Interserver, p.Keeper, p.KeeperRaft)
+	}
+
+	return flat
+}
+
+// reserveClusterPorts reserves the distinct ports of every node of a cluster of replicas
+// as one batch with reservePorts, so no port repeats within a node or across nodes. The
+// ports stay bound until release is called, right before the nodes are launched.
+func reserveClusterPorts(replicas int, r portRange) ([]ClusterNodePorts, func(), error) {
+	flat, release, err := reservePorts(replicas*portsPerClusterNode, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ports := make([]ClusterNodePorts, replicas)
+	for i := range ports {
+		p := flat[i*portsPerClusterNode:]
+		ports[i] = ClusterNodePorts{TCP: p[0], HTTP: p[1], Interserver: p[2], Keeper: p[3], KeeperRaft: p[4]}
+	}
+
+	return ports, release, nil
+}
+
+// launchClusterNodes creates each node's temp dir, writes its config, and starts its
+// process, all nodes in parallel. The returned slice is indexed by node; an entry is
+// nil if that node failed to launch, and every non-nil entry owns a running process
+// and temp dir the caller must clean up. When several nodes fail, the error of the
+// lowest-indexed node is returned so failures are reported deterministically.
+func launchClusterNodes(
+	ctx context.Context, cfg Config, binPath string, topo clusterTopology, logger io.Writer,
+) ([]*EmbeddedClickHouse, error) {
+	nodes := make([]*EmbeddedClickHouse, len(topo.Nodes))
+	errs := make([]error, len(topo.Nodes))
+
+	var wg sync.WaitGroup
+
+	for i := range topo.Nodes {
+		wg.Go(func() {
+			nodes[i], errs[i] = launchClusterNode(ctx, cfg, binPath, i, topo, logger)
+		})
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nodes, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// launchClusterNode prepares and starts a single cluster node. On failure it removes
+// the temp dir it created, so a nil node never leaves anything behind; a persistent
+// node dir under DataPath is kept.
+func launchClusterNode(
+	ctx context.Context, cfg Config, binPath string, i int, topo clusterTopology, logger io.Writer,
+) (*EmbeddedClickHouse, error) {
+	tmpDir, removeDir, err := clusterNodeWorkDir(cfg, i)
 	if err != nil {
-		return clusterNodePorts{}, err
+		return nil, &ClusterStartError{Node: i, Phase: ClusterPhaseConfig, Err: err}
 	}
 
-	return clusterNodePorts{
-		TCP:         ports[0],
-		HTTP:        ports[1],
-		Interserver: ports[2],
-		Keeper:      ports[3],
-		KeeperRaft:  ports[4],
+	configDone := timePhase(ctx, fmt.Sprintf("node-%d/config", i))
+	configPath, err := writeClusterNodeConfig(tmpDir, i, topo)
+
+	configDone()
+
+	if err != nil {
+		removeDir()
+		return nil, &ClusterStartError{Node: i, Phase: ClusterPhaseConfig, Err: err}
+	}
+
+	ports := topo.Nodes[i]
+
+	_, span := startSpan(ctx, "embedded-clickhouse.startProcess",
+		append(portAttrs(ports.TCP, ports.HTTP), attrNode.Int(i))...)
+
+	output := outputBufferFor(cfg)
+
+	startDone := timePhase(ctx, fmt.Sprintf("node-%d/process-start", i))
+	proc, err := startProcess(binPath, configPath, cfg.extraArgs, cfg.cgroup, logger, output)
+
+	startDone()
+	endSpan(span, err)
+
+	if err != nil {
+		removeDir()
+		return nil, &ClusterStartError{Node: i, Phase: ClusterPhaseProcess, Err: err}
+	}
+
+	emitClusterEvent(cfg.clusterEvents, ClusterNodeStarted, i)
+
+	return &EmbeddedClickHouse{
+		config:          cfg,
+		started:         true,
+		proc:            proc,
+		output:          output,
+		tmpDir:          tmpDir,
+		binPath:         binPath,
+		tcpPort:         ports.TCP,
+		httpPort:        ports.HTTP,
+		interserverPort: ports.Interserver,
+		keeperPort:      ports.Keeper,
+		keeperRaftPort:  ports.KeeperRaft,
+		clusterManaged:  true,
 	}, nil
 }
 
-// waitForAllNodesReady waits for every node's /ping endpoint to respond, in parallel.
+// clusterNodeWorkDir returns node i's working directory and a func that removes it on a
+// failed launch: DataPath/node-<i> (kept) when DataPath is set, else a fresh temp dir.
+func clusterNodeWorkDir(cfg Config, i int) (string, func(), error) {
+	if cfg.dataPath != "" {
+		dir := clusterNodeDir(cfg.dataPath, i)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", nil, fmt.Errorf("embedded-clickhouse: create data dir for node %d: %w", i, err)
+		}
+
+		return dir, func() {}, nil
+	}
+
+	dir, err := makeTempDir(cfg, fmt.Sprintf("embedded-clickhouse-cluster-%d-*", i))
+	if err != nil {
+		return "", nil, fmt.Errorf("embedded-clickhouse: create temp dir for node %d: %w", i, err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
+
+// waitForAllNodesReady waits for every node's /ping endpoint and native port to respond, in parallel.
 // If any node's process exits (or otherwise fails) during startup, the first error
 // cancels the shared context so the remaining nodes stop polling immediately instead
 // of burning the full start timeout. Cancellation is triggered only after a real error
 // is recorded, so the genuine failure (e.g. ErrServerExited) is the first error enqueued
 // and is what gets returned — never a sibling's "context canceled" artifact.
+// Each node that becomes ready is reported on events as ClusterNodeReady.
 // Returns the first error reported by any node, or nil if all are ready.
-func waitForAllNodesReady(ctx context.Context, nodes []*EmbeddedClickHouse) error {
+func waitForAllNodesReady(ctx context.Context, nodes []*EmbeddedClickHouse, events chan<- ClusterEvent) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -325,15 +836,24 @@ func waitForAllNodesReady(ctx context.Context, nodes []*EmbeddedClickHouse) erro
 	for i, node := range nodes {
 		wg.Add(1)
 
-		go func(i int, port uint32, p *process) {
+		go func(i int, node *EmbeddedClickHouse) {
 			defer wg.Done()
 
-			if err := waitForReadyOrExit(ctx, port, p); err != nil {
-				readyErrs <- fmt.Errorf("embedded-clickhouse: node %d not ready: %w", i, err)
+			readyDone := timePhase(ctx, fmt.Sprintf("node-%d/wait-ready", i))
+			err := waitForServerReady(ctx, node.httpPort, node.tcpPort, node.proc, node.config)
+
+			readyDone()
+
+			if err != nil {
+				readyErrs <- &ClusterStartError{Node: i, Phase: ClusterPhaseReady, Err: err}
 
 				cancel() // stop sibling waits as soon as one node fails
+
+				return
 			}
-		}(i, node.httpPort, node.proc)
+
+			emitClusterEvent(events, ClusterNodeReady, i)
+		}(i, node)
 	}
 
 	wg.Wait()
@@ -346,29 +866,76 @@ func waitForAllNodesReady(ctx context.Context, nodes []*EmbeddedClickHouse) erro
 	return nil
 }
 
-// waitForKeeperQuorum polls system.zookeeper via the HTTP interface until it succeeds
-// or the context is cancelled.
-func waitForKeeperQuorum(ctx context.Context, httpPort uint32) error {
-	query := "SELECT 1 FROM system.zookeeper WHERE path = '/' LIMIT 1"
-	checkURL := fmt.Sprintf("http://127.0.0.1:%d/?query=%s", httpPort, url.QueryEscape(query))
+// nodeHTTPPorts returns the HTTP port of every node, in node order.
+func nodeHTTPPorts(nodes []*EmbeddedClickHouse) []uint32 {
+	ports := make([]uint32, len(nodes))
+	for i, node := range nodes {
+		ports[i] = node.httpPort
+	}
+
+	return ports
+}
+
+// nodeKeeperPorts returns the Keeper client ports of nodes.
+func nodeKeeperPorts(nodes []*EmbeddedClickHouse) []uint32 {
+	ports := make([]uint32, len(nodes))
+	for i, node := range nodes {
+		ports[i] = node.keeperPort
+	}
+
+	return ports
+}
+
+// defaultKeeperReadinessQuery succeeds once a node's Keeper client session can read the
+// root znode, i.e. the node has joined a Keeper ensemble with quorum.
+const defaultKeeperReadinessQuery = "SELECT 1 FROM system.zookeeper WHERE path = '/' LIMIT 1"
 
+// waitForKeeperQuorum polls query via the HTTP interface of every node until it succeeds
+// on all of them, or the context is cancelled, backing off up to maxInterval. Nodes that
+// answered are not probed again and are reported on events as ClusterKeeperQuorum.
+func waitForKeeperQuorum(
+	ctx context.Context, httpPorts []uint32, query string, maxInterval time.Duration, events chan<- ClusterEvent,
+) error {
 	client := &http.Client{Timeout: healthRequestTimeout}
 
-	if keeperReady(ctx, client, checkURL) {
+	pending := make(map[int]string, len(httpPorts))
+	for i, port := range httpPorts {
+		pending[i] = fmt.Sprintf("http://127.0.0.1:%d/?query=%s", port, url.QueryEscape(query))
+	}
+
+	poll := func() bool {
+		for i, checkURL := range pending {
+			if keeperReady(ctx, client, checkURL) {
+				delete(pending, i)
+				emitClusterEvent(events, ClusterKeeperQuorum, i)
+			}
+		}
+
+		return len(pending) == 0
+	}
+
+	if poll() {
 		return nil
 	}
 
-	ticker := time.NewTicker(keeperQuorumPollInterval)
-	defer ticker.Stop()
+	p := newPoller(keeperQuorumPollInterval, maxInterval)
+
+	timer := time.NewTimer(p.next())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("%w: %w", ErrKeeperNotReady, ctx.Err())
-		case <-ticker.C:
-			if keeperReady(ctx, client, checkURL) {
+			nodes := slices.Sorted(maps.Keys(pending))
+			err := fmt.Errorf("%w: nodes %v: %w", ErrKeeperNotReady, nodes, ctx.Err())
+
+			return &ClusterStartError{Node: nodes[0], Phase: ClusterPhaseKeeper, Err: err}
+		case <-timer.C:
+			if poll() {
 				return nil
 			}
+
+			timer.Reset(p.next())
 		}
 	}
 }
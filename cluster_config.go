@@ -1,30 +1,68 @@
 package embeddedclickhouse
 
 import (
+	"cmp"
 	"fmt"
 	"maps"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"text/template"
+	"time"
 )
 
+// Keeper coordination timeouts used when the Config does not override them, and the
+// bounds KeeperSessionTimeout/KeeperOperationTimeout are validated against.
+const (
+	defaultKeeperOperationTimeout = 10 * time.Second
+	defaultKeeperSessionTimeout   = 30 * time.Second
+	minKeeperTimeout              = 100 * time.Millisecond
+	maxKeeperTimeout              = 10 * time.Minute
+)
+
+// defaultInterserverHost is the <interserver_http_host> nodes advertise without InterserverHost.
+const defaultInterserverHost = "127.0.0.1"
+
 const clusterConfigTemplate = `<?xml version="1.0"?>
 <clickhouse>
     <logger>
         <level>warning</level>
         <console>1</console>
     </logger>
+{{- if not .Telemetry}}
+    <send_crash_reports>
+        <enabled>false</enabled>
+    </send_crash_reports>
+{{- end}}
 
     <tcp_port>{{.TCPPort}}</tcp_port>
     <http_port>{{.HTTPPort}}</http_port>
     <interserver_http_port>{{.InterserverPort}}</interserver_http_port>
-    <interserver_http_host>127.0.0.1</interserver_http_host>
+    <interserver_http_host>{{xmlEscape .InterserverHost}}</interserver_http_host>
+{{- if .InterserverUser}}
+    <interserver_http_credentials>
+        <user>{{xmlEscape .InterserverUser}}</user>
+        <password>{{xmlEscape .InterserverPassword}}</password>
+    </interserver_http_credentials>
+{{- end}}
 
     <path>{{xmlEscape .DataDir}}/</path>
     <tmp_path>{{xmlEscape .TmpDir}}/</tmp_path>
     <user_files_path>{{xmlEscape .UserFilesDir}}/</user_files_path>
     <format_schema_path>{{xmlEscape .FormatSchemaDir}}/</format_schema_path>
+    <user_scripts_path>{{xmlEscape .UserScriptsDir}}/</user_scripts_path>
+{{- if .UDFConfigPath}}
+    <user_defined_executable_functions_config>{{xmlEscape .UDFConfigPath}}</user_defined_executable_functions_config>
+{{- end}}
+{{- if .DictionariesConfigPath}}
+    <dictionaries_config>{{xmlEscape .DictionariesConfigPath}}</dictionaries_config>
+{{- end}}
+{{- if .UsersConfigPath}}
+
+    <users_config>{{xmlEscape .UsersConfigPath}}</users_config>
+{{- else}}
 
     <users>
         <default>
@@ -35,17 +73,30 @@ const clusterConfigTemplate = `<?xml version="1.0"?>
             </networks>
             <profile>default</profile>
             <quota>default</quota>
-            <access_management>1</access_management>
+            <access_management>{{if .AccessManagement}}1{{else}}0{{end}}</access_management>
         </default>
     </users>
 
     <profiles>
-        <default/>
+        <default>
+{{- range .Profile}}
+            <{{.Key}}>{{xmlEscape .Value}}</{{.Key}}>
+{{- end}}
+        </default>
     </profiles>
 
     <quotas>
         <default/>
     </quotas>
+{{- end}}
+{{- if .QueryLog}}
+
+    <query_log>
+        <database>system</database>
+        <table>query_log</table>
+        <flush_interval_milliseconds>{{.QueryLogFlushMS}}</flush_interval_milliseconds>
+    </query_log>
+{{- end}}
 
     <keeper_server>
         <tcp_port>{{.KeeperPort}}</tcp_port>
@@ -53,9 +104,12 @@ const clusterConfigTemplate = `<?xml version="1.0"?>
         <log_storage_path>{{xmlEscape .KeeperLogDir}}/</log_storage_path>
         <snapshot_storage_path>{{xmlEscape .KeeperSnapshotDir}}/</snapshot_storage_path>
         <coordination_settings>
-            <operation_timeout_ms>10000</operation_timeout_ms>
-            <session_timeout_ms>30000</session_timeout_ms>
+            <operation_timeout_ms>{{.KeeperOperationTimeoutMS}}</operation_timeout_ms>
+            <session_timeout_ms>{{.KeeperSessionTimeoutMS}}</session_timeout_ms>
             <raft_logs_level>warning</raft_logs_level>
+{{- if .Ephemeral}}
+            <force_sync>false</force_sync>
+{{- end}}
         </coordination_settings>
         <raft_configuration>
 {{- range .RaftServers}}
@@ -74,6 +128,9 @@ const clusterConfigTemplate = `<?xml version="1.0"?>
             <host>127.0.0.1</host>
             <port>{{.Port}}</port>
         </node>
+{{- end}}
+{{- if .KeeperRoot}}
+        <root>{{xmlEscape .KeeperRoot}}</root>
 {{- end}}
     </zookeeper>
 
@@ -96,9 +153,9 @@ const clusterConfigTemplate = `<?xml version="1.0"?>
     </distributed_ddl>
 
     <macros>
-        <shard>01</shard>
-        <replica>{{.ReplicaName}}</replica>
-        <cluster>test_cluster</cluster>
+{{- range .Macros}}
+        <{{.Key}}>{{xmlEscape .Value}}</{{.Key}}>
+{{- end}}
     </macros>
 {{range .Settings}}
     <{{.Key}}>{{xmlEscape .Value}}</{{.Key}}>
@@ -107,9 +164,7 @@ const clusterConfigTemplate = `<?xml version="1.0"?>
 `
 
 //nolint:gochecknoglobals // compile once, reuse
-var clusterConfigTmpl = template.Must(template.New("cluster-config").Funcs(template.FuncMap{
-	"xmlEscape": xmlEscapeString,
-}).Parse(clusterConfigTemplate))
+var clusterConfigTmpl = template.Must(template.New("cluster-config").Funcs(templateFuncs()).Parse(clusterConfigTemplate))
 
 // raftServer describes one server entry inside <raft_configuration>.
 type raftServer struct {
@@ -127,19 +182,37 @@ type clusterReplica struct {
 	Port uint32
 }
 
-// clusterNodePorts holds the 5 allocated ports for a single cluster node.
-type clusterNodePorts struct {
-	TCP         uint32
-	HTTP        uint32
-	Interserver uint32
-	Keeper      uint32
-	KeeperRaft  uint32
+// ClusterNodePorts holds the 5 ports of a single cluster node: native TCP, HTTP,
+// interserver HTTP, Keeper client and Keeper Raft.
+type ClusterNodePorts struct {
+	TCP         uint32 `json:"tcp"`
+	HTTP        uint32 `json:"http"`
+	Interserver uint32 `json:"interserver"`
+	Keeper      uint32 `json:"keeper"`
+	KeeperRaft  uint32 `json:"keeperRaft"`
 }
 
-// clusterTopology is pre-computed shared topology built from all node ports.
+// clusterTopology is pre-computed shared topology built from all node ports
+// and the cluster-wide options of the Config.
 type clusterTopology struct {
-	Nodes    []clusterNodePorts
-	Settings map[string]string
+	Nodes                  []ClusterNodePorts
+	Settings               map[string]string
+	InterserverHost        string
+	InterserverUser        string
+	InterserverPassword    string
+	Macros                 map[string]string
+	Profile                map[string]string
+	ReplicaNames           []string
+	DefaultDatabaseEngine  string
+	QueryLog               bool
+	HTTPCompression        bool
+	Telemetry              bool
+	Ephemeral              bool
+	AccessManagement       bool
+	KeeperRoot             string
+	Aux                    auxFiles
+	KeeperOperationTimeout time.Duration
+	KeeperSessionTimeout   time.Duration
 }
 
 // settingEntry is a key-value pair for a ClickHouse setting,
@@ -151,64 +224,231 @@ type settingEntry struct {
 
 // clusterNodeConfigData is the template data for a single cluster node.
 type clusterNodeConfigData struct {
-	TCPPort           uint32
-	HTTPPort          uint32
-	InterserverPort   uint32
-	KeeperPort        uint32
-	ServerID          int
-	DataDir           string
-	TmpDir            string
-	UserFilesDir      string
-	FormatSchemaDir   string
-	KeeperLogDir      string
-	KeeperSnapshotDir string
-	ReplicaName       string
-	RaftServers       []raftServer
-	KeeperNodes       []keeperNode
-	ClusterReplicas   []clusterReplica
-	Settings          []settingEntry
+	TCPPort                  uint32
+	HTTPPort                 uint32
+	InterserverPort          uint32
+	KeeperPort               uint32
+	ServerID                 int
+	DataDir                  string
+	TmpDir                   string
+	FormatSchemaDir          string
+	KeeperLogDir             string
+	KeeperSnapshotDir        string
+	InterserverHost          string
+	InterserverUser          string
+	InterserverPassword      string
+	DefaultDatabaseEngine    string
+	QueryLog                 bool
+	QueryLogFlushMS          int
+	HTTPCompression          bool
+	Telemetry                bool
+	Ephemeral                bool
+	AccessManagement         bool
+	KeeperRoot               string
+	KeeperOperationTimeoutMS int64
+	KeeperSessionTimeoutMS   int64
+	RaftServers              []raftServer
+	KeeperNodes              []keeperNode
+	ClusterReplicas          []clusterReplica
+	Macros                   []settingEntry
+	Profile                  []settingEntry
+	Settings                 []settingEntry
+	auxPaths
 }
 
-// buildClusterTopology creates a clusterTopology from allocated ports and user settings.
-func buildClusterTopology(ports []clusterNodePorts, settings map[string]string) clusterTopology {
-	merged := make(map[string]string, len(settings))
-	maps.Copy(merged, settings)
+// buildClusterTopology creates a clusterTopology from allocated ports and the config's
+// cluster-wide options (user settings, per-node memory limit, macros, interserver host
+// and credentials, default profile, database engine, query log, HTTP compression,
+// Ephemeral, access management, Keeper root, UDFs, dictionaries).
+func buildClusterTopology(ports []ClusterNodePorts, cfg Config) clusterTopology {
+	settings := serverSettingsFor(cfg)
+	if _, ok := cfg.settings[maxServerMemoryUsageKey]; !ok {
+		if limit := nodeMemoryLimit(cfg, len(ports)); limit > 0 {
+			settings[maxServerMemoryUsageKey] = strconv.FormatUint(limit, 10)
+		}
+	}
+
+	for key, pattern := range map[string]string{
+		"default_replica_path": cfg.defaultReplicaPath,
+		"default_replica_name": cfg.defaultReplicaName,
+	} {
+		if _, ok := cfg.settings[key]; !ok && pattern != "" {
+			settings[key] = pattern
+		}
+	}
+
+	macros := map[string]string{"shard": "01", "cluster": "test_cluster"}
+	maps.Copy(macros, cfg.macros)
 
 	return clusterTopology{
-		Nodes:    ports,
-		Settings: merged,
+		Nodes:                  ports,
+		Settings:               settings,
+		InterserverHost:        cmp.Or(cfg.interserverHost, defaultInterserverHost),
+		InterserverUser:        cfg.interserverUser,
+		InterserverPassword:    cfg.interserverPassword,
+		Macros:                 macros,
+		Profile:                profileSettingsFor(cfg),
+		ReplicaNames:           replicaNamesFor(cfg, len(ports)),
+		DefaultDatabaseEngine:  cfg.defaultDatabaseEngine,
+		QueryLog:               cfg.queryLog,
+		HTTPCompression:        cfg.httpCompression,
+		Telemetry:              cfg.allowTelemetry,
+		Ephemeral:              cfg.ephemeral,
+		AccessManagement:       !cfg.noAccessManagement,
+		KeeperRoot:             cfg.keeperRoot,
+		Aux:                    auxFilesFor(cfg),
+		KeeperOperationTimeout: cmp.Or(cfg.keeperOperationTimeout, defaultKeeperOperationTimeout),
+		KeeperSessionTimeout:   cmp.Or(cfg.keeperSessionTimeout, defaultKeeperSessionTimeout),
 	}
 }
 
-// writeClusterNodeConfig generates a ClickHouse XML config for one cluster node.
-func writeClusterNodeConfig(dir string, nodeIndex int, topo clusterTopology) (string, error) {
+// nodeMemoryLimit returns the max_server_memory_usage for each of replicas nodes: the
+// MaxMemoryPerNode value, or else half the host memory split evenly across the nodes, so
+// several servers sized for the whole host cannot exhaust it together. It returns 0 (no
+// limit) with LowMemory, whose preset already caps each node, or when host memory is unknown.
+func nodeMemoryLimit(cfg Config, replicas int) uint64 {
+	switch {
+	case cfg.maxMemoryPerNode > 0:
+		return uint64(cfg.maxMemoryPerNode)
+	case cfg.lowMemory:
+		return 0
+	default:
+		return totalHostMemory() / uint64(max(replicas, 1)) / 2
+	}
+}
+
+// validateKeeperTimeouts rejects Keeper timeouts outside minKeeperTimeout..maxKeeperTimeout,
+// and an operation timeout longer than the session timeout (a request would outlive the
+// session it runs in).
+func validateKeeperTimeouts(cfg Config) error {
+	op := cmp.Or(cfg.keeperOperationTimeout, defaultKeeperOperationTimeout)
+	session := cmp.Or(cfg.keeperSessionTimeout, defaultKeeperSessionTimeout)
+
+	for _, d := range []time.Duration{op, session} {
+		if d < minKeeperTimeout || d > maxKeeperTimeout {
+			return fmt.Errorf("%w: %s is outside %s..%s", ErrInvalidKeeperTimeout, d, minKeeperTimeout, maxKeeperTimeout)
+		}
+	}
+
+	if op > session {
+		return fmt.Errorf("%w: operation timeout %s exceeds session timeout %s", ErrInvalidKeeperTimeout, op, session)
+	}
+
+	return nil
+}
+
+// replicaNamesFor computes the {replica} macro of each of n nodes using cfg's ReplicaNamer,
+// falling back to defaultReplicaName.
+func replicaNamesFor(cfg Config, n int) []string {
+	namer := cfg.replicaNamer
+	if namer == nil {
+		namer = defaultReplicaName
+	}
+
+	names := make([]string, n)
+	for i := range n {
+		names[i] = namer(i)
+	}
+
+	return names
+}
+
+// defaultReplicaName is the default {replica} macro for the node at index: replica_01, replica_02, ...
+func defaultReplicaName(index int) string {
+	return fmt.Sprintf("replica_%02d", index+1)
+}
+
+// validateReplicaNames rejects empty or duplicate replica names, either of which would
+// break replication (replicas register under their name in Keeper).
+func validateReplicaNames(names []string) error {
+	seen := make(map[string]int, len(names))
+
+	for i, name := range names {
+		if name == "" {
+			return fmt.Errorf("%w: node %d has an empty name", ErrInvalidReplicaName, i)
+		}
+
+		if prev, ok := seen[name]; ok {
+			return fmt.Errorf("%w: nodes %d and %d are both named %q", ErrInvalidReplicaName, prev, i, name)
+		}
+
+		seen[name] = i
+	}
+
+	return nil
+}
+
+// RenderClusterNodeConfig returns the XML config Cluster.Start would generate for node
+// index of a cluster with one node per entry of ports, without creating any files or
+// launching ClickHouse, e.g. for golden-file tests. Paths are rooted at the node's
+// directory under cfg's DataPath, or under /tmp/embedded-clickhouse in place of the temp
+// directories Cluster.Start would create.
+func RenderClusterNodeConfig(cfg Config, ports []ClusterNodePorts, index int) (string, error) {
+	if len(ports) < minReplicas {
+		return "", fmt.Errorf("%w: got %d", ErrInvalidReplicaCount, len(ports))
+	}
+
+	if index < 0 || index >= len(ports) {
+		return "", fmt.Errorf("%w: %d (cluster has %d nodes)", ErrNodeOutOfRange, index, len(ports))
+	}
+
+	if err := validateReplicaNames(replicaNamesFor(cfg, len(ports))); err != nil {
+		return "", err
+	}
+
+	if err := validateKeeperTimeouts(cfg); err != nil {
+		return "", err
+	}
+
+	if err := validateKeeperRoot(cfg.keeperRoot); err != nil {
+		return "", err
+	}
+
+	data, err := clusterNodeConfigFor(clusterNodeDir(cmp.Or(cfg.dataPath, renderDir), index),
+		index, buildClusterTopology(ports, cfg))
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := clusterConfigTmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: render cluster config: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// clusterNodeConfigFor validates topo's options and builds the template data of node
+// nodeIndex rooted at dir.
+func clusterNodeConfigFor(dir string, nodeIndex int, topo clusterTopology) (clusterNodeConfigData, error) {
 	sortedKeys := slices.Sorted(maps.Keys(topo.Settings))
 
 	settings := make([]settingEntry, 0, len(sortedKeys))
 
 	for _, k := range sortedKeys {
 		if !validSettingKey.MatchString(k) {
-			return "", fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidSettingKey, k)
+			return clusterNodeConfigData{}, fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidSettingKey, k)
 		}
 
 		settings = append(settings, settingEntry{Key: k, Value: topo.Settings[k]})
 	}
 
-	node := topo.Nodes[nodeIndex]
+	// The {replica} macro is always per node, overriding any cluster-wide value.
+	nodeMacros := maps.Clone(topo.Macros)
+	nodeMacros["replica"] = topo.ReplicaNames[nodeIndex]
 
-	dataDir := filepath.Join(dir, "data")
-	tmpDir := filepath.Join(dir, "tmp")
-	userFilesDir := filepath.Join(dir, "user_files")
-	formatSchemaDir := filepath.Join(dir, "format_schemas")
-	keeperLogDir := filepath.Join(dir, "coordination", "log")
-	keeperSnapshotDir := filepath.Join(dir, "coordination", "snapshots")
+	macros, err := macroEntries(nodeMacros)
+	if err != nil {
+		return clusterNodeConfigData{}, err
+	}
 
-	for _, d := range []string{dataDir, tmpDir, userFilesDir, formatSchemaDir, keeperLogDir, keeperSnapshotDir} {
-		if err := os.MkdirAll(d, 0o755); err != nil {
-			return "", fmt.Errorf("embedded-clickhouse: create dir %s: %w", d, err)
-		}
+	profile, err := profileEntries(topo.Profile)
+	if err != nil {
+		return clusterNodeConfigData{}, err
 	}
 
+	node := topo.Nodes[nodeIndex]
+
 	raftServers := make([]raftServer, len(topo.Nodes))
 	keeperNodes := make([]keeperNode, len(topo.Nodes))
 	clusterReplicas := make([]clusterReplica, len(topo.Nodes))
@@ -219,26 +459,61 @@ func writeClusterNodeConfig(dir string, nodeIndex int, topo clusterTopology) (st
 		clusterReplicas[i] = clusterReplica{Port: n.TCP}
 	}
 
-	data := clusterNodeConfigData{
-		TCPPort:           node.TCP,
-		HTTPPort:          node.HTTP,
-		InterserverPort:   node.Interserver,
-		KeeperPort:        node.Keeper,
-		ServerID:          nodeIndex + 1,
-		DataDir:           dataDir,
-		TmpDir:            tmpDir,
-		UserFilesDir:      userFilesDir,
-		FormatSchemaDir:   formatSchemaDir,
-		KeeperLogDir:      keeperLogDir,
-		KeeperSnapshotDir: keeperSnapshotDir,
-		ReplicaName:       fmt.Sprintf("replica_%02d", nodeIndex+1),
-		RaftServers:       raftServers,
-		KeeperNodes:       keeperNodes,
-		ClusterReplicas:   clusterReplicas,
-		Settings:          settings,
+	return clusterNodeConfigData{
+		TCPPort:                  node.TCP,
+		HTTPPort:                 node.HTTP,
+		InterserverPort:          node.Interserver,
+		KeeperPort:               node.Keeper,
+		ServerID:                 nodeIndex + 1,
+		DataDir:                  filepath.Join(dir, "data"),
+		TmpDir:                   filepath.Join(dir, "tmp"),
+		FormatSchemaDir:          filepath.Join(dir, "format_schemas"),
+		KeeperLogDir:             filepath.Join(dir, "coordination", "log"),
+		KeeperSnapshotDir:        filepath.Join(dir, "coordination", "snapshots"),
+		InterserverHost:          topo.InterserverHost,
+		InterserverUser:          topo.InterserverUser,
+		InterserverPassword:      topo.InterserverPassword,
+		DefaultDatabaseEngine:    topo.DefaultDatabaseEngine,
+		QueryLog:                 topo.QueryLog,
+		QueryLogFlushMS:          queryLogFlushIntervalMS,
+		HTTPCompression:          topo.HTTPCompression,
+		Telemetry:                topo.Telemetry,
+		Ephemeral:                topo.Ephemeral,
+		AccessManagement:         topo.AccessManagement,
+		KeeperRoot:               topo.KeeperRoot,
+		KeeperOperationTimeoutMS: topo.KeeperOperationTimeout.Milliseconds(),
+		KeeperSessionTimeoutMS:   topo.KeeperSessionTimeout.Milliseconds(),
+		RaftServers:              raftServers,
+		KeeperNodes:              keeperNodes,
+		ClusterReplicas:          clusterReplicas,
+		Macros:                   macros,
+		Profile:                  profile,
+		Settings:                 settings,
+		auxPaths:                 planAuxPaths(dir, topo.Aux),
+	}, nil
+}
+
+// writeClusterNodeConfig generates a ClickHouse XML config for one cluster node.
+func writeClusterNodeConfig(dir string, nodeIndex int, topo clusterTopology) (string, error) {
+	data, err := clusterNodeConfigFor(dir, nodeIndex, topo)
+	if err != nil {
+		return "", err
+	}
+
+	err = makeDirs(data.DataDir, data.TmpDir, data.FormatSchemaDir, data.KeeperLogDir, data.KeeperSnapshotDir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := writeAuxFiles(dir, topo.Aux); err != nil {
+		return "", err
+	}
+
+	if err := writeUsersProfile(data.UsersConfigPath, data.Profile); err != nil {
+		return "", err
 	}
 
-	configPath := filepath.Join(dir, "config.xml")
+	configPath := configPathIn(dir)
 
 	f, err := os.Create(configPath)
 	if err != nil {
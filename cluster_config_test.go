@@ -1,23 +1,26 @@
 package embeddedclickhouse
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 const testKeyMaxServerMemoryUsage = "max_server_memory_usage"
 
 func threeNodeTopology() clusterTopology {
-	ports := []clusterNodePorts{
+	ports := []ClusterNodePorts{
 		{TCP: 19000, HTTP: 18123, Interserver: 19009, Keeper: 19181, KeeperRaft: 19234},
 		{TCP: 29000, HTTP: 28123, Interserver: 29009, Keeper: 29181, KeeperRaft: 29234},
 		{TCP: 39000, HTTP: 38123, Interserver: 39009, Keeper: 39181, KeeperRaft: 39234},
 	}
 
-	return buildClusterTopology(ports, nil)
+	return buildClusterTopology(ports, DefaultConfig())
 }
 
 func TestWriteClusterNodeConfig_XMLCorrectness(t *testing.T) {
@@ -138,39 +141,160 @@ func TestWriteClusterNodeConfig_CreatesKeeperDirs(t *testing.T) {
 func TestBuildClusterTopology_NilSettings(t *testing.T) {
 	t.Parallel()
 
-	topo := buildClusterTopology([]clusterNodePorts{
+	topo := buildClusterTopology([]ClusterNodePorts{
 		{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5},
-	}, nil)
+	}, DefaultConfig().MaxMemoryPerNode(1<<30))
 
-	if len(topo.Settings) != 0 {
-		t.Errorf("expected empty settings for nil input, got %v", topo.Settings)
+	// Only the per-node memory limit is injected.
+	if len(topo.Settings) != 1 || topo.Settings[testKeyMaxServerMemoryUsage] != "1073741824" {
+		t.Errorf("expected only the memory limit for nil input, got %v", topo.Settings)
+	}
+}
+
+func TestBuildClusterTopology_MemoryPerNode(t *testing.T) {
+	t.Parallel()
+
+	ports := threeNodeTopology().Nodes
+
+	host := totalHostMemory()
+	if host == 0 {
+		t.Skip("host memory unknown on this platform")
+	}
+
+	topo := buildClusterTopology(ports, DefaultConfig())
+	if want := strconv.FormatUint(host/3/2, 10); topo.Settings[testKeyMaxServerMemoryUsage] != want {
+		t.Errorf("default limit = %q, want %q", topo.Settings[testKeyMaxServerMemoryUsage], want)
+	}
+
+	// LowMemory keeps its preset unless MaxMemoryPerNode is set.
+	topo = buildClusterTopology(ports, DefaultConfig().LowMemory())
+	if got := topo.Settings[testKeyMaxServerMemoryUsage]; got != "1073741824" {
+		t.Errorf("LowMemory limit = %q, want preset", got)
+	}
+
+	topo = buildClusterTopology(ports, DefaultConfig().LowMemory().MaxMemoryPerNode(512<<20))
+	if got := topo.Settings[testKeyMaxServerMemoryUsage]; got != "536870912" {
+		t.Errorf("LowMemory+MaxMemoryPerNode limit = %q, want 536870912", got)
+	}
+
+	// An explicit setting wins over MaxMemoryPerNode.
+	topo = buildClusterTopology(ports, DefaultConfig().MaxMemoryPerNode(512<<20).ServerSettings(map[string]string{
+		testKeyMaxServerMemoryUsage: "2147483648",
+	}))
+	if got := topo.Settings[testKeyMaxServerMemoryUsage]; got != "2147483648" {
+		t.Errorf("Settings limit = %q, want 2147483648", got)
+	}
+}
+
+func TestWriteClusterNodeConfig_MaxMemoryPerNode(t *testing.T) {
+	t.Parallel()
+
+	topo := buildClusterTopology(threeNodeTopology().Nodes, DefaultConfig().MaxMemoryPerNode(768<<20))
+
+	for i := range topo.Nodes {
+		configPath, err := writeClusterNodeConfig(t.TempDir(), i, topo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(content), "<max_server_memory_usage>805306368</max_server_memory_usage>") {
+			t.Errorf("node %d: max_server_memory_usage element missing", i)
+		}
 	}
 }
 
 func TestBuildClusterTopology_UserSettings(t *testing.T) {
 	t.Parallel()
 
-	topo := buildClusterTopology([]clusterNodePorts{
+	topo := buildClusterTopology([]ClusterNodePorts{
 		{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5},
-	}, map[string]string{
+	}, DefaultConfig().ServerSettings(map[string]string{
 		testKeyMaxServerMemoryUsage: "2147483648",
-	})
+	}))
 
 	if topo.Settings[testKeyMaxServerMemoryUsage] != "2147483648" {
 		t.Errorf("expected user setting, got %s", topo.Settings[testKeyMaxServerMemoryUsage])
 	}
 }
 
+func TestRenderClusterNodeConfig_DefaultReplicaPath(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().
+		DefaultReplicaPath("/clickhouse/tables/{database}/{table}/{shard}").
+		DefaultReplicaName("{replica}")
+
+	xml, err := RenderClusterNodeConfig(cfg, threeNodeTopology().Nodes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<default_replica_path>/clickhouse/tables/{database}/{table}/{shard}</default_replica_path>",
+		"<default_replica_name>{replica}</default_replica_name>",
+	} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("config missing %s", want)
+		}
+	}
+
+	// Unset, ClickHouse's built-in defaults apply.
+	xml, err = RenderClusterNodeConfig(DefaultConfig(), threeNodeTopology().Nodes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(xml, "default_replica_") {
+		t.Error("config sets default_replica_* without DefaultReplicaPath/DefaultReplicaName")
+	}
+
+	// An explicit setting wins.
+	topo := buildClusterTopology(threeNodeTopology().Nodes, cfg.ServerSettings(map[string]string{
+		"default_replica_path": "/custom/{shard}",
+	}))
+	if got := topo.Settings["default_replica_path"]; got != "/custom/{shard}" {
+		t.Errorf("default_replica_path = %q, want the Settings value", got)
+	}
+}
+
+func TestRenderClusterNodeConfig_LowMemory(t *testing.T) {
+	t.Parallel()
+
+	ports := []ClusterNodePorts{
+		{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5},
+		{TCP: 6, HTTP: 7, Interserver: 8, Keeper: 9, KeeperRaft: 10},
+	}
+	for i := range ports {
+		xml, err := RenderClusterNodeConfig(DefaultConfig().LowMemory(), ports, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(xml, "<max_server_memory_usage>1073741824</max_server_memory_usage>") {
+			t.Errorf("node %d: LowMemory max_server_memory_usage missing", i)
+		}
+
+		if !strings.Contains(xml, "<background_pool_size>2</background_pool_size>") {
+			t.Errorf("node %d: LowMemory background_pool_size missing", i)
+		}
+	}
+}
+
 func TestWriteClusterNodeConfig_SettingsSortedDeterministically(t *testing.T) {
 	t.Parallel()
 
 	topo := buildClusterTopology(
-		[]clusterNodePorts{{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5}},
-		map[string]string{
+		[]ClusterNodePorts{{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5}},
+		DefaultConfig().ServerSettings(map[string]string{
 			"max_memory_usage":          "1000000000",
 			"allow_introspection":       "1",
 			testKeyMaxServerMemoryUsage: "2147483648",
-		},
+		}),
 	)
 	dir := t.TempDir()
 
@@ -204,8 +328,8 @@ func TestWriteClusterNodeConfig_InvalidSettingKey(t *testing.T) {
 	t.Parallel()
 
 	topo := buildClusterTopology(
-		[]clusterNodePorts{{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5}},
-		map[string]string{"bad key!": "value"},
+		[]ClusterNodePorts{{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5}},
+		DefaultConfig().ServerSettings(map[string]string{"bad key!": "value"}),
 	)
 	dir := t.TempDir()
 
@@ -252,3 +376,603 @@ func TestWriteClusterNodeConfig_DifferentNodes(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteClusterNodeConfig_InterserverCredentials(t *testing.T) {
+	t.Parallel()
+
+	ports := threeNodeTopology().Nodes
+
+	t.Run("absent by default", func(t *testing.T) {
+		t.Parallel()
+
+		configPath, err := writeClusterNodeConfig(t.TempDir(), 0, buildClusterTopology(ports, DefaultConfig()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(content), "<interserver_http_credentials>") {
+			t.Error("credentials block should be absent when not configured")
+		}
+	})
+
+	t.Run("present on every node", func(t *testing.T) {
+		t.Parallel()
+
+		topo := buildClusterTopology(ports, DefaultConfig().InterserverCredentials("replicator", "s3<cret>"))
+
+		for nodeIdx := range len(ports) {
+			configPath, err := writeClusterNodeConfig(t.TempDir(), nodeIdx, topo)
+			if err != nil {
+				t.Fatalf("node %d: %v", nodeIdx, err)
+			}
+
+			content, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("node %d: %v", nodeIdx, err)
+			}
+
+			xml := string(content)
+
+			for _, check := range []string{
+				"<interserver_http_credentials>",
+				"<user>replicator</user>",
+				"<password>s3&lt;cret&gt;</password>",
+			} {
+				if !strings.Contains(xml, check) {
+					t.Errorf("node %d: config missing %q", nodeIdx, check)
+				}
+			}
+		}
+	})
+}
+
+func TestWriteClusterNodeConfig_CustomMacros(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().Macros(map[string]string{
+		"layer":   "edge",
+		"shard":   "07",
+		"replica": "ignored", // always per node
+	})
+	topo := buildClusterTopology(threeNodeTopology().Nodes, cfg)
+
+	configPath, err := writeClusterNodeConfig(t.TempDir(), 1, topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xml := string(content)
+
+	for _, check := range []string{
+		"<layer>edge</layer>",
+		"<shard>07</shard>",
+		"<replica>replica_02</replica>",
+		"<cluster>test_cluster</cluster>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("config missing %q", check)
+		}
+	}
+
+	if strings.Contains(xml, "ignored") {
+		t.Error("cluster-wide replica macro must not override the per-node value")
+	}
+}
+
+func TestWriteClusterNodeConfig_ReplicaNamer(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().ReplicaNamer(func(index int) string {
+		return fmt.Sprintf("ch-%c", 'a'+index)
+	})
+	topo := buildClusterTopology(threeNodeTopology().Nodes, cfg)
+
+	for i, want := range []string{"ch-a", "ch-b", "ch-c"} {
+		configPath, err := writeClusterNodeConfig(t.TempDir(), i, topo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(content), "<replica>"+want+"</replica>") {
+			t.Errorf("node %d: config missing replica macro %q", i, want)
+		}
+	}
+}
+
+func TestReplicaNamesFor_Default(t *testing.T) {
+	t.Parallel()
+
+	got := replicaNamesFor(DefaultConfig(), 3)
+	want := []string{"replica_01", "replica_02", "replica_03"}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("replica %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestValidateReplicaNames(t *testing.T) {
+	t.Parallel()
+
+	if err := validateReplicaNames([]string{"a", "b", "c"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, names := range [][]string{{"a", "", "c"}, {"a", "b", "a"}} {
+		if err := validateReplicaNames(names); !errors.Is(err, ErrInvalidReplicaName) {
+			t.Errorf("validateReplicaNames(%q) = %v, want ErrInvalidReplicaName", names, err)
+		}
+	}
+}
+
+func TestWriteClusterNodeConfig_KeeperTimeouts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		checks []string
+	}{
+		{"defaults", DefaultConfig(), []string{
+			"<operation_timeout_ms>10000</operation_timeout_ms>",
+			"<session_timeout_ms>30000</session_timeout_ms>",
+		}},
+		{"overridden", DefaultConfig().KeeperOperationTimeout(500 * time.Millisecond).KeeperSessionTimeout(2 * time.Second), []string{
+			"<operation_timeout_ms>500</operation_timeout_ms>",
+			"<session_timeout_ms>2000</session_timeout_ms>",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			topo := buildClusterTopology(threeNodeTopology().Nodes, tt.cfg)
+
+			configPath, err := writeClusterNodeConfig(t.TempDir(), 0, topo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, check := range tt.checks {
+				if !strings.Contains(string(content), check) {
+					t.Errorf("config missing %q", check)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateKeeperTimeouts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"defaults", DefaultConfig(), false},
+		{"short", DefaultConfig().KeeperOperationTimeout(time.Second).KeeperSessionTimeout(3 * time.Second), false},
+		{"negative session", DefaultConfig().KeeperSessionTimeout(-time.Second), true},
+		{"too short", DefaultConfig().KeeperOperationTimeout(time.Millisecond), true},
+		{"too long", DefaultConfig().KeeperSessionTimeout(time.Hour), true},
+		{"operation exceeds session", DefaultConfig().KeeperSessionTimeout(5 * time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateKeeperTimeouts(tt.cfg)
+			if got := errors.Is(err, ErrInvalidKeeperTimeout); got != tt.wantErr {
+				t.Errorf("validateKeeperTimeouts() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteClusterNodeConfig_DefaultDatabaseEngine(t *testing.T) {
+	t.Parallel()
+
+	topo := buildClusterTopology(threeNodeTopology().Nodes, DefaultConfig().DefaultDatabaseEngine("Replicated"))
+
+	configPath, err := writeClusterNodeConfig(t.TempDir(), 0, topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xml := string(content)
+
+	for _, check := range []string{
+		"<allow_experimental_database_replicated>1</allow_experimental_database_replicated>",
+		"<default_database_engine>Replicated</default_database_engine>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("config missing %q", check)
+		}
+	}
+}
+
+func TestWriteClusterNodeConfig_QueryLog(t *testing.T) {
+	t.Parallel()
+
+	topo := buildClusterTopology(threeNodeTopology().Nodes, DefaultConfig().EnableQueryLog(true))
+
+	configPath, err := writeClusterNodeConfig(t.TempDir(), 2, topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(content), "<flush_interval_milliseconds>100</flush_interval_milliseconds>") {
+		t.Error("config missing query_log flush interval")
+	}
+}
+
+func TestRenderClusterNodeConfig_HTTPCompression(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().EnableHTTPCompression(true)
+
+	xml, err := RenderClusterNodeConfig(cfg, threeNodeTopology().Nodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(xml, "<enable_http_compression>1</enable_http_compression>") {
+		t.Error("config missing enable_http_compression")
+	}
+}
+
+func TestRenderClusterNodeConfig_Profile(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().ProfileSettings(map[string]string{"async_insert": "1"})
+
+	xml, err := RenderClusterNodeConfig(cfg, threeNodeTopology().Nodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, profiles, _ := strings.Cut(xml, "<profiles>")
+	profiles, _, _ = strings.Cut(profiles, "</profiles>")
+
+	if !strings.Contains(profiles, "<async_insert>1</async_insert>") {
+		t.Error("default profile missing async_insert")
+	}
+}
+
+func TestRenderClusterNodeConfig_QuorumInserts(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().
+		QuorumInserts(5 * time.Second).
+		ProfileSettings(map[string]string{"insert_quorum": "3"})
+
+	xml, err := RenderClusterNodeConfig(cfg, threeNodeTopology().Nodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, profiles, _ := strings.Cut(xml, "<profiles>")
+	profiles, _, _ = strings.Cut(profiles, "</profiles>")
+
+	for _, want := range []string{
+		"<insert_quorum>3</insert_quorum>",
+		"<insert_quorum_timeout>5000</insert_quorum_timeout>",
+		"<insert_quorum_parallel>0</insert_quorum_parallel>",
+		"<select_sequential_consistency>1</select_sequential_consistency>",
+	} {
+		if !strings.Contains(profiles, want) {
+			t.Errorf("default profile missing %s", want)
+		}
+	}
+
+	xml, err = RenderClusterNodeConfig(DefaultConfig().QuorumInserts(0), threeNodeTopology().Nodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(xml, "<insert_quorum>auto</insert_quorum>") || strings.Contains(xml, "insert_quorum_timeout") {
+		t.Error("QuorumInserts(0) should set insert_quorum and keep the server's default timeout")
+	}
+}
+
+func TestRenderClusterNodeConfig_Ephemeral(t *testing.T) {
+	t.Parallel()
+
+	for _, enable := range []bool{true, false} {
+		xml, err := RenderClusterNodeConfig(DefaultConfig().Ephemeral(enable), threeNodeTopology().Nodes, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, setting := range []string{"<force_sync>false</force_sync>", "<fsync_metadata>0</fsync_metadata>"} {
+			if got := strings.Contains(xml, setting); got != enable {
+				t.Errorf("Ephemeral(%v): config contains %s = %v", enable, setting, got)
+			}
+		}
+	}
+}
+
+func TestRenderClusterNodeConfig_AccessManagement(t *testing.T) {
+	t.Parallel()
+
+	for _, enable := range []bool{true, false} {
+		xml, err := RenderClusterNodeConfig(DefaultConfig().AccessManagement(enable), threeNodeTopology().Nodes, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(xml, "<access_management>1</access_management>"); got != enable {
+			t.Errorf("AccessManagement(%v): config enables access management = %v", enable, got)
+		}
+	}
+}
+
+func TestWriteClusterNodeConfig_UsersConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	topo := buildClusterTopology(threeNodeTopology().Nodes, DefaultConfig().UsersConfig([]byte("<clickhouse/>")))
+
+	configPath, err := writeClusterNodeConfig(dir, 0, topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xml := string(content)
+
+	if !strings.Contains(xml, "<users_config>"+filepath.Join(dir, usersConfigFile)+"</users_config>") {
+		t.Error("config should reference users.xml")
+	}
+
+	if strings.Contains(xml, "<users>") || strings.Contains(xml, "<profiles>") {
+		t.Error("config should not define users or profiles inline")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users.d", usersProfileFile)); err != nil {
+		t.Errorf("users.d profile not written: %v", err)
+	}
+}
+
+func TestRenderClusterNodeConfig_Telemetry(t *testing.T) {
+	t.Parallel()
+
+	for _, allow := range []bool{false, true} {
+		xml, err := RenderClusterNodeConfig(DefaultConfig().AllowTelemetry(allow), threeNodeTopology().Nodes, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(xml, "<send_crash_reports>"); got == allow {
+			t.Errorf("AllowTelemetry(%v): config disables crash reports = %v", allow, got)
+		}
+	}
+}
+
+func TestWriteClusterNodeConfig_UDFConfig(t *testing.T) {
+	t.Parallel()
+
+	topo := buildClusterTopology(threeNodeTopology().Nodes, DefaultConfig().UDFConfig([]byte("<functions/>")))
+
+	dir := t.TempDir()
+
+	configPath, err := writeClusterNodeConfig(dir, 0, topo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udfPath := filepath.Join(dir, udfConfigFile)
+	if !strings.Contains(string(content), "<user_defined_executable_functions_config>"+udfPath) {
+		t.Error("config missing UDF config reference")
+	}
+
+	if _, err := os.Stat(udfPath); err != nil {
+		t.Errorf("UDF config not written: %v", err)
+	}
+}
+
+func TestWriteClusterNodeConfig_InvalidMacroKey(t *testing.T) {
+	t.Parallel()
+
+	topo := buildClusterTopology(threeNodeTopology().Nodes, DefaultConfig().Macros(map[string]string{"1bad": "x"}))
+
+	_, err := writeClusterNodeConfig(t.TempDir(), 0, topo)
+	if !errors.Is(err, ErrInvalidMacroKey) {
+		t.Fatalf("err = %v, want ErrInvalidMacroKey", err)
+	}
+}
+
+func TestRenderClusterNodeConfig(t *testing.T) {
+	t.Parallel()
+
+	ports := threeNodeTopology().Nodes
+
+	rendered, err := RenderClusterNodeConfig(DefaultConfig(), ports, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range []string{
+		"<tcp_port>29000</tcp_port>",
+		"<server_id>2</server_id>",
+		"<replica>replica_02</replica>",
+		"<path>/tmp/embedded-clickhouse/node-1/data/</path>",
+	} {
+		if !strings.Contains(rendered, check) {
+			t.Errorf("rendered config missing %q", check)
+		}
+	}
+
+	// Rendering matches what Cluster.Start writes for the same node directory.
+	base := t.TempDir()
+
+	written, err := RenderClusterNodeConfig(DefaultConfig().DataPath(base), ports, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath, err := writeClusterNodeConfig(clusterNodeDir(base, 1), 1, threeNodeTopology())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if written != string(content) {
+		t.Errorf("rendered config differs from written config:\n%s\n---\n%s", written, content)
+	}
+}
+
+func TestRenderClusterNodeConfig_Invalid(t *testing.T) {
+	t.Parallel()
+
+	ports := threeNodeTopology().Nodes
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		ports   []ClusterNodePorts
+		index   int
+		wantErr error
+	}{
+		{"index out of range", DefaultConfig(), ports, 3, ErrNodeOutOfRange},
+		{"negative index", DefaultConfig(), ports, -1, ErrNodeOutOfRange},
+		{"single node", DefaultConfig(), ports[:1], 0, ErrInvalidReplicaCount},
+		{"duplicate replica names", DefaultConfig().ReplicaNamer(func(int) string { return "r" }), ports, 0, ErrInvalidReplicaName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := RenderClusterNodeConfig(tt.cfg, tt.ports, tt.index)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderClusterNodeConfig_KeeperRoot(t *testing.T) {
+	t.Parallel()
+
+	xml, err := RenderClusterNodeConfig(DefaultConfig().KeeperRoot("/clusters/a"), threeNodeTopology().Nodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zookeeper := xml[strings.Index(xml, "<zookeeper>"):strings.Index(xml, "</zookeeper>")]
+	if !strings.Contains(zookeeper, "<root>/clusters/a</root>") {
+		t.Errorf("zookeeper section missing root:\n%s", zookeeper)
+	}
+
+	xml, err = RenderClusterNodeConfig(DefaultConfig(), threeNodeTopology().Nodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(xml, "<root>") {
+		t.Error("default config should not set a keeper root")
+	}
+
+	_, err = RenderClusterNodeConfig(DefaultConfig().KeeperRoot("clusters"), threeNodeTopology().Nodes, 1)
+	if !errors.Is(err, ErrInvalidKeeperRoot) {
+		t.Errorf("relative root: err = %v, want ErrInvalidKeeperRoot", err)
+	}
+}
+
+func TestValidateKeeperRoot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		root    string
+		wantErr bool
+	}{
+		{"", false},
+		{"/a", false},
+		{"/clusters/test_1.v-2", false},
+		{"/", true},
+		{"a/b", true},
+		{"/a/", true},
+		{"/a//b", true},
+		{"/a/../b", true},
+		{"/a/./b", true},
+		{"/a b", true},
+		{"/a<b>", true},
+	}
+
+	for _, tt := range tests {
+		err := validateKeeperRoot(tt.root)
+		if got := errors.Is(err, ErrInvalidKeeperRoot); got != tt.wantErr {
+			t.Errorf("validateKeeperRoot(%q) = %v, wantErr %v", tt.root, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRenderClusterNodeConfig_InterserverHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{DefaultConfig(), "<interserver_http_host>127.0.0.1</interserver_http_host>"},
+		{DefaultConfig().InterserverHost("replica-1.internal"), "<interserver_http_host>replica-1.internal</interserver_http_host>"},
+	}
+
+	for _, tt := range tests {
+		xml, err := RenderClusterNodeConfig(tt.cfg, threeNodeTopology().Nodes, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(xml, tt.want) {
+			t.Errorf("config missing %s", tt.want)
+		}
+	}
+}
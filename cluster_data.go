@@ -0,0 +1,79 @@
+package embeddedclickhouse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// clusterPortsFile records a persistent cluster's ports under its DataPath, so a restart
+// reuses the Raft and replica endpoints the Keeper logs and replicated tables refer to.
+const clusterPortsFile = "cluster_ports.json"
+
+// ErrClusterDataPathMismatch is returned by Cluster.Start when the DataPath holds a
+// cluster with a different number of replicas.
+var ErrClusterDataPathMismatch = errors.New("embedded-clickhouse: cluster data path holds a different topology")
+
+// clusterNodeDir returns the persistent directory of node i under base.
+func clusterNodeDir(base string, i int) string {
+	return filepath.Join(base, fmt.Sprintf("node-%d", i))
+}
+
+// clusterPortsState is the on-disk form of clusterPortsFile.
+type clusterPortsState struct {
+	Nodes []ClusterNodePorts `json:"nodes"`
+}
+
+// persistentClusterPorts returns the ports recorded under base by a previous Start, once
+// reuse accepts them, or allocates fresh ones with alloc and records them when base holds
+// no cluster yet.
+func persistentClusterPorts(
+	base string, replicas int, alloc func() ([]ClusterNodePorts, error), reuse func([]ClusterNodePorts) error,
+) ([]ClusterNodePorts, error) {
+	path := filepath.Join(base, clusterPortsFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var state clusterPortsState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("embedded-clickhouse: parse %s: %w", path, err)
+		}
+
+		if len(state.Nodes) != replicas {
+			return nil, fmt.Errorf("%w: %s has %d replicas, want %d",
+				ErrClusterDataPathMismatch, base, len(state.Nodes), replicas)
+		}
+
+		if err := reuse(state.Nodes); err != nil {
+			return nil, err
+		}
+
+		return state.Nodes, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("embedded-clickhouse: read %s: %w", path, err)
+	}
+
+	ports, err := alloc()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: create dir %s: %w", base, err)
+	}
+
+	data, err = json.Marshal(clusterPortsState{Nodes: ports})
+	if err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: encode cluster ports: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: write %s: %w", path, err)
+	}
+
+	return ports, nil
+}
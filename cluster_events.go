@@ -0,0 +1,52 @@
+package embeddedclickhouse
+
+import "time"
+
+// ClusterEventType identifies a step of cluster bring-up reported to ClusterEvents.
+type ClusterEventType int
+
+const (
+	// ClusterNodeStarted is sent when a node's process has been launched.
+	ClusterNodeStarted ClusterEventType = iota
+	// ClusterNodeReady is sent when a node answers /ping and accepts native connections.
+	ClusterNodeReady
+	// ClusterKeeperQuorum is sent when a node's Keeper readiness query first succeeds.
+	ClusterKeeperQuorum
+)
+
+// String returns the event type as "node-started", "node-ready" or "keeper-quorum".
+func (t ClusterEventType) String() string {
+	switch t {
+	case ClusterNodeStarted:
+		return "node-started"
+	case ClusterNodeReady:
+		return "node-ready"
+	case ClusterKeeperQuorum:
+		return "keeper-quorum"
+	default:
+		return "unknown"
+	}
+}
+
+// ClusterEvent is one step of cluster bring-up.
+type ClusterEvent struct {
+	// Type is the step the node reached.
+	Type ClusterEventType
+	// Node is the 0-based index of the node.
+	Node int
+	// Time is when the step was reached.
+	Time time.Time
+}
+
+// emitClusterEvent sends an event for node to ch, if any, without blocking: Start holds
+// the cluster lock with nodes running, so an event the reader is not ready for is dropped.
+func emitClusterEvent(ch chan<- ClusterEvent, typ ClusterEventType, node int) {
+	if ch == nil {
+		return
+	}
+
+	select {
+	case ch <- ClusterEvent{Type: typ, Node: node, Time: time.Now()}:
+	default:
+	}
+}
@@ -0,0 +1,112 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterEventType_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "node-started", ClusterNodeStarted.String())
+	assert.Equal(t, "node-ready", ClusterNodeReady.String())
+	assert.Equal(t, "keeper-quorum", ClusterKeeperQuorum.String())
+	assert.Equal(t, "unknown", ClusterEventType(42).String())
+}
+
+func TestEmitClusterEvent(t *testing.T) {
+	t.Parallel()
+
+	// Without a channel, emitting is a no-op.
+	emitClusterEvent(nil, ClusterNodeStarted, 0)
+
+	events := make(chan ClusterEvent, 1)
+	before := time.Now()
+
+	emitClusterEvent(events, ClusterNodeReady, 2)
+
+	ev := <-events
+	assert.Equal(t, ClusterNodeReady, ev.Type)
+	assert.Equal(t, 2, ev.Node)
+	assert.False(t, ev.Time.Before(before))
+}
+
+func TestEmitClusterEvent_UnreadChannelDrops(t *testing.T) {
+	t.Parallel()
+
+	done := make(chan struct{})
+
+	go func() {
+		emitClusterEvent(make(chan ClusterEvent), ClusterNodeStarted, 0)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("emitClusterEvent blocked on a channel nobody reads")
+	}
+}
+
+func TestLaunchClusterNodes_EmitsNodeStarted(t *testing.T) {
+	t.Parallel()
+
+	fake := writeFakeBinary(t, 0)
+	topo := threeNodeTopology()
+	events := make(chan ClusterEvent, len(topo.Nodes))
+
+	nodes, err := launchClusterNodes(context.Background(), DefaultConfig().ClusterEvents(events), fake, topo, io.Discard)
+	require.NoError(t, err)
+
+	for _, node := range nodes {
+		<-node.proc.done
+		require.NoError(t, os.RemoveAll(node.tmpDir))
+	}
+
+	close(events)
+
+	var started []int
+
+	for ev := range events {
+		assert.Equal(t, ClusterNodeStarted, ev.Type)
+
+		started = append(started, ev.Node)
+	}
+
+	slices.Sort(started)
+	assert.Equal(t, []int{0, 1, 2}, started)
+}
+
+func TestWaitForKeeperQuorum_EmitsPerNode(t *testing.T) {
+	t.Parallel()
+
+	ok := func(w http.ResponseWriter, _ url.Values, _ string) { w.WriteHeader(http.StatusOK) }
+	ports := []uint32{fakeQueryServerWithURL(t, ok), fakeQueryServerWithURL(t, ok)}
+	events := make(chan ClusterEvent, len(ports))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, waitForKeeperQuorum(ctx, ports, defaultKeeperReadinessQuery, 0, events))
+	close(events)
+
+	var joined []int
+
+	for ev := range events {
+		assert.Equal(t, ClusterKeeperQuorum, ev.Type)
+
+		joined = append(joined, ev.Node)
+	}
+
+	slices.Sort(joined)
+	assert.Equal(t, []int{0, 1}, joined)
+}
@@ -3,8 +3,18 @@ package embeddedclickhouse
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -62,13 +72,14 @@ func TestCluster_InvalidReplicaCount(t *testing.T) {
 func TestCluster_RejectsUnsupportedOptions(t *testing.T) {
 	t.Parallel()
 
-	// Cluster mode auto-manages ports and data dirs; these single-node options must be
+	// Cluster mode auto-manages ports and per-node data; these single-node options must be
 	// rejected before any binary download, so this test stays hermetic. A valid replica
 	// count (3) is used so Start reaches the option-rejection branch.
 	cases := map[string]Config{
-		"DataPath": DefaultConfig().DataPath("/tmp/x"),
-		"TCPPort":  DefaultConfig().TCPPort(19000),
-		"HTTPPort": DefaultConfig().HTTPPort(18123),
+		"TCPPort":          DefaultConfig().TCPPort(19000),
+		"HTTPPort":         DefaultConfig().HTTPPort(18123),
+		"GRPCPort":         DefaultConfig().GRPCPort(0),
+		"TemplateDataPath": DefaultConfig().TemplateDataPath("/tmp/golden"),
 	}
 
 	for name, cfg := range cases {
@@ -81,6 +92,162 @@ func TestCluster_RejectsUnsupportedOptions(t *testing.T) {
 	}
 }
 
+// fatalRecorder is a testing.TB for NewClusterForTest that records Fatal and Errorf calls
+// and keeps the registered cleanups for the test to run.
+type fatalRecorder struct {
+	testing.TB
+
+	cleanups []func()
+	fatal    []any
+	errors   []string
+}
+
+func (r *fatalRecorder) Helper()           {}
+func (r *fatalRecorder) Cleanup(fn func()) { r.cleanups = append(r.cleanups, fn) }
+
+func (r *fatalRecorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *fatalRecorder) Fatal(args ...any) {
+	r.fatal = args
+	runtime.Goexit()
+}
+
+func TestNewClusterForTest_StartFailureLeavesNothing(t *testing.T) {
+	t.Parallel()
+
+	// A binary that never becomes ready: every node launches, then Start times out.
+	pids := filepath.Join(t.TempDir(), "pids")
+	fake := writeFakeScript(t, "[ \"$1\" = --version ] && exit 1\necho $$ >> "+pids+"\nexec sleep 30\n")
+	root := t.TempDir()
+	cfg := DefaultConfig().
+		BinaryPath(fake).
+		TempDirRoot(root).
+		StartTimeout(500 * time.Millisecond).
+		Logger(io.Discard)
+
+	tb := &fatalRecorder{TB: t}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		NewClusterForTest(tb, 3, cfg)
+	}()
+
+	<-done
+
+	require.NotEmpty(t, tb.fatal, "NewClusterForTest did not fail")
+
+	for _, fn := range slices.Backward(tb.cleanups) {
+		fn()
+	}
+
+	assert.Empty(t, tb.errors)
+
+	left, err := filepath.Glob(filepath.Join(root, "embedded-clickhouse-cluster-*"))
+	require.NoError(t, err)
+	assert.Empty(t, left, "temp dirs left after a failed Start")
+
+	data, err := os.ReadFile(pids)
+	require.NoError(t, err)
+
+	launched := strings.Fields(string(data))
+	assert.Len(t, launched, 3)
+
+	for _, pid := range launched {
+		n, err := strconv.Atoi(pid)
+		require.NoError(t, err)
+		assert.False(t, pidAlive(n), "node process %d still running", n)
+	}
+}
+
+func TestCluster_BinaryPath(t *testing.T) {
+	t.Parallel()
+
+	// A binary that never becomes ready, so Start fails after resolving it.
+	fake := writeFakeScript(t, "[ \"$1\" = --version ] && exit 1\nexec sleep 30\n")
+	cl := NewCluster(2, DefaultConfig().
+		BinaryPath(fake).
+		TempDirRoot(t.TempDir()).
+		StartTimeout(500*time.Millisecond).
+		Logger(io.Discard))
+
+	assert.Empty(t, cl.BinaryPath())
+	require.Error(t, cl.Start())
+	assert.Equal(t, fake, cl.BinaryPath())
+}
+
+func TestCluster_RejectsDuplicateReplicaNames(t *testing.T) {
+	t.Parallel()
+
+	// Rejected before any binary download, so this test stays hermetic.
+	cfg := DefaultConfig().ReplicaNamer(func(int) string { return "same" })
+
+	err := NewCluster(3, cfg).Start()
+	assert.ErrorIs(t, err, ErrInvalidReplicaName)
+}
+
+func TestCluster_RejectsInvalidKeeperTimeout(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().KeeperOperationTimeout(time.Minute).KeeperSessionTimeout(time.Second)
+
+	err := NewCluster(3, cfg).Start()
+	assert.ErrorIs(t, err, ErrInvalidKeeperTimeout)
+}
+
+func TestCluster_RejectsInvalidPortRange(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().PortRange(30010, 30000)
+
+	err := NewCluster(3, cfg).Start()
+	assert.ErrorIs(t, err, ErrInvalidPortRange)
+}
+
+func TestCluster_RejectsInvalidExtraArgs(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().ExtraArgs("-C", "/etc/clickhouse-server/config.xml")
+
+	err := NewCluster(3, cfg).Start()
+	assert.ErrorIs(t, err, ErrInvalidExtraArgs)
+}
+
+func TestCluster_DSNs(t *testing.T) {
+	t.Parallel()
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{tcpPort: 19000}, {tcpPort: 19005}}}
+
+	assert.Equal(t, []string{
+		"clickhouse://127.0.0.1:19000/default",
+		"clickhouse://127.0.0.1:19005/default",
+	}, cl.ClusterDSNs())
+	assert.Equal(t,
+		"clickhouse://127.0.0.1:19000,127.0.0.1:19005/default?connection_open_strategy=round_robin",
+		cl.LoadBalancedDSN())
+
+	assert.Nil(t, NewCluster(2).ClusterDSNs())
+	assert.Panics(t, func() { NewCluster(2).LoadBalancedDSN() })
+}
+
+func TestCluster_IdempotentStop(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, NewCluster(3, DefaultConfig().IdempotentStop(true)).Stop())
+}
+
+func TestCluster_CloseIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	var closer io.Closer = NewCluster(3)
+
+	require.NoError(t, closer.Close(), "Close before Start")
+	require.NoError(t, closer.Close(), "second Close")
+}
+
 func TestCluster_ClusterName(t *testing.T) {
 	t.Parallel()
 
@@ -103,6 +270,34 @@ func TestCluster_NodeOutOfRange(t *testing.T) {
 	assert.Panics(t, func() { cl.Node(-1) })
 }
 
+func TestCluster_NodeDB(t *testing.T) {
+	t.Parallel()
+
+	cl := &Cluster{
+		started: true,
+		nodes: []*EmbeddedClickHouse{
+			{started: true, tcpPort: 1},
+			{started: true, tcpPort: 2},
+		},
+	}
+
+	db, err := cl.NodeDB(1)
+	require.NoError(t, err)
+
+	again, err := cl.NodeDB(1)
+	require.NoError(t, err)
+	assert.Same(t, db, again, "NodeDB should cache one pool per node")
+
+	_, err = cl.NodeDB(2)
+	require.ErrorIs(t, err, ErrNodeOutOfRange)
+
+	require.NoError(t, cl.closeNodeDBs())
+	require.ErrorContains(t, db.Ping(), "database is closed")
+
+	_, err = NewCluster(3).NodeDB(0)
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
+
 func TestCluster_DSNBeforeStart(t *testing.T) {
 	t.Parallel()
 
@@ -126,60 +321,71 @@ func TestCluster_ClusterManagedGuard(t *testing.T) {
 	require.ErrorIs(t, node.Stop(), ErrClusterManaged)
 }
 
-func TestAllocateClusterNodePorts(t *testing.T) {
+func TestReserveClusterPorts(t *testing.T) {
 	t.Parallel()
 
-	np, err := allocateClusterNodePorts()
+	ports, release, err := reserveClusterPorts(3, portRange{})
 	require.NoError(t, err)
-	assert.NotZero(t, np.TCP)
-	assert.NotZero(t, np.HTTP)
-	assert.NotZero(t, np.Interserver)
-	assert.NotZero(t, np.Keeper)
-	assert.NotZero(t, np.KeeperRaft)
+	release()
 
-	// All ports should be distinct.
-	ports := []uint32{np.TCP, np.HTTP, np.Interserver, np.Keeper, np.KeeperRaft}
-	seen := make(map[uint32]bool, len(ports))
+	require.Len(t, ports, 3)
 
-	for _, p := range ports {
-		if seen[p] {
-			t.Errorf("duplicate port: %d", p)
-		}
+	// All ports of all nodes should be distinct.
+	seen := make(map[uint32]bool, 3*portsPerClusterNode)
+
+	for i, np := range ports {
+		for _, p := range []uint32{np.TCP, np.HTTP, np.Interserver, np.Keeper, np.KeeperRaft} {
+			assert.NotZero(t, p, "node %d", i)
+
+			if seen[p] {
+				t.Errorf("duplicate port %d (node %d)", p, i)
+			}
 
-		seen[p] = true
+			seen[p] = true
+		}
 	}
 }
 
-// TestAllocateClusterNodePorts_AlwaysDistinct guards against regressing to
-// sequential bind-and-close allocation, which can hand back a just-freed
-// ephemeral port and produce a duplicate within a node's 5 ports. Distinctness
-// is guaranteed by construction (allocatePorts holds every listener open), but
-// allocating concurrently churns the ephemeral range as an extra stress check.
-func TestAllocateClusterNodePorts_AlwaysDistinct(t *testing.T) {
+// TestReserveClusterPorts_AlwaysDistinct guards against regressing to per-node or
+// sequential bind-and-close allocation, which can hand back a just-freed ephemeral port
+// to another node. Distinctness is guaranteed by construction (reservePorts holds every
+// listener open), but reserving concurrently churns the ephemeral range as an extra
+// stress check.
+func TestReserveClusterPorts_AlwaysDistinct(t *testing.T) {
 	t.Parallel()
 
-	const iterations = 200
+	const (
+		iterations = 200
+		workers    = 8 // bounds the open listeners, for low file-descriptor limits
+	)
+
+	sem := make(chan struct{}, workers)
 
 	var wg sync.WaitGroup
 
 	for range iterations {
 		wg.Go(func() {
-			np, err := allocateClusterNodePorts()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ports, release, err := reserveClusterPorts(3, portRange{})
 			if err != nil {
-				t.Errorf("allocate cluster node ports: %v", err)
+				t.Errorf("reserve cluster ports: %v", err)
 
 				return
 			}
+			defer release()
 
-			ports := []uint32{np.TCP, np.HTTP, np.Interserver, np.Keeper, np.KeeperRaft}
-			seen := make(map[uint32]bool, len(ports))
+			seen := make(map[uint32]bool, 3*portsPerClusterNode)
 
-			for _, port := range ports {
-				if seen[port] {
-					t.Errorf("duplicate port %d in %+v", port, np)
-				}
+			for _, np := range ports {
+				for _, port := range []uint32{np.TCP, np.HTTP, np.Interserver, np.Keeper, np.KeeperRaft} {
+					if seen[port] {
+						t.Errorf("duplicate port %d in %+v", port, ports)
+					}
 
-				seen[port] = true
+					seen[port] = true
+				}
 			}
 		})
 	}
@@ -187,6 +393,219 @@ func TestAllocateClusterNodePorts_AlwaysDistinct(t *testing.T) {
 	wg.Wait()
 }
 
+func TestLaunchClusterNodes_StartsEveryNode(t *testing.T) {
+	t.Parallel()
+
+	fake := writeFakeBinary(t, 0)
+	topo := threeNodeTopology()
+
+	nodes, err := launchClusterNodes(context.Background(), DefaultConfig(), fake, topo, io.Discard)
+	require.NoError(t, err)
+	require.Len(t, nodes, len(topo.Nodes))
+
+	for i, node := range nodes {
+		require.NotNil(t, node, "node %d", i)
+		assert.Equal(t, topo.Nodes[i].TCP, node.tcpPort, "node %d: tcp port", i)
+		assert.True(t, node.clusterManaged, "node %d: cluster managed", i)
+
+		<-node.proc.done
+		require.NoError(t, os.RemoveAll(node.tmpDir))
+	}
+}
+
+func TestLaunchClusterNodes_ReportsLowestIndexFailure(t *testing.T) {
+	t.Parallel()
+
+	missing := filepath.Join(t.TempDir(), "no-such-clickhouse")
+
+	nodes, err := launchClusterNodes(context.Background(), DefaultConfig(), missing, threeNodeTopology(), io.Discard)
+
+	var startErr *ClusterStartError
+	require.ErrorAs(t, err, &startErr)
+	assert.Equal(t, 0, startErr.Node)
+	assert.Equal(t, ClusterPhaseProcess, startErr.Phase)
+
+	for i, node := range nodes {
+		assert.Nil(t, node, "node %d should not have launched", i)
+	}
+}
+
+func TestWaitForAllNodesReady_ReportsExitedNode(t *testing.T) {
+	t.Parallel()
+
+	proc, err := startProcess(writeFakeBinary(t, 3), "", nil, cgroupLimits{}, io.Discard, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Port 1 never answers, so only the process exit can end the wait.
+	err = waitForAllNodesReady(ctx, []*EmbeddedClickHouse{{httpPort: 1, tcpPort: 1, proc: proc}}, nil)
+	require.ErrorIs(t, err, ErrServerExited)
+
+	var startErr *ClusterStartError
+	require.ErrorAs(t, err, &startErr)
+	assert.Equal(t, 0, startErr.Node)
+	assert.Equal(t, ClusterPhaseReady, startErr.Phase)
+}
+
+func TestWaitForKeeperQuorum_PollsEveryNode(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+
+	lagging := 2 // node 1 fails its first probes, as if it had not joined yet
+
+	ready := fakeQueryServerWithURL(t, func(w http.ResponseWriter, _ url.Values, _ string) {
+		w.WriteHeader(http.StatusOK)
+	})
+	late := fakeQueryServerWithURL(t, func(w http.ResponseWriter, params url.Values, _ string) {
+		assert.Equal(t, "SELECT 42", params.Get("query"))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if lagging > 0 {
+			lagging--
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, waitForKeeperQuorum(ctx, []uint32{ready, late}, "SELECT 42", 0, nil))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Zero(t, lagging, "returned before the lagging node answered")
+}
+
+func TestWaitForKeeperQuorum_ReportsPendingNodes(t *testing.T) {
+	t.Parallel()
+
+	ready := fakeQueryServerWithURL(t, func(w http.ResponseWriter, _ url.Values, _ string) {
+		w.WriteHeader(http.StatusOK)
+	})
+	down := fakeQueryServerWithURL(t, func(w http.ResponseWriter, _ url.Values, _ string) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := waitForKeeperQuorum(ctx, []uint32{ready, down}, defaultKeeperReadinessQuery, 0, nil)
+	require.ErrorIs(t, err, ErrKeeperNotReady)
+	assert.Contains(t, err.Error(), "nodes [1]")
+
+	var startErr *ClusterStartError
+	require.ErrorAs(t, err, &startErr)
+	assert.Equal(t, ClusterStartError{Node: 1, Phase: ClusterPhaseKeeper, Err: startErr.Err}, *startErr)
+}
+
+func TestPersistentClusterPorts(t *testing.T) {
+	t.Parallel()
+
+	base := filepath.Join(t.TempDir(), "cluster")
+	want := []ClusterNodePorts{
+		{TCP: 1, HTTP: 2, Interserver: 3, Keeper: 4, KeeperRaft: 5},
+		{TCP: 6, HTTP: 7, Interserver: 8, Keeper: 9, KeeperRaft: 10},
+	}
+
+	calls := 0
+	alloc := func() ([]ClusterNodePorts, error) {
+		calls++
+		return want, nil
+	}
+
+	var reused []ClusterNodePorts
+
+	reuse := func(ports []ClusterNodePorts) error {
+		reused = ports
+		return nil
+	}
+
+	got, err := persistentClusterPorts(base, 2, alloc, reuse)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Nil(t, reused, "freshly allocated ports are not reused")
+	assert.FileExists(t, filepath.Join(base, clusterPortsFile))
+
+	// A second Start reuses the recorded ports instead of allocating.
+	got, err = persistentClusterPorts(base, 2, alloc, reuse)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, want, reused)
+	assert.Equal(t, 1, calls)
+
+	// Recorded ports that are no longer free fail the Start.
+	_, err = persistentClusterPorts(base, 2, alloc, func([]ClusterNodePorts) error { return ErrPortInUse })
+	require.ErrorIs(t, err, ErrPortInUse)
+
+	_, err = persistentClusterPorts(base, 3, alloc, reuse)
+	require.ErrorIs(t, err, ErrClusterDataPathMismatch)
+}
+
+func TestCluster_AllocatePorts_RecordedPortTaken(t *testing.T) {
+	t.Parallel()
+
+	ports, release, err := reserveClusterPorts(1, portRange{})
+	require.NoError(t, err)
+
+	release()
+
+	base := t.TempDir()
+	data, err := json.Marshal(clusterPortsState{Nodes: ports})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(base, clusterPortsFile), data, 0o600))
+
+	// Another listener now holds the recorded Keeper port.
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Keeper))
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	claimedPorts.release(flattenClusterPorts(ports)...)
+
+	c := NewCluster(1, DefaultConfig().DataPath(base))
+	_, _, err = c.allocatePorts()
+	require.ErrorIs(t, err, ErrPortInUse)
+	assert.Empty(t, c.claimedPorts)
+}
+
+func TestClusterNodeWorkDir_DataPath(t *testing.T) {
+	t.Parallel()
+
+	base := t.TempDir()
+
+	dir, removeDir, err := clusterNodeWorkDir(DefaultConfig().DataPath(base), 1)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "node-1"), dir)
+
+	// A failed launch must not remove persistent data.
+	removeDir()
+	assert.DirExists(t, dir)
+}
+
+func TestClusterNodeWorkDir_TempDirRoot(t *testing.T) {
+	t.Parallel()
+
+	root := filepath.Join(t.TempDir(), "big-volume")
+
+	dir, removeDir, err := clusterNodeWorkDir(DefaultConfig().TempDirRoot(root), 2)
+	require.NoError(t, err)
+	assert.Equal(t, root, filepath.Dir(dir))
+	assert.Contains(t, filepath.Base(dir), "embedded-clickhouse-cluster-2-")
+
+	removeDir()
+	assert.NoDirExists(t, dir)
+}
+
 // --- Integration tests (skipped in short mode) ---
 
 func TestIntegration_ClusterStartStop(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
@@ -194,9 +613,23 @@ func TestIntegration_ClusterStartStop(t *testing.T) { //nolint:paralleltest // c
 		t.Skip("skipping integration test in short mode")
 	}
 
-	cl := NewCluster(3, DefaultConfig().Logger(io.Discard))
+	events := make(chan ClusterEvent, 9)
+
+	cl := NewCluster(3, DefaultConfig().ClusterEvents(events).Logger(io.Discard))
 	require.NoError(t, cl.Start())
 
+	// Every node reports each bring-up step once, in order.
+	close(events)
+
+	steps := make(map[int][]ClusterEventType)
+	for ev := range events {
+		steps[ev.Node] = append(steps[ev.Node], ev.Type)
+	}
+
+	for i := range 3 {
+		assert.Equal(t, []ClusterEventType{ClusterNodeStarted, ClusterNodeReady, ClusterKeeperQuorum}, steps[i], "node %d", i)
+	}
+
 	// Double-start should fail.
 	require.ErrorIs(t, cl.Start(), ErrClusterAlreadyStarted)
 
@@ -239,16 +672,12 @@ func TestIntegration_ClusterReplication(t *testing.T) { //nolint:paralleltest //
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	db0, err := sql.Open("clickhouse", cl.Node(0).DSN())
+	db0, err := cl.NodeDB(0)
 	require.NoError(t, err)
 
-	defer db0.Close()
-
-	db1, err := sql.Open("clickhouse", cl.Node(1).DSN())
+	db1, err := cl.NodeDB(1)
 	require.NoError(t, err)
 
-	defer db1.Close()
-
 	// Create a ReplicatedMergeTree table ON CLUSTER.
 	_, err = db0.ExecContext(ctx, `
 		CREATE TABLE test_repl ON CLUSTER 'test_cluster' (
@@ -280,6 +709,12 @@ func TestIntegration_ClusterNewClusterForTest(t *testing.T) { //nolint:parallelt
 
 	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard))
 
+	require.NotEmpty(t, cl.BinaryPath())
+
+	for _, node := range cl.Nodes() {
+		assert.Equal(t, cl.BinaryPath(), node.BinaryPath())
+	}
+
 	db, err := sql.Open("clickhouse", cl.DSN())
 	require.NoError(t, err)
 
@@ -290,6 +725,53 @@ func TestIntegration_ClusterNewClusterForTest(t *testing.T) { //nolint:parallelt
 	assert.Equal(t, 2, result)
 }
 
+func TestIntegration_ClusterConcurrentStartsDistinctPorts(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	clusters := []*Cluster{
+		NewCluster(2, DefaultConfig().LowMemory().Logger(io.Discard)),
+		NewCluster(2, DefaultConfig().LowMemory().Logger(io.Discard)),
+	}
+	errs := make([]error, len(clusters))
+
+	var wg sync.WaitGroup
+
+	for i, cl := range clusters {
+		wg.Go(func() { errs[i] = cl.Start() })
+	}
+
+	wg.Wait()
+
+	for i, cl := range clusters {
+		if errs[i] == nil {
+			t.Cleanup(func() { assert.NoError(t, cl.Stop()) })
+		}
+	}
+
+	for i, err := range errs {
+		require.NoError(t, err, "cluster %d", i)
+	}
+
+	seen := make(map[uint32]string)
+
+	for i, cl := range clusters {
+		for j, node := range cl.Nodes() {
+			for _, port := range []uint32{node.tcpPort, node.httpPort, node.interserverPort, node.keeperPort, node.keeperRaftPort} {
+				owner := fmt.Sprintf("cluster %d node %d", i, j)
+				if prev, ok := seen[port]; ok {
+					t.Errorf("port %d used by %s and %s", port, prev, owner)
+				}
+
+				seen[port] = owner
+			}
+		}
+	}
+
+	assert.Len(t, seen, 2*2*portsPerClusterNode)
+}
+
 func TestIntegration_ClusterKeeperMetadata(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
@@ -322,6 +804,97 @@ func TestIntegration_ClusterKeeperMetadata(t *testing.T) { //nolint:paralleltest
 	assert.Positive(t, znodeCount, "expected Keeper znodes for replicated table metadata")
 }
 
+func TestIntegration_ClusterKeeperRoot(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	// ClickHouse refuses a <zookeeper> root that does not exist, so Start succeeding
+	// means it created /clusters/a.
+	cl := NewClusterForTest(t, 3, DefaultConfig().Logger(io.Discard).KeeperRoot("/clusters/a"))
+
+	db, err := sql.Open("clickhouse", cl.DSN())
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE test_keeper_root ON CLUSTER 'test_cluster' (
+			id UInt64
+		) ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/test_keeper_root', '{replica}')
+		ORDER BY id
+	`)
+	require.NoError(t, err)
+
+	// Paths are relative to the root: the table's znodes are under /clusters/a.
+	var znodeCount int
+
+	err = db.QueryRowContext(ctx,
+		"SELECT count() FROM system.zookeeper WHERE path = '/clickhouse/tables/01/test_keeper_root'",
+	).Scan(&znodeCount)
+	require.NoError(t, err)
+	assert.Positive(t, znodeCount, "expected Keeper znodes under the root")
+
+	// Creating the root again, as the next Start would, finds it in place.
+	require.NoError(t, keeperCreatePath(ctx, cl.Node(0).keeperPort, "/clusters/a"))
+}
+
+func TestIntegration_ClusterKeeperStat(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 3, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	statuses, err := cl.KeeperStat(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+
+	modes := make(map[string]int)
+
+	for i, st := range statuses {
+		assert.Equal(t, i, st.Node)
+		assert.Positive(t, st.ZnodeCount, "node %d", i)
+
+		modes[st.Mode]++
+
+		if st.Mode == "leader" {
+			assert.Equal(t, 2, st.Followers, "leader followers")
+			assert.Equal(t, 2, st.SyncedFollowers, "leader synced followers")
+		}
+	}
+
+	assert.Equal(t, map[string]int{"leader": 1, "follower": 2}, modes)
+}
+
+func TestIntegration_ClusterKeeperLeaderFailover(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 3, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	leader, err := cl.KeeperLeader(ctx)
+	require.NoError(t, err)
+
+	// Stop the leader's process; the two survivors keep a quorum and elect a new one.
+	require.NoError(t, stopProcess(cl.Node(leader).proc, 10*time.Second))
+
+	require.Eventually(t, func() bool {
+		next, err := cl.KeeperLeader(ctx)
+		return err == nil && next != leader
+	}, 30*time.Second, 200*time.Millisecond, "no new keeper leader after stopping node %d", leader)
+}
+
 func TestIntegration_ClusterSystemReplicas(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
@@ -476,15 +1049,7 @@ func TestIntegration_ClusterDistributedQuery(t *testing.T) { //nolint:parallelte
 	require.NoError(t, err)
 
 	// Sync all replicas.
-	for ri := 1; ri < 3; ri++ {
-		db, dbErr := sql.Open("clickhouse", cl.Node(ri).DSN())
-		require.NoError(t, dbErr)
-
-		_, syncErr := db.ExecContext(ctx, "SYSTEM SYNC REPLICA test_dist")
-		require.NoError(t, syncErr, "node %d sync", ri)
-
-		db.Close()
-	}
+	require.NoError(t, cl.SystemOnAll(ctx, "SYNC REPLICA test_dist"))
 
 	// clusterAllReplicas reads from every replica: 2 rows × 3 replicas = 6.
 	var total int
@@ -562,3 +1127,264 @@ func TestIntegration_ClusterReplicationToAllNodes(t *testing.T) { //nolint:paral
 		assert.Equal(t, expected, got, "node %d: row data mismatch", ri)
 	}
 }
+
+func TestIntegration_ClusterInterserverCredentials(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().
+		InterserverCredentials("replicator", "secret").
+		Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	db0, err := sql.Open("clickhouse", cl.Node(0).DSN())
+	require.NoError(t, err)
+
+	defer db0.Close()
+
+	db1, err := sql.Open("clickhouse", cl.Node(1).DSN())
+	require.NoError(t, err)
+
+	defer db1.Close()
+
+	_, err = db0.ExecContext(ctx, `
+		CREATE TABLE test_creds ON CLUSTER 'test_cluster' (
+			id UInt64
+		) ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/test_creds', '{replica}')
+		ORDER BY id
+	`)
+	require.NoError(t, err)
+
+	_, err = db0.ExecContext(ctx, "INSERT INTO test_creds (id) VALUES (1), (2), (3)")
+	require.NoError(t, err)
+
+	// Node 1 must fetch the part from node 0 over the authenticated interserver endpoint.
+	_, err = db1.ExecContext(ctx, "SYSTEM SYNC REPLICA test_creds")
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, db1.QueryRowContext(ctx, "SELECT count() FROM test_creds").Scan(&count))
+	assert.Equal(t, 3, count)
+}
+
+func TestIntegration_ClusterReplicatedDatabase(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	db0, err := sql.Open("clickhouse", cl.Node(0).DSN())
+	require.NoError(t, err)
+
+	defer db0.Close()
+
+	db1, err := sql.Open("clickhouse", cl.Node(1).DSN())
+	require.NoError(t, err)
+
+	defer db1.Close()
+
+	_, err = db0.ExecContext(ctx,
+		"CREATE DATABASE repl ON CLUSTER 'test_cluster' ENGINE = Replicated('/clickhouse/databases/repl', '{shard}', '{replica}')")
+	require.NoError(t, err)
+
+	// DDL in a Replicated database is replicated by the database itself, without ON CLUSTER.
+	_, err = db0.ExecContext(ctx, "CREATE TABLE repl.events (id UInt64) ENGINE = ReplicatedMergeTree ORDER BY id")
+	require.NoError(t, err)
+
+	_, err = db0.ExecContext(ctx, "INSERT INTO repl.events (id) VALUES (1), (2)")
+	require.NoError(t, err)
+
+	_, err = db1.ExecContext(ctx, "SYSTEM SYNC DATABASE REPLICA repl")
+	require.NoError(t, err)
+
+	_, err = db1.ExecContext(ctx, "SYSTEM SYNC REPLICA repl.events")
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, db1.QueryRowContext(ctx, "SELECT count() FROM repl.events").Scan(&count))
+	assert.Equal(t, 2, count)
+}
+
+func TestIntegration_ClusterDataPathRestart(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cfg := DefaultConfig().DataPath(t.TempDir()).Logger(io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	cl := NewCluster(2, cfg)
+	require.NoError(t, cl.Start())
+
+	db0, err := sql.Open("clickhouse", cl.Node(0).DSN())
+	require.NoError(t, err)
+
+	_, err = db0.ExecContext(ctx, `CREATE TABLE kept ON CLUSTER 'test_cluster' (id UInt64)
+		ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/kept', '{replica}') ORDER BY id`)
+	require.NoError(t, err)
+
+	_, err = db0.ExecContext(ctx, "INSERT INTO kept VALUES (1), (2), (3)")
+	require.NoError(t, err)
+	db0.Close()
+
+	require.NoError(t, cl.Stop())
+
+	// The restarted cluster reattaches to the same Keeper state and replicated data.
+	cl = NewCluster(2, cfg)
+	require.NoError(t, cl.Start())
+
+	defer func() {
+		require.NoError(t, cl.Stop())
+	}()
+
+	db1, err := sql.Open("clickhouse", cl.Node(1).DSN())
+	require.NoError(t, err)
+
+	defer db1.Close()
+
+	_, err = db1.ExecContext(ctx, "INSERT INTO kept VALUES (4)")
+	require.NoError(t, err)
+
+	_, err = db1.ExecContext(ctx, "SYSTEM SYNC REPLICA kept")
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, db1.QueryRowContext(ctx, "SELECT count() FROM kept").Scan(&count))
+	assert.Equal(t, 4, count)
+}
+
+func TestIntegration_ClusterTopology(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := cl.Topology(ctx)
+	require.NoError(t, err)
+
+	var got []ClusterRow
+
+	for _, row := range rows {
+		if row.Cluster == cl.ClusterName() {
+			got = append(got, row)
+		}
+	}
+
+	require.Len(t, got, 2)
+
+	for i, row := range got {
+		assert.Equal(t, uint32(1), row.ShardNum)
+		assert.Equal(t, uint32(i+1), row.ReplicaNum)
+		assert.Equal(t, cl.Node(i).TCPAddr(), fmt.Sprintf("%s:%d", row.HostName, row.Port))
+	}
+}
+
+func TestIntegration_ClusterWaitForReplicas(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	_, err := cl.Node(0).ExecHTTP(ctx, `CREATE TABLE waited ON CLUSTER 'test_cluster' (id UInt64)
+		ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/waited', '{replica}') ORDER BY id`)
+	require.NoError(t, err)
+
+	require.NoError(t, cl.WaitForReplicas(ctx, "default.waited", 2))
+
+	short, cancelShort := context.WithTimeout(ctx, time.Second)
+	defer cancelShort()
+
+	require.ErrorIs(t, cl.WaitForReplicas(short, "waited", 3), ErrReplicasNotReady)
+}
+
+func TestIntegration_ClusterDefaultReplicaPath(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard).
+		DefaultReplicaPath("/tables/{database}/{table}/{shard}").
+		DefaultReplicaName("{replica}"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	_, err := cl.Node(0).ExecHTTP(ctx, `CREATE TABLE bare ON CLUSTER 'test_cluster' (id UInt64)
+		ENGINE = ReplicatedMergeTree ORDER BY id`)
+	require.NoError(t, err)
+
+	path, err := cl.Node(1).ScalarHTTP(ctx,
+		"SELECT zookeeper_path FROM system.replicas WHERE database = 'default' AND table = 'bare'")
+	require.NoError(t, err)
+	assert.Equal(t, "/tables/default/bare/01", path)
+}
+
+func TestIntegration_ClusterCreateDistributed(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	require.NoError(t, cl.CreateDistributed(ctx, "hits (id UInt64) ORDER BY id", "hits_dist", "id"))
+
+	_, err := cl.Node(0).ExecHTTP(ctx, "INSERT INTO hits_dist SETTINGS insert_distributed_sync = 1 VALUES (1), (2), (3)")
+	require.NoError(t, err)
+
+	_, err = cl.Node(1).ExecHTTP(ctx, "SYSTEM SYNC REPLICA hits")
+	require.NoError(t, err)
+
+	got, err := cl.Node(1).ExecHTTP(ctx, "SELECT count() FROM hits_dist")
+	require.NoError(t, err)
+	assert.Equal(t, "3\n", got)
+}
+
+func TestIntegration_ClusterLoadBalancedDSN(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 2, DefaultConfig().Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := sql.Open("clickhouse", cl.LoadBalancedDSN())
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	// No idle connections: every query dials, and round_robin moves to the next node.
+	db.SetMaxIdleConns(0)
+
+	seen := make(map[uint16]bool)
+
+	for range 4 {
+		var port uint16
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT tcpPort()").Scan(&port))
+
+		seen[port] = true
+	}
+
+	assert.Len(t, seen, 2, "queries should reach both nodes")
+}
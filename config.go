@@ -1,10 +1,14 @@
 package embeddedclickhouse
 
 import (
+	"context"
 	"io"
 	"maps"
 	"os"
+	"slices"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ClickHouseVersion represents a ClickHouse server version string.
@@ -27,23 +31,84 @@ const DefaultVersion = V26_3
 
 // Config holds configuration for an embedded ClickHouse server.
 type Config struct {
-	version              ClickHouseVersion
-	tcpPort              uint32
-	httpPort             uint32
-	cachePath            string
-	dataPath             string
-	binaryPath           string
-	binaryRepositoryURL  string
-	customArchivePath    string
-	customArchiveURL     string
-	sha256               string
-	sha512hash           string
-	allowMissingChecksum bool
-	startTimeout         time.Duration
-	startTimeoutSet      bool
-	stopTimeout          time.Duration
-	logger               io.Writer
-	settings             map[string]string
+	version                ClickHouseVersion
+	tcpPort                uint32
+	httpPort               uint32
+	grpc                   bool
+	grpcPort               uint32
+	extraArgs              []string
+	defaultReplicaPath     string
+	defaultReplicaName     string
+	healthPollBackoff      time.Duration
+	readinessProbe         func(ctx context.Context, baseURL string) bool
+	allowTelemetry         bool
+	ephemeral              bool
+	portRange              portRange
+	cgroup                 cgroupLimits
+	cachePath              string
+	sharedCachePath        string
+	dataPath               string
+	templateDataPath       string
+	binaryPath             string
+	binaryRepositoryURL    string
+	assetNameFunc          func(version, goos, goarch string) (string, AssetType)
+	customArchivePath      string
+	customArchiveURL       string
+	sha256                 string
+	sha512hash             string
+	allowMissingChecksum   bool
+	requireChecksum        bool
+	useSystemBinary        bool
+	skipVersionCheck       bool
+	maxBinarySize          int64
+	startTimeout           time.Duration
+	startTimeoutSet        bool
+	stopTimeout            time.Duration
+	drainOnStop            bool
+	flushOnStop            bool
+	idempotentStop         bool
+	lowMemory              bool
+	maxMemoryPerNode       int64
+	monitorInterval        time.Duration
+	linuxAsset             AssetType
+	verifyBinaryRuns       bool
+	tempDirRoot            string
+	sharedName             string
+	tracer                 trace.Tracer
+	onTiming               func(phase string, d time.Duration)
+	clusterEvents          chan<- ClusterEvent
+	logger                 io.Writer
+	settings               map[string]string
+	profile                map[string]string
+	macros                 map[string]string
+	replicaNamer           func(index int) string
+	defaultDatabaseEngine  string
+	accessEntities         []string
+	noAccessManagement     bool
+	queryLog               bool
+	httpCompression        bool
+	quorumInserts          bool
+	quorumInsertTimeout    time.Duration
+	udfConfig              []byte
+	userScriptsPath        string
+	dictionaries           []byte
+	usersConfig            []byte
+	formatSchemas          map[string][]byte
+	userFilesPath          string
+	interserverUser        string
+	interserverPassword    string
+	interserverHost        string
+	keeperSessionTimeout   time.Duration
+	keeperOperationTimeout time.Duration
+	keeperRoot             string
+	keeperReadinessQuery   string
+	configTemplate         string
+
+	// resolvedBinaryPath is set by the ForTest helpers from the Prepare memo; when
+	// non-empty ensureBinary returns it without touching the filesystem.
+	resolvedBinaryPath string
+	// resolvedDownloaded records whether the Prepare memo downloaded resolvedBinaryPath.
+	resolvedDownloaded bool
 }
 
 // DefaultConfig returns a Config with sensible defaults.
@@ -56,7 +121,63 @@ func DefaultConfig() Config {
 	}
 }
 
-// Version sets the ClickHouse version to use.
+// Clone returns a deep copy of c: its maps (ServerSettings, ProfileSettings, Macros, FormatSchemas) and
+// slices (UDFConfig, Dictionaries, UsersConfig, AccessEntities, ExtraArgs) are copied rather than shared.
+// Builders that take a map or slice already copy it, so configs derived from a common base never share mutable
+// state; Clone is for code that keeps a Config around and wants an explicit snapshot.
+// Funcs, the Logger, the Tracer and the ClusterEvents channel are shared, as references.
+func (c Config) Clone() Config {
+	c.settings = maps.Clone(c.settings)
+	c.profile = maps.Clone(c.profile)
+	c.macros = maps.Clone(c.macros)
+	c.udfConfig = slices.Clone(c.udfConfig)
+	c.dictionaries = slices.Clone(c.dictionaries)
+	c.usersConfig = slices.Clone(c.usersConfig)
+	c.formatSchemas = cloneFiles(c.formatSchemas)
+	c.accessEntities = slices.Clone(c.accessEntities)
+	c.extraArgs = slices.Clone(c.extraArgs)
+
+	return c
+}
+
+// Environment variables read by FromEnv.
+const (
+	EnvVersion   = "EMBEDDED_CLICKHOUSE_VERSION"
+	EnvCachePath = "EMBEDDED_CLICKHOUSE_CACHE"
+	EnvBinary    = "EMBEDDED_CLICKHOUSE_BINARY"
+	EnvRepoURL   = "EMBEDDED_CLICKHOUSE_REPO_URL"
+)
+
+// FromEnv overrides Version, CachePath, BinaryPath, and BinaryRepositoryURL from
+// EMBEDDED_CLICKHOUSE_VERSION, EMBEDDED_CLICKHOUSE_CACHE, EMBEDDED_CLICKHOUSE_BINARY, and
+// EMBEDDED_CLICKHOUSE_REPO_URL. Unset or empty variables keep the current values, so
+// call it last to let CI jobs override what the code configures:
+//
+//	cfg := DefaultConfig().Version(V25_8).FromEnv()
+func (c Config) FromEnv() Config {
+	if v := os.Getenv(EnvVersion); v != "" {
+		c = c.Version(ClickHouseVersion(v))
+	}
+
+	if v := os.Getenv(EnvCachePath); v != "" {
+		c = c.CachePath(v)
+	}
+
+	if v := os.Getenv(EnvBinary); v != "" {
+		c = c.BinaryPath(v)
+	}
+
+	if v := os.Getenv(EnvRepoURL); v != "" {
+		c = c.BinaryRepositoryURL(v)
+	}
+
+	return c
+}
+
+// Version sets the ClickHouse version to use. Any release works, not only the
+// constants: pass the tag without its "v", e.g. ClickHouseVersion("24.8.4.13-lts").
+// Start returns ErrInvalidVersion for an empty or malformed version before resolving the
+// binary, whatever its source (download, BinaryPath, custom archive or system binary).
 func (c Config) Version(v ClickHouseVersion) Config {
 	c.version = v
 	return c
@@ -78,20 +199,85 @@ func (c Config) HTTPPort(port uint32) Config {
 	return c
 }
 
+// GRPCPort enables the ClickHouse gRPC interface on port, for testing gRPC clients.
+// 0 means auto-allocate. The interface is off unless this is called; once Start returns,
+// GRPCAddr reports the address. RenderServerConfig includes the gRPC section only for an
+// explicit port, since an auto-allocated one is not known before Start. Single-node
+// only: Cluster.Start returns ErrClusterUnsupportedOption if this is set.
+func (c Config) GRPCPort(port uint32) Config {
+	c.grpc = true
+	c.grpcPort = port
+
+	return c
+}
+
+// PortRange makes auto-allocated ports come from [low, high] (inclusive) instead of the
+// OS ephemeral range, so firewall rules can be opened ahead of time and failing runs
+// reproduced. Ports are probed in order, continuing after the last one handed out, and
+// explicit TCPPort/HTTPPort/GRPCPort values still win. A cluster needs five ports per node.
+// Start returns ErrInvalidPortRange for an invalid range and ErrNoFreePort when every
+// port in it is taken.
+func (c Config) PortRange(low, high uint32) Config {
+	c.portRange = portRange{min: low, max: high}
+	return c
+}
+
+// Cgroup runs the server in a new cgroup v2 that limits it to memBytes of memory (swap
+// disabled) and cpus CPUs of time, e.g. 1.5 for 150ms per 100ms, to reproduce a
+// resource-constrained production host. Unlike max_server_memory_usage, the kernel
+// enforces the limit on everything the server uses, page cache included, and the OOM
+// killer ends the server when it is exceeded. Zero leaves a resource unlimited. The
+// cgroup is created next to the test process's own cgroup and removed once the server
+// exits, so the process needs write access there, and the parent cgroup must already
+// delegate the memory and cpu controllers (as under a systemd user manager with
+// Delegate=yes); Start does not enable them itself. Start returns ErrCgroupUnavailable
+// when that is not the case or the platform is not Linux, ErrInvalidCgroupLimits for
+// negative limits, and ErrCgroupWithShared with Shared. Each cluster node gets its own
+// cgroup.
+func (c Config) Cgroup(memBytes int64, cpus float64) Config {
+	c.cgroup = cgroupLimits{memBytes: memBytes, cpus: cpus}
+	return c
+}
+
 // CachePath overrides the directory used to cache downloaded binaries.
 func (c Config) CachePath(path string) Config {
 	c.cachePath = path
 	return c
 }
 
+// SharedCachePath sets a read-only cache checked before CachePath, such as a pre-warmed
+// volume mounted into many CI jobs. A binary found there is used as is; on a miss the
+// writable CachePath is checked next and downloads go there. The package never writes
+// to the shared path, and it uses the same layout as CachePath, so a directory populated
+// through CachePath can be mounted as a shared cache later.
+func (c Config) SharedCachePath(path string) Config {
+	c.sharedCachePath = path
+	return c
+}
+
 // DataPath sets a persistent data directory that survives Stop.
-// Single-node only: cluster nodes always use per-node temp directories, so
-// Cluster.Start returns ErrClusterUnsupportedOption if this is set.
+// In cluster mode it is a base directory: each node gets its own node-<i> subdirectory
+// and the cluster's ports are recorded alongside, so a restarted cluster reattaches to
+// its Keeper logs and replicated data. Start fails with ErrPortInUse if one of the
+// recorded ports has been taken since.
 func (c Config) DataPath(path string) Config {
 	c.dataPath = path
 	return c
 }
 
+// TemplateDataPath seeds each fresh server from a "golden" data directory, the
+// embedded-postgres template pattern. Prepare the template once: start a server with
+// DataPath(path), create the schema and seed data, then Stop it. Every server started
+// with TemplateDataPath(path) then gets an isolated clone of that data in its own temp
+// directory. Files are reflinked on filesystems that support it (btrfs, XFS, APFS) and
+// copied otherwise. Single-node only, and mutually exclusive with DataPath: Start returns
+// ErrTemplateWithDataPath if both are set, and Cluster.Start returns
+// ErrClusterUnsupportedOption.
+func (c Config) TemplateDataPath(path string) Config {
+	c.templateDataPath = path
+	return c
+}
+
 // BinaryPath uses a pre-existing ClickHouse binary, skipping download.
 func (c Config) BinaryPath(path string) Config {
 	c.binaryPath = path
@@ -104,6 +290,55 @@ func (c Config) BinaryRepositoryURL(url string) Config {
 	return c
 }
 
+// AssetNameFunc overrides how the release asset is named for a version and platform,
+// for mirrors that repackage ClickHouse under their own naming convention. fn receives
+// the full version (e.g. "25.3.14.14-lts") and runtime.GOOS/GOARCH and returns the file
+// name appended to the repository URL together with its AssetType. Returning an empty
+// name reports the platform as unsupported. Default: the upstream release names.
+func (c Config) AssetNameFunc(fn func(version, goos, goarch string) (filename string, typ AssetType)) Config {
+	c.assetNameFunc = fn
+	return c
+}
+
+// Ephemeral trades crash-safety for speed in tests that need no durable storage. The
+// server's working directory goes to a memory-backed location when one is available
+// (/dev/shm on Linux, if it has at least 1 GiB free; an explicit TempDirRoot wins), and
+// metadata fsyncs are turned off (fsync_metadata=0 in the default profile; Keeper's
+// force_sync in a Cluster). Data may be lost if the host crashes, and a large dataset
+// uses RAM. Ephemeral cannot be combined with DataPath: Start and Cluster.Start return
+// ErrEphemeralWithDataPath.
+func (c Config) Ephemeral(enable bool) Config {
+	c.ephemeral = enable
+	return c
+}
+
+// TempDirRoot sets the directory under which the server, or each cluster node, gets its
+// temporary working directory when no DataPath is set, instead of os.TempDir ($TMPDIR).
+// Use it when the default temp directory is a small tmpfs that cannot hold the data. The
+// directory is created if missing; the per-run directories are still removed by Stop.
+func (c Config) TempDirRoot(path string) Config {
+	c.tempDirRoot = path
+	return c
+}
+
+// VerifyBinaryRuns makes binary resolution run `clickhouse --version` (bounded by a short
+// timeout) before returning the path, so a truncated extract or a binary the host cannot
+// run (e.g. an incompatible glibc) fails with ErrBinaryNotExecutable instead of at server
+// start. Off by default to keep cold starts fast.
+func (c Config) VerifyBinaryRuns(verify bool) Config {
+	c.verifyBinaryRuns = verify
+	return c
+}
+
+// LinuxAsset selects which upstream release asset is downloaded on Linux: AssetArchive
+// (the default) fetches the clickhouse-common-static .tgz and extracts usr/bin/clickhouse;
+// AssetRawBinary fetches the single clickhouse-linux-amd64/aarch64 executable and skips
+// extraction, as on macOS. Both cache to the same path. Ignored with AssetNameFunc.
+func (c Config) LinuxAsset(typ AssetType) Config {
+	c.linuxAsset = typ
+	return c
+}
+
 // CustomArchivePath sets a local .tar.gz archive containing a ClickHouse binary.
 // The binary is extracted and cached. This bypasses the standard download logic.
 func (c Config) CustomArchivePath(path string) Config {
@@ -145,6 +380,44 @@ func (c Config) AllowMissingChecksum(allow bool) Config {
 	return c
 }
 
+// RequireChecksum makes every download fail rather than run an unverified binary: a
+// missing (non-200) .sha512 fails with ErrSHA512NotFound (also matching
+// ErrSHA512Unavailable) for raw binaries (the macOS path) as well as archives,
+// overriding AllowMissingChecksum. A custom archive without SHA256 or SHA512 fails with
+// ErrChecksumRequired, even when its binary is already in the cache. The default (false)
+// keeps the lenient raw-binary behavior. A BinaryPath, or a release binary already in
+// the cache, is used as is.
+func (c Config) RequireChecksum(require bool) Config {
+	c.requireChecksum = require
+	return c
+}
+
+// UseSystemBinary makes the standard download path first look for a clickhouse on PATH
+// and use it when `clickhouse --version` reports the configured Version, so local runs
+// on a machine with ClickHouse installed download nothing. A missing or mismatched
+// binary falls back to the cache and download. BinaryPath and custom archives take
+// precedence. Pinning Version keeps CI deterministic: a runner with some other
+// release installed still downloads the pinned one.
+func (c Config) UseSystemBinary(use bool) Config {
+	c.useSystemBinary = use
+	return c
+}
+
+// SkipVersionCheck makes UseSystemBinary accept the clickhouse on PATH whatever its
+// version. It has no effect without UseSystemBinary.
+func (c Config) SkipVersionCheck(skip bool) Config {
+	c.skipVersionCheck = skip
+	return c
+}
+
+// MaxBinarySize caps the size of the binary extracted from an archive, so a corrupt or
+// malicious archive cannot fill the disk; larger entries fail with ErrBinaryTooLarge.
+// Default is 4 GiB; a value <= 0 restores the default.
+func (c Config) MaxBinarySize(bytes int64) Config {
+	c.maxBinarySize = bytes
+	return c
+}
+
 // StartTimeout sets the maximum time to wait for the server to become ready.
 func (c Config) StartTimeout(d time.Duration) Config {
 	c.startTimeout = d
@@ -153,21 +426,422 @@ func (c Config) StartTimeout(d time.Duration) Config {
 	return c
 }
 
+// HealthPollBackoff makes the readiness polls of Start, ReloadConfig, and the restarts of
+// Snapshot and Restore back off exponentially, doubling the interval after every
+// unsuccessful poll up to maxInterval, instead of polling at a fixed rate (every 100ms for
+// /ping and the native handshake, 500ms for Keeper quorum). It cuts the requests of dozens
+// of servers starting at once, at the cost of noticing readiness up to maxInterval later.
+// The first poll is always immediate, and every interval is randomized by up to 20% either
+// way whether or not this is set. 0 (the default) disables the backoff.
+func (c Config) HealthPollBackoff(maxInterval time.Duration) Config {
+	c.healthPollBackoff = maxInterval
+	return c
+}
+
+// ReadinessProbe replaces the HTTP readiness check, a GET /ping expecting HTTP 200, e.g.
+// for a config that moves /ping or to gate on a query such as SELECT 1. Start polls probe
+// with the server's base URL ("http://127.0.0.1:<port>") until it returns true; each call
+// gets a context bounded by 2s. The native-protocol handshake still follows. The probe
+// also serves Monitor, ReloadConfig and, in a Cluster, every node.
+func (c Config) ReadinessProbe(probe func(ctx context.Context, baseURL string) bool) Config {
+	c.readinessProbe = probe
+	return c
+}
+
 // StopTimeout sets the maximum time to wait for the server to shut down gracefully.
 func (c Config) StopTimeout(d time.Duration) Config {
 	c.stopTimeout = d
 	return c
 }
 
+// MonitorInterval sets how often Monitor pings the server. Default is 1 second; a value
+// <= 0 restores the default.
+func (c Config) MonitorInterval(d time.Duration) Config {
+	c.monitorInterval = d
+	return c
+}
+
+// DrainOnStop makes Stop wait for pending mutations (system.mutations) to finish and
+// then issue SYSTEM STOP MERGES before sending SIGTERM, so state persisted under
+// DataPath is deterministic. The drain gets its own StopTimeout, on top of the one for
+// the SIGTERM wait, so Stop can take up to twice StopTimeout (three times with
+// FlushOnStop). If mutations are still pending when it runs out, the server is stopped
+// anyway and Stop returns ErrDrainTimeout.
+func (c Config) DrainOnStop(enable bool) Config {
+	c.drainOnStop = enable
+	return c
+}
+
+// FlushOnStop makes Stop wait for running inserts to finish, then flush the asynchronous
+// insert queue and the system log tables (SYSTEM FLUSH LOGS) before sending SIGTERM, so
+// rows written just before Stop survive a restart on the same DataPath. The wait is
+// bounded by the stop timeout; if inserts are still running the server is stopped anyway
+// and Stop returns ErrFlushTimeout. With DrainOnStop the flush runs first, so mutations
+// see the flushed rows. The flush, the drain and the SIGTERM wait each get their own
+// stop timeout, so Stop can take up to three times StopTimeout with both enabled.
+func (c Config) FlushOnStop(enable bool) Config {
+	c.flushOnStop = enable
+	return c
+}
+
+// IdempotentStop makes Stop return nil instead of ErrServerNotStarted (or
+// ErrClusterNotStarted) when the server or cluster is not running, so deferred and
+// repeated Stops need no error filtering. Close always behaves this way.
+func (c Config) IdempotentStop(enable bool) Config {
+	c.idempotentStop = enable
+	return c
+}
+
+// Shared lets several test binaries (e.g. the packages of one go test ./... run) use a
+// single server or cluster. Start attaches to the instance advertised under name in a
+// metadata file in os.TempDir (its ports, binary and cluster name), or starts one and
+// advertises it when none is running. Handles are reference-counted across processes:
+// Stop detaches, and the last Stop shuts the instance down. The instance outlives the
+// binary that started it, so its output goes to a name.log file next to the metadata
+// instead of Logger, and Snapshot/Restore return ErrSharedInstance. A binary killed
+// before Stop leaks its reference; the instance then keeps running until stopped by hand.
+func (c Config) Shared(name string) Config {
+	c.sharedName = name
+	return c
+}
+
+// Tracer enables OpenTelemetry tracing of Start and binary resolution. Each Start (and
+// each Prepare resolution) becomes a root span with children for ensureBinary,
+// downloadFile, extract, startProcess and waitForReady, carrying the version, byte
+// counts and ports as attributes, which shows where cold-cache startup time goes.
+// The default (nil) emits nothing.
+func (c Config) Tracer(t trace.Tracer) Config {
+	c.tracer = t
+	return c
+}
+
+// OnTiming registers a callback that receives the duration of each startup phase, a
+// lighter alternative to Tracer for spotting regressions between ClickHouse versions.
+// A server reports "download" and "extract" (cold cache only), "config",
+// "process-start" and "wait-ready". A cluster reports "download" and "extract", then
+// per node "node-<i>/config", "node-<i>/process-start" and "node-<i>/wait-ready", and in
+// aggregate "launch" (every node's config and process start, wall clock), "wait-ready"
+// and "keeper-quorum". Calls are serialized, and phases are reported even when they fail.
+func (c Config) OnTiming(fn func(phase string, d time.Duration)) Config {
+	c.onTiming = fn
+	return c
+}
+
+// ClusterEvents makes Cluster.Start report bring-up progress on ch, e.g. for a progress
+// display: ClusterNodeStarted and ClusterNodeReady for every node, then
+// ClusterKeeperQuorum as each node joins the Keeper ensemble. Start still blocks until
+// the cluster is ready, but never on ch: an event ch has no room for is dropped, so read
+// ch from another goroutine or make it large enough for three events per node. The
+// channel is never closed. Only used by Cluster.
+func (c Config) ClusterEvents(ch chan<- ClusterEvent) Config {
+	c.clusterEvents = ch
+	return c
+}
+
 // Logger sets the writer for server stdout/stderr output.
 func (c Config) Logger(w io.Writer) Config {
 	c.logger = w
 	return c
 }
 
-// Settings sets arbitrary ClickHouse server settings.
+// Macros adds entries to the server's <macros> section, for ReplicatedMergeTree paths
+// and ON CLUSTER DDL that reference custom macros such as {layer}. Keys must match
+// [a-zA-Z][a-zA-Z0-9_]*. In a cluster these are merged into every node's macros and may
+// override the built-in {shard} and {cluster}, but {replica} is always set per node.
 // The provided map is copied; subsequent caller mutations do not affect the Config.
-func (c Config) Settings(s map[string]string) Config {
+func (c Config) Macros(m map[string]string) Config {
+	macros := make(map[string]string, len(m))
+	maps.Copy(macros, m)
+
+	c.macros = macros
+
+	return c
+}
+
+// UDFConfig sets an executable user-defined function definition file (an XML
+// <functions> document, see user_defined_executable_functions_config). It is written
+// next to the generated server config and referenced from it. Use os.ReadFile to load
+// an existing definition file. SQL UDFs (CREATE FUNCTION) need no configuration.
+func (c Config) UDFConfig(definition []byte) Config {
+	c.udfConfig = slices.Clone(definition)
+	return c
+}
+
+// UserScriptsPath sets the directory holding the scripts run by executable UDFs
+// (user_scripts_path). Defaults to an empty user_scripts directory in the server's temp dir.
+func (c Config) UserScriptsPath(path string) Config {
+	c.userScriptsPath = path
+	return c
+}
+
+// Dictionaries sets external dictionary definitions (an XML <dictionaries> document,
+// see dictionaries_config). It is written to dictionaries.xml next to the generated
+// server config and referenced from it, so dictGet() works against loaded dictionaries.
+// File sources should use absolute paths, typically inside UserFilesPath.
+func (c Config) Dictionaries(definition []byte) Config {
+	c.dictionaries = slices.Clone(definition)
+	return c
+}
+
+// UsersConfig replaces the generated default user, default profile and default quota
+// with a users config file (an XML <clickhouse> document with <users>, <profiles> and
+// <quotas>, see users_config), for RBAC tests that need several users, profiles and
+// quotas. It is written to users.xml next to the generated server config and referenced
+// from it; use os.ReadFile to load an existing file. Start fails with
+// ErrInvalidUsersConfig if it is not well-formed XML.
+//
+// The file must keep a password-less default user allowed from localhost, which Start
+// and the query helpers connect as. The settings the generated config puts in the default
+// profile (ProfileSettings and those implied by other options) are written to a users.d
+// fragment, so they still apply, overriding the file's own; AccessManagement has no
+// effect, since the file defines the default user.
+func (c Config) UsersConfig(definition []byte) Config {
+	c.usersConfig = slices.Clone(definition)
+	return c
+}
+
+// FormatSchemas seeds the server's format_schema_path with schema files, keyed by their
+// path relative to it, e.g. {"message.proto": ...}. They are written before Start, so
+// FORMAT Protobuf or CapnProto with SETTINGS format_schema = 'message:Msg' finds them.
+// Names must be local paths; Start fails on absolute ones or ones escaping the directory.
+func (c Config) FormatSchemas(files map[string][]byte) Config {
+	c.formatSchemas = cloneFiles(files)
+	return c
+}
+
+// UserFilesPath sets the user_files_path directory, which file() table functions,
+// File tables and dictionary file sources read from. Seed it with fixture files before
+// Start. Defaults to an empty user_files directory in the server's temp dir.
+func (c Config) UserFilesPath(path string) Config {
+	c.userFilesPath = path
+	return c
+}
+
+// EnableQueryLog makes the server record every query in system.query_log, flushed every
+// 100ms instead of the default 7.5s. Call FlushLogs before reading the table to make
+// rows from the queries just issued visible without racing the flush.
+func (c Config) EnableQueryLog(enable bool) Config {
+	c.queryLog = enable
+	return c
+}
+
+// EnableHTTPCompression sets enable_http_compression in the default profile, so the HTTP
+// interface compresses responses for clients that send Accept-Encoding (gzip, deflate,
+// br, zstd, lz4, ...). ExecHTTP and the helpers built on it request gzip, so with this
+// set they exercise the compressed path too.
+func (c Config) EnableHTTPCompression(enable bool) Config {
+	c.httpCompression = enable
+	return c
+}
+
+// QuorumInserts makes the default profile require an insert into a replicated table to be
+// acknowledged by a majority of the replicas (insert_quorum = 'auto') before it returns,
+// and SELECTs to see only quorum-written data (select_sequential_consistency = 1, with
+// insert_quorum_parallel = 0, which it needs). An insert that cannot reach the quorum
+// within timeout fails; zero keeps the server's default of ten minutes, too long for most
+// tests. It is meant for clusters, to test data-loss semantics under replica failure:
+//
+//	cl := embeddedclickhouse.NewClusterForTest(t, 3, embeddedclickhouse.DefaultConfig().
+//		QuorumInserts(5 * time.Second))
+//
+// Inserts into non-replicated tables, and any on a single-node server, are unaffected.
+// ProfileSettings override the individual settings, and Cluster.SetProfileSetting changes
+// them at runtime.
+func (c Config) QuorumInserts(timeout time.Duration) Config {
+	c.quorumInserts = true
+	c.quorumInsertTimeout = timeout
+
+	return c
+}
+
+// AllowTelemetry controls whether the server may report telemetry. By default the
+// generated config turns off send_crash_reports, so a crashing test server never
+// contacts ClickHouse's crash reporting endpoint; ClickHouse has no other usage
+// reporting to disable. Pass true to leave crash reporting at the server's default.
+func (c Config) AllowTelemetry(allow bool) Config {
+	c.allowTelemetry = allow
+	return c
+}
+
+// AccessEntities sets access-control DDL statements (CREATE ROLE, CREATE USER, GRANT,
+// CREATE ROW POLICY, ...) that Start runs in order as the default user once the server
+// is ready, so authorization tests see a deterministic set of users, roles and grants.
+// In a Cluster they run on every node. Entities are stored in the data directory, so
+// with DataPath or TemplateDataPath prefer the IF NOT EXISTS / OR REPLACE forms.
+func (c Config) AccessEntities(statements []string) Config {
+	c.accessEntities = slices.Clone(statements)
+	return c
+}
+
+// AccessManagement controls access_management for the default user, which the generated
+// config enables so tests can create users, roles and grants with SQL. Pass false for a
+// locked-down server on which the default user's CREATE USER, GRANT and the like fail
+// with ACCESS_DENIED, for negative authorization tests. AccessEntities need it enabled:
+// Start returns ErrAccessManagementDisabled if both are set. Not applied to a
+// ConfigTemplate, which can reference it as .AccessManagement.
+func (c Config) AccessManagement(enable bool) Config {
+	c.noAccessManagement = !enable
+	return c
+}
+
+// ExtraArgs appends args to the server command line, after the config file flag, for
+// options the generated config cannot express. Config overrides go after a "--", e.g.
+// ExtraArgs("--", "--logger.level=trace"). Each call replaces the previous args. Start
+// returns ErrInvalidExtraArgs if args repeat the config file flag; other flags are
+// passed through unchecked. In a Cluster they apply to every node.
+func (c Config) ExtraArgs(args ...string) Config {
+	c.extraArgs = slices.Clone(args)
+	return c
+}
+
+// DefaultDatabaseEngine sets the engine used by CREATE DATABASE statements that omit
+// ENGINE (the default_database_engine profile setting), e.g. "Atomic", "Ordinary" or
+// "Replicated". Choosing "Ordinary" also allows that deprecated engine. Replicated
+// databases are always allowed but need Keeper, so they only work in a Cluster.
+func (c Config) DefaultDatabaseEngine(engine string) Config {
+	c.defaultDatabaseEngine = engine
+	return c
+}
+
+// ReplicaNamer sets the function that computes each cluster node's {replica} macro from
+// its 0-based index, e.g. to reproduce the replica names of an existing production
+// Keeper layout. The default yields replica_01, replica_02, and so on. Names must be
+// non-empty and unique, or Cluster.Start returns ErrInvalidReplicaName. Only used by Cluster.
+func (c Config) ReplicaNamer(fn func(index int) string) Config {
+	c.replicaNamer = fn
+	return c
+}
+
+// DefaultReplicaPath sets the server-level default_replica_path, the Keeper path pattern
+// ReplicatedMergeTree tables use when the engine is declared without arguments, e.g.
+// "/clickhouse/tables/{database}/{table}/{shard}". Together with DefaultReplicaName it
+// lets production DDL such as CREATE TABLE ... ON CLUSTER ... ENGINE =
+// ReplicatedMergeTree ORDER BY id run unchanged. Unset, ClickHouse's own default
+// "/clickhouse/tables/{uuid}/{shard}" applies. A default_replica_path key in
+// ServerSettings wins. Only used by Cluster.
+func (c Config) DefaultReplicaPath(pattern string) Config {
+	c.defaultReplicaPath = pattern
+	return c
+}
+
+// DefaultReplicaName sets the server-level default_replica_name, the replica name pattern
+// for ReplicatedMergeTree tables declared without arguments (ClickHouse's default is
+// "{replica}", the name from ReplicaNamer). A default_replica_name key in ServerSettings
+// wins. Only used by Cluster.
+func (c Config) DefaultReplicaName(pattern string) Config {
+	c.defaultReplicaName = pattern
+	return c
+}
+
+// InterserverCredentials makes cluster replicas authenticate to each other's interserver
+// HTTP endpoint (used to fetch parts during replication) with the given user and password,
+// mirroring a secured production cluster. Every node gets the same
+// <interserver_http_credentials> block. Only used by Cluster; an empty user disables it.
+func (c Config) InterserverCredentials(user, password string) Config {
+	c.interserverUser = user
+	c.interserverPassword = password
+
+	return c
+}
+
+// InterserverHost sets the <interserver_http_host> each cluster node advertises to its
+// replicas as the address to fetch parts from (default 127.0.0.1). Set it to a name or
+// address other machines can reach when replicas run on different hosts. The nodes still
+// listen on loopback only, so the host must forward to them. Only used by Cluster.
+func (c Config) InterserverHost(host string) Config {
+	c.interserverHost = host
+	return c
+}
+
+// KeeperSessionTimeout sets the embedded Keeper's session_timeout_ms (default 30s). A
+// replica whose Keeper session expires goes read-only until it reconnects, so a shorter
+// timeout detects a killed or partitioned node sooner: SYSTEM SYNC REPLICA on it then
+// fails fast instead of waiting, while a longer one rides out simulated slow networks.
+// Must be between 100ms and 10m. Only used by Cluster.
+func (c Config) KeeperSessionTimeout(d time.Duration) Config {
+	c.keeperSessionTimeout = d
+	return c
+}
+
+// KeeperOperationTimeout sets the embedded Keeper's operation_timeout_ms (default 10s),
+// the limit on a single Keeper request. SYSTEM SYNC REPLICA and other replication
+// commands fail with a Keeper timeout once a request exceeds it. Must be between 100ms
+// and 10m and not exceed the session timeout. Only used by Cluster.
+func (c Config) KeeperOperationTimeout(d time.Duration) Config {
+	c.keeperOperationTimeout = d
+	return c
+}
+
+// KeeperRoot sets the <root> of every node's <zookeeper> section, a chroot under which the
+// cluster keeps all its Keeper metadata (replicated table paths, DDL queue, Replicated
+// databases), so several clusters sharing an ensemble, or one test reusing paths across
+// clusters, cannot collide. Cluster.Start creates the znode and its parents. Must be an
+// absolute path such as /clusters/a. Only used by Cluster; empty (the default) uses the
+// ensemble root.
+func (c Config) KeeperRoot(path string) Config {
+	c.keeperRoot = path
+	return c
+}
+
+// KeeperReadinessQuery replaces the query Cluster.Start polls on every node before
+// returning; a node counts as joined once the query succeeds (HTTP 200). The default,
+// SELECT 1 FROM system.zookeeper WHERE path = '/' LIMIT 1, succeeds once the node's
+// Keeper session can read the root znode. Use it for a stricter check, e.g. a throwIf
+// over system.zookeeper_connection. Only used by Cluster.
+func (c Config) KeeperReadinessQuery(query string) Config {
+	c.keeperReadinessQuery = query
+	return c
+}
+
+// ConfigTemplate replaces the built-in server config.xml with a text/template, for nested
+// blocks that flat ServerSettings cannot express. Start still allocates the ports and creates
+// the directories and passes them in; the template can reference:
+//
+//   - .TCPPort, .HTTPPort: the allocated ports
+//   - .GRPCPort: the gRPC port, 0 unless GRPCPort is set
+//   - .DataDir, .TmpDir, .FormatSchemaDir, .UserFilesDir, .UserScriptsDir: directories
+//     (without a trailing slash)
+//   - .UDFConfigPath, .DictionariesConfigPath, .UsersConfigPath: fragment files, "" when
+//     not configured
+//   - .Macros: sorted entries with .Key and .Value
+//   - .Profile: the default profile's settings, sorted entries with .Key and .Value
+//   - .Settings: the ServerSettings map
+//   - .DefaultDatabaseEngine, .QueryLog, .QueryLogFlushMS, .HTTPCompression, .Telemetry,
+//     .Ephemeral, .AccessManagement
+//
+// and the xmlEscape function for text nodes. Start fails with ErrInvalidConfigTemplate
+// when the template does not parse. Not used by Cluster.
+func (c Config) ConfigTemplate(text string) Config {
+	c.configTemplate = text
+	return c
+}
+
+// LowMemory applies a preset for memory-constrained CI machines: max_server_memory_usage
+// of 1 GiB, 64 MiB mark and uncompressed caches, and small background thread pools. In a
+// Cluster it applies to every node, so five nodes stay within about 5 GiB. Values given
+// with ServerSettings take precedence over the preset, whichever is called first.
+func (c Config) LowMemory() Config {
+	c.lowMemory = true
+	return c
+}
+
+// MaxMemoryPerNode sets max_server_memory_usage, in bytes, for every Cluster node.
+// Default is half the host memory divided by the number of replicas (the 1 GiB preset with
+// LowMemory); a value <= 0 restores the default. A max_server_memory_usage passed to
+// ServerSettings takes precedence. Standalone servers are not affected.
+func (c Config) MaxMemoryPerNode(bytes int64) Config {
+	c.maxMemoryPerNode = bytes
+	return c
+}
+
+// ServerSettings sets server-level settings, written as top-level elements of config.xml.
+// These are the settings listed in system.server_settings: memory and cache limits
+// (max_server_memory_usage, mark_cache_size), thread pools (background_pool_size),
+// max_concurrent_queries, default_replica_path, and the like. ClickHouse silently ignores
+// query-level settings placed here; pass those (max_threads, async_insert,
+// max_execution_time, anything in system.settings) to ProfileSettings instead.
+// The provided map is copied; subsequent caller mutations do not affect the Config.
+func (c Config) ServerSettings(s map[string]string) Config {
 	m := make(map[string]string, len(s))
 	maps.Copy(m, s)
 
@@ -175,3 +849,27 @@ func (c Config) Settings(s map[string]string) Config {
 
 	return c
 }
+
+// Settings is the former name of ServerSettings.
+//
+// Deprecated: use ServerSettings for server-level settings and ProfileSettings for
+// query-level ones.
+func (c Config) Settings(s map[string]string) Config {
+	return c.ServerSettings(s)
+}
+
+// ProfileSettings sets query-level settings in the default settings profile, so every
+// query runs with them unless it overrides them, e.g. {"async_insert": "1",
+// "async_insert_busy_timeout_ms": "200", "max_threads": "2"}. These are the settings listed
+// in system.settings; server-level ones (system.server_settings) go to ServerSettings.
+// Values override those implied by other options (log_queries, enable_http_compression,
+// default_database_engine).
+// The provided map is copied; subsequent caller mutations do not affect the Config.
+func (c Config) ProfileSettings(s map[string]string) Config {
+	m := make(map[string]string, len(s))
+	maps.Copy(m, s)
+
+	c.profile = m
+
+	return c
+}
@@ -2,6 +2,7 @@ package embeddedclickhouse
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -40,7 +41,7 @@ func TestConfigBuilderChaining(t *testing.T) {
 	t.Parallel()
 
 	buf := &bytes.Buffer{}
-	settings := map[string]string{"max_threads": "2"}
+	settings := map[string]string{"max_concurrent_queries": "2"}
 
 	cfg := DefaultConfig().
 		Version(V25_3).
@@ -53,7 +54,7 @@ func TestConfigBuilderChaining(t *testing.T) {
 		StartTimeout(60 * time.Second).
 		StopTimeout(20 * time.Second).
 		Logger(buf).
-		Settings(settings)
+		ServerSettings(settings)
 
 	if cfg.version != V25_3 {
 		t.Errorf("version = %q, want %q", cfg.version, V25_3)
@@ -95,8 +96,8 @@ func TestConfigBuilderChaining(t *testing.T) {
 		t.Error("logger mismatch")
 	}
 
-	if cfg.settings["max_threads"] != "2" {
-		t.Errorf("settings[max_threads] = %q, want 2", cfg.settings["max_threads"])
+	if cfg.settings["max_concurrent_queries"] != "2" {
+		t.Errorf("settings[max_concurrent_queries] = %q, want 2", cfg.settings["max_concurrent_queries"])
 	}
 }
 
@@ -167,3 +168,171 @@ func TestConfigBuilderImmutability(t *testing.T) {
 		t.Errorf("modified tcpPort = %d, want 9000", modified.tcpPort)
 	}
 }
+
+func TestConfigMacrosCopied(t *testing.T) {
+	t.Parallel()
+
+	m := map[string]string{"layer": "a"}
+	cfg := DefaultConfig().Macros(m)
+
+	m["layer"] = "mutated"
+
+	if cfg.macros["layer"] != "a" {
+		t.Errorf("macros[layer] = %q, want a (caller mutation leaked into Config)", cfg.macros["layer"])
+	}
+}
+
+func TestConfigAccessEntitiesCopied(t *testing.T) {
+	t.Parallel()
+
+	stmts := []string{"CREATE ROLE reader"}
+	cfg := DefaultConfig().AccessEntities(stmts)
+
+	stmts[0] = "mutated"
+
+	if cfg.accessEntities[0] != "CREATE ROLE reader" {
+		t.Errorf("accessEntities[0] = %q, want CREATE ROLE reader (caller mutation leaked into Config)", cfg.accessEntities[0])
+	}
+}
+
+func TestConfigSettingsCopied(t *testing.T) {
+	t.Parallel()
+
+	m := map[string]string{"max_concurrent_queries": "2"}
+	base := DefaultConfig().ServerSettings(m)
+	derived := base.ServerSettings(map[string]string{"max_concurrent_queries": "4"})
+
+	m["max_concurrent_queries"] = "mutated"
+
+	if base.settings["max_concurrent_queries"] != "2" {
+		t.Errorf("base settings[max_concurrent_queries] = %q, want 2", base.settings["max_concurrent_queries"])
+	}
+
+	if derived.settings["max_concurrent_queries"] != "4" {
+		t.Errorf("derived settings[max_concurrent_queries] = %q, want 4", derived.settings["max_concurrent_queries"])
+	}
+}
+
+func TestConfigSettingsIsServerSettings(t *testing.T) {
+	t.Parallel()
+
+	m := map[string]string{"max_concurrent_queries": "10"}
+
+	if got, want := DefaultConfig().Settings(m), DefaultConfig().ServerSettings(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("Settings(%v) = %+v, want the ServerSettings config %+v", m, got, want)
+	}
+}
+
+func TestConfigClone(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().
+		ServerSettings(map[string]string{"max_concurrent_queries": "2"}).
+		ProfileSettings(map[string]string{"async_insert": "1"}).
+		Macros(map[string]string{"layer": "a"}).
+		UDFConfig([]byte("<functions/>")).
+		Dictionaries([]byte("<dictionaries/>")).
+		UsersConfig([]byte("<clickhouse/>")).
+		FormatSchemas(map[string][]byte{"message.proto": []byte("syntax = \"proto3\";")}).
+		AccessEntities([]string{"CREATE ROLE reader"}).
+		ExtraArgs("--", "--logger.level=trace")
+
+	clone := cfg.Clone()
+
+	if !reflect.DeepEqual(cfg, clone) {
+		t.Fatal("clone differs from the original")
+	}
+
+	// Every map and slice field, including ones added later, must be copied, not shared.
+	orig, cloned := reflect.ValueOf(cfg), reflect.ValueOf(clone)
+
+	for i := range orig.NumField() {
+		field := orig.Type().Field(i)
+
+		switch field.Type.Kind() { //nolint:exhaustive // only reference types can be shared
+		case reflect.Map, reflect.Slice:
+			if orig.Field(i).IsNil() {
+				t.Errorf("%s: set it in this test so the copy is checked", field.Name)
+				continue
+			}
+
+			if orig.Field(i).Pointer() == cloned.Field(i).Pointer() {
+				t.Errorf("%s is shared between the config and its clone", field.Name)
+			}
+		}
+	}
+
+	clone.formatSchemas["message.proto"][0] = 'X'
+	if cfg.formatSchemas["message.proto"][0] == 'X' {
+		t.Error("FormatSchemas contents are shared between the config and its clone")
+	}
+}
+
+func TestConfigMaxBinarySize(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().MaxBinarySize(1 << 20)
+
+	if cfg.maxBinarySize != 1<<20 {
+		t.Errorf("maxBinarySize = %d, want %d", cfg.maxBinarySize, 1<<20)
+	}
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvVersion, "24.8.4.13-lts")
+	t.Setenv(EnvCachePath, "/env/cache")
+	t.Setenv(EnvBinary, "/env/clickhouse")
+	t.Setenv(EnvRepoURL, "https://env.example.com")
+
+	cfg := DefaultConfig().
+		Version(V25_3).
+		CachePath("/code/cache").
+		FromEnv()
+
+	if cfg.version != "24.8.4.13-lts" {
+		t.Errorf("version = %q, want 24.8.4.13-lts", cfg.version)
+	}
+
+	if cfg.cachePath != "/env/cache" {
+		t.Errorf("cachePath = %q, want /env/cache", cfg.cachePath)
+	}
+
+	if cfg.binaryPath != "/env/clickhouse" {
+		t.Errorf("binaryPath = %q, want /env/clickhouse", cfg.binaryPath)
+	}
+
+	if cfg.binaryRepositoryURL != "https://env.example.com" {
+		t.Errorf("binaryRepositoryURL = %q, want https://env.example.com", cfg.binaryRepositoryURL)
+	}
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestConfigFromEnv_UnsetKeepsValues(t *testing.T) {
+	t.Setenv(EnvVersion, "")
+	t.Setenv(EnvCachePath, "")
+	t.Setenv(EnvBinary, "")
+	t.Setenv(EnvRepoURL, "")
+
+	cfg := DefaultConfig().
+		Version(V25_3).
+		CachePath("/code/cache").
+		BinaryRepositoryURL("https://mirror.example.com").
+		FromEnv()
+
+	if cfg.version != V25_3 {
+		t.Errorf("version = %q, want %q", cfg.version, V25_3)
+	}
+
+	if cfg.cachePath != "/code/cache" {
+		t.Errorf("cachePath = %q, want /code/cache", cfg.cachePath)
+	}
+
+	if cfg.binaryPath != "" {
+		t.Errorf("binaryPath = %q, want empty", cfg.binaryPath)
+	}
+
+	if cfg.binaryRepositoryURL != "https://mirror.example.com" {
+		t.Errorf("binaryRepositoryURL = %q, want https://mirror.example.com", cfg.binaryRepositoryURL)
+	}
+}
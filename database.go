@@ -0,0 +1,63 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidDatabaseName is returned by CreateDatabase and DropDatabase for an empty name.
+var ErrInvalidDatabaseName = errors.New("embedded-clickhouse: invalid database name")
+
+// CreateDatabase creates the database name through the HTTP interface, for tests that
+// isolate themselves in a fresh database on a shared server instead of restarting it.
+// It fails, wrapping ErrQueryFailed, if the database already exists, so two tests
+// picking the same name notice rather than share it. Pair it with DropDatabase and
+// DatabaseDSN:
+//
+//	require.NoError(t, ch.CreateDatabase(ctx, "t_orders"))
+//	t.Cleanup(func() { ch.DropDatabase(context.Background(), "t_orders") })
+//	db, err := sql.Open("clickhouse", ch.DatabaseDSN("t_orders"))
+func (e *EmbeddedClickHouse) CreateDatabase(ctx context.Context, name string) error {
+	return e.execDatabaseStatement(ctx, "CREATE DATABASE %s", name)
+}
+
+// DropDatabase drops the database name and everything in it through the HTTP interface,
+// waiting until its tables are gone (SYNC). Dropping a database that does not exist is
+// not an error.
+func (e *EmbeddedClickHouse) DropDatabase(ctx context.Context, name string) error {
+	return e.execDatabaseStatement(ctx, "DROP DATABASE IF EXISTS %s SYNC", name)
+}
+
+// DatabaseDSN returns the DSN of the server with name as its database, e.g.
+// "clickhouse://127.0.0.1:19000/t_orders", so unqualified table names resolve there.
+// It is DSNWithParams(DSNParams{}.Database(name)).
+func (e *EmbeddedClickHouse) DatabaseDSN(name string) string {
+	return e.DSNWithParams(DSNParams{}.Database(name))
+}
+
+// execDatabaseStatement runs format with the quoted database name.
+func (e *EmbeddedClickHouse) execDatabaseStatement(ctx context.Context, format, name string) error {
+	if name == "" {
+		return ErrInvalidDatabaseName
+	}
+
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return err
+	}
+
+	stmt := fmt.Sprintf(format, quoteIdentifier(name))
+	if _, err := execHTTP(ctx, httpPort, stmt); err != nil {
+		return fmt.Errorf("embedded-clickhouse: %s: %w", statementPreview(stmt), err)
+	}
+
+	return nil
+}
+
+// quoteIdentifier returns name as a backquoted ClickHouse identifier, escaping backslashes
+// and backquotes, so any database name is passed through verbatim.
+func quoteIdentifier(name string) string {
+	return "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(name) + "`"
+}
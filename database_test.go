@@ -0,0 +1,97 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDropDatabase(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		got = append(got, query)
+
+		if query == "CREATE DATABASE `taken`" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "Code: 82. DB::Exception: Database taken already exists")
+		}
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateDatabase(ctx, "t_orders"))
+	require.NoError(t, s.DropDatabase(ctx, "t_orders"))
+	require.NoError(t, s.CreateDatabase(ctx, "odd`name\\"))
+	assert.Equal(t, []string{
+		"CREATE DATABASE `t_orders`",
+		"DROP DATABASE IF EXISTS `t_orders` SYNC",
+		"CREATE DATABASE `odd\\`name\\\\`",
+	}, got)
+
+	err := s.CreateDatabase(ctx, "taken")
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "already exists")
+}
+
+func TestCreateDatabase_Guards(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	require.ErrorIs(t, (&EmbeddedClickHouse{started: true}).CreateDatabase(ctx, ""), ErrInvalidDatabaseName)
+	require.ErrorIs(t, NewServer().CreateDatabase(ctx, "db"), ErrServerNotStarted)
+	require.ErrorIs(t, NewServer().DropDatabase(ctx, "db"), ErrServerNotStarted)
+}
+
+func TestDatabaseDSN(t *testing.T) {
+	t.Parallel()
+
+	s := &EmbeddedClickHouse{tcpPort: 19000}
+	assert.Equal(t, "clickhouse://127.0.0.1:19000/t_orders", s.DatabaseDSN("t_orders"))
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_DatabasePerTest(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+	ctx := context.Background()
+
+	for _, name := range []string{"t_a", "t_b"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.NoError(t, s.CreateDatabase(ctx, name))
+			t.Cleanup(func() { require.NoError(t, s.DropDatabase(context.Background(), name)) })
+
+			db, err := sql.Open("clickhouse", s.DatabaseDSN(name))
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			// The same unqualified table name in each database does not collide.
+			_, err = db.ExecContext(ctx, "CREATE TABLE events (id UInt64) ENGINE = MergeTree ORDER BY id")
+			require.NoError(t, err)
+
+			var current string
+			require.NoError(t, db.QueryRowContext(ctx, "SELECT currentDatabase()").Scan(&current))
+			assert.Equal(t, name, current)
+		})
+	}
+
+	require.ErrorIs(t, s.CreateDatabase(ctx, "default"), ErrQueryFailed)
+}
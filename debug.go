@@ -0,0 +1,53 @@
+package embeddedclickhouse
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// EnvBreakpoint enables BreakpointWait when set to a non-empty value.
+const EnvBreakpoint = "EMBEDDED_CLICKHOUSE_BREAKPOINT"
+
+// OpenPlayURL returns the URL of the server's built-in SQL web UI (e.g.,
+// "http://127.0.0.1:18123/play"), for poking at a running server from a browser.
+func (e *EmbeddedClickHouse) OpenPlayURL() string {
+	return e.HTTPURL() + "/play"
+}
+
+// DashboardURL returns the URL of the server's built-in monitoring dashboard (e.g.,
+// "http://127.0.0.1:18123/dashboard").
+func (e *EmbeddedClickHouse) DashboardURL() string {
+	return e.HTTPURL() + "/dashboard"
+}
+
+// BreakpointWait pauses a test while EMBEDDED_CLICKHOUSE_BREAKPOINT is set: it prints the
+// server's addresses and web UI URLs to stderr and blocks until the developer presses
+// Ctrl+C, which resumes the test instead of killing it. It returns immediately when the
+// variable is unset, so calls can stay in the code. NewServerForTest calls it before
+// stopping the server, so every test can be paused at teardown:
+//
+//	EMBEDDED_CLICKHOUSE_BREAKPOINT=1 go test -run TestOrders -timeout 0 ./...
+func (e *EmbeddedClickHouse) BreakpointWait() {
+	if os.Getenv(EnvBreakpoint) == "" {
+		return
+	}
+
+	resume := make(chan os.Signal, 1)
+	signal.Notify(resume, os.Interrupt)
+
+	defer signal.Stop(resume)
+
+	e.waitForResume(os.Stderr, resume)
+}
+
+// waitForResume prints where the paused server can be reached to out and blocks until
+// resume delivers.
+func (e *EmbeddedClickHouse) waitForResume(out io.Writer, resume <-chan os.Signal) {
+	fmt.Fprintf(out, "embedded-clickhouse: paused at breakpoint, press Ctrl+C to continue\n"+
+		"  native: %s\n  http:   %s\n  play:   %s\n  dash:   %s\n",
+		e.TCPAddr(), e.HTTPURL(), e.OpenPlayURL(), e.DashboardURL())
+
+	<-resume
+}
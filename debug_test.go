@@ -0,0 +1,87 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenPlayURL(t *testing.T) {
+	t.Parallel()
+
+	s := &EmbeddedClickHouse{httpPort: 18123}
+
+	assert.Equal(t, "http://127.0.0.1:18123/play", s.OpenPlayURL())
+	assert.Equal(t, "http://127.0.0.1:18123/dashboard", s.DashboardURL())
+}
+
+func TestRenderServerConfig_KeepsDefaultHTTPHandlers(t *testing.T) {
+	t.Parallel()
+
+	// Custom handlers would replace the built-in ones, /play and /dashboard included.
+	xml, err := RenderServerConfig(DefaultConfig(), 19000, 18123)
+	require.NoError(t, err)
+	assert.NotContains(t, xml, "<http_handlers>")
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestBreakpointWait_Disabled(t *testing.T) {
+	t.Setenv(EnvBreakpoint, "")
+
+	done := make(chan struct{})
+
+	go func() {
+		(&EmbeddedClickHouse{}).BreakpointWait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("BreakpointWait blocked with the variable unset")
+	}
+}
+
+func TestWaitForResume(t *testing.T) {
+	t.Parallel()
+
+	s := &EmbeddedClickHouse{tcpPort: 19000, httpPort: 18123}
+	resume := make(chan os.Signal, 1)
+	resume <- os.Interrupt
+
+	var out strings.Builder
+
+	s.waitForResume(&out, resume)
+
+	assert.Contains(t, out.String(), "127.0.0.1:19000")
+	assert.Contains(t, out.String(), "http://127.0.0.1:18123/play")
+	assert.Contains(t, out.String(), "http://127.0.0.1:18123/dashboard")
+}
+
+func TestIntegration_OpenPlayURL(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	for _, url := range []string{s.OpenPlayURL(), s.DashboardURL()} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, url)
+	}
+}
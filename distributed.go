@@ -0,0 +1,104 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidTableDefinition is returned by CreateDistributed when the local table
+// definition is not of the form "name (columns) [clauses]".
+var ErrInvalidTableDefinition = errors.New("embedded-clickhouse: invalid table definition")
+
+// CreateDistributed creates a ReplicatedMergeTree table and a Distributed table over it
+// on every node of the cluster. local is the local table's definition without the
+// engine, e.g. "events (id UInt64, ts DateTime) ORDER BY id" (clauses after the columns
+// are optional and default to ORDER BY tuple()). The local table is created ON CLUSTER
+// with ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}',
+// '{replica}'); dist is then created with its columns and
+// ENGINE = Distributed(test_cluster, db, local, shardingKey). Names may be qualified as
+// "db.table"; unqualified names use the default database. An empty shardingKey means rand().
+func (c *Cluster) CreateDistributed(ctx context.Context, local, dist, shardingKey string) error {
+	c.mu.RLock()
+
+	if !c.started {
+		c.mu.RUnlock()
+		return ErrClusterNotStarted
+	}
+
+	httpPort := c.nodes[0].httpPort
+	c.mu.RUnlock()
+
+	stmts, err := distributedStatements(c.ClusterName(), local, dist, shardingKey)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range stmts {
+		if _, err := execHTTP(ctx, httpPort, stmt); err != nil {
+			return fmt.Errorf("embedded-clickhouse: create distributed %s: %w", dist, err)
+		}
+	}
+
+	return nil
+}
+
+// distributedStatements builds the two CREATE TABLE statements of CreateDistributed.
+func distributedStatements(cluster, local, dist, shardingKey string) ([]string, error) {
+	name, columns, clauses, err := splitTableDefinition(local)
+	if err != nil {
+		return nil, err
+	}
+
+	if clauses == "" {
+		clauses = "ORDER BY tuple()"
+	}
+
+	if shardingKey == "" {
+		shardingKey = "rand()"
+	}
+
+	db, table, ok := strings.Cut(name, ".")
+	if !ok {
+		db, table = "currentDatabase()", name
+	}
+
+	return []string{
+		fmt.Sprintf("CREATE TABLE %s ON CLUSTER '%s' %s "+
+			"ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}') %s",
+			name, cluster, columns, clauses),
+		fmt.Sprintf("CREATE TABLE %s ON CLUSTER '%s' AS %s ENGINE = Distributed('%s', %s, %s, %s)",
+			dist, cluster, name, cluster, db, table, shardingKey),
+	}, nil
+}
+
+// splitTableDefinition splits "name (columns) clauses" into the name, the parenthesized
+// column list (parentheses included) and the trimmed clauses. Parentheses inside quoted
+// strings and identifiers do not count.
+func splitTableDefinition(def string) (string, string, string, error) {
+	open := strings.IndexByte(def, '(')
+	name := strings.TrimSpace(def[:max(open, 0)])
+
+	if open == -1 || name == "" || strings.ContainsAny(name, " \t\n") {
+		return "", "", "", fmt.Errorf("%w: %q", ErrInvalidTableDefinition, def)
+	}
+
+	depth := 0
+
+	for i := open; i < len(def); i++ {
+		switch def[i] {
+		case '\'', '"', '`':
+			i = quotedEnd(def, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return name, def[open : i+1], strings.TrimSpace(def[i+1:]), nil
+			}
+		}
+	}
+
+	return "", "", "", fmt.Errorf("%w: unbalanced parentheses in %q", ErrInvalidTableDefinition, def)
+}
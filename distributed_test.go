@@ -0,0 +1,95 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitTableDefinition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		def         string
+		wantName    string
+		wantColumns string
+		wantClauses string
+	}{
+		{"events (id UInt64) ORDER BY id", "events", "(id UInt64)", "ORDER BY id"},
+		{"db.events(id UInt64, d Decimal(10, 2))", "db.events", "(id UInt64, d Decimal(10, 2))", ""},
+		{"e (s String DEFAULT ')(') ORDER BY s", "e", "(s String DEFAULT ')(')", "ORDER BY s"},
+	}
+
+	for _, tt := range tests {
+		name, columns, clauses, err := splitTableDefinition(tt.def)
+		require.NoError(t, err, tt.def)
+		assert.Equal(t, tt.wantName, name)
+		assert.Equal(t, tt.wantColumns, columns)
+		assert.Equal(t, tt.wantClauses, clauses)
+	}
+}
+
+func TestSplitTableDefinition_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, def := range []string{"events", "(id UInt64)", "my events (id UInt64)", "events (id UInt64"} {
+		_, _, _, err := splitTableDefinition(def)
+		require.ErrorIs(t, err, ErrInvalidTableDefinition, def)
+	}
+}
+
+func TestDistributedStatements(t *testing.T) {
+	t.Parallel()
+
+	stmts, err := distributedStatements("test_cluster", "events (id UInt64)", "events_dist", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE TABLE events ON CLUSTER 'test_cluster' (id UInt64) " +
+			"ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}') ORDER BY tuple()",
+		"CREATE TABLE events_dist ON CLUSTER 'test_cluster' AS events " +
+			"ENGINE = Distributed('test_cluster', currentDatabase(), events, rand())",
+	}, stmts)
+
+	stmts, err = distributedStatements("test_cluster", "db.events (id UInt64) ORDER BY id", "db.events_all", "id")
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE db.events_all ON CLUSTER 'test_cluster' AS db.events "+
+		"ENGINE = Distributed('test_cluster', db, events, id)", stmts[1])
+}
+
+func TestCluster_CreateDistributed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+
+	port := fakeQueryServer(t, func(_ http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queries = append(queries, query)
+	})
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{httpPort: port}}}
+
+	require.NoError(t, cl.CreateDistributed(context.Background(), "events (id UInt64) ORDER BY id", "events_dist", "id"))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, queries, 2)
+	assert.Contains(t, queries[0], "ReplicatedMergeTree")
+	assert.Contains(t, queries[1], "Distributed('test_cluster', currentDatabase(), events, id)")
+}
+
+func TestCluster_CreateDistributedNotStarted(t *testing.T) {
+	t.Parallel()
+
+	err := NewCluster(2).CreateDistributed(context.Background(), "events (id UInt64)", "events_dist", "")
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
@@ -1,6 +1,7 @@
 package embeddedclickhouse
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
@@ -10,38 +11,79 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
-// httpClient is a shared HTTP client with a timeout to prevent indefinite hangs on slow CDNs.
+// httpClient is a shared HTTP client with a timeout to prevent indefinite hangs on slow CDNs
+// when the caller's context has no deadline of its own.
 var httpClient = &http.Client{Timeout: 10 * time.Minute} //nolint:gochecknoglobals
 
 // ensureBinary returns the path to a ClickHouse binary, downloading it if necessary.
-func ensureBinary(cfg Config) (string, error) {
+// downloaded reports whether this call fetched it from the network rather than finding
+// it in a cache or on disk.
+func ensureBinary(ctx context.Context, cfg Config) (path string, downloaded bool, err error) {
+	// Checked for every binary source, not just the standard download, so a malformed
+	// version fails the same way whichever one is configured.
+	if err := validateVersion(cfg.version); err != nil {
+		return "", false, err
+	}
+
+	ctx, span := startSpan(ctx, "embedded-clickhouse.ensureBinary", attrVersion.String(string(cfg.version)))
+
+	path, downloaded, err = resolveBinary(ctx, cfg)
+	if err == nil && cfg.verifyBinaryRuns && cfg.resolvedBinaryPath == "" {
+		err = checkBinaryRuns(ctx, cfg, path)
+	}
+
+	endSpan(span, err)
+
+	return path, downloaded, err
+}
+
+// resolveBinary implements ensureBinary.
+func resolveBinary(ctx context.Context, cfg Config) (string, bool, error) {
+	// Already resolved by Prepare (via the ForTest helpers).
+	if cfg.resolvedBinaryPath != "" {
+		return cfg.resolvedBinaryPath, false, nil
+	}
+
 	// Priority: BinaryPath > CustomArchivePath > CustomArchiveURL > standard download.
 	if cfg.binaryPath != "" {
 		if _, err := os.Stat(cfg.binaryPath); err != nil {
-			return "", fmt.Errorf("embedded-clickhouse: specified binary not found: %w", err)
+			return "", false, fmt.Errorf("embedded-clickhouse: specified binary not found: %w", err)
 		}
 
-		return cfg.binaryPath, nil
+		return cfg.binaryPath, false, nil
+	}
+
+	if (cfg.customArchivePath != "" || cfg.customArchiveURL != "") && cfg.requireChecksum &&
+		cfg.sha256 == "" && cfg.sha512hash == "" {
+		return "", false, ErrChecksumRequired
 	}
 
 	if cfg.customArchivePath != "" {
-		return ensureCustomArchiveFromPath(cfg)
+		path, err := ensureCustomArchiveFromPath(ctx, cfg)
+		return path, false, err
 	}
 
 	if cfg.customArchiveURL != "" {
-		return ensureCustomArchiveFromURL(cfg)
+		return ensureCustomArchiveFromURL(ctx, cfg)
+	}
+
+	if cfg.useSystemBinary {
+		if path, ok := systemBinary(ctx, cfg); ok {
+			return path, false, nil
+		}
 	}
 
-	return ensureStandardBinary(cfg)
+	return ensureStandardBinary(ctx, cfg)
 }
 
 // ensureCustomArchiveFromPath extracts a ClickHouse binary from a local archive.
-func ensureCustomArchiveFromPath(cfg Config) (string, error) {
+func ensureCustomArchiveFromPath(ctx context.Context, cfg Config) (string, error) {
 	if _, err := os.Stat(cfg.customArchivePath); err != nil {
 		return "", fmt.Errorf("embedded-clickhouse: custom archive not found: %w", err)
 	}
@@ -63,14 +105,19 @@ func ensureCustomArchiveFromPath(cfg Config) (string, error) {
 
 	binPath := customCachedBinaryPath(dir, contentHash)
 
+	// Read-only shared cache first.
+	if shared, ok := sharedCachedBinary(cfg, binPath); ok {
+		return shared, nil
+	}
+
 	// Lock-free fast path.
 	if _, err := os.Stat(binPath); err == nil {
 		return binPath, nil
 	}
 
 	// The lock file lives in dir, so the directory must exist before locking.
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", fmt.Errorf("embedded-clickhouse: create cache dir: %w", err)
+	if err := ensureCacheDir(dir); err != nil {
+		return "", err
 	}
 
 	lock, err := acquireLock(lockPathFor(binPath))
@@ -86,7 +133,7 @@ func ensureCustomArchiveFromPath(cfg Config) (string, error) {
 
 	logf(cfg.logger, "Extracting ClickHouse from custom archive %s...\n", cfg.customArchivePath)
 
-	if err := extractClickHouseBinary(cfg.customArchivePath, binPath); err != nil {
+	if err := extractClickHouseBinary(ctx, cfg.customArchivePath, binPath, cfg.maxBinarySize); err != nil {
 		return "", err
 	}
 
@@ -96,42 +143,47 @@ func ensureCustomArchiveFromPath(cfg Config) (string, error) {
 }
 
 // ensureCustomArchiveFromURL downloads and extracts a ClickHouse binary from a custom URL.
-func ensureCustomArchiveFromURL(cfg Config) (string, error) {
+func ensureCustomArchiveFromURL(ctx context.Context, cfg Config) (string, bool, error) {
 	dir, err := cacheDir(cfg.cachePath)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	// Include configured digests in cache key so hash changes invalidate the cache.
 	cacheInput := cfg.customArchiveURL + "\x00" + strings.ToLower(cfg.sha256) + "\x00" + strings.ToLower(cfg.sha512hash)
 	binPath := customCachedBinaryPath(dir, cacheInput)
 
+	// Read-only shared cache first.
+	if shared, ok := sharedCachedBinary(cfg, binPath); ok {
+		return shared, false, nil
+	}
+
 	// Lock-free fast path.
 	if _, err := os.Stat(binPath); err == nil {
-		return binPath, nil
+		return binPath, false, nil
 	}
 
 	// The lock file lives in dir, so the directory must exist before locking.
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", fmt.Errorf("embedded-clickhouse: create cache dir: %w", err)
+	if err := ensureCacheDir(dir); err != nil {
+		return "", false, err
 	}
 
 	lock, err := acquireLock(lockPathFor(binPath))
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	defer lock.release() //nolint:errcheck
 
 	// Re-stat under the lock: another process/goroutine may have downloaded it.
 	if _, err := os.Stat(binPath); err == nil {
-		return binPath, nil
+		return binPath, false, nil
 	}
 
 	logf(cfg.logger, "Downloading ClickHouse from %s...\n", redactURL(cfg.customArchiveURL))
 
 	archiveFile, err := os.CreateTemp(dir, filepath.Base(binPath)+".tar.gz.*.tmp")
 	if err != nil {
-		return "", fmt.Errorf("embedded-clickhouse: create temp file: %w", err)
+		return "", false, fmt.Errorf("embedded-clickhouse: create temp file: %w", err)
 	}
 
 	archivePath := archiveFile.Name()
@@ -139,56 +191,61 @@ func ensureCustomArchiveFromURL(cfg Config) (string, error) {
 
 	defer os.Remove(archivePath)
 
-	if err := downloadFile(cfg.customArchiveURL, archivePath); err != nil {
-		return "", err
+	if err := downloadFile(ctx, cfg.customArchiveURL, archivePath); err != nil {
+		return "", false, err
 	}
 
 	if err := verifyCustomArchive(archivePath, cfg); err != nil {
-		return "", err
+		return "", false, err
 	}
 
-	if err := extractClickHouseBinary(archivePath, binPath); err != nil {
-		return "", err
+	if err := extractClickHouseBinary(ctx, archivePath, binPath, cfg.maxBinarySize); err != nil {
+		return "", false, err
 	}
 
 	logf(cfg.logger, "Done.\n")
 
-	return binPath, nil
+	return binPath, true, nil
 }
 
 // ensureStandardBinary handles the standard GitHub release download path.
-func ensureStandardBinary(cfg Config) (string, error) {
+func ensureStandardBinary(ctx context.Context, cfg Config) (string, bool, error) {
 	dir, err := cacheDir(cfg.cachePath)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	binPath := cachedBinaryPath(dir, cfg.version)
 
+	// Read-only shared cache first.
+	if shared, ok := sharedCachedBinary(cfg, binPath); ok {
+		return shared, false, nil
+	}
+
 	// Lock-free fast path.
 	if _, err := os.Stat(binPath); err == nil {
-		return binPath, nil
+		return binPath, false, nil
 	}
 
 	// The lock file lives in dir, so the directory must exist before locking.
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", fmt.Errorf("embedded-clickhouse: create cache dir: %w", err)
+	if err := ensureCacheDir(dir); err != nil {
+		return "", false, err
 	}
 
 	lock, err := acquireLock(lockPathFor(binPath))
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	defer lock.release() //nolint:errcheck
 
 	// Re-stat under the lock: another process/goroutine may have downloaded it.
 	if _, err := os.Stat(binPath); err == nil {
-		return binPath, nil
+		return binPath, false, nil
 	}
 
-	asset, err := resolveCurrentPlatformAsset(cfg.version)
+	asset, err := resolveCurrentPlatformAsset(cfg)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	url := downloadURL(cfg.binaryRepositoryURL, cfg.version, asset)
@@ -196,24 +253,24 @@ func ensureStandardBinary(cfg Config) (string, error) {
 	logf(cfg.logger, "Downloading ClickHouse v%s...\n", cfg.version)
 
 	switch asset.assetType {
-	case assetArchive:
-		if err := downloadAndExtract(cfg, url, asset, binPath); err != nil {
-			return "", err
+	case AssetArchive:
+		if err := downloadAndExtract(ctx, cfg, url, asset, binPath); err != nil {
+			return "", false, err
 		}
-	case assetRawBinary:
-		if err := downloadRawBinary(cfg, asset, url, binPath); err != nil {
-			return "", err
+	case AssetRawBinary:
+		if err := downloadRawBinary(ctx, cfg, asset, url, binPath); err != nil {
+			return "", false, err
 		}
 	default:
-		return "", fmt.Errorf("%w: %d", ErrUnknownAssetType, asset.assetType)
+		return "", false, fmt.Errorf("%w: %d", ErrUnknownAssetType, asset.assetType)
 	}
 
 	logf(cfg.logger, "Done.\n")
 
-	return binPath, nil
+	return binPath, true, nil
 }
 
-func downloadAndExtract(cfg Config, url string, asset platformAsset, binPath string) error {
+func downloadAndExtract(ctx context.Context, cfg Config, url string, asset platformAsset, binPath string) error {
 	dir, err := cacheDir(cfg.cachePath)
 	if err != nil {
 		return err
@@ -223,7 +280,7 @@ func downloadAndExtract(cfg Config, url string, asset platformAsset, binPath str
 		return fmt.Errorf("embedded-clickhouse: create cache dir: %w", err)
 	}
 
-	archiveFile, err := os.CreateTemp(dir, asset.filename+".*.tmp")
+	archiveFile, err := os.CreateTemp(dir, path.Base(asset.filename)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("embedded-clickhouse: create temp file: %w", err)
 	}
@@ -233,21 +290,23 @@ func downloadAndExtract(cfg Config, url string, asset platformAsset, binPath str
 
 	defer os.Remove(archivePath)
 
-	if err := downloadFile(url, archivePath); err != nil {
+	if err := downloadFile(ctx, url, archivePath); err != nil {
 		return err
 	}
 
 	// Verify SHA512 for archives.
-	sha512url := sha512URL(cfg.binaryRepositoryURL, cfg.version, asset)
+	urls := checksumURLs(cfg.binaryRepositoryURL, cfg.version, asset)
 
-	if err := verifySHA512(archivePath, sha512url, asset.filename, cfg.allowMissingChecksum, cfg.logger); err != nil {
-		return err
+	allowMissing := cfg.allowMissingChecksum && !cfg.requireChecksum
+
+	if err := verifySHA512(ctx, archivePath, urls, asset.filename, allowMissing, cfg.logger); err != nil {
+		return requiredChecksumError(cfg, err)
 	}
 
-	return extractClickHouseBinary(archivePath, binPath)
+	return extractClickHouseBinary(ctx, archivePath, binPath, cfg.maxBinarySize)
 }
 
-func downloadRawBinary(cfg Config, asset platformAsset, url, binPath string) error {
+func downloadRawBinary(ctx context.Context, cfg Config, asset platformAsset, url, binPath string) error {
 	if err := os.MkdirAll(filepath.Dir(binPath), 0o755); err != nil {
 		return fmt.Errorf("embedded-clickhouse: create cache dir: %w", err)
 	}
@@ -262,18 +321,18 @@ func downloadRawBinary(cfg Config, asset platformAsset, url, binPath string) err
 
 	defer os.Remove(tmp)
 
-	if err := downloadFile(url, tmp); err != nil {
+	if err := downloadFile(ctx, url, tmp); err != nil {
 		return err
 	}
 
-	sha512url := sha512URL(cfg.binaryRepositoryURL, cfg.version, asset)
+	urls := checksumURLs(cfg.binaryRepositoryURL, cfg.version, asset)
 
 	// Raw binaries (macOS) are published without a .sha512 upstream, so a missing
 	// checksum is expected here and must not fail the download — unlike archives,
 	// which always ship one and are verified strictly. A checksum that IS present
-	// is still verified regardless.
-	if err := verifySHA512(tmp, sha512url, asset.filename, true, cfg.logger); err != nil {
-		return err
+	// is still verified regardless, and RequireChecksum makes a missing one fatal.
+	if err := verifySHA512(ctx, tmp, urls, asset.filename, !cfg.requireChecksum, cfg.logger); err != nil {
+		return requiredChecksumError(cfg, err)
 	}
 
 	if err := os.Chmod(tmp, 0o755); err != nil {
@@ -287,67 +346,89 @@ func downloadRawBinary(cfg Config, asset platformAsset, url, binPath string) err
 	return nil
 }
 
-func downloadFile(url, destPath string) error {
-	resp, err := httpClient.Get(url) //nolint:noctx // URL is constructed internally
+// downloadFile fetches url into destPath.
+func downloadFile(ctx context.Context, url, destPath string) error {
+	ctx, span := startSpan(ctx, "embedded-clickhouse.downloadFile", attrURL.String(redactURL(url)))
+	defer timePhase(ctx, "download")()
+
+	n, err := fetchFile(ctx, url, destPath)
+	span.SetAttributes(attrBytes.Int64(n))
+	endSpan(span, err)
+
+	return err
+}
+
+// fetchFile implements downloadFile and returns the number of bytes written.
+func fetchFile(ctx context.Context, url, destPath string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("embedded-clickhouse: download %s: %w", redactURL(url), redactURLError(err))
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("embedded-clickhouse: download %s: %w", redactURL(url), redactURLError(err))
+		return 0, fmt.Errorf("embedded-clickhouse: download %s: %w", redactURL(url), redactURLError(err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: %s: HTTP %d", ErrDownloadFailed, redactURL(url), resp.StatusCode)
+		return 0, fmt.Errorf("%w: %s: HTTP %d", ErrDownloadFailed, redactURL(url), resp.StatusCode)
 	}
 
 	out, err := os.Create(destPath)
 	if err != nil {
-		return fmt.Errorf("embedded-clickhouse: create %s: %w", destPath, err)
+		return 0, fmt.Errorf("embedded-clickhouse: create %s: %w", destPath, err)
 	}
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
 		out.Close()
 		os.Remove(destPath)
 
-		return fmt.Errorf("embedded-clickhouse: write %s: %w", destPath, err)
+		return n, fmt.Errorf("embedded-clickhouse: write %s: %w", destPath, err)
 	}
 
 	if err := out.Close(); err != nil {
 		os.Remove(destPath)
-		return fmt.Errorf("embedded-clickhouse: close %s: %w", destPath, err)
+		return n, fmt.Errorf("embedded-clickhouse: close %s: %w", destPath, err)
 	}
 
-	return nil
+	return n, nil
 }
 
-func verifySHA512(filePath, sha512URL, expectedFilename string, allowMissing bool, logger io.Writer) error {
-	resp, err := httpClient.Get(sha512URL) //nolint:noctx // URL is constructed internally
+// requiredChecksumError adds ErrSHA512NotFound to a missing-checksum error under
+// RequireChecksum, so callers can match either sentinel; other errors pass through.
+func requiredChecksumError(cfg Config, err error) error {
+	if cfg.requireChecksum && errors.Is(err, ErrSHA512Unavailable) {
+		return fmt.Errorf("%w: %w", ErrSHA512NotFound, err)
+	}
+
+	return err
+}
+
+// verifySHA512 checks filePath against the SHA512 listed for expectedFilename in the first
+// checksum file among checksumURLs that has one (see lookupSHA512).
+func verifySHA512(
+	ctx context.Context, filePath string, checksumURLs []string, expectedFilename string, allowMissing bool, logger io.Writer,
+) error {
+	expectedHash, status, err := lookupSHA512(ctx, checksumURLs, expectedFilename)
 	if err != nil {
-		return fmt.Errorf("embedded-clickhouse: download SHA512 %s: %w", redactURL(sha512URL), redactURLError(err))
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if status != http.StatusOK {
 		if !allowMissing {
 			// Fail closed: a missing checksum is a verification failure by default.
-			return fmt.Errorf("%w: %s: HTTP %d", ErrSHA512Unavailable, expectedFilename, resp.StatusCode)
+			return fmt.Errorf("%w: %s: HTTP %d", ErrSHA512Unavailable, expectedFilename, status)
 		}
 
 		// Opt-in fallback: skip verification but warn the caller.
 		logf(logger, "embedded-clickhouse: SHA512 not available for %s (HTTP %d), skipping verification\n",
-			expectedFilename, resp.StatusCode)
+			expectedFilename, status)
 
 		return nil
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("embedded-clickhouse: read SHA512: %w", err)
-	}
-
-	expectedHash, err := parseSHA512(string(body), expectedFilename)
-	if err != nil {
-		return err
-	}
-
 	actualHash, err := fileSHA512(filePath)
 	if err != nil {
 		return err
@@ -361,6 +442,69 @@ func verifySHA512(filePath, sha512URL, expectedFilename string, allowMissing boo
 	return nil
 }
 
+// lookupSHA512 returns the SHA512 of filename from the first of urls that has it, and
+// HTTP 200. The next URL is only tried when one answers 404, or when it is a fallback
+// (not the first URL, e.g. a release-wide checksumsFile) that does not list filename.
+// When no URL has the hash, it returns the status of the last one tried.
+func lookupSHA512(ctx context.Context, urls []string, filename string) (string, int, error) {
+	status := http.StatusNotFound
+
+	for i, u := range urls {
+		body, st, err := fetchChecksumFile(ctx, u)
+		if err != nil {
+			return "", 0, err
+		}
+
+		status = st
+		if status == http.StatusNotFound {
+			continue
+		}
+
+		if status != http.StatusOK {
+			return "", status, nil
+		}
+
+		hash, err := parseSHA512(body, filename)
+		if i > 0 && errors.Is(err, ErrSHA512NotFound) {
+			status = http.StatusNotFound
+			continue
+		}
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		return hash, http.StatusOK, nil
+	}
+
+	return "", status, nil
+}
+
+// fetchChecksumFile downloads one checksum file, returning its body only on HTTP 200.
+func fetchChecksumFile(ctx context.Context, url string) (string, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("embedded-clickhouse: download SHA512 %s: %w", redactURL(url), redactURLError(err))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("embedded-clickhouse: download SHA512 %s: %w", redactURL(url), redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", resp.StatusCode, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("embedded-clickhouse: read SHA512: %w", err)
+	}
+
+	return string(body), http.StatusOK, nil
+}
+
 // parseSHA512 parses a sha512sum-format string and returns the hex hash for the given filename.
 // Format: "<hash>  <filename>\n". It also tolerates two common real-world variants:
 //   - a GNU binary-mode marker ("<hash> *<filename>") and a "./<filename>" prefix on the
@@ -0,0 +1,110 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrDrainTimeout is returned by Stop when DrainOnStop is set and unfinished mutations
+// remain after the stop timeout. The server is stopped regardless.
+var ErrDrainTimeout = errors.New("embedded-clickhouse: mutations did not finish before stop")
+
+// ErrFlushTimeout is returned by Stop when FlushOnStop is set and inserts are still
+// running after the stop timeout. The server is stopped regardless.
+var ErrFlushTimeout = errors.New("embedded-clickhouse: inserts did not finish before stop")
+
+// runningInsertsQuery counts the INSERT queries the server is still executing.
+const runningInsertsQuery = "SELECT count() FROM system.processes WHERE query_kind = 'Insert'"
+
+// pendingMutationsQuery counts mutations that have not been applied to all parts yet.
+const pendingMutationsQuery = "SELECT count() FROM system.mutations WHERE NOT is_done"
+
+// drainServer waits for pending mutations on the server at httpPort to finish, then
+// issues SYSTEM STOP MERGES so no new background work starts before SIGTERM. Merges
+// are stopped only after the wait because mutations execute as merges.
+func drainServer(httpPort uint32, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := waitForZeroCount(ctx, httpPort, pendingMutationsQuery, ErrDrainTimeout); err != nil {
+		return err
+	}
+
+	if _, err := execHTTP(ctx, httpPort, "SYSTEM STOP MERGES"); err != nil {
+		return fmt.Errorf("embedded-clickhouse: stop merges: %w", err)
+	}
+
+	return nil
+}
+
+// flushServer waits for running inserts on the server at httpPort to finish, then
+// flushes the asynchronous insert queue and the system log tables, so everything
+// written before Stop is in table parts when SIGTERM arrives.
+func flushServer(httpPort uint32, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := waitForZeroCount(ctx, httpPort, runningInsertsQuery, ErrFlushTimeout); err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{"SYSTEM FLUSH ASYNC INSERT QUEUE", "SYSTEM FLUSH LOGS"} {
+		if _, err := execHTTPWithSettings(ctx, httpPort, stmt, internalQuerySettings()); err != nil {
+			return fmt.Errorf("embedded-clickhouse: %s: %w", stmt, err)
+		}
+	}
+
+	return nil
+}
+
+// waitForZeroCount polls the count() returned by query until it is 0. If ctx ends first
+// it returns timeoutErr with the last count seen, or with the last query error when the
+// server never answered.
+func waitForZeroCount(ctx context.Context, httpPort uint32, query string, timeoutErr error) error {
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+
+	// pending is the last count the server reported; it survives a final poll that
+	// fails only because the deadline cut it short.
+	pending := ""
+
+	for {
+		body, err := execHTTP(ctx, httpPort, query)
+		if err == nil {
+			pending = strings.TrimSpace(body)
+			if pending == "0" {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if pending == "" {
+				return fmt.Errorf("%w: %w", timeoutErr, err)
+			}
+
+			return fmt.Errorf("%w: %s pending", timeoutErr, pending)
+		case <-ticker.C:
+		}
+	}
+}
+
+// beforeStop runs the FlushOnStop and DrainOnStop steps cfg enables against the server
+// at httpPort, each within its own stop timeout. Their errors are joined; the server is
+// to be stopped regardless.
+func beforeStop(httpPort uint32, cfg Config) error {
+	var errs []error
+
+	if cfg.flushOnStop {
+		errs = append(errs, flushServer(httpPort, cfg.stopTimeout))
+	}
+
+	if cfg.drainOnStop {
+		errs = append(errs, drainServer(httpPort, cfg.stopTimeout))
+	}
+
+	return errors.Join(errs...)
+}
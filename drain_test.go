@@ -0,0 +1,245 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainServer_WaitsForMutations(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		pending = 2
+		queries []string
+	)
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queries = append(queries, query)
+
+		if query == pendingMutationsQuery {
+			io.WriteString(w, itoa(pending)+"\n")
+
+			pending--
+		}
+	})
+
+	require.NoError(t, drainServer(port, 5*time.Second))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, queries, 4)
+	assert.Equal(t, "SYSTEM STOP MERGES", queries[3], "merges must be stopped only after mutations drain")
+}
+
+func TestDrainServer_Timeout(t *testing.T) {
+	t.Parallel()
+
+	var stopped bool
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		if query == pendingMutationsQuery {
+			io.WriteString(w, "1\n")
+			return
+		}
+
+		stopped = true
+	})
+
+	err := drainServer(port, 300*time.Millisecond)
+	require.ErrorIs(t, err, ErrDrainTimeout)
+	assert.Contains(t, err.Error(), "1 pending")
+	assert.False(t, stopped, "merges should not be stopped when draining times out")
+}
+
+func TestDrainServer_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	// Nothing listens on the port: the drain gives up at the timeout instead of hanging.
+	port, err := allocatePort(portRange{})
+	require.NoError(t, err)
+
+	err = drainServer(port, 300*time.Millisecond)
+	require.ErrorIs(t, err, ErrDrainTimeout)
+}
+
+func TestFlushServer_WaitsForInserts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		running = 1
+		queries []string
+	)
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queries = append(queries, query)
+
+		if query == runningInsertsQuery {
+			io.WriteString(w, itoa(running)+"\n")
+
+			running--
+		}
+	})
+
+	require.NoError(t, flushServer(port, 5*time.Second))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{
+		runningInsertsQuery,
+		runningInsertsQuery,
+		"SYSTEM FLUSH ASYNC INSERT QUEUE",
+		"SYSTEM FLUSH LOGS",
+	}, queries)
+}
+
+func TestFlushServer_Timeout(t *testing.T) {
+	t.Parallel()
+
+	var flushed bool
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		if query == runningInsertsQuery {
+			io.WriteString(w, "2\n")
+			return
+		}
+
+		flushed = true
+	})
+
+	err := flushServer(port, 300*time.Millisecond)
+	require.ErrorIs(t, err, ErrFlushTimeout)
+	assert.Contains(t, err.Error(), "2 pending")
+	assert.False(t, flushed, "logs should not be flushed while inserts are running")
+}
+
+func TestBeforeStop_FlushesBeforeDraining(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queries = append(queries, query)
+
+		if strings.HasPrefix(query, "SELECT count()") {
+			io.WriteString(w, "0\n")
+		}
+	})
+
+	require.NoError(t, beforeStop(port, DefaultConfig()))
+	assert.Empty(t, queries, "nothing runs unless FlushOnStop or DrainOnStop is set")
+
+	require.NoError(t, beforeStop(port, DefaultConfig().FlushOnStop(true).DrainOnStop(true)))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{
+		runningInsertsQuery,
+		"SYSTEM FLUSH ASYNC INSERT QUEUE",
+		"SYSTEM FLUSH LOGS",
+		pendingMutationsQuery,
+		"SYSTEM STOP MERGES",
+	}, queries)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_FlushOnStop(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	cfg := DefaultConfig().Version(V25_3).DataPath(t.TempDir()).FlushOnStop(true).Logger(io.Discard)
+
+	s := NewServer(cfg)
+	require.NoError(t, s.Start())
+
+	_, err := s.ExecHTTP(ctx, "CREATE TABLE flushed (id UInt64) ENGINE = MergeTree ORDER BY id")
+	require.NoError(t, err)
+
+	// Fire-and-forget async insert: the rows sit in the async insert queue until flushed.
+	_, err = s.ExecHTTP(ctx, "INSERT INTO flushed SETTINGS async_insert = 1, wait_for_async_insert = 0, "+
+		"async_insert_busy_timeout_max_ms = 600000 VALUES (1), (2), (3)")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Stop())
+
+	s = NewServer(cfg)
+	require.NoError(t, s.Start())
+
+	defer s.Stop()
+
+	n, err := s.ScalarInt(ctx, "SELECT count() FROM flushed")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
+
+func TestIntegration_DrainOnStop(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	dataPath := t.TempDir()
+
+	cfg := DefaultConfig().Version(V25_3).DataPath(dataPath).DrainOnStop(true).Logger(io.Discard)
+
+	s := NewServer(cfg)
+	require.NoError(t, s.Start())
+
+	db, err := sql.Open("clickhouse", s.DSN())
+	require.NoError(t, err)
+
+	for _, q := range []string{
+		"CREATE TABLE drained (id UInt64, v UInt64) ENGINE = MergeTree ORDER BY id",
+		"INSERT INTO drained SELECT number, 0 FROM numbers(1000)",
+		"ALTER TABLE drained UPDATE v = 1 WHERE 1",
+	} {
+		_, err = db.ExecContext(ctx, q)
+		require.NoError(t, err)
+	}
+
+	db.Close()
+	require.NoError(t, s.Stop())
+
+	// The mutation finished before shutdown, so the restarted server sees its result.
+	s = NewServer(cfg)
+	require.NoError(t, s.Start())
+
+	defer s.Stop()
+
+	body, err := s.ExecHTTP(ctx, "SELECT countIf(v = 1) FROM drained")
+	require.NoError(t, err)
+	assert.Equal(t, "1000\n", body)
+}
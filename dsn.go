@@ -0,0 +1,164 @@
+package embeddedclickhouse
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDSN is returned by ParseDSN for a string that is not a single-host
+// clickhouse:// DSN.
+var ErrInvalidDSN = errors.New("embedded-clickhouse: invalid DSN")
+
+// dsnDatabaseParam is the DSNParams key Database stores the database under; it becomes
+// the DSN path rather than a query parameter.
+const dsnDatabaseParam = "database"
+
+// DSNParams holds query parameters for DSNWithParams, with typed setters for the common
+// clickhouse-go options. Like Config, every setter returns a copy:
+//
+//	dsn := ch.DSNWithParams(embeddedclickhouse.DSNParams{}.
+//		DialTimeout(5 * time.Second).
+//		Compress("lz4").
+//		MaxExecutionTime(time.Minute))
+type DSNParams map[string]string
+
+// with returns a copy of p with key set to value.
+func (p DSNParams) with(key, value string) DSNParams {
+	out := make(DSNParams, len(p)+1)
+	maps.Copy(out, p)
+	out[key] = value
+
+	return out
+}
+
+// Set sets an arbitrary parameter, e.g. a ClickHouse setting or a driver option without
+// a typed setter.
+func (p DSNParams) Set(key, value string) DSNParams {
+	return p.with(key, value)
+}
+
+// DialTimeout sets dial_timeout, the driver's connection timeout.
+func (p DSNParams) DialTimeout(d time.Duration) DSNParams {
+	return p.with("dial_timeout", d.String())
+}
+
+// ReadTimeout sets read_timeout, the driver's timeout for reading a server response.
+func (p DSNParams) ReadTimeout(d time.Duration) DSNParams {
+	return p.with("read_timeout", d.String())
+}
+
+// Compress sets compress, the driver's native-protocol compression method (e.g. "lz4",
+// "zstd").
+func (p DSNParams) Compress(method string) DSNParams {
+	return p.with("compress", method)
+}
+
+// MaxExecutionTime sets the max_execution_time setting, in whole seconds, for every
+// query on the connection.
+func (p DSNParams) MaxExecutionTime(d time.Duration) DSNParams {
+	return p.with("max_execution_time", strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// Database replaces the default database in the DSN path.
+func (p DSNParams) Database(name string) DSNParams {
+	return p.with(dsnDatabaseParam, name)
+}
+
+// Debug sets debug, which makes the driver log its protocol traffic.
+func (p DSNParams) Debug(debug bool) DSNParams {
+	return p.with("debug", strconv.FormatBool(debug))
+}
+
+// DSNWithParams returns DSN with params appended as URL-encoded query parameters, in
+// sorted key order (e.g. "clickhouse://127.0.0.1:19000/default?compress=lz4&dial_timeout=5s").
+// A "database" entry replaces the default database in the path. Accepts a plain
+// map[string]string or a DSNParams.
+func (e *EmbeddedClickHouse) DSNWithParams(params map[string]string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return dsnFor(e.tcpPort, params)
+}
+
+// DSNWithParams returns the DSNWithParams of the first node (shortcut for
+// Node(0).DSNWithParams(params)).
+func (c *Cluster) DSNWithParams(params map[string]string) string {
+	return c.Node(0).DSNWithParams(params)
+}
+
+// dsnFor builds the clickhouse-go DSN of the server on tcpPort with params.
+func dsnFor(tcpPort uint32, params map[string]string) string {
+	return BuildDSN("127.0.0.1", tcpPort, "default", params)
+}
+
+// BuildDSN returns the clickhouse-go DSN for database db on host:port, with params
+// appended as URL-encoded query parameters in sorted key order, e.g.
+// "clickhouse://127.0.0.1:19000/analytics?dial_timeout=5s". A "database" entry in params
+// (DSNParams.Database) replaces db. With an empty db the DSN names no database, so the
+// server picks the user's default one. It is what DSN and DSNWithParams use; ParseDSN
+// reverses it.
+func BuildDSN(host string, port uint32, db string, params map[string]string) string {
+	query := url.Values{}
+
+	for k, v := range params {
+		if k == dsnDatabaseParam {
+			db = v
+			continue
+		}
+
+		query.Set(k, v)
+	}
+
+	dsn := "clickhouse://" + net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+	if db != "" {
+		dsn += "/" + url.PathEscape(db)
+	}
+
+	if len(query) == 0 {
+		return dsn
+	}
+
+	return dsn + "?" + query.Encode()
+}
+
+// ParseDSN splits a single-host clickhouse:// DSN, as built by BuildDSN or returned by
+// DSN, into its host, port and database. db is "" when the DSN names no database.
+// Credentials and query parameters are accepted and ignored. Anything else, including a
+// missing port or several comma-separated hosts (LoadBalancedDSN), fails with ErrInvalidDSN.
+func ParseDSN(dsn string) (host string, port uint32, db string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("%w: %w", ErrInvalidDSN, err)
+	}
+
+	if u.Scheme != "clickhouse" {
+		return "", 0, "", fmt.Errorf("%w: %q: scheme must be clickhouse", ErrInvalidDSN, dsn)
+	}
+
+	if strings.Contains(u.Host, ",") {
+		return "", 0, "", fmt.Errorf("%w: %q: names more than one host", ErrInvalidDSN, dsn)
+	}
+
+	p, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil || u.Hostname() == "" {
+		return "", 0, "", fmt.Errorf("%w: %q: want host:port", ErrInvalidDSN, dsn)
+	}
+
+	// The escaped path keeps a database name containing an escaped "/" in one segment.
+	path := strings.TrimPrefix(u.EscapedPath(), "/")
+	if strings.Contains(path, "/") {
+		return "", 0, "", fmt.Errorf("%w: %q: path has more than a database", ErrInvalidDSN, dsn)
+	}
+
+	if db, err = url.PathUnescape(path); err != nil {
+		return "", 0, "", fmt.Errorf("%w: %w", ErrInvalidDSN, err)
+	}
+
+	return u.Hostname(), uint32(p), db, nil
+}
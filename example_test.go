@@ -41,17 +41,20 @@ func ExampleNewServerForTest() {
 	// Output:
 }
 
-// ExampleConfig_Settings demonstrates builder chaining and Settings usage.
-func ExampleConfig_Settings() {
+// ExampleConfig_ServerSettings demonstrates builder chaining with server-level settings
+// in ServerSettings and query-level ones in ProfileSettings.
+func ExampleConfig_ServerSettings() {
 	cfg := embeddedclickhouse.DefaultConfig().
 		Version(embeddedclickhouse.V25_3).
 		TCPPort(19000).
 		HTTPPort(18123).
 		StartTimeout(60 * time.Second).
 		Logger(io.Discard).
-		Settings(map[string]string{
-			"max_threads":             "2",
+		ServerSettings(map[string]string{
 			"max_server_memory_usage": "2147483648", // 2 GiB
+		}).
+		ProfileSettings(map[string]string{
+			"max_threads": "2",
 		})
 
 	_ = cfg
@@ -3,19 +3,38 @@ package embeddedclickhouse
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
+// maxLinkHops bounds how many symlink/hardlink entries extractClickHouseBinary follows
+// to reach the real binary, so a link cycle in the archive cannot loop forever.
+const maxLinkHops = 8
+
+// defaultMaxBinarySize is the MaxBinarySize used when none is configured. Real
+// ClickHouse binaries are well under 1 GiB.
+const defaultMaxBinarySize int64 = 4 << 30
+
+// normalizeTarPath cleans a tar entry name to a slash-separated archive path without a
+// leading "./" (e.g. "./usr/bin/clickhouse" becomes "usr/bin/clickhouse").
+func normalizeTarPath(name string) string {
+	clean := path.Clean(filepath.ToSlash(name))
+
+	return strings.TrimPrefix(clean, "./")
+}
+
 // isClickHouseBinaryPath returns true if the tar entry path looks like
 // the main ClickHouse server binary (e.g., "*/usr/bin/clickhouse" or "*/bin/clickhouse").
 // This avoids matching bash-completion scripts and other files also named "clickhouse".
 func isClickHouseBinaryPath(name string) bool {
-	// Normalize to forward slashes for matching.
-	clean := filepath.ToSlash(filepath.Clean(name))
+	clean := normalizeTarPath(name)
 
 	return strings.HasSuffix(clean, "/usr/bin/clickhouse") ||
 		strings.HasSuffix(clean, "/bin/clickhouse") ||
@@ -24,18 +43,118 @@ func isClickHouseBinaryPath(name string) bool {
 		clean == "clickhouse"
 }
 
+// isRootClickHouseExecutable reports whether hdr is an executable regular file at the
+// archive root named like the ClickHouse binary (e.g. "clickhouse-25.8"). It is the
+// last-resort match for repackaged archives without a bin/ directory; the executable bit
+// keeps it from picking up completion scripts and other data files.
+func isRootClickHouseExecutable(hdr *tar.Header) bool {
+	clean := normalizeTarPath(hdr.Name)
+
+	return hdr.Typeflag == tar.TypeReg &&
+		hdr.Mode&0o111 != 0 &&
+		!strings.Contains(clean, "/") &&
+		strings.HasPrefix(clean, "clickhouse")
+}
+
+// linkTargetPath resolves the archive path a symlink or hardlink entry points to.
+// Hardlink names are archive paths already; symlink targets are relative to the link's
+// directory, or to the archive root when absolute. A target that climbs out of the
+// archive root is rejected with ErrInvalidPath.
+func linkTargetPath(hdr *tar.Header) (string, error) {
+	target := filepath.ToSlash(hdr.Linkname)
+
+	if hdr.Typeflag == tar.TypeSymlink && !path.IsAbs(target) {
+		target = path.Join(path.Dir(normalizeTarPath(hdr.Name)), target)
+	}
+
+	target = normalizeTarPath(strings.TrimLeft(target, "/"))
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", fmt.Errorf("%w: link %s -> %s escapes the archive", ErrInvalidPath, hdr.Name, hdr.Linkname)
+	}
+
+	return target, nil
+}
+
+// validateTarName rejects entry names that could escape an extraction root: absolute
+// paths (including Windows volume names) and names with a ".." component.
+func validateTarName(name string) error {
+	slashed := filepath.ToSlash(name)
+
+	if path.IsAbs(slashed) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return fmt.Errorf("%w: absolute archive entry %q", ErrInvalidPath, name)
+	}
+
+	if slices.Contains(strings.Split(slashed, "/"), "..") {
+		return fmt.Errorf("%w: archive entry %q contains ..", ErrInvalidPath, name)
+	}
+
+	return nil
+}
+
 // extractClickHouseBinary extracts the clickhouse binary from a .tgz archive.
-// It looks for the file at a bin/ path (e.g., usr/bin/clickhouse).
-func extractClickHouseBinary(archivePath, destPath string) error {
+// It looks for the file at a bin/ path (e.g., usr/bin/clickhouse). When that entry is a
+// symlink or hardlink (e.g. to a versioned file), the link is followed to its target
+// within the archive, re-reading the archive since the target may precede the link.
+// Only when no entry matches does it fall back to the first executable file at the
+// archive root whose name starts with "clickhouse" (isRootClickHouseExecutable).
+// Archives with absolute or ".." entry names are rejected with ErrInvalidPath, and a
+// binary larger than maxSize (defaultMaxBinarySize when <= 0) with ErrBinaryTooLarge.
+func extractClickHouseBinary(ctx context.Context, archivePath, destPath string, maxSize int64) error {
+	_, span := startSpan(ctx, "embedded-clickhouse.extract")
+	defer timePhase(ctx, "extract")()
+
+	err := extractBinary(archivePath, destPath, maxSize)
+	if info, statErr := os.Stat(destPath); err == nil && statErr == nil {
+		span.SetAttributes(attrBytes.Int64(info.Size()))
+	}
+
+	endSpan(span, err)
+
+	return err
+}
+
+// extractBinary implements extractClickHouseBinary.
+func extractBinary(archivePath, destPath string, maxSize int64) error {
+	if maxSize <= 0 {
+		maxSize = defaultMaxBinarySize
+	}
+
+	match := func(hdr *tar.Header) bool { return isClickHouseBinaryPath(hdr.Name) }
+
+	for hop := range maxLinkHops + 1 {
+		target, err := extractTarEntry(archivePath, destPath, maxSize, match)
+		if hop == 0 && errors.Is(err, ErrBinaryNotFound) {
+			target, err = extractTarEntry(archivePath, destPath, maxSize, isRootClickHouseExecutable)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if target == "" {
+			return nil
+		}
+
+		match = func(hdr *tar.Header) bool { return normalizeTarPath(hdr.Name) == target }
+	}
+
+	return fmt.Errorf("%w: %s: too many links", ErrBinaryNotFound, archivePath)
+}
+
+// extractTarEntry scans the archive for the first regular file or link entry accepted by
+// match. A regular file is written to destPath and "" is returned; for a link, nothing
+// is written and the archive path of its target is returned. Every header up to the
+// match is validated with validateTarName.
+func extractTarEntry(archivePath, destPath string, maxSize int64, match func(hdr *tar.Header) bool) (string, error) {
 	f, err := os.Open(archivePath)
 	if err != nil {
-		return fmt.Errorf("embedded-clickhouse: open archive: %w", err)
+		return "", fmt.Errorf("embedded-clickhouse: open archive: %w", err)
 	}
 	defer f.Close()
 
 	gz, err := gzip.NewReader(f)
 	if err != nil {
-		return fmt.Errorf("embedded-clickhouse: gzip reader: %w", err)
+		return "", fmt.Errorf("embedded-clickhouse: gzip reader: %w", err)
 	}
 	defer gz.Close()
 
@@ -47,25 +166,35 @@ func extractClickHouseBinary(archivePath, destPath string) error {
 		}
 
 		if err != nil {
-			return fmt.Errorf("embedded-clickhouse: tar reader: %w", err)
+			return "", fmt.Errorf("embedded-clickhouse: tar reader: %w", err)
 		}
 
-		if hdr.Typeflag != tar.TypeReg {
-			continue
+		if err := validateTarName(hdr.Name); err != nil {
+			return "", err
 		}
 
-		if !isClickHouseBinaryPath(hdr.Name) {
+		if !match(hdr) {
 			continue
 		}
 
-		return writeExecutable(tr, destPath)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			if hdr.Size > maxSize {
+				return "", fmt.Errorf("%w: %s is %d bytes (limit %d)", ErrBinaryTooLarge, hdr.Name, hdr.Size, maxSize)
+			}
+
+			return "", writeExecutable(tr, destPath, maxSize)
+		case tar.TypeSymlink, tar.TypeLink:
+			return linkTargetPath(hdr)
+		}
 	}
 
-	return fmt.Errorf("%w: %s", ErrBinaryNotFound, archivePath)
+	return "", fmt.Errorf("%w: %s", ErrBinaryNotFound, archivePath)
 }
 
-// writeExecutable writes reader content to destPath atomically via a temp file.
-func writeExecutable(r io.Reader, destPath string) error {
+// writeExecutable writes reader content to destPath atomically via a temp file. It
+// copies at most maxSize bytes and fails with ErrBinaryTooLarge if r holds more.
+func writeExecutable(r io.Reader, destPath string, maxSize int64) error {
 	// Sanitize before any filesystem mutation to prevent path traversal.
 	destPath = filepath.Clean(destPath)
 	if strings.Contains(destPath, "..") {
@@ -84,13 +213,22 @@ func writeExecutable(r io.Reader, destPath string) error {
 
 	tmp := out.Name()
 
-	if _, err := io.Copy(out, r); err != nil {
+	// Copy one byte past the limit to tell "exactly maxSize" from "more than maxSize".
+	n, err := io.Copy(out, io.LimitReader(r, maxSize+1))
+	if err != nil {
 		out.Close()
 		os.Remove(tmp)
 
 		return fmt.Errorf("embedded-clickhouse: write binary: %w", err)
 	}
 
+	if n > maxSize {
+		out.Close()
+		os.Remove(tmp)
+
+		return fmt.Errorf("%w: limit %d bytes", ErrBinaryTooLarge, maxSize)
+	}
+
 	if err := out.Close(); err != nil {
 		os.Remove(tmp)
 		return fmt.Errorf("embedded-clickhouse: close temp file: %w", err)
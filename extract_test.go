@@ -1,7 +1,11 @@
 package embeddedclickhouse
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,7 +24,7 @@ func TestExtractClickHouseBinary(t *testing.T) {
 	destDir := t.TempDir()
 	destPath := filepath.Join(destDir, "clickhouse")
 
-	err := extractClickHouseBinary(archivePath, destPath)
+	err := extractClickHouseBinary(context.Background(), archivePath, destPath, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -44,10 +48,300 @@ func TestExtractClickHouseBinary(t *testing.T) {
 	}
 }
 
+func TestExtractClickHouseBinary_Fixtures(t *testing.T) {
+	t.Parallel()
+
+	// Each fixture stores the binary differently; all must yield the real file content.
+	for _, name := range []string{
+		"clickhouse-dotslash.tgz", // ./usr/bin/clickhouse
+		"clickhouse-symlink.tgz",  // usr/bin/clickhouse -> clickhouse-25.3.1 (target after link)
+		"clickhouse-hardlink.tgz", // usr/bin/clickhouse hardlinked to an earlier versioned file
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			destPath := filepath.Join(t.TempDir(), "clickhouse")
+
+			if err := extractClickHouseBinary(context.Background(), filepath.Join("testdata", name), destPath, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(destPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != "#!/bin/sh\necho clickhouse\n" {
+				t.Errorf("extracted content = %q, want the fake binary", content)
+			}
+		})
+	}
+}
+
+func TestExtractClickHouseBinary_LinkCycle(t *testing.T) {
+	t.Parallel()
+
+	archivePath := filepath.Join(t.TempDir(), "cycle.tgz")
+	writeTarGz(t, archivePath, []*tar.Header{
+		{Name: "usr/bin/clickhouse", Typeflag: tar.TypeSymlink, Linkname: "a"},
+		{Name: "usr/bin/a", Typeflag: tar.TypeSymlink, Linkname: "b"},
+		{Name: "usr/bin/b", Typeflag: tar.TypeSymlink, Linkname: "a"},
+	})
+
+	err := extractClickHouseBinary(context.Background(), archivePath, filepath.Join(t.TempDir(), "clickhouse"), 0)
+	if !errors.Is(err, ErrBinaryNotFound) {
+		t.Fatalf("err = %v, want ErrBinaryNotFound", err)
+	}
+}
+
+func TestExtractClickHouseBinary_RootFallback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		want    string // extracted content (the entry name); "" for ErrBinaryNotFound
+	}{
+		{
+			name: "versioned name at root",
+			headers: []*tar.Header{
+				{Name: "clickhouse-completion", Typeflag: tar.TypeReg, Mode: 0o644},
+				{Name: "README.md", Typeflag: tar.TypeReg},
+				{Name: "./clickhouse-25.8", Typeflag: tar.TypeReg},
+			},
+			want: "./clickhouse-25.8",
+		},
+		{
+			name: "bin path preferred",
+			headers: []*tar.Header{
+				{Name: "clickhouse-25.8", Typeflag: tar.TypeReg},
+				{Name: "usr/bin/clickhouse", Typeflag: tar.TypeReg},
+			},
+			want: "usr/bin/clickhouse",
+		},
+		{
+			name: "not executable",
+			headers: []*tar.Header{
+				{Name: "clickhouse-25.8", Typeflag: tar.TypeReg, Mode: 0o644},
+			},
+		},
+		{
+			name: "not at root",
+			headers: []*tar.Header{
+				{Name: "share/clickhouse-25.8", Typeflag: tar.TypeReg},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			archivePath := filepath.Join(t.TempDir(), "archive.tgz")
+			writeTarGz(t, archivePath, tt.headers)
+
+			destPath := filepath.Join(t.TempDir(), "clickhouse")
+			err := extractClickHouseBinary(context.Background(), archivePath, destPath, 0)
+
+			if tt.want == "" {
+				if !errors.Is(err, ErrBinaryNotFound) {
+					t.Fatalf("err = %v, want ErrBinaryNotFound", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(destPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != tt.want {
+				t.Errorf("extracted %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractClickHouseBinary_RejectsUnsafeNames(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string][]*tar.Header{
+		"absolute":      {{Name: "/usr/bin/clickhouse", Typeflag: tar.TypeReg}},
+		"dotdot":        {{Name: "../../usr/bin/clickhouse", Typeflag: tar.TypeReg}},
+		"inner dotdot":  {{Name: "pkg/../../etc/passwd", Typeflag: tar.TypeReg}, {Name: "usr/bin/clickhouse", Typeflag: tar.TypeReg}},
+		"escaping link": {{Name: "usr/bin/clickhouse", Typeflag: tar.TypeSymlink, Linkname: "../../../etc/passwd"}},
+	}
+
+	for name, headers := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			archivePath := filepath.Join(t.TempDir(), "unsafe.tgz")
+			writeTarGz(t, archivePath, headers)
+
+			destPath := filepath.Join(t.TempDir(), "clickhouse")
+
+			err := extractClickHouseBinary(context.Background(), archivePath, destPath, 0)
+			if !errors.Is(err, ErrInvalidPath) {
+				t.Fatalf("err = %v, want ErrInvalidPath", err)
+			}
+
+			if _, statErr := os.Stat(destPath); !os.IsNotExist(statErr) {
+				t.Errorf("nothing should be extracted, stat err = %v", statErr)
+			}
+		})
+	}
+}
+
+func TestExtractClickHouseBinary_MaxSize(t *testing.T) {
+	t.Parallel()
+
+	archivePath := filepath.Join(t.TempDir(), "big.tgz")
+	// writeTarGz stores the entry name as content: 18 bytes.
+	writeTarGz(t, archivePath, []*tar.Header{{Name: "usr/bin/clickhouse", Typeflag: tar.TypeReg}})
+
+	destPath := filepath.Join(t.TempDir(), "clickhouse")
+
+	err := extractClickHouseBinary(context.Background(), archivePath, destPath, 17)
+	if !errors.Is(err, ErrBinaryTooLarge) {
+		t.Fatalf("err = %v, want ErrBinaryTooLarge", err)
+	}
+
+	if err := extractClickHouseBinary(context.Background(), archivePath, destPath, 18); err != nil {
+		t.Fatalf("binary exactly at the limit: %v", err)
+	}
+}
+
+func TestWriteExecutable_MaxSize(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	destPath := filepath.Join(dir, "clickhouse")
+
+	// The reader is larger than its (unknown) declared size: the copy itself must stop.
+	err := writeExecutable(strings.NewReader("0123456789"), destPath, 4)
+	if !errors.Is(err, ErrBinaryTooLarge) {
+		t.Fatalf("err = %v, want ErrBinaryTooLarge", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
+
+func TestLinkTargetPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		hdr  tar.Header
+		want string
+	}{
+		{
+			name: "relative symlink",
+			hdr:  tar.Header{Name: "./usr/bin/clickhouse", Typeflag: tar.TypeSymlink, Linkname: "clickhouse-25.3"},
+			want: "usr/bin/clickhouse-25.3",
+		},
+		{
+			name: "symlink to parent dir",
+			hdr:  tar.Header{Name: "pkg/usr/bin/clickhouse", Typeflag: tar.TypeSymlink, Linkname: "../lib/clickhouse"},
+			want: "pkg/usr/lib/clickhouse",
+		},
+		{
+			name: "absolute symlink is archive-rooted",
+			hdr:  tar.Header{Name: "usr/bin/clickhouse", Typeflag: tar.TypeSymlink, Linkname: "/opt/clickhouse"},
+			want: "opt/clickhouse",
+		},
+		{
+			name: "hardlink is an archive path",
+			hdr:  tar.Header{Name: "usr/bin/clickhouse", Typeflag: tar.TypeLink, Linkname: "./opt/clickhouse"},
+			want: "opt/clickhouse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := linkTargetPath(&tt.hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("linkTargetPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsClickHouseBinaryPath_DotSlash(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"./usr/bin/clickhouse", "./clickhouse", "./pkg/usr/bin/clickhouse"} {
+		if !isClickHouseBinaryPath(name) {
+			t.Errorf("isClickHouseBinaryPath(%q) = false, want true", name)
+		}
+	}
+}
+
+// writeTarGz writes a .tgz containing the given headers; regular entries get their Name
+// as content.
+func writeTarGz(t *testing.T, archivePath string, headers []*tar.Header) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, hdr := range headers {
+		var body []byte
+		if hdr.Typeflag == tar.TypeReg {
+			body = []byte(hdr.Name)
+			hdr.Size = int64(len(body))
+		}
+
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o755
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestExtractClickHouseBinary_MissingArchive(t *testing.T) {
 	t.Parallel()
 
-	err := extractClickHouseBinary("/nonexistent/archive.tgz", filepath.Join(t.TempDir(), "clickhouse"))
+	err := extractClickHouseBinary(context.Background(), "/nonexistent/archive.tgz", filepath.Join(t.TempDir(), "clickhouse"), 0)
 	if err == nil {
 		t.Fatal("expected error for missing archive")
 	}
@@ -62,7 +356,7 @@ func TestExtractClickHouseBinary_NotATgz(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := extractClickHouseBinary(tmpFile, filepath.Join(t.TempDir(), "clickhouse"))
+	err := extractClickHouseBinary(context.Background(), tmpFile, filepath.Join(t.TempDir(), "clickhouse"), 0)
 	if err == nil {
 		t.Fatal("expected error for non-gzip file")
 	}
@@ -103,7 +397,7 @@ func TestWriteExecutable_ConcurrentNoTruncate(t *testing.T) {
 
 			<-start
 
-			errs[idx] = writeExecutable(bytes.NewReader(payloads[idx]), destPath)
+			errs[idx] = writeExecutable(bytes.NewReader(payloads[idx]), destPath, defaultMaxBinarySize)
 		}(i)
 	}
 
@@ -2,8 +2,11 @@ package embeddedclickhouse
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"time"
 )
@@ -13,27 +16,53 @@ const (
 	healthRequestTimeout = 2 * time.Second
 )
 
-// waitForReady polls the ClickHouse HTTP /ping endpoint until it returns HTTP 200 or the context is cancelled.
-func waitForReady(ctx context.Context, httpPort uint32) error {
-	url := fmt.Sprintf("http://127.0.0.1:%d/ping", httpPort)
+// httpReadiness returns the HTTP readiness check of the server on httpPort: probe (the
+// ReadinessProbe), called with the server's base URL and bounded by healthRequestTimeout,
+// or else, when probe is nil, a GET /ping expecting HTTP 200.
+func httpReadiness(httpPort uint32, probe func(ctx context.Context, baseURL string) bool) func(context.Context) bool {
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", httpPort)
+
+	if probe != nil {
+		return func(ctx context.Context) bool {
+			ctx, cancel := context.WithTimeout(ctx, healthRequestTimeout)
+			defer cancel()
+
+			return probe(ctx, baseURL)
+		}
+	}
+
 	client := &http.Client{Timeout: healthRequestTimeout}
 
+	return func(ctx context.Context) bool {
+		return ping(ctx, client, baseURL+"/ping")
+	}
+}
+
+// waitForReady polls the server's HTTP readiness check (see httpReadiness) until it
+// succeeds or the context is cancelled, with cfg's ReadinessProbe and HealthPollBackoff.
+func waitForReady(ctx context.Context, httpPort uint32, cfg Config) error {
+	ready := httpReadiness(httpPort, cfg.readinessProbe)
+
 	// Immediate poll to avoid unnecessary 100ms latency when the server is already up.
-	if ping(ctx, client, url) {
+	if ready(ctx) {
 		return nil
 	}
 
-	ticker := time.NewTicker(healthPollInterval)
-	defer ticker.Stop()
+	p := newPoller(healthPollInterval, cfg.healthPollBackoff)
+
+	timer := time.NewTimer(p.next())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("embedded-clickhouse: server did not become ready: %w", ctx.Err())
-		case <-ticker.C:
-			if ping(ctx, client, url) {
+		case <-timer.C:
+			if ready(ctx) {
 				return nil
 			}
+
+			timer.Reset(p.next())
 		}
 	}
 }
@@ -48,16 +77,63 @@ func exitError(proc *process) error {
 	return ErrServerExited
 }
 
-// waitForReadyOrExit polls the ClickHouse HTTP /ping endpoint until it returns HTTP 200,
-// the context is cancelled, or the server process exits. If the process exits before
+// waitForReadyOrExit polls the server's HTTP readiness check (see httpReadiness) until it
+// succeeds, the context is cancelled, or the server process exits. If the process exits before
 // becoming ready, it returns ErrServerExited (wrapping the underlying wait error, if any)
 // immediately instead of burning the entire start timeout. Process exit always wins over
 // a readiness response, so a child that has already died is never reported ready (even if
 // another process answers /ping on a user-fixed port).
-func waitForReadyOrExit(ctx context.Context, httpPort uint32, proc *process) error {
-	url := fmt.Sprintf("http://127.0.0.1:%d/ping", httpPort)
+//
+// Only 127.0.0.1 counts: ClickHouse binds ::1 and 127.0.0.1 separately, and the DSN and
+// accessors use the IPv4 address, so a server reachable on [::1] alone is not ready. When
+// the wait times out that way, the error wraps ErrIPv4LoopbackNotReady.
+func waitForReadyOrExit(ctx context.Context, httpPort uint32, proc *process, cfg Config) error {
+	err := waitForProbeOrExit(ctx, proc, cfg.healthPollBackoff, httpReadiness(httpPort, cfg.readinessProbe))
+	if errors.Is(err, context.DeadlineExceeded) && answersOnIPv6Only(httpPort) {
+		return fmt.Errorf("%w: %w", ErrIPv4LoopbackNotReady, err)
+	}
+
+	return err
+}
+
+// answersOnIPv6Only reports whether /ping on httpPort answers on [::1] but not on
+// 127.0.0.1. It runs after the start context is done, so it has its own timeout.
+func answersOnIPv6Only(httpPort uint32) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthRequestTimeout)
+	defer cancel()
+
 	client := &http.Client{Timeout: healthRequestTimeout}
 
+	return ping(ctx, client, fmt.Sprintf("http://[::1]:%d/ping", httpPort)) &&
+		!ping(ctx, client, fmt.Sprintf("http://127.0.0.1:%d/ping", httpPort))
+}
+
+// waitForServerReady runs both readiness stages for a freshly started server: the HTTP
+// /ping check, then the native-protocol handshake.
+func waitForServerReady(ctx context.Context, httpPort, tcpPort uint32, proc *process, cfg Config) error {
+	if err := waitForReadyOrExit(ctx, httpPort, proc, cfg); err != nil {
+		return err
+	}
+
+	return waitForNativeReadyOrExit(ctx, tcpPort, proc, cfg)
+}
+
+// waitForNativeReadyOrExit is the native-protocol counterpart of waitForReadyOrExit: it
+// polls until the TCP port completes a protocol handshake (see nativeHello). The HTTP
+// listener can come up slightly before the native one, so Start runs this after the
+// /ping check to guarantee that a driver connecting over TCP succeeds on first try.
+func waitForNativeReadyOrExit(ctx context.Context, tcpPort uint32, proc *process, cfg Config) error {
+	return waitForProbeOrExit(ctx, proc, cfg.healthPollBackoff, func(ctx context.Context) bool {
+		return nativeHello(ctx, tcpPort)
+	})
+}
+
+// waitForProbeOrExit polls probe until it reports ready, the context is cancelled, or
+// the server process exits, with the exit semantics documented on waitForReadyOrExit.
+// The polls back off up to maxInterval (see newPoller).
+func waitForProbeOrExit(
+	ctx context.Context, proc *process, maxInterval time.Duration, probe func(context.Context) bool,
+) error {
 	// exited reports the process-exit error if the child has already exited, else nil.
 	exited := func() error {
 		select {
@@ -69,14 +145,14 @@ func waitForReadyOrExit(ctx context.Context, httpPort uint32, proc *process) err
 	}
 
 	// check reports (ready, error): error if the process exited (checked both before and
-	// after the ping, so a child that dies around the probe is never reported ready);
-	// ready is true only on a /ping 200.
+	// after the probe, so a child that dies around the probe is never reported ready);
+	// ready is true only when the probe succeeds.
 	check := func() (bool, error) {
 		if err := exited(); err != nil {
 			return false, err
 		}
 
-		if !ping(ctx, client, url) {
+		if !probe(ctx) {
 			return false, nil
 		}
 
@@ -92,8 +168,10 @@ func waitForReadyOrExit(ctx context.Context, httpPort uint32, proc *process) err
 		return err
 	}
 
-	ticker := time.NewTicker(healthPollInterval)
-	defer ticker.Stop()
+	p := newPoller(healthPollInterval, maxInterval)
+
+	timer := time.NewTimer(p.next())
+	defer timer.Stop()
 
 	for {
 		select {
@@ -106,10 +184,12 @@ func waitForReadyOrExit(ctx context.Context, httpPort uint32, proc *process) err
 			return fmt.Errorf("embedded-clickhouse: server did not become ready: %w", ctx.Err())
 		case <-proc.done:
 			return exitError(proc)
-		case <-ticker.C:
+		case <-timer.C:
 			if ready, err := check(); err != nil || ready {
 				return err
 			}
+
+			timer.Reset(p.next())
 		}
 	}
 }
@@ -130,3 +210,59 @@ func ping(ctx context.Context, client *http.Client, url string) bool {
 
 	return resp.StatusCode == http.StatusOK
 }
+
+// Native protocol constants used by nativeHello.
+const (
+	nativeClientHello     = 0     // client packet type: Hello
+	nativeServerHello     = 0     // server packet type: Hello
+	nativeServerException = 2     // server packet type: Exception
+	nativeProtocolVersion = 54213 // a long-supported protocol revision; only the reply type matters
+)
+
+// nativeHello reports whether the native TCP port completes a protocol handshake. It
+// sends a ClientHello for the default user and accepts either a ServerHello or an
+// Exception packet in reply: both prove the listener is serving the native protocol
+// (an Exception just means the credentials were rejected, e.g. after RBAC seeding).
+func nativeHello(ctx context.Context, tcpPort uint32) bool {
+	dialer := net.Dialer{Timeout: healthRequestTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", tcpPort))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(healthRequestTimeout))
+
+	if _, err := conn.Write(clientHelloPacket()); err != nil {
+		return false
+	}
+
+	// Packet types are small uvarints, so the first byte is the whole type.
+	var reply [1]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return false
+	}
+
+	return reply[0] == nativeServerHello || reply[0] == nativeServerException
+}
+
+// clientHelloPacket encodes a native-protocol ClientHello: the packet type, client name,
+// version major/minor, protocol revision, then database, user, and password. Integers
+// are uvarints and strings are uvarint-length-prefixed bytes.
+func clientHelloPacket() []byte {
+	appendString := func(b []byte, s string) []byte {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		return append(b, s...)
+	}
+
+	b := binary.AppendUvarint(nil, nativeClientHello)
+	b = appendString(b, "embedded-clickhouse")
+	b = binary.AppendUvarint(b, 1)
+	b = binary.AppendUvarint(b, 0)
+	b = binary.AppendUvarint(b, nativeProtocolVersion)
+	b = appendString(b, "default")
+	b = appendString(b, "default")
+
+	return appendString(b, "")
+}
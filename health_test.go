@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -38,7 +39,7 @@ func TestWaitForReady_ImmediateSuccess(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err = waitForReady(ctx, port)
+	err = waitForReady(ctx, port, DefaultConfig())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +49,7 @@ func TestWaitForReady_Timeout(t *testing.T) {
 	t.Parallel()
 
 	// Use a port that nothing is listening on.
-	port, err := allocatePort()
+	port, err := allocatePort(portRange{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -56,7 +57,7 @@ func TestWaitForReady_Timeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
 	defer cancel()
 
-	err = waitForReady(ctx, port)
+	err = waitForReady(ctx, port, DefaultConfig())
 	if err == nil {
 		t.Fatal("expected timeout error")
 	}
@@ -106,7 +107,7 @@ func TestWaitForReady_DelayedStart(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err = waitForReady(ctx, port)
+	err = waitForReady(ctx, port, DefaultConfig())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,7 +140,7 @@ func TestWaitForReadyOrExit_ReadyWins(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := waitForReadyOrExit(ctx, port, proc); err != nil {
+	if err := waitForReadyOrExit(ctx, port, proc, DefaultConfig()); err != nil {
 		t.Fatalf("waitForReadyOrExit = %v, want nil", err)
 	}
 }
@@ -179,7 +180,7 @@ func TestWaitForReadyOrExit_EarlyExit(t *testing.T) {
 	defer cancel()
 
 	start := time.Now()
-	err = waitForReadyOrExit(ctx, port, proc)
+	err = waitForReadyOrExit(ctx, port, proc, DefaultConfig())
 	elapsed := time.Since(start)
 
 	if !errors.Is(err, ErrServerExited) {
@@ -216,3 +217,234 @@ func TestPing(t *testing.T) {
 		t.Error("ping should return true")
 	}
 }
+
+// fakeNativeServer listens on loopback and answers every connection by reading the
+// client's hello and writing reply (if non-nil) before closing. Returns the port.
+func fakeNativeServer(t *testing.T, reply []byte) uint32 {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			buf := make([]byte, 256)
+			conn.Read(buf)
+
+			if reply != nil {
+				conn.Write(reply)
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return uint32(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestNativeHello(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		reply []byte
+		want  bool
+	}{
+		{name: "server hello", reply: []byte{nativeServerHello, 0x0a}, want: true},
+		{name: "exception still means serving", reply: []byte{nativeServerException, 0x00}, want: true},
+		{name: "unexpected packet", reply: []byte{0x05}, want: false},
+		{name: "closed without reply", reply: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			port := fakeNativeServer(t, tt.reply)
+
+			if got := nativeHello(context.Background(), port); got != tt.want {
+				t.Errorf("nativeHello = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNativeHello_NothingListening(t *testing.T) {
+	t.Parallel()
+
+	port, err := allocatePort(portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nativeHello(context.Background(), port) {
+		t.Error("nativeHello should be false with nothing listening")
+	}
+}
+
+func TestClientHelloPacket(t *testing.T) {
+	t.Parallel()
+
+	pkt := clientHelloPacket()
+
+	if pkt[0] != nativeClientHello {
+		t.Fatalf("packet type = %d, want %d", pkt[0], nativeClientHello)
+	}
+
+	// Packet type, then the length-prefixed client name.
+	name := "embedded-clickhouse"
+	if int(pkt[1]) != len(name) || string(pkt[2:2+len(name)]) != name {
+		t.Errorf("client name not encoded as a length-prefixed string: %q", pkt[:2+len(name)])
+	}
+}
+
+func TestWaitForNativeReadyOrExit_EarlyExit(t *testing.T) {
+	t.Parallel()
+
+	// Holds the port and never replies, so only the process exit can end the wait.
+	port := fakeNativeServer(t, nil)
+
+	done := make(chan struct{})
+	close(done)
+
+	proc := &process{cmd: nil, done: done, waitErr: errTestProcExit}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := waitForNativeReadyOrExit(ctx, port, proc, DefaultConfig()); !errors.Is(err, ErrServerExited) {
+		t.Fatalf("waitForNativeReadyOrExit = %v, want ErrServerExited", err)
+	}
+}
+
+func TestWaitForServerReady(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Ok.\n")
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpPort := uint32(l.Addr().(*net.TCPAddr).Port)
+
+	srv := &http.Server{Handler: mux}
+
+	go srv.Serve(l)
+	defer srv.Close()
+
+	tcpPort := fakeNativeServer(t, []byte{nativeServerHello})
+	proc := &process{cmd: nil, done: make(chan struct{}), waitErr: nil}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := waitForServerReady(ctx, httpPort, tcpPort, proc, DefaultConfig()); err != nil {
+		t.Fatalf("waitForServerReady = %v, want nil", err)
+	}
+}
+
+func TestWaitForReady_ReadinessProbe(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls   atomic.Int32
+		baseURL atomic.Value
+	)
+
+	probe := func(ctx context.Context, url string) bool {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("probe context has no deadline")
+		}
+
+		baseURL.Store(url)
+
+		return calls.Add(1) == 3
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nothing listens on the port: only the probe decides readiness.
+	if err := waitForReady(ctx, 1, DefaultConfig().ReadinessProbe(probe)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("probe called %d times, want 3", got)
+	}
+
+	if got := baseURL.Load(); got != "http://127.0.0.1:1" {
+		t.Errorf("baseURL = %v, want http://127.0.0.1:1", got)
+	}
+}
+
+func TestWaitForReadyOrExit_IPv6Only(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Ok.\n")
+	})
+
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+
+	// Skip if the IPv4 side of the port is taken, which would make the server look ready.
+	l4, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		l.Close()
+		t.Skipf("127.0.0.1:%d unavailable: %v", port, err)
+	}
+
+	l4.Close()
+
+	srv := &http.Server{Handler: mux}
+
+	go srv.Serve(l)
+	defer srv.Close()
+
+	proc := &process{cmd: nil, done: make(chan struct{}), waitErr: nil}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err = waitForReadyOrExit(ctx, port, proc, DefaultConfig())
+	if !errors.Is(err, ErrIPv4LoopbackNotReady) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want ErrIPv4LoopbackNotReady wrapping a deadline error", err)
+	}
+}
+
+func TestWaitForReadyOrExit_ReadinessProbeNeverReady(t *testing.T) {
+	t.Parallel()
+
+	proc := startFakeServer(t, "")
+	port := pingServer(t, http.StatusOK)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// /ping answers 200, but the probe replaces it.
+	cfg := DefaultConfig().ReadinessProbe(func(context.Context, string) bool { return false })
+
+	if err := waitForReadyOrExit(ctx, port, proc, cfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a deadline error", err)
+	}
+}
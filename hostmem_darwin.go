@@ -0,0 +1,15 @@
+//go:build darwin
+
+package embeddedclickhouse
+
+import "golang.org/x/sys/unix"
+
+// totalHostMemory returns the physical memory of the host in bytes, or 0 if unknown.
+func totalHostMemory() uint64 {
+	total, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return 0
+	}
+
+	return total
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package embeddedclickhouse
+
+import "golang.org/x/sys/unix"
+
+// totalHostMemory returns the physical memory of the host in bytes, or 0 if unknown.
+func totalHostMemory() uint64 {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0
+	}
+
+	return uint64(info.Totalram) * uint64(info.Unit) //nolint:unconvert // Totalram is uint32 on 32-bit platforms
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package embeddedclickhouse
+
+// totalHostMemory is unknown on this platform, so clusters get no default memory limit.
+func totalHostMemory() uint64 {
+	return 0
+}
@@ -0,0 +1,222 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKeeperRoot is returned by Cluster.Start when KeeperRoot is not an absolute
+// znode path such as "/clusters/a".
+var ErrInvalidKeeperRoot = errors.New("embedded-clickhouse: invalid keeper root")
+
+// validKeeperRoot matches absolute znode paths without empty, "." or ".." components.
+var validKeeperRoot = regexp.MustCompile(`^(/[A-Za-z0-9_.-]+)+$`)
+
+// validateKeeperRoot rejects a KeeperRoot that ClickHouse would not accept as a chroot.
+func validateKeeperRoot(root string) error {
+	if root == "" {
+		return nil
+	}
+
+	if !validKeeperRoot.MatchString(root) {
+		return fmt.Errorf("%w: %q (want an absolute path such as /clusters/a)", ErrInvalidKeeperRoot, root)
+	}
+
+	for _, part := range strings.Split(root[1:], "/") {
+		if part == "." || part == ".." {
+			return fmt.Errorf("%w: %q (relative component %q)", ErrInvalidKeeperRoot, root, part)
+		}
+	}
+
+	return nil
+}
+
+// keeperRootPollInterval is the initial delay between attempts to create the KeeperRoot
+// while the ensemble elects a leader.
+const keeperRootPollInterval = 100 * time.Millisecond
+
+// ensureKeeperRoot creates the KeeperRoot znode and its parents through the Keeper on one
+// of keeperPorts, retrying (backing off up to maxInterval) until one succeeds or ctx is
+// done. ClickHouse refuses a
+// <zookeeper> root that does not exist, and nothing else can create it in an embedded
+// ensemble, since every server session is confined to the root. Every round tries the
+// nodes in order, so on timeout the error it returns is that of the last node.
+func ensureKeeperRoot(ctx context.Context, keeperPorts []uint32, root string, maxInterval time.Duration) error {
+	p := newPoller(keeperRootPollInterval, maxInterval)
+
+	for {
+		var err error
+
+		for _, port := range keeperPorts {
+			if err = keeperCreatePath(ctx, port, root); err == nil {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: create root %s: %w: %w", ErrKeeperNotReady, root, err, ctx.Err())
+		case <-time.After(p.next()):
+		}
+	}
+}
+
+// ZooKeeper protocol values used by keeperCreatePath.
+const (
+	zkOpCreate        = 1
+	zkOpClose         = -11
+	zkErrNodeExists   = -110
+	zkPermAll         = 31 // read, write, create, delete, admin
+	zkSessionTimeout  = 10 * time.Second
+	zkPasswordLength  = 16
+	zkMaxResponseSize = 1 << 20
+)
+
+// keeperCreatePath opens a ZooKeeper session with the Keeper on port and creates each
+// component of path as a persistent znode, treating existing ones as done.
+func keeperCreatePath(ctx context.Context, port uint32, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, keeperCommandTimeout)
+	defer cancel()
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: keeper connect: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) //nolint:errcheck // a failed deadline only loses the bound
+	}
+
+	if err := zkHandshake(conn); err != nil {
+		return err
+	}
+
+	xid := int32(0)
+
+	for i := 1; i <= len(path); i++ {
+		if i < len(path) && path[i] != '/' {
+			continue
+		}
+
+		xid++
+
+		if err := zkCreate(conn, xid, path[:i]); err != nil {
+			return err
+		}
+	}
+
+	// Close the session rather than leave it to expire; the reply does not matter.
+	zkWrite(conn, zkHeader(xid+1, zkOpClose)) //nolint:errcheck // best effort
+
+	return nil
+}
+
+// zkHandshake sends a ConnectRequest for a new session and checks the ConnectResponse.
+func zkHandshake(conn net.Conn) error {
+	req := binary.BigEndian.AppendUint32(nil, 0)                                      // protocol version
+	req = binary.BigEndian.AppendUint64(req, 0)                                       // last zxid seen
+	req = binary.BigEndian.AppendUint32(req, uint32(zkSessionTimeout.Milliseconds())) // timeout
+	req = binary.BigEndian.AppendUint64(req, 0)                                       // session id
+	req = binary.BigEndian.AppendUint32(req, zkPasswordLength)
+	req = append(req, make([]byte, zkPasswordLength)...)
+
+	if err := zkWrite(conn, req); err != nil {
+		return err
+	}
+
+	resp, err := zkRead(conn)
+	if err != nil {
+		return err
+	}
+
+	// protocol version, timeout, session id: a refused session (e.g. no leader yet) has a
+	// zero timeout or session id.
+	if len(resp) < 16 || binary.BigEndian.Uint32(resp[4:]) == 0 || binary.BigEndian.Uint64(resp[8:]) == 0 {
+		return fmt.Errorf("%w: keeper refused the session", ErrKeeperNotReady)
+	}
+
+	return nil
+}
+
+// zkCreate sends a CreateRequest for a persistent, world-accessible znode at path and
+// checks the reply.
+func zkCreate(conn net.Conn, xid int32, path string) error {
+	appendString := func(b []byte, s string) []byte {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s))) //nolint:gosec // paths are short
+		return append(b, s...)
+	}
+
+	req := zkHeader(xid, zkOpCreate)
+	req = appendString(req, path)
+	req = binary.BigEndian.AppendUint32(req, 0) // empty data
+	req = binary.BigEndian.AppendUint32(req, 1) // one ACL
+	req = binary.BigEndian.AppendUint32(req, zkPermAll)
+	req = appendString(req, "world")
+	req = appendString(req, "anyone")
+	req = binary.BigEndian.AppendUint32(req, 0) // persistent
+
+	if err := zkWrite(conn, req); err != nil {
+		return err
+	}
+
+	resp, err := zkRead(conn)
+	if err != nil {
+		return err
+	}
+
+	// xid, zxid, error code.
+	if len(resp) < 16 {
+		return fmt.Errorf("%w: short create reply for %s", ErrKeeperNotReady, path)
+	}
+
+	if code := int32(binary.BigEndian.Uint32(resp[12:])); code != 0 && code != zkErrNodeExists { //nolint:gosec // the error code is an int32
+		return fmt.Errorf("%w: create %s: keeper error %d", ErrKeeperNotReady, path, code)
+	}
+
+	return nil
+}
+
+// zkHeader returns a request header: the client-chosen xid and the opcode.
+func zkHeader(xid, opcode int32) []byte {
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(xid)), uint32(opcode)) //nolint:gosec // the wire carries int32s
+}
+
+// zkWrite sends one length-prefixed ZooKeeper message.
+func zkWrite(conn net.Conn, msg []byte) error {
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg))) //nolint:gosec // messages are small
+	if _, err := conn.Write(append(frame, msg...)); err != nil {
+		return fmt.Errorf("embedded-clickhouse: keeper write: %w", err)
+	}
+
+	return nil
+}
+
+// zkRead reads one length-prefixed ZooKeeper message.
+func zkRead(conn net.Conn) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: keeper read: %w", err)
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > zkMaxResponseSize {
+		return nil, fmt.Errorf("%w: %d-byte keeper reply", ErrKeeperNotReady, n)
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: keeper read: %w", err)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,137 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeZooKeeper accepts ZooKeeper sessions, records the paths of create requests and
+// answers them from existing (ZNODEEXISTS) or with success, and returns its port.
+func fakeZooKeeper(t *testing.T, existing map[string]bool) (uint32, func() []string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	var (
+		mu      sync.Mutex
+		created []string
+	)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			if _, err := zkRead(conn); err != nil {
+				conn.Close()
+				continue
+			}
+
+			// protocol version, timeout, session id, password.
+			resp := binary.BigEndian.AppendUint32(nil, 0)
+			resp = binary.BigEndian.AppendUint32(resp, 10000)
+			resp = binary.BigEndian.AppendUint64(resp, 1)
+			resp = binary.BigEndian.AppendUint32(resp, zkPasswordLength)
+			resp = append(resp, make([]byte, zkPasswordLength)...)
+			zkWrite(conn, resp)
+
+			for {
+				req, err := zkRead(conn)
+				if err != nil || int32(binary.BigEndian.Uint32(req[4:])) != zkOpCreate {
+					break
+				}
+
+				n := binary.BigEndian.Uint32(req[8:])
+				path := string(req[12 : 12+n])
+
+				code := int32(0)
+				if existing[path] {
+					code = zkErrNodeExists
+				} else {
+					mu.Lock()
+					created = append(created, path)
+					mu.Unlock()
+				}
+
+				reply := append([]byte{}, req[:4]...)
+				reply = binary.BigEndian.AppendUint64(reply, 1)
+				reply = binary.BigEndian.AppendUint32(reply, uint32(code))
+				zkWrite(conn, reply)
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return uint32(ln.Addr().(*net.TCPAddr).Port), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), created...)
+	}
+}
+
+// droppingKeeper accepts connections and closes them at once, like a Keeper without
+// quorum, and returns its port. Unlike a closed port it cannot be reassigned mid-test.
+func droppingKeeper(t *testing.T) uint32 {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return uint32(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestKeeperCreatePath(t *testing.T) {
+	t.Parallel()
+
+	port, created := fakeZooKeeper(t, map[string]bool{"/clusters": true})
+
+	require.NoError(t, keeperCreatePath(context.Background(), port, "/clusters/a/b"))
+	assert.Equal(t, []string{"/clusters/a", "/clusters/a/b"}, created())
+}
+
+func TestEnsureKeeperRoot_TriesEveryNode(t *testing.T) {
+	t.Parallel()
+
+	down := droppingKeeper(t)
+	port, created := fakeZooKeeper(t, nil)
+
+	require.NoError(t, ensureKeeperRoot(context.Background(), []uint32{down, port}, "/a", 0))
+	assert.Equal(t, []string{"/a"}, created())
+}
+
+func TestEnsureKeeperRoot_Timeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err := ensureKeeperRoot(ctx, []uint32{droppingKeeper(t), droppingKeeper(t)}, "/a", 0)
+	require.ErrorIs(t, err, ErrKeeperNotReady)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "create root /a")
+}
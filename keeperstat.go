@@ -0,0 +1,223 @@
+package embeddedclickhouse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keeperCommandTimeout bounds each four-letter-word exchange when ctx has no earlier deadline.
+const keeperCommandTimeout = 5 * time.Second
+
+// ErrKeeperStatUnavailable is returned by KeeperStat for a node whose Keeper answers
+// without reporting its role, e.g. "This instance is not currently serving requests".
+var ErrKeeperStatUnavailable = errors.New("embedded-clickhouse: keeper status unavailable")
+
+// ErrNoKeeperLeader is returned by KeeperLeader when no node, or more than one, reports the
+// leader role, e.g. while an election is in progress.
+var ErrNoKeeperLeader = errors.New("embedded-clickhouse: no single keeper leader")
+
+// KeeperNodeStatus is one node's Keeper state, read with the mntr and srvr four-letter words.
+type KeeperNodeStatus struct {
+	// Node is the 0-based index of the node.
+	Node int
+	// Mode is the node's Raft role: "leader", "follower", "observer" or "standalone".
+	// It is empty when the node could not be queried.
+	Mode string
+	// Zxid is the last transaction id the node has committed.
+	Zxid uint64
+	// Followers is the number of followers connected to the leader; 0 on other nodes.
+	Followers int
+	// SyncedFollowers is the number of followers in sync with the leader; 0 on other nodes.
+	SyncedFollowers int
+	// ZnodeCount is the number of znodes in the node's data tree.
+	ZnodeCount int
+}
+
+// KeeperStat queries every node's Keeper port directly with the mntr and srvr
+// four-letter words, to tell whether the ensemble is healthy (one leader, every
+// follower synced) beyond the HTTP probe Start uses. The result has one entry per node,
+// in node order. A node that cannot be queried keeps an empty Mode, and its error,
+// prefixed with the node index, is joined into the returned error.
+func (c *Cluster) KeeperStat(ctx context.Context) ([]KeeperNodeStatus, error) {
+	c.mu.RLock()
+
+	if !c.started {
+		c.mu.RUnlock()
+		return nil, ErrClusterNotStarted
+	}
+
+	ports := make([]uint32, len(c.nodes))
+	for i, node := range c.nodes {
+		ports[i] = node.keeperPort
+	}
+
+	c.mu.RUnlock()
+
+	statuses := make([]KeeperNodeStatus, len(ports))
+
+	var errs []error
+
+	for i, port := range ports {
+		status, err := keeperNodeStatus(ctx, port)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("embedded-clickhouse: node %d: %w", i, err))
+		}
+
+		status.Node = i
+		statuses[i] = status
+	}
+
+	return statuses, errors.Join(errs...)
+}
+
+// KeeperLeader returns the index of the node whose Keeper reports the leader role, read
+// with KeeperStat, e.g. to stop that node in a failover test. Nodes that cannot be
+// queried (such as one stopped earlier in the test) are skipped. It returns
+// ErrNoKeeperLeader, joined with the errors of the unreachable nodes, unless exactly one
+// node is leader; retry it to wait out an election.
+func (c *Cluster) KeeperLeader(ctx context.Context) (int, error) {
+	statuses, statErr := c.KeeperStat(ctx)
+	if errors.Is(statErr, ErrClusterNotStarted) {
+		return -1, statErr
+	}
+
+	var leaders []int
+
+	for _, status := range statuses {
+		if status.Mode == "leader" {
+			leaders = append(leaders, status.Node)
+		}
+	}
+
+	switch len(leaders) {
+	case 1:
+		return leaders[0], nil
+	case 0:
+		return -1, errors.Join(ErrNoKeeperLeader, statErr)
+	default:
+		return -1, errors.Join(fmt.Errorf("%w: nodes %v report leader", ErrNoKeeperLeader, leaders), statErr)
+	}
+}
+
+// keeperNodeStatus reads the status of the Keeper listening on port.
+func keeperNodeStatus(ctx context.Context, port uint32) (KeeperNodeStatus, error) {
+	mntr, err := keeperCommand(ctx, port, "mntr")
+	if err != nil {
+		return KeeperNodeStatus{}, err
+	}
+
+	srvr, err := keeperCommand(ctx, port, "srvr")
+	if err != nil {
+		return KeeperNodeStatus{}, err
+	}
+
+	return parseKeeperStatus(mntr, srvr)
+}
+
+// keeperCommand sends a four-letter word to the Keeper on port and returns its reply.
+// Keeper closes the connection after replying.
+func keeperCommand(ctx context.Context, port uint32, cmd string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, keeperCommandTimeout)
+	defer cancel()
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: keeper %s: %w", cmd, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) //nolint:errcheck // a failed deadline only loses the bound
+	}
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: keeper %s: %w", cmd, err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: keeper %s: %w", cmd, err)
+	}
+
+	return string(reply), nil
+}
+
+// parseKeeperStatus combines the replies to mntr (tab-separated zk_* metrics) and srvr
+// ("Key: value" lines, the only one carrying the zxid).
+func parseKeeperStatus(mntr, srvr string) (KeeperNodeStatus, error) {
+	metrics := keeperFields(mntr, "\t")
+	server := keeperFields(srvr, ":")
+
+	mode := metrics["zk_server_state"]
+	if mode == "" {
+		mode = server["Mode"]
+	}
+
+	if mode == "" {
+		return KeeperNodeStatus{}, fmt.Errorf("%w: %q", ErrKeeperStatUnavailable, strings.TrimSpace(mntr))
+	}
+
+	zxid, err := parseZxid(server["Zxid"])
+	if err != nil {
+		return KeeperNodeStatus{}, err
+	}
+
+	return KeeperNodeStatus{
+		Mode:            mode,
+		Zxid:            zxid,
+		Followers:       atoiOrZero(metrics["zk_followers"]),
+		SyncedFollowers: atoiOrZero(metrics["zk_synced_followers"]),
+		ZnodeCount:      atoiOrZero(metrics["zk_znode_count"]),
+	}, nil
+}
+
+// keeperFields splits each line of a four-letter-word reply at the first sep into a
+// trimmed key and value.
+func keeperFields(reply, sep string) map[string]string {
+	fields := make(map[string]string)
+
+	sc := bufio.NewScanner(strings.NewReader(reply))
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), sep); ok {
+			fields[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	return fields
+}
+
+// parseZxid parses srvr's Zxid, printed in hex with a 0x prefix or in decimal depending
+// on the Keeper version. A missing zxid is 0.
+func parseZxid(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	base := 10
+	if hex, ok := strings.CutPrefix(s, "0x"); ok {
+		s, base = hex, 16
+	}
+
+	zxid, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("embedded-clickhouse: parse keeper zxid: %w", err)
+	}
+
+	return zxid, nil
+}
+
+// atoiOrZero parses a metric, treating a missing or malformed one as 0.
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(s)
+
+	return n
+}
@@ -0,0 +1,152 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	leaderMntr = "zk_version\tv25.3.2.39-lts\n" +
+		"zk_server_state\tleader\n" +
+		"zk_znode_count\t12\n" +
+		"zk_followers\t2\n" +
+		"zk_synced_followers\t2\n"
+	leaderSrvr = "ClickHouse Keeper version: v25.3.2.39-lts\n" +
+		"Latency min/avg/max: 0/0/1\n" +
+		"Zxid: 0x2a\n" +
+		"Mode: leader\n" +
+		"Node count: 12\n"
+)
+
+// fakeKeeper answers four-letter words from replies and returns its port.
+func fakeKeeper(t *testing.T, replies map[string]string) uint32 {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			cmd := make([]byte, 4)
+			if _, err := io.ReadFull(conn, cmd); err == nil {
+				io.WriteString(conn, replies[string(cmd)])
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return uint32(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestParseKeeperStatus(t *testing.T) {
+	t.Parallel()
+
+	got, err := parseKeeperStatus(leaderMntr, leaderSrvr)
+	require.NoError(t, err)
+	assert.Equal(t, KeeperNodeStatus{Mode: "leader", Zxid: 42, Followers: 2, SyncedFollowers: 2, ZnodeCount: 12}, got)
+
+	// Followers report no follower counts; older Keepers print the zxid in decimal.
+	got, err = parseKeeperStatus("zk_server_state\tfollower\nzk_znode_count\t12\n", "Zxid: 41\nMode: follower\n")
+	require.NoError(t, err)
+	assert.Equal(t, KeeperNodeStatus{Mode: "follower", Zxid: 41, ZnodeCount: 12}, got)
+}
+
+func TestParseKeeperStatus_NotServing(t *testing.T) {
+	t.Parallel()
+
+	const reply = "This instance is not currently serving requests"
+
+	_, err := parseKeeperStatus(reply, reply)
+	require.ErrorIs(t, err, ErrKeeperStatUnavailable)
+	assert.Contains(t, err.Error(), reply)
+}
+
+func TestParseZxid(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]uint64{"": 0, "0x1f": 31, "31": 31} {
+		got, err := parseZxid(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := parseZxid("0xzz")
+	require.Error(t, err)
+}
+
+func TestKeeperStat(t *testing.T) {
+	t.Parallel()
+
+	leader := fakeKeeper(t, map[string]string{"mntr": leaderMntr, "srvr": leaderSrvr})
+	down := fakeKeeper(t, map[string]string{"mntr": "This instance is not currently serving requests"})
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{keeperPort: leader}, {keeperPort: down}}}
+
+	statuses, err := cl.KeeperStat(context.Background())
+	require.ErrorIs(t, err, ErrKeeperStatUnavailable)
+	assert.Contains(t, err.Error(), "node 1")
+
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "leader", statuses[0].Mode)
+	assert.Equal(t, uint64(42), statuses[0].Zxid)
+	assert.Equal(t, 1, statuses[1].Node)
+	assert.Empty(t, statuses[1].Mode)
+}
+
+func TestKeeperLeader(t *testing.T) {
+	t.Parallel()
+
+	followerMntr := "zk_server_state\tfollower\n"
+	followerSrvr := "Zxid: 0x2a\nMode: follower\n"
+
+	follower := fakeKeeper(t, map[string]string{"mntr": followerMntr, "srvr": followerSrvr})
+	leader := fakeKeeper(t, map[string]string{"mntr": leaderMntr, "srvr": leaderSrvr})
+	down := fakeKeeper(t, map[string]string{"mntr": "This instance is not currently serving requests"})
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{keeperPort: down}, {keeperPort: follower}, {keeperPort: leader}}}
+
+	// The unreachable node does not prevent finding the leader.
+	index, err := cl.KeeperLeader(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, index)
+
+	// No leader: the node errors are kept alongside ErrNoKeeperLeader.
+	cl = &Cluster{started: true, nodes: []*EmbeddedClickHouse{{keeperPort: down}, {keeperPort: follower}}}
+
+	_, err = cl.KeeperLeader(context.Background())
+	require.ErrorIs(t, err, ErrNoKeeperLeader)
+	require.ErrorIs(t, err, ErrKeeperStatUnavailable)
+
+	// Two leaders, e.g. a deposed one that has not noticed yet.
+	cl = &Cluster{started: true, nodes: []*EmbeddedClickHouse{{keeperPort: leader}, {keeperPort: leader}}}
+
+	_, err = cl.KeeperLeader(context.Background())
+	require.ErrorIs(t, err, ErrNoKeeperLeader)
+	assert.Contains(t, err.Error(), "[0 1]")
+}
+
+func TestKeeperLeader_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCluster(3).KeeperLeader(context.Background())
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
+
+func TestKeeperStat_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCluster(3).KeeperStat(context.Background())
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
@@ -0,0 +1,32 @@
+//go:build linux
+
+package embeddedclickhouse
+
+import "golang.org/x/sys/unix"
+
+// shmDir is the tmpfs mount glibc uses for POSIX shared memory, present on most Linux
+// systems.
+const shmDir = "/dev/shm"
+
+// minMemoryDirFree is the free space memoryTempRoot requires, so a container's default
+// 64 MiB /dev/shm is not chosen for a server that would soon fill it.
+const minMemoryDirFree = 1 << 30 // 1 GiB
+
+// memoryTempRoot returns a writable memory-backed directory for Ephemeral servers with
+// at least minMemoryDirFree available, or "" if there is none.
+func memoryTempRoot() string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(shmDir, &st); err != nil || st.Type != unix.TMPFS_MAGIC {
+		return ""
+	}
+
+	if st.Bavail*uint64(st.Bsize) < minMemoryDirFree { //nolint:gosec,unconvert // Bsize is positive; int32 on some platforms
+		return ""
+	}
+
+	if unix.Access(shmDir, unix.W_OK) != nil {
+		return ""
+	}
+
+	return shmDir
+}
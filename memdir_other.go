@@ -0,0 +1,9 @@
+//go:build !linux
+
+package embeddedclickhouse
+
+// memoryTempRoot has no memory-backed directory to offer on this platform, so Ephemeral
+// servers keep their data in the default temp directory.
+func memoryTempRoot() string {
+	return ""
+}
@@ -0,0 +1,68 @@
+package embeddedclickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// metadataFile is written by Start into the working directory of the server, or of each
+// cluster node (the temp dir, or the DataPath), see MetadataPath.
+const metadataFile = "embedded-clickhouse.json"
+
+// serverMetadata is the content of metadataFile. Owner is only recorded for temporary
+// directories, which CleanupOrphans may remove once the owner is gone; DataPath and
+// Shared instances outlive the process that started them.
+type serverMetadata struct {
+	PID      int               `json:"pid"`
+	Owner    int               `json:"owner,omitempty"`
+	TCPPort  uint32            `json:"tcpPort"`
+	HTTPPort uint32            `json:"httpPort"`
+	Version  ClickHouseVersion `json:"version"`
+	Cluster  string            `json:"cluster,omitempty"`
+}
+
+// writeMetadata writes the metadata of the server proc running in dir.
+func writeMetadata(cfg Config, dir string, proc *process, tcpPort, httpPort uint32, version ClickHouseVersion, cluster string) error {
+	meta := serverMetadata{
+		PID:      proc.cmd.Process.Pid,
+		Owner:    0,
+		TCPPort:  tcpPort,
+		HTTPPort: httpPort,
+		Version:  version,
+		Cluster:  cluster,
+	}
+	if cfg.dataPath == "" && cfg.sharedName == "" {
+		meta.Owner = os.Getpid()
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: encode metadata: %w", err)
+	}
+
+	path := filepath.Join(dir, metadataFile)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("embedded-clickhouse: write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// MetadataPath returns the path of the JSON file Start wrote into the server's working
+// directory (the temp dir, or the DataPath), describing the running server for other
+// processes and for CleanupOrphans: its "pid", "tcpPort", "httpPort", "version", the
+// "cluster" name for cluster nodes, and, for a temp dir, the "owner" PID of the process
+// that started it. It is empty while not started and for handles attached to a Shared
+// instance.
+func (e *EmbeddedClickHouse) MetadataPath() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.started || e.tmpDir == "" {
+		return ""
+	}
+
+	return filepath.Join(e.tmpDir, metadataFile)
+}
@@ -0,0 +1,73 @@
+package embeddedclickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readMetadata(t *testing.T, dir string) serverMetadata {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	require.NoError(t, err)
+
+	var meta serverMetadata
+	require.NoError(t, json.Unmarshal(data, &meta))
+
+	return meta
+}
+
+func TestWriteMetadata(t *testing.T) {
+	t.Parallel()
+
+	proc := startFakeServer(t, "")
+
+	dir := t.TempDir()
+	require.NoError(t, writeMetadata(DefaultConfig(), dir, proc, 19000, 18123, V25_8, "test_cluster"))
+
+	assert.Equal(t, serverMetadata{
+		PID:      proc.cmd.Process.Pid,
+		Owner:    os.Getpid(),
+		TCPPort:  19000,
+		HTTPPort: 18123,
+		Version:  V25_8,
+		Cluster:  "test_cluster",
+	}, readMetadata(t, dir))
+
+	// Persistent and shared directories outlive this process, so they record no owner.
+	for _, cfg := range []Config{DefaultConfig().DataPath(t.TempDir()), DefaultConfig().Shared("metadata")} {
+		dir := t.TempDir()
+		require.NoError(t, writeMetadata(cfg, dir, proc, 19000, 18123, V25_8, ""))
+		assert.Zero(t, readMetadata(t, dir).Owner)
+	}
+}
+
+func TestMetadataPath_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, NewServer().MetadataPath())
+}
+
+func TestIntegration_MetadataFile(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	meta := readMetadata(t, filepath.Dir(s.MetadataPath()))
+	assert.Equal(t, s.HTTPURL(), fmt.Sprintf("http://127.0.0.1:%d", meta.HTTPPort))
+	assert.Equal(t, s.DSN(), fmt.Sprintf("clickhouse://127.0.0.1:%d/default", meta.TCPPort))
+	assert.Equal(t, V25_3, meta.Version)
+	assert.Equal(t, os.Getpid(), meta.Owner)
+	assert.Empty(t, meta.Cluster)
+}
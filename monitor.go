@@ -0,0 +1,118 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultMonitorInterval is how often Monitor pings the server unless MonitorInterval
+// overrides it.
+const defaultMonitorInterval = time.Second
+
+// ErrServerUnhealthy is sent by Monitor when the server stops answering /ping while its
+// process is still running.
+var ErrServerUnhealthy = errors.New("embedded-clickhouse: server is not answering /ping")
+
+// Monitor watches the running server until ctx is done, pinging /ping every
+// MonitorInterval (default 1s). Each failed ping sends an error wrapping
+// ErrServerUnhealthy; a process exit sends one wrapping ErrServerExited and ends the
+// watch. The channel is closed when the watch ends: on ctx done, after an exit, or once
+// the handle is stopped or restarted, which is not reported. Sends block until received
+// or ctx is done. If the server is not started, the channel yields ErrServerNotStarted.
+//
+// A soak test can fail fast when the server dies mid-run:
+//
+//	go func() {
+//		for err := range ch.Monitor(ctx) {
+//			t.Errorf("clickhouse: %v", err)
+//		}
+//	}()
+func (e *EmbeddedClickHouse) Monitor(ctx context.Context) <-chan error {
+	errs := make(chan error, 1)
+
+	e.mu.RLock()
+	started, proc, httpPort, interval := e.started, e.proc, e.httpPort, e.config.monitorInterval
+	e.mu.RUnlock()
+
+	if interval <= 0 {
+		interval = defaultMonitorInterval
+	}
+
+	if !started {
+		errs <- ErrServerNotStarted
+		close(errs)
+
+		return errs
+	}
+
+	go e.monitor(ctx, errs, proc, httpPort, interval)
+
+	return errs
+}
+
+// monitor implements Monitor. proc is nil for a handle attached to a Shared instance,
+// whose process belongs to another handle; only /ping is watched then.
+func (e *EmbeddedClickHouse) monitor(
+	ctx context.Context, errs chan<- error, proc *process, httpPort uint32, interval time.Duration,
+) {
+	defer close(errs)
+
+	ready := httpReadiness(httpPort, e.config.readinessProbe)
+
+	var exited <-chan struct{} // nil (never ready) without a process
+	if proc != nil {
+		exited = proc.done
+	}
+
+	send := func(err error) {
+		select {
+		case errs <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-exited:
+			if e.runs(proc, httpPort) {
+				send(exitError(proc))
+			}
+
+			return
+		case <-ticker.C:
+			if ready(ctx) || ctx.Err() != nil {
+				continue
+			}
+
+			if !e.runs(proc, httpPort) {
+				return
+			}
+
+			// A ping that fails because the process just died reports the exit instead.
+			select {
+			case <-exited:
+				send(exitError(proc))
+				return
+			default:
+				send(fmt.Errorf("%w: port %d", ErrServerUnhealthy, httpPort))
+			}
+		}
+	}
+}
+
+// runs reports whether the handle still runs the server a Monitor started watching, so
+// a failure caused by Stop (which holds e.mu until the process is gone) or by a restart
+// is not reported.
+func (e *EmbeddedClickHouse) runs(proc *process, httpPort uint32) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.started && e.proc == proc && e.httpPort == httpPort
+}
@@ -0,0 +1,139 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// pingServer answers /ping with status and returns its port.
+func pingServer(t *testing.T, status int) uint32 {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return uint32(srv.Listener.Addr().(*net.TCPAddr).Port)
+}
+
+// monitoredServer returns a started handle for a fake server process answering /ping
+// with status, monitored every 20ms.
+func monitoredServer(t *testing.T, status int) (*EmbeddedClickHouse, *process) {
+	t.Helper()
+
+	proc := startFakeServer(t, "")
+
+	return &EmbeddedClickHouse{
+		config:   DefaultConfig().MonitorInterval(20 * time.Millisecond),
+		started:  true,
+		proc:     proc,
+		httpPort: pingServer(t, status),
+	}, proc
+}
+
+// nextMonitorError reports whether errs was still open and returns its next value,
+// failing the test if nothing arrives in time.
+func nextMonitorError(t *testing.T, errs <-chan error) (bool, error) {
+	t.Helper()
+
+	select {
+	case err, ok := <-errs:
+		return ok, err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Monitor sent nothing")
+		return false, nil
+	}
+}
+
+func TestMonitor_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	errs := NewServer().Monitor(context.Background())
+
+	if _, err := nextMonitorError(t, errs); !errors.Is(err, ErrServerNotStarted) {
+		t.Errorf("err = %v, want ErrServerNotStarted", err)
+	}
+
+	if ok, _ := nextMonitorError(t, errs); ok {
+		t.Error("channel not closed")
+	}
+}
+
+func TestMonitor_ProcessExit(t *testing.T) {
+	t.Parallel()
+
+	s, proc := monitoredServer(t, http.StatusOK)
+	errs := s.Monitor(context.Background())
+
+	if err := proc.cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := nextMonitorError(t, errs); !errors.Is(err, ErrServerExited) {
+		t.Errorf("err = %v, want ErrServerExited", err)
+	}
+
+	if ok, _ := nextMonitorError(t, errs); ok {
+		t.Error("channel not closed after the exit")
+	}
+}
+
+func TestMonitor_PingFailure(t *testing.T) {
+	t.Parallel()
+
+	s, _ := monitoredServer(t, http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := s.Monitor(ctx)
+
+	if _, err := nextMonitorError(t, errs); !errors.Is(err, ErrServerUnhealthy) {
+		t.Errorf("err = %v, want ErrServerUnhealthy", err)
+	}
+
+	cancel()
+
+	// Drain a failure sent before the cancel was seen; the channel must then close.
+	for {
+		if ok, _ := nextMonitorError(t, errs); !ok {
+			return
+		}
+	}
+}
+
+func TestMonitor_StopNotReported(t *testing.T) {
+	t.Parallel()
+
+	s, proc := monitoredServer(t, http.StatusOK)
+	errs := s.Monitor(context.Background())
+
+	// What Stop does under the lock: the process goes away along with the handle state.
+	s.mu.Lock()
+	stopProcess(proc, time.Second) //nolint:errcheck
+	s.started = false
+	s.proc = nil
+	s.mu.Unlock()
+
+	if ok, err := nextMonitorError(t, errs); ok {
+		t.Errorf("Monitor reported %v after Stop", err)
+	}
+}
+
+func TestMonitor_ReadinessProbe(t *testing.T) {
+	t.Parallel()
+
+	s, _ := monitoredServer(t, http.StatusOK)
+	s.config = s.config.ReadinessProbe(func(context.Context, string) bool { return false })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := nextMonitorError(t, s.Monitor(ctx)); !errors.Is(err, ErrServerUnhealthy) {
+		t.Errorf("err = %v, want ErrServerUnhealthy from the probe", err)
+	}
+}
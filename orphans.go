@@ -0,0 +1,131 @@
+package embeddedclickhouse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// orphanDirPrefix starts the names of the temporary server and cluster node directories.
+const orphanDirPrefix = "embedded-clickhouse-"
+
+// orphanStopTimeout bounds the SIGTERM wait for an orphaned server before SIGKILL.
+const orphanStopTimeout = 10 * time.Second
+
+// CleanupOrphans removes what runs killed before Stop left behind: it scans the
+// temporary directories of servers and cluster nodes under roots (when none are given,
+// os.TempDir and the memory-backed directory Ephemeral servers use, if any; pass
+// TempDirRoot values to cover those too), and for each whose owning test
+// process is gone it stops the server's process group, if still running, and removes the
+// directory. A recorded PID that now belongs to an unrelated process is not signalled.
+// Directories of live processes, of Shared instances and of starts that have not
+// launched a server yet are left alone. Call it from TestMain to keep CI runners clean:
+//
+//	func TestMain(m *testing.M) {
+//		if err := embeddedclickhouse.CleanupOrphans(); err != nil {
+//			log.Print(err)
+//		}
+//		os.Exit(m.Run())
+//	}
+func CleanupOrphans(roots ...string) error {
+	if len(roots) == 0 {
+		roots = defaultOrphanRoots()
+	}
+
+	var errs []error
+
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("embedded-clickhouse: scan %s: %w", root, err))
+			continue
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() || !strings.HasPrefix(entry.Name(), orphanDirPrefix) {
+				continue
+			}
+
+			if err := cleanupOrphan(filepath.Join(root, entry.Name())); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// defaultOrphanRoots returns the roots CleanupOrphans scans when given none: os.TempDir,
+// and memoryTempRoot unless there is none or it is the same directory.
+func defaultOrphanRoots() []string {
+	roots := []string{os.TempDir()}
+
+	if mem := memoryTempRoot(); mem != "" && filepath.Clean(mem) != filepath.Clean(roots[0]) {
+		roots = append(roots, mem)
+	}
+
+	return roots
+}
+
+// cleanupOrphan stops the server of dir and removes dir if its owner is gone.
+func cleanupOrphan(dir string) error {
+	path := filepath.Join(dir, metadataFile)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: read %s: %w", path, err)
+	}
+
+	var meta serverMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return fmt.Errorf("embedded-clickhouse: parse %s: %w", path, err)
+	}
+
+	// No owner: a DataPath or Shared instance, never an orphan.
+	if meta.Owner == 0 || pidAlive(meta.Owner) {
+		return nil
+	}
+
+	// The PID may have been reused since the metadata was written: only signal a process
+	// still running this directory's config, and otherwise just remove the directory.
+	if pidAlive(meta.PID) && runsConfigIn(meta.PID, dir) {
+		if err := stopSharedNode(meta.PID, orphanStopTimeout); err != nil {
+			return fmt.Errorf("embedded-clickhouse: stop orphaned server %d: %w", meta.PID, err)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("embedded-clickhouse: remove %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// runsConfigIn reports whether pid is a server started with the config.xml in dir. Only
+// the directory's own name is matched, so a root given through a symlink still matches.
+func runsConfigIn(pid int, dir string) bool {
+	cmdline, err := processCommandLine(pid)
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(cmdline, string(filepath.Separator)+configPathIn(filepath.Base(dir)))
+}
+
+// pidAlive reports whether a process with pid exists (possibly owned by another user).
+func pidAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	return !errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+}
@@ -0,0 +1,112 @@
+package embeddedclickhouse
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadPID returns the PID of a process that has already exited and been reaped.
+func deadPID(t *testing.T) int {
+	t.Helper()
+
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	return cmd.Process.Pid
+}
+
+// orphanDir creates root/name holding meta as its metadata file.
+func orphanDir(t *testing.T, root, name string, meta serverMetadata) string {
+	t.Helper()
+
+	dir := filepath.Join(root, name)
+	require.NoError(t, os.Mkdir(dir, 0o755))
+
+	data, err := json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, metadataFile), data, 0o600))
+
+	return dir
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	proc := startFakeServerWithConfig(t, "", configPathIn(filepath.Join(root, "embedded-clickhouse-1")))
+
+	orphan := orphanDir(t, root, "embedded-clickhouse-1", serverMetadata{Owner: deadPID(t), PID: proc.cmd.Process.Pid})
+	stale := orphanDir(t, root, "embedded-clickhouse-cluster-0-2", serverMetadata{Owner: deadPID(t), PID: deadPID(t)})
+	live := orphanDir(t, root, "embedded-clickhouse-3", serverMetadata{Owner: os.Getpid()})
+	persistent := orphanDir(t, root, "embedded-clickhouse-4", serverMetadata{PID: deadPID(t)}) // no owner
+	foreign := orphanDir(t, root, "other-5", serverMetadata{Owner: deadPID(t)})
+
+	starting := filepath.Join(root, "embedded-clickhouse-6") // no metadata yet
+	require.NoError(t, os.Mkdir(starting, 0o755))
+
+	require.NoError(t, CleanupOrphans(root))
+
+	select {
+	case <-proc.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphaned server still running")
+	}
+
+	assert.NoDirExists(t, orphan)
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, live)
+	assert.DirExists(t, persistent)
+	assert.DirExists(t, foreign)
+	assert.DirExists(t, starting)
+}
+
+func TestCleanupOrphans_ReusedPID(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	// The recorded PID now belongs to a process running some other directory's config.
+	other := startFakeServer(t, "")
+	orphan := orphanDir(t, root, "embedded-clickhouse-1", serverMetadata{Owner: deadPID(t), PID: other.cmd.Process.Pid})
+
+	require.NoError(t, CleanupOrphans(root))
+
+	assert.NoDirExists(t, orphan)
+
+	select {
+	case <-other.done:
+		t.Fatal("CleanupOrphans signalled a process that is not the orphaned server")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestDefaultOrphanRoots(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	want := []string{tmp}
+	if mem := memoryTempRoot(); mem != "" {
+		want = append(want, mem)
+
+		// With TMPDIR on the memory-backed directory it is scanned once.
+		t.Setenv("TMPDIR", mem)
+		assert.Equal(t, []string{mem}, defaultOrphanRoots())
+		t.Setenv("TMPDIR", tmp)
+	}
+
+	assert.Equal(t, want, defaultOrphanRoots())
+}
+
+func TestCleanupOrphans_MissingRoot(t *testing.T) {
+	t.Parallel()
+
+	assert.Error(t, CleanupOrphans(filepath.Join(t.TempDir(), "missing")))
+}
@@ -0,0 +1,112 @@
+package embeddedclickhouse
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// outputBufferLines is how many lines of server output LastOutput can return.
+	outputBufferLines = 1000
+	// maxOutputLineBytes caps a line that is still being written, so a server that never
+	// prints a newline cannot grow the buffer without bound.
+	maxOutputLineBytes = 64 << 10
+)
+
+// outputBuffer keeps the last outputBufferLines lines written to it. The server's
+// stdout and stderr are teed into it alongside the configured Logger.
+type outputBuffer struct {
+	mu      sync.Mutex
+	lines   []string // ring of complete lines; next is the oldest once full
+	next    int
+	partial []byte
+}
+
+func newOutputBuffer() *outputBuffer {
+	return &outputBuffer{lines: make([]string, 0, outputBufferLines)}
+}
+
+// Write implements io.Writer, splitting p into lines.
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rest := p
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
+		}
+
+		b.partial = append(b.partial, rest[:i]...)
+		b.push(string(bytes.TrimSuffix(b.partial, []byte("\r"))))
+		b.partial = b.partial[:0]
+		rest = rest[i+1:]
+	}
+
+	b.partial = append(b.partial, rest...)
+	if len(b.partial) > maxOutputLineBytes {
+		b.partial = b.partial[len(b.partial)-maxOutputLineBytes:]
+	}
+
+	return len(p), nil
+}
+
+// push appends a complete line, evicting the oldest one when full. Caller holds b.mu.
+func (b *outputBuffer) push(line string) {
+	if len(b.lines) < outputBufferLines {
+		b.lines = append(b.lines, line)
+		return
+	}
+
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % outputBufferLines
+}
+
+// last returns up to n of the most recent lines, oldest first, including a trailing line
+// that has no newline yet.
+func (b *outputBuffer) last(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	all := make([]string, 0, len(b.lines)+1)
+	all = append(all, b.lines[b.next:]...)
+	all = append(all, b.lines[:b.next]...)
+
+	if len(b.partial) > 0 {
+		all = append(all, string(b.partial))
+	}
+
+	if n < len(all) {
+		all = all[len(all)-max(n, 0):]
+	}
+
+	return all
+}
+
+// outputBufferFor returns the buffer to tee a new server process's output into, or nil
+// for a Shared instance: it outlives this process and writes to its log file directly,
+// where a tee would put a pipe drained by this process in between.
+func outputBufferFor(cfg Config) *outputBuffer {
+	if cfg.sharedName != "" {
+		return nil
+	}
+
+	return newOutputBuffer()
+}
+
+// LastOutput returns up to nLines of the most recent stdout/stderr lines of the server,
+// oldest first. Output is teed here alongside the configured Logger, so it can be
+// asserted on while still being shown; the last 1000 lines of the process started by the
+// last Start are kept, including after Stop or a failed Start. It returns nil before
+// Start and for a Shared instance, whose output goes only to its log file.
+func (e *EmbeddedClickHouse) LastOutput(nLines int) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.output == nil {
+		return nil
+	}
+
+	return e.output.last(nLines)
+}
@@ -0,0 +1,79 @@
+package embeddedclickhouse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputBuffer_Lines(t *testing.T) {
+	t.Parallel()
+
+	b := newOutputBuffer()
+
+	fmt.Fprint(b, "one\r\ntw")
+	fmt.Fprint(b, "o\nthree")
+
+	assert.Equal(t, []string{"one", "two", "three"}, b.last(10))
+	assert.Equal(t, []string{"two", "three"}, b.last(2))
+	assert.Empty(t, b.last(0))
+}
+
+func TestOutputBuffer_Bounded(t *testing.T) {
+	t.Parallel()
+
+	b := newOutputBuffer()
+
+	for i := range outputBufferLines + 5 {
+		fmt.Fprintf(b, "line %d\n", i)
+	}
+
+	got := b.last(outputBufferLines + 100)
+	require.Len(t, got, outputBufferLines)
+	assert.Equal(t, "line 5", got[0])
+	assert.Equal(t, fmt.Sprintf("line %d", outputBufferLines+4), got[len(got)-1])
+
+	b.Write(bytes.Repeat([]byte("x"), 2*maxOutputLineBytes)) //nolint:errcheck
+	assert.Len(t, b.last(1)[0], maxOutputLineBytes)
+}
+
+func TestLastOutput_TeesLogger(t *testing.T) {
+	t.Parallel()
+
+	var logged bytes.Buffer
+
+	fake := writeFakeScript(t, "echo starting\necho 'fatal: bad config' >&2\nexit 70\n")
+
+	s := NewServer(DefaultConfig().
+		BinaryPath(fake).
+		Logger(&syncWriter{w: &logged}).
+		StartTimeout(5 * time.Second))
+
+	assert.Nil(t, s.LastOutput(10), "no output before Start")
+	require.Error(t, s.Start())
+
+	// The failed start's output is kept for inspection and still reached the logger.
+	assert.Equal(t, []string{"starting", "fatal: bad config"}, s.LastOutput(10))
+	assert.Equal(t, []string{"fatal: bad config"}, s.LastOutput(1))
+	assert.Contains(t, logged.String(), "fatal: bad config")
+}
+
+// syncWriter serializes writes to w, which the tee may reach from the process's
+// output-copying goroutine.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.w.Write(p) //nolint:wrapcheck // test helper
+}
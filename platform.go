@@ -1,7 +1,10 @@
 package embeddedclickhouse
 
 import (
+	"debug/elf"
+	"debug/macho"
 	"fmt"
+	"regexp"
 	"runtime"
 	"strings"
 )
@@ -14,18 +17,46 @@ const (
 
 	assetMacOS        = "clickhouse-macos"
 	assetMacOSAARCH64 = "clickhouse-macos-aarch64"
+	assetLinux        = "clickhouse-linux-amd64"
+	assetLinuxAARCH64 = "clickhouse-linux-aarch64"
 )
 
-type assetType int
+// AssetType tells how a downloaded release asset holds the ClickHouse binary.
+type AssetType int
 
 const (
-	assetArchive   assetType = iota // .tgz archive (Linux)
-	assetRawBinary                  // raw executable (macOS)
+	// AssetArchive is a .tgz archive containing usr/bin/clickhouse (the default Linux
+	// releases).
+	AssetArchive AssetType = iota
+	// AssetRawBinary is the executable itself (the macOS releases, and the Linux ones
+	// selected with Config.LinuxAsset).
+	AssetRawBinary
 )
 
 type platformAsset struct {
 	filename  string
-	assetType assetType
+	assetType AssetType
+}
+
+// validVersion matches a ClickHouse release version as used in release tags: four
+// numeric components and an optional channel suffix, e.g. "24.8.4.13-lts".
+var validVersion = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+(-[a-z]+)?$`)
+
+// validateVersion rejects empty or malformed versions before anything is downloaded.
+func validateVersion(v ClickHouseVersion) error {
+	if v == "" {
+		return fmt.Errorf("%w: empty (use a constant such as V25_8 or e.g. \"24.8.4.13-lts\")", ErrInvalidVersion)
+	}
+
+	if strings.HasPrefix(string(v), "v") {
+		return fmt.Errorf("%w: %q (omit the leading \"v\" of the release tag)", ErrInvalidVersion, v)
+	}
+
+	if !validVersion.MatchString(string(v)) {
+		return fmt.Errorf("%w: %q (want MAJOR.MINOR.PATCH.BUILD[-channel], e.g. \"24.8.4.13-lts\")", ErrInvalidVersion, v)
+	}
+
+	return nil
 }
 
 // numericVersion strips the -stable/-lts/-testing suffix from a version string.
@@ -42,20 +73,12 @@ func numericVersion(v ClickHouseVersion) string {
 	return s
 }
 
-func resolveAsset(version ClickHouseVersion, goos, goarch string) (platformAsset, error) {
+// resolveAsset returns the upstream release asset for version on goos/goarch. On Linux,
+// linuxAsset picks the clickhouse-common-static archive or the raw binary.
+func resolveAsset(version ClickHouseVersion, goos, goarch string, linuxAsset AssetType) (platformAsset, error) {
 	switch goos {
 	case "linux":
-		numVer := numericVersion(version)
-
-		arch, err := linuxArch(goarch)
-		if err != nil {
-			return platformAsset{}, err
-		}
-
-		return platformAsset{
-			filename:  fmt.Sprintf("clickhouse-common-static-%s-%s.tgz", numVer, arch),
-			assetType: assetArchive,
-		}, nil
+		return linuxAssetFor(version, goarch, linuxAsset)
 	case "darwin":
 		name, err := darwinAssetName(goarch)
 		if err != nil {
@@ -64,13 +87,37 @@ func resolveAsset(version ClickHouseVersion, goos, goarch string) (platformAsset
 
 		return platformAsset{
 			filename:  name,
-			assetType: assetRawBinary,
+			assetType: AssetRawBinary,
 		}, nil
 	default:
 		return platformAsset{}, fmt.Errorf("%w: %s/%s", ErrUnsupportedPlatform, goos, goarch)
 	}
 }
 
+func linuxAssetFor(version ClickHouseVersion, goarch string, typ AssetType) (platformAsset, error) {
+	arch, err := linuxArch(goarch)
+	if err != nil {
+		return platformAsset{}, err
+	}
+
+	switch typ {
+	case AssetArchive:
+		return platformAsset{
+			filename:  fmt.Sprintf("clickhouse-common-static-%s-%s.tgz", numericVersion(version), arch),
+			assetType: AssetArchive,
+		}, nil
+	case AssetRawBinary:
+		name := assetLinux
+		if arch == archARM64 {
+			name = assetLinuxAARCH64
+		}
+
+		return platformAsset{filename: name, assetType: AssetRawBinary}, nil
+	default:
+		return platformAsset{}, fmt.Errorf("%w: %d", ErrUnknownAssetType, typ)
+	}
+}
+
 func linuxArch(goarch string) (string, error) {
 	switch goarch {
 	case archAMD64:
@@ -114,6 +161,91 @@ func sha512URL(baseURL string, version ClickHouseVersion, asset platformAsset) s
 	return u + ".sha512"
 }
 
-func resolveCurrentPlatformAsset(version ClickHouseVersion) (platformAsset, error) {
-	return resolveAsset(version, runtime.GOOS, runtime.GOARCH)
+// checksumsFile is the release-wide checksum file some releases publish instead of a
+// .sha512 per asset: sha512sum lines for every asset.
+const checksumsFile = "checksums.txt"
+
+// checksumURLs returns where the SHA512 of asset is looked up, in order: the asset's own
+// .sha512, then the release's checksumsFile.
+func checksumURLs(baseURL string, version ClickHouseVersion, asset platformAsset) []string {
+	u := sha512URL(baseURL, version, asset)
+	if u == "" {
+		return nil
+	}
+
+	return []string{u, strings.TrimSuffix(u, asset.filename+".sha512") + checksumsFile}
+}
+
+// resolveAssetWith resolves the asset via nameFunc when set (see Config.AssetNameFunc),
+// falling back to resolveAsset's release naming.
+func resolveAssetWith(
+	nameFunc func(version, goos, goarch string) (string, AssetType),
+	version ClickHouseVersion, goos, goarch string, linuxAsset AssetType,
+) (platformAsset, error) {
+	if nameFunc == nil {
+		return resolveAsset(version, goos, goarch, linuxAsset)
+	}
+
+	filename, typ := nameFunc(string(version), goos, goarch)
+	if filename == "" {
+		return platformAsset{}, fmt.Errorf("%w: %s/%s (AssetNameFunc returned no asset)", ErrUnsupportedPlatform, goos, goarch)
+	}
+
+	if typ != AssetArchive && typ != AssetRawBinary {
+		return platformAsset{}, fmt.Errorf("%w: %d", ErrUnknownAssetType, typ)
+	}
+
+	return platformAsset{filename: filename, assetType: typ}, nil
+}
+
+func resolveCurrentPlatformAsset(cfg Config) (platformAsset, error) {
+	return resolveAssetWith(cfg.assetNameFunc, cfg.version, runtime.GOOS, runtime.GOARCH, cfg.linuxAsset)
+}
+
+// elfArches maps the ELF machines ClickHouse (or Go) builds for to GOARCH names.
+var elfArches = map[elf.Machine]string{ //nolint:gochecknoglobals // lookup table
+	elf.EM_X86_64:  archAMD64,
+	elf.EM_AARCH64: archARM64,
+	elf.EM_386:     "386",
+	elf.EM_ARM:     "arm",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_RISCV:   "riscv64",
+	elf.EM_S390:    "s390x",
+}
+
+// machoArches maps Mach-O CPU types to GOARCH names.
+var machoArches = map[macho.Cpu]string{ //nolint:gochecknoglobals // lookup table
+	macho.CpuAmd64: archAMD64,
+	macho.CpuArm64: archARM64,
+}
+
+// binaryPlatform reads the ELF or Mach-O header of the executable at path and returns
+// the GOOS and GOARCH it was built for. ok is false when path is no complete executable
+// of a known platform, e.g. a truncated or corrupt file.
+func binaryPlatform(path string) (goos, goarch string, ok bool) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+
+		goos = "linux"
+		if f.OSABI == elf.ELFOSABI_FREEBSD {
+			goos = "freebsd"
+		}
+
+		goarch, ok = elfArches[f.Machine]
+		if ok && f.Machine == elf.EM_PPC64 && f.Data == elf.ELFDATA2LSB {
+			goarch = "ppc64le"
+		}
+
+		return goos, goarch, ok
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+
+		goarch, ok = machoArches[f.Cpu]
+
+		return "darwin", goarch, ok
+	}
+
+	return "", "", false
 }
@@ -1,7 +1,11 @@
 package embeddedclickhouse
 
 import (
+	"debug/elf"
 	"errors"
+	"os"
+	"runtime"
+	"slices"
 	"testing"
 )
 
@@ -19,7 +23,7 @@ func TestResolveAsset_Linux(t *testing.T) {
 		t.Run("linux/"+tt.arch, func(t *testing.T) {
 			t.Parallel()
 
-			asset, err := resolveAsset(V25_8, "linux", tt.arch)
+			asset, err := resolveAsset(V25_8, "linux", tt.arch, AssetArchive)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -28,13 +32,37 @@ func TestResolveAsset_Linux(t *testing.T) {
 				t.Errorf("filename = %q, want %q", asset.filename, tt.wantFile)
 			}
 
-			if asset.assetType != assetArchive {
-				t.Errorf("assetType = %d, want assetArchive", asset.assetType)
+			if asset.assetType != AssetArchive {
+				t.Errorf("assetType = %d, want AssetArchive", asset.assetType)
 			}
 		})
 	}
 }
 
+func TestResolveAsset_LinuxRawBinary(t *testing.T) {
+	t.Parallel()
+
+	for arch, want := range map[string]string{archAMD64: assetLinux, archARM64: assetLinuxAARCH64} {
+		asset, err := resolveAsset(V25_8, "linux", arch, AssetRawBinary)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if asset.filename != want || asset.assetType != AssetRawBinary {
+			t.Errorf("linux/%s: asset = %+v, want raw %q", arch, asset, want)
+		}
+
+		// LinuxAsset does not affect macOS, which only publishes raw binaries.
+		if asset, _ := resolveAsset(V25_8, "darwin", arch, AssetArchive); asset.assetType != AssetRawBinary {
+			t.Errorf("darwin/%s: assetType = %d, want AssetRawBinary", arch, asset.assetType)
+		}
+	}
+
+	if _, err := resolveAsset(V25_8, "linux", archAMD64, AssetType(42)); !errors.Is(err, ErrUnknownAssetType) {
+		t.Errorf("bad type: err = %v, want ErrUnknownAssetType", err)
+	}
+}
+
 func TestResolveAsset_Darwin(t *testing.T) {
 	t.Parallel()
 
@@ -49,7 +77,7 @@ func TestResolveAsset_Darwin(t *testing.T) {
 		t.Run("darwin/"+tt.arch, func(t *testing.T) {
 			t.Parallel()
 
-			asset, err := resolveAsset(V25_8, "darwin", tt.arch)
+			asset, err := resolveAsset(V25_8, "darwin", tt.arch, AssetArchive)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -58,8 +86,8 @@ func TestResolveAsset_Darwin(t *testing.T) {
 				t.Errorf("filename = %q, want %q", asset.filename, tt.wantFile)
 			}
 
-			if asset.assetType != assetRawBinary {
-				t.Errorf("assetType = %d, want assetRawBinary", asset.assetType)
+			if asset.assetType != AssetRawBinary {
+				t.Errorf("assetType = %d, want AssetRawBinary", asset.assetType)
 			}
 		})
 	}
@@ -82,7 +110,7 @@ func TestResolveAsset_Unsupported(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			_, err := resolveAsset(V25_8, tt.goos, tt.arch)
+			_, err := resolveAsset(V25_8, tt.goos, tt.arch, AssetArchive)
 			if !errors.Is(err, ErrUnsupportedPlatform) {
 				t.Errorf("err = %v, want ErrUnsupportedPlatform", err)
 			}
@@ -118,7 +146,7 @@ func TestNumericVersion(t *testing.T) {
 func TestDownloadURL(t *testing.T) {
 	t.Parallel()
 
-	asset := platformAsset{filename: "clickhouse-common-static-25.8.16.34-amd64.tgz", assetType: assetArchive}
+	asset := platformAsset{filename: "clickhouse-common-static-25.8.16.34-amd64.tgz", assetType: AssetArchive}
 
 	got := downloadURL("", V25_8, asset)
 
@@ -131,7 +159,7 @@ func TestDownloadURL(t *testing.T) {
 func TestDownloadURL_CustomBase(t *testing.T) {
 	t.Parallel()
 
-	asset := platformAsset{filename: assetMacOSAARCH64, assetType: assetRawBinary}
+	asset := platformAsset{filename: assetMacOSAARCH64, assetType: AssetRawBinary}
 
 	got := downloadURL("https://mirror.example.com/releases", V25_3, asset)
 
@@ -144,7 +172,7 @@ func TestDownloadURL_CustomBase(t *testing.T) {
 func TestSHA512URL(t *testing.T) {
 	t.Parallel()
 
-	asset := platformAsset{filename: "clickhouse-common-static-25.8.16.34-amd64.tgz", assetType: assetArchive}
+	asset := platformAsset{filename: "clickhouse-common-static-25.8.16.34-amd64.tgz", assetType: AssetArchive}
 
 	got := sha512URL("", V25_8, asset)
 
@@ -154,10 +182,30 @@ func TestSHA512URL(t *testing.T) {
 	}
 }
 
+func TestChecksumURLs(t *testing.T) {
+	t.Parallel()
+
+	asset := platformAsset{filename: "clickhouse-common-static-25.8.16.34-amd64.tgz", assetType: AssetArchive}
+
+	got := checksumURLs("https://mirror.example.com/ch", V25_8, asset)
+
+	want := []string{
+		"https://mirror.example.com/ch/v25.8.16.34-lts/clickhouse-common-static-25.8.16.34-amd64.tgz.sha512",
+		"https://mirror.example.com/ch/v25.8.16.34-lts/checksums.txt",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("checksumURLs = %q, want %q", got, want)
+	}
+
+	if got := checksumURLs("", "", asset); got != nil {
+		t.Errorf("checksumURLs without a version = %q, want nil", got)
+	}
+}
+
 func TestSHA512URL_Darwin(t *testing.T) {
 	t.Parallel()
 
-	asset := platformAsset{filename: assetMacOSAARCH64, assetType: assetRawBinary}
+	asset := platformAsset{filename: assetMacOSAARCH64, assetType: AssetRawBinary}
 
 	got := sha512URL("", V25_8, asset)
 
@@ -166,3 +214,116 @@ func TestSHA512URL_Darwin(t *testing.T) {
 		t.Errorf("sha512URL = %q, want %q", got, want)
 	}
 }
+
+func TestResolveAssetWith_Custom(t *testing.T) {
+	t.Parallel()
+
+	var gotVersion, gotOS, gotArch string
+
+	nameFunc := func(version, goos, goarch string) (string, AssetType) {
+		gotVersion, gotOS, gotArch = version, goos, goarch
+		return "mirror/ch-" + version + "-" + goos + "-" + goarch + ".tar.gz", AssetArchive
+	}
+
+	asset, err := resolveAssetWith(nameFunc, V25_8, "linux", archARM64, AssetArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if asset.filename != "mirror/ch-25.8.16.34-lts-linux-arm64.tar.gz" || asset.assetType != AssetArchive {
+		t.Errorf("asset = %+v, want the custom archive name", asset)
+	}
+
+	if gotVersion != string(V25_8) || gotOS != "linux" || gotArch != archARM64 {
+		t.Errorf("nameFunc got (%q, %q, %q)", gotVersion, gotOS, gotArch)
+	}
+}
+
+func TestResolveAssetWith_Default(t *testing.T) {
+	t.Parallel()
+
+	got, err := resolveAssetWith(nil, V25_8, "darwin", archARM64, AssetArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := resolveAsset(V25_8, "darwin", archARM64, AssetArchive)
+	if got != want {
+		t.Errorf("asset = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveAssetWith_Errors(t *testing.T) {
+	t.Parallel()
+
+	unsupported := func(string, string, string) (string, AssetType) { return "", AssetArchive }
+	if _, err := resolveAssetWith(unsupported, V25_8, "linux", archAMD64, AssetArchive); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("empty name: err = %v, want ErrUnsupportedPlatform", err)
+	}
+
+	badType := func(string, string, string) (string, AssetType) { return "ch.bin", AssetType(42) }
+	if _, err := resolveAssetWith(badType, V25_8, "linux", archAMD64, AssetArchive); !errors.Is(err, ErrUnknownAssetType) {
+		t.Errorf("bad type: err = %v, want ErrUnknownAssetType", err)
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []ClickHouseVersion{V26_3, V25_8, V25_3, "24.8.4.13-lts", "25.1.1.4165-stable", "24.3.1.2672"} {
+		if err := validateVersion(v); err != nil {
+			t.Errorf("validateVersion(%q) = %v, want nil", v, err)
+		}
+	}
+
+	for _, v := range []ClickHouseVersion{"", "v24.8.4.13-lts", "24.8", "latest", "24.8.4.13-LTS", "24.8.4.13-lts/../x"} {
+		if err := validateVersion(v); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("validateVersion(%q) = %v, want ErrInvalidVersion", v, err)
+		}
+	}
+}
+
+func TestRawVersion_EndToEnd(t *testing.T) {
+	t.Parallel()
+
+	raw := ClickHouseVersion("24.8.4.13-lts")
+
+	asset, err := resolveAsset(raw, "linux", archAMD64, AssetArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if asset.filename != "clickhouse-common-static-24.8.4.13-amd64.tgz" {
+		t.Errorf("filename = %q", asset.filename)
+	}
+
+	wantURL := "https://github.com/ClickHouse/ClickHouse/releases/download/v24.8.4.13-lts/clickhouse-common-static-24.8.4.13-amd64.tgz"
+	if got := downloadURL("", raw, asset); got != wantURL {
+		t.Errorf("downloadURL = %q, want %q", got, wantURL)
+	}
+
+	if cachedBinaryPath("/cache", raw) == cachedBinaryPath("/cache", V25_8) {
+		t.Error("a raw version must cache under a path distinct from the constants")
+	}
+}
+
+func TestBinaryPlatform(t *testing.T) {
+	t.Parallel()
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if goos, goarch, ok := binaryPlatform(self); !ok || goos != runtime.GOOS || goarch != runtime.GOARCH {
+		t.Errorf("binaryPlatform(test binary) = %s/%s, %v, want %s/%s", goos, goarch, ok, runtime.GOOS, runtime.GOARCH)
+	}
+
+	if goos, goarch, ok := binaryPlatform(writeELFHeader(t, elf.EM_AARCH64)); !ok || goos != "linux" || goarch != archARM64 {
+		t.Errorf("binaryPlatform(aarch64 header) = %s/%s, %v, want linux/arm64", goos, goarch, ok)
+	}
+
+	if _, _, ok := binaryPlatform(writeFakeScript(t, "exit 0\n")); ok {
+		t.Error("binaryPlatform(script) reported a platform")
+	}
+}
@@ -0,0 +1,41 @@
+package embeddedclickhouse
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// pollJitter is the fraction by which each readiness poll interval is randomized either
+// way, so many servers started together do not probe in lockstep.
+const pollJitter = 0.2
+
+// poller yields the delays between the polls of a readiness wait: interval with jitter,
+// doubling after every poll up to the HealthPollBackoff cap, if any.
+type poller struct {
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+// newPoller returns the poller of a wait that starts polling every interval and backs off
+// up to maxInterval (the HealthPollBackoff); a maxInterval <= interval keeps it fixed.
+func newPoller(interval, maxInterval time.Duration) *poller {
+	return &poller{interval: interval, maxInterval: max(maxInterval, interval)}
+}
+
+// next returns the delay before the next poll and grows the interval.
+func (p *poller) next() time.Duration {
+	d := jittered(p.interval)
+	p.interval = min(2*p.interval, p.maxInterval)
+
+	return d
+}
+
+// jittered returns d randomized by up to pollJitter either way.
+func jittered(d time.Duration) time.Duration {
+	spread := int64(float64(d) * pollJitter)
+	if spread <= 0 {
+		return d
+	}
+
+	return d - time.Duration(spread) + time.Duration(rand.Int64N(2*spread+1)) //nolint:gosec // jitter needs no secure randomness
+}
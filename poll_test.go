@@ -0,0 +1,62 @@
+package embeddedclickhouse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJittered(t *testing.T) {
+	t.Parallel()
+
+	const d = 100 * time.Millisecond
+
+	for range 1000 {
+		if got := jittered(d); got < 80*time.Millisecond || got > 120*time.Millisecond {
+			t.Fatalf("jittered(%s) = %s, want within 20%%", d, got)
+		}
+	}
+
+	if got := jittered(1); got != 1 {
+		t.Errorf("jittered(1ns) = %s, want 1ns", got)
+	}
+}
+
+func TestPoller_Fixed(t *testing.T) {
+	t.Parallel()
+
+	p := newPoller(100*time.Millisecond, 0)
+
+	for range 10 {
+		if d := p.next(); d > 120*time.Millisecond {
+			t.Fatalf("delay = %s, want about 100ms without HealthPollBackoff", d)
+		}
+	}
+}
+
+func TestPoller_Backoff(t *testing.T) {
+	t.Parallel()
+
+	p := newPoller(100*time.Millisecond, time.Second)
+
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, base := range want {
+		base *= time.Millisecond
+
+		if d := p.next(); d < base*8/10 || d > base*12/10 {
+			t.Errorf("poll %d: delay = %s, want about %s", i, d, base)
+		}
+	}
+}
+
+func TestPoller_BackoffBelowInterval(t *testing.T) {
+	t.Parallel()
+
+	// A cap below the base interval never shortens it.
+	p := newPoller(500*time.Millisecond, time.Millisecond)
+
+	for range 3 {
+		if d := p.next(); d < 400*time.Millisecond {
+			t.Fatalf("delay = %s, want about 500ms", d)
+		}
+	}
+}
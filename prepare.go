@@ -0,0 +1,190 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// binaryKey identifies a binary resolution: every Config field that influences which
+// binary ensureBinary returns. Two configs with the same key resolve to the same path.
+type binaryKey struct {
+	version              ClickHouseVersion
+	cachePath            string
+	sharedCachePath      string
+	binaryPath           string
+	binaryRepositoryURL  string
+	customArchivePath    string
+	customArchiveURL     string
+	sha256               string
+	sha512hash           string
+	allowMissingChecksum bool
+	requireChecksum      bool
+	useSystemBinary      bool
+	skipVersionCheck     bool
+	verifyBinaryRuns     bool
+	maxBinarySize        int64
+	linuxAsset           AssetType
+	// assetName and assetType are AssetNameFunc's answer for this platform: funcs are not
+	// comparable, but the asset they resolve to identifies the download.
+	assetName string
+	assetType AssetType
+}
+
+// preparedBinary is the memoized result of resolving one binaryKey. mu serializes the
+// resolutions; done is set by the first one that succeeds.
+type preparedBinary struct {
+	mu         sync.Mutex
+	done       bool
+	path       string
+	downloaded bool
+}
+
+// preparedBinaries maps binaryKey -> *preparedBinary for the lifetime of the process.
+var preparedBinaries sync.Map //nolint:gochecknoglobals // process-wide memo shared by all tests in a package
+
+func binaryKeyFor(cfg Config) binaryKey {
+	var (
+		assetName string
+		assetType AssetType
+	)
+
+	if cfg.assetNameFunc != nil {
+		assetName, assetType = cfg.assetNameFunc(string(cfg.version), runtime.GOOS, runtime.GOARCH)
+	}
+
+	return binaryKey{
+		version:              cfg.version,
+		cachePath:            cfg.cachePath,
+		sharedCachePath:      cfg.sharedCachePath,
+		binaryPath:           cfg.binaryPath,
+		binaryRepositoryURL:  cfg.binaryRepositoryURL,
+		customArchivePath:    cfg.customArchivePath,
+		customArchiveURL:     cfg.customArchiveURL,
+		sha256:               cfg.sha256,
+		sha512hash:           cfg.sha512hash,
+		allowMissingChecksum: cfg.allowMissingChecksum,
+		requireChecksum:      cfg.requireChecksum,
+		useSystemBinary:      cfg.useSystemBinary,
+		skipVersionCheck:     cfg.skipVersionCheck,
+		verifyBinaryRuns:     cfg.verifyBinaryRuns,
+		maxBinarySize:        cfg.maxBinarySize,
+		linuxAsset:           cfg.linuxAsset,
+		assetName:            assetName,
+		assetType:            assetType,
+	}
+}
+
+// prepareBinary resolves the binary for cfg once per process. Concurrent callers with an
+// equivalent config wait for the resolution in progress and share its result. Only a
+// success is memoized: after a failure, such as a transient download error, the next
+// caller tries again. downloaded reports whether the successful resolution fetched the
+// binary from the network.
+func prepareBinary(cfg Config) (path string, downloaded bool, err error) {
+	v, _ := preparedBinaries.LoadOrStore(binaryKeyFor(cfg), &preparedBinary{})
+
+	pb := v.(*preparedBinary) //nolint:forcetypeassert // only *preparedBinary is ever stored
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if pb.done {
+		return pb.path, pb.downloaded, nil
+	}
+
+	ctx, span := cfg.rootSpan(context.Background(), "embedded-clickhouse.Prepare", attrVersion.String(string(cfg.version)))
+	ctx = withTiming(ctx, cfg.onTiming)
+
+	path, downloaded, err = ensureBinary(ctx, cfg)
+	endSpan(span, err)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	pb.done, pb.path, pb.downloaded = true, path, downloaded
+
+	return pb.path, pb.downloaded, nil
+}
+
+// Prepare downloads (if needed) and resolves the ClickHouse binary for the given config
+// once per process. Later NewServerForTest and NewClusterForTest calls with an equivalent
+// config reuse the result and skip binary resolution entirely. Call it from a top-level
+// test or benchmark setup so the first parallel test does not pay for the download while
+// holding up the others. Calls tb.Fatal on error and returns the resolved binary path.
+func Prepare(tb testing.TB, config ...Config) string {
+	tb.Helper()
+
+	cfg := DefaultConfig()
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	binPath, _, err := prepareBinary(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return binPath
+}
+
+// prefetchConcurrency bounds how many binaries PrefetchVersions resolves at once.
+const prefetchConcurrency = 3
+
+// PrefetchVersions downloads (if needed) the binaries for every config concurrently, at
+// most three at a time, so a TestMain can warm the cache for a whole version matrix up
+// front. Configs resolving to the same binary are fetched once, and the per-binary cache
+// lock keeps concurrent test processes from duplicating work. The first failure cancels
+// the remaining downloads and is returned.
+func PrefetchVersions(ctx context.Context, cfgs ...Config) error {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, prefetchConcurrency)
+	errs := make(chan error, len(cfgs))
+	seen := make(map[binaryKey]bool, len(cfgs))
+
+	var wg sync.WaitGroup
+
+	for _, cfg := range cfgs {
+		key := binaryKeyFor(cfg)
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+
+		wg.Go(func() {
+			select {
+			case sem <- struct{}{}:
+			case <-fetchCtx.Done():
+				return
+			}
+
+			defer func() { <-sem }()
+
+			spanCtx, span := cfg.rootSpan(fetchCtx, "embedded-clickhouse.Prefetch", attrVersion.String(string(cfg.version)))
+			spanCtx = withTiming(spanCtx, cfg.onTiming)
+
+			_, _, err := ensureBinary(spanCtx, cfg)
+			endSpan(span, err)
+
+			if err != nil {
+				errs <- fmt.Errorf("embedded-clickhouse: prefetch %s: %w", cfg.version, err)
+
+				cancel() // stop the other downloads as soon as one fails
+			}
+		})
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if err, ok := <-errs; ok {
+		return err
+	}
+
+	return ctx.Err() //nolint:wrapcheck // the caller's own context error
+}
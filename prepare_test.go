@@ -0,0 +1,245 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepare_MemoizesResolution(t *testing.T) {
+	t.Parallel()
+
+	bin := filepath.Join(t.TempDir(), "clickhouse")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig().BinaryPath(bin)
+
+	if got := Prepare(t, cfg); got != bin {
+		t.Fatalf("Prepare = %q, want %q", got, bin)
+	}
+
+	// Remove the binary: a second resolution would now fail the stat in ensureBinary,
+	// so a successful result proves the memo was used.
+	if err := os.Remove(bin); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _, err := prepareBinary(cfg)
+	if err != nil {
+		t.Fatalf("prepareBinary after removal: %v", err)
+	}
+
+	if got != bin {
+		t.Errorf("prepareBinary = %q, want %q", got, bin)
+	}
+}
+
+func TestPrepareBinary_RetriesAfterFailure(t *testing.T) {
+	t.Parallel()
+
+	bin := filepath.Join(t.TempDir(), "clickhouse")
+	cfg := DefaultConfig().BinaryPath(bin)
+
+	_, _, err := prepareBinary(cfg)
+	require.Error(t, err, "binary does not exist yet")
+
+	// A transient failure must not stick: once the binary appears, resolution succeeds.
+	require.NoError(t, os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755))
+
+	got, _, err := prepareBinary(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, bin, got)
+}
+
+func TestPrepareBinary_ConcurrentCallersShareResult(t *testing.T) {
+	t.Parallel()
+
+	bin := filepath.Join(t.TempDir(), "clickhouse")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := DefaultConfig().BinaryPath(bin)
+
+	const goroutines = 16
+
+	paths := make([]string, goroutines)
+
+	var wg sync.WaitGroup
+
+	for i := range goroutines {
+		wg.Go(func() {
+			p, _, err := prepareBinary(cfg)
+			if err != nil {
+				t.Errorf("goroutine %d: %v", i, err)
+			}
+
+			paths[i] = p
+		})
+	}
+
+	wg.Wait()
+
+	for i, p := range paths {
+		if p != bin {
+			t.Errorf("goroutine %d: path = %q, want %q", i, p, bin)
+		}
+	}
+}
+
+func TestEnsureBinary_ResolvedPathShortCircuits(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig()
+	cfg.resolvedBinaryPath = "/does/not/exist/clickhouse"
+
+	got, _, err := ensureBinary(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != cfg.resolvedBinaryPath {
+		t.Errorf("ensureBinary = %q, want %q", got, cfg.resolvedBinaryPath)
+	}
+}
+
+func TestBinaryKeyFor_SharedCachePath(t *testing.T) {
+	t.Parallel()
+
+	// The shared cache can change which binary resolves, so it must split the memo.
+	if binaryKeyFor(DefaultConfig()) == binaryKeyFor(DefaultConfig().SharedCachePath("/mnt/warm")) {
+		t.Error("SharedCachePath does not change the Prepare memo key")
+	}
+}
+
+func TestPrepareBinary_LinuxAssetSplitsMemo(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("LinuxAsset only applies on Linux")
+	}
+
+	// A mirror without the .tgz: the archive config fails, the raw one must still try its own asset.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tgz") || strings.HasSuffix(r.URL.Path, ".sha512") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		io.WriteString(w, "#!/bin/sh\n")
+	}))
+	t.Cleanup(ts.Close)
+
+	archive := DefaultConfig().
+		Version("25.6.1.1").
+		CachePath(t.TempDir()).
+		BinaryRepositoryURL(ts.URL).
+		Logger(io.Discard)
+	raw := archive.LinuxAsset(AssetRawBinary)
+
+	require.NotEqual(t, binaryKeyFor(archive), binaryKeyFor(raw))
+
+	_, _, err := prepareBinary(archive)
+	require.ErrorIs(t, err, ErrDownloadFailed)
+
+	path, downloaded, err := prepareBinary(raw)
+	require.NoError(t, err)
+	assert.True(t, downloaded)
+	assert.FileExists(t, path)
+}
+
+// prefetchMirror serves a raw binary for every version, counting downloads per path and
+// the peak number of concurrent ones. Paths containing "missing" answer 404.
+type prefetchMirror struct {
+	mu        sync.Mutex
+	downloads map[string]int
+	inFlight  int
+	peak      int
+}
+
+func (m *prefetchMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, ".sha512") || strings.Contains(r.URL.Path, "missing") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	m.mu.Lock()
+	m.downloads[r.URL.Path]++
+	m.inFlight++
+	m.peak = max(m.peak, m.inFlight)
+	m.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond) // overlap the downloads
+
+	m.mu.Lock()
+	m.inFlight--
+	m.mu.Unlock()
+
+	io.WriteString(w, "#!/bin/sh\n")
+}
+
+func prefetchConfig(url, cache string, version ClickHouseVersion) Config {
+	return DefaultConfig().
+		Version(version).
+		CachePath(cache).
+		BinaryRepositoryURL(url).
+		AssetNameFunc(func(string, string, string) (string, AssetType) { return "clickhouse", AssetRawBinary }).
+		Logger(io.Discard)
+}
+
+func TestPrefetchVersions(t *testing.T) {
+	t.Parallel()
+
+	mirror := &prefetchMirror{downloads: map[string]int{}}
+	ts := httptest.NewServer(mirror)
+	t.Cleanup(ts.Close)
+
+	cache := t.TempDir()
+	versions := []ClickHouseVersion{"25.1.1.1", "25.2.1.1", "25.3.1.1", "25.4.1.1", "25.5.1.1"}
+
+	cfgs := make([]Config, 0, len(versions)+1)
+	for _, v := range versions {
+		cfgs = append(cfgs, prefetchConfig(ts.URL, cache, v))
+	}
+
+	cfgs = append(cfgs, cfgs[0]) // duplicates are fetched once
+
+	require.NoError(t, PrefetchVersions(context.Background(), cfgs...))
+
+	for _, v := range versions {
+		assert.FileExists(t, cachedBinaryPath(cache, v))
+		assert.Equal(t, 1, mirror.downloads["/v"+string(v)+"/clickhouse"], "downloads of %s", v)
+	}
+
+	assert.LessOrEqual(t, mirror.peak, prefetchConcurrency)
+	assert.Greater(t, mirror.peak, 1, "downloads did not overlap")
+}
+
+func TestPrefetchVersions_ReturnsFailure(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(&prefetchMirror{downloads: map[string]int{}})
+	t.Cleanup(ts.Close)
+
+	cache := t.TempDir()
+
+	err := PrefetchVersions(context.Background(),
+		prefetchConfig(ts.URL, cache, "25.1.1.1"),
+		prefetchConfig(ts.URL+"/missing", cache, "25.2.1.1"),
+	)
+	require.ErrorIs(t, err, ErrDownloadFailed)
+	assert.Contains(t, err.Error(), "prefetch 25.2.1.1")
+}
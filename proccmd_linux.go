@@ -0,0 +1,19 @@
+//go:build linux
+
+package embeddedclickhouse
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// processCommandLine returns the arguments pid was started with, NUL-separated.
+func processCommandLine(pid int) (string, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: read command line of %d: %w", pid, err)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package embeddedclickhouse
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// processCommandLine returns the arguments pid was started with, space-separated, as
+// reported by ps (there is no /proc to read).
+func processCommandLine(pid int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "ps", "-ww", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: read command line of %d: %w", pid, err)
+	}
+
+	return string(out), nil
+}
@@ -6,16 +6,172 @@ import (
 	"io"
 	"net"
 	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-// allocatePort finds a free TCP port by binding to :0 and immediately closing.
-func allocatePort() (uint32, error) {
-	//nolint:noctx // ephemeral bind-and-close; context is meaningless
-	l, err := net.Listen("tcp", "127.0.0.1:0")
+// portRange bounds port allocation (see Config.PortRange). The zero value means
+// OS-assigned ephemeral ports.
+type portRange struct {
+	min uint32
+	max uint32
+}
+
+// isSet reports whether a range was configured.
+func (r portRange) isSet() bool { return r.min != 0 || r.max != 0 }
+
+// validate rejects ranges that are inverted or outside 1-65535.
+func (r portRange) validate() error {
+	if r.isSet() && (r.min == 0 || r.max < r.min || r.max > maxPort) {
+		return fmt.Errorf("%w: %d-%d", ErrInvalidPortRange, r.min, r.max)
+	}
+
+	return nil
+}
+
+// cgroupLimits are the resource limits of the cgroup the server runs in (see
+// Config.Cgroup). The zero value means no cgroup.
+type cgroupLimits struct {
+	memBytes int64
+	cpus     float64
+}
+
+// isSet reports whether any limit was configured.
+func (l cgroupLimits) isSet() bool { return l.memBytes != 0 || l.cpus != 0 }
+
+// minCgroupCPUs is the smallest CPU quota the kernel accepts: 1ms per 100ms period.
+const minCgroupCPUs = 0.01
+
+// validate rejects negative limits and a CPU quota below minCgroupCPUs.
+func (l cgroupLimits) validate() error {
+	if l.memBytes < 0 || l.cpus < 0 || (l.cpus > 0 && l.cpus < minCgroupCPUs) {
+		return fmt.Errorf("%w: memory %d bytes, %g CPUs", ErrInvalidCgroupLimits, l.memBytes, l.cpus)
+	}
+
+	return nil
+}
+
+// maxPort is the highest valid TCP port.
+const maxPort = 65535
+
+// portRangeCursor spreads scans of a configured range: each probe takes the next port
+// after the previous one handed out in this process, so concurrent Starts sharing a
+// range walk it in lockstep instead of all probing (and racing for) its first port.
+var portRangeCursor atomic.Uint32 //nolint:gochecknoglobals // process-wide scan position
+
+// portClaims is a registry of auto-allocated ports. Allocation binds a port and closes the
+// listener before ClickHouse binds it, and in that window the kernel may hand the same
+// port to another Start of this process, e.g. a second Cluster starting in parallel. A
+// port therefore stays claimed from allocation until its server or cluster stops (or
+// fails to start), and allocation skips claimed ports.
+type portClaims struct {
+	mu    sync.Mutex
+	ports map[uint32]struct{}
+}
+
+// claimedPorts is the process-wide registry shared by all allocations.
+var claimedPorts = &portClaims{ports: map[uint32]struct{}{}} //nolint:gochecknoglobals // process-wide registry
+
+// claim records port as taken; it reports false if it already was.
+func (p *portClaims) claim(port uint32) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.ports[port]; ok {
+		return false
+	}
+
+	p.ports[port] = struct{}{}
+
+	return true
+}
+
+// release makes ports available to later allocations again.
+func (p *portClaims) release(ports ...uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, port := range ports {
+		delete(p.ports, port)
+	}
+}
+
+// maxEphemeralAttempts bounds how many OS-assigned ports listenFree tries before giving
+// up when every one it gets is already claimed.
+const maxEphemeralAttempts = 100
+
+// listenFree binds a loopback listener on a free port that it claims in claimedPorts: an
+// OS-assigned one, or the next free port of a configured range.
+func listenFree(r portRange) (net.Listener, error) {
+	if !r.isSet() {
+		return listenFreeEphemeral()
+	}
+
+	size := r.max - r.min + 1
+
+	for range size {
+		port := r.min + (portRangeCursor.Add(1)-1)%size
+		if !claimedPorts.claim(port) {
+			continue
+		}
+
+		//nolint:noctx // ephemeral bind-and-close; context is meaningless
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.FormatUint(uint64(port), 10)))
+		if err == nil {
+			return l, nil
+		}
+
+		claimedPorts.release(port)
+	}
+
+	return nil, fmt.Errorf("%w: %d-%d", ErrNoFreePort, r.min, r.max)
+}
+
+// listenFreeEphemeral binds an OS-assigned loopback port that is not claimed yet. Rejected
+// listeners stay open until it returns, so the kernel cannot offer their ports again.
+func listenFreeEphemeral() (net.Listener, error) {
+	var rejected []net.Listener
+
+	defer func() {
+		for _, l := range rejected {
+			l.Close()
+		}
+	}()
+
+	for range maxEphemeralAttempts {
+		//nolint:noctx // ephemeral bind-and-close; context is meaningless
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("embedded-clickhouse: allocate port: %w", err)
+		}
+
+		tcpAddr, ok := l.Addr().(*net.TCPAddr)
+		if !ok {
+			l.Close()
+			return nil, fmt.Errorf("%w: %T", ErrUnexpectedAddrType, l.Addr())
+		}
+
+		if claimedPorts.claim(uint32(tcpAddr.Port)) {
+			return l, nil
+		}
+
+		rejected = append(rejected, l)
+	}
+
+	return nil, fmt.Errorf("%w: every port the OS offered is in use by this process", ErrNoFreePort)
+}
+
+// allocatePort finds a free TCP port by binding to it and immediately closing. The port
+// stays claimed in claimedPorts until the caller releases it.
+func allocatePort(r portRange) (uint32, error) {
+	l, err := listenFree(r)
 	if err != nil {
-		return 0, fmt.Errorf("embedded-clickhouse: allocate port: %w", err)
+		return 0, err
 	}
 
 	tcpAddr, ok := l.Addr().(*net.TCPAddr)
@@ -27,52 +183,104 @@ func allocatePort() (uint32, error) {
 	port := uint32(tcpAddr.Port)
 
 	// Note: there is an inherent TOCTOU race between releasing this listener
-	// and ClickHouse binding to the same port. This is unavoidable with
-	// bind-and-release port allocation, but is safe in practice because
-	// the port is allocated on loopback and ClickHouse binds quickly.
+	// and ClickHouse binding to the same port. The claim keeps other Starts of this
+	// process off it, but another process can still take it; that is unavoidable
+	// with bind-and-release port allocation, and safe in practice because the port
+	// is allocated on loopback and ClickHouse binds quickly.
 	l.Close()
 
 	return port, nil
 }
 
-// allocatePorts finds count distinct free TCP ports. Unlike calling allocatePort
-// in a loop, it keeps every listener open until all of them are bound, so the
-// kernel cannot reassign a just-freed ephemeral port to a later iteration. This
-// makes the returned ports distinct by construction rather than by chance.
+// claimPorts claims the given, already chosen ports in claimedPorts after checking that
+// each is free by binding it. If one is claimed or bound already, it claims none and fails
+// with ErrPortInUse. The ports stay claimed until the caller releases them; the TOCTOU
+// caveat documented on allocatePort applies.
+func claimPorts(ports []uint32) error {
+	for i, port := range ports {
+		if !claimedPorts.claim(port) {
+			claimedPorts.release(ports[:i]...)
+			return fmt.Errorf("%w: %d is used by another server of this process", ErrPortInUse, port)
+		}
+
+		//nolint:noctx // bind-and-close free check; context is meaningless
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.FormatUint(uint64(port), 10)))
+		if err != nil {
+			claimedPorts.release(ports[:i+1]...)
+			return fmt.Errorf("%w: %d: %w", ErrPortInUse, port, err)
+		}
+
+		l.Close()
+	}
+
+	return nil
+}
+
+// reservePorts finds count distinct free TCP ports and keeps them bound until the
+// returned release func is called. Unlike calling allocatePort in a loop, no listener
+// is closed before all of them are bound, so the kernel cannot reassign a just-freed
+// ephemeral port to a later iteration: the ports are distinct by construction rather
+// than by chance. Call release right before the ports are used. Like allocatePort, the
+// ports stay claimed in claimedPorts until the caller releases them.
 //
 // The same TOCTOU caveat documented on allocatePort applies once the listeners
-// are released here.
-func allocatePorts(count int) ([]uint32, error) {
+// are released.
+func reservePorts(count int, r portRange) ([]uint32, func(), error) {
 	listeners := make([]net.Listener, 0, count)
-
-	defer func() {
+	release := func() {
 		for _, l := range listeners {
 			l.Close()
 		}
-	}()
+	}
 
 	ports := make([]uint32, 0, count)
 
 	for range count {
-		//nolint:noctx // ephemeral bind-and-close; context is meaningless
-		l, err := net.Listen("tcp", "127.0.0.1:0")
+		l, err := listenFree(r)
 		if err != nil {
-			return nil, fmt.Errorf("embedded-clickhouse: allocate port: %w", err)
+			release()
+			claimedPorts.release(ports...)
+
+			return nil, nil, err
 		}
 
 		listeners = append(listeners, l)
 
 		tcpAddr, ok := l.Addr().(*net.TCPAddr)
 		if !ok {
-			return nil, fmt.Errorf("%w: %T", ErrUnexpectedAddrType, l.Addr())
+			release()
+			claimedPorts.release(ports...)
+
+			return nil, nil, fmt.Errorf("%w: %T", ErrUnexpectedAddrType, l.Addr())
 		}
 
 		ports = append(ports, uint32(tcpAddr.Port))
 	}
 
-	return ports, nil
+	return ports, release, nil
+}
+
+// validateExtraArgs rejects ExtraArgs that would repeat the config flag startProcess
+// sets, in any spelling ClickHouse accepts (--config-file, --config, -C). Arguments after
+// a "--" are config overrides rather than flags, so they are not checked.
+func validateExtraArgs(args []string) error {
+	for _, arg := range args {
+		if arg == "--" {
+			return nil
+		}
+
+		name, _, _ := strings.Cut(arg, "=")
+		if name == "--config-file" || name == "--config" || strings.HasPrefix(name, "-C") {
+			return fmt.Errorf("%w: %q is set by embedded-clickhouse", ErrInvalidExtraArgs, arg)
+		}
+	}
+
+	return nil
 }
 
+// exitCodeSIGTERM is the exit status a shell wrapper reports for a child ended by SIGTERM (128+15).
+const exitCodeSIGTERM = 143
+
 // process wraps a started ClickHouse server command together with a single-shot
 // wait goroutine. cmd.Wait() is called exactly once (in startProcess); the result
 // is published via waitErr and broadcast by closing done. Both the startup monitor
@@ -85,16 +293,45 @@ type process struct {
 	waitErr error         // safe to read only after <-done (happens-before via close)
 }
 
-// startProcess launches the ClickHouse server process and starts the single Wait goroutine.
-func startProcess(binaryPath, configPath string, logger io.Writer) (*process, error) {
+// startProcess launches the ClickHouse server process, with extraArgs after the config
+// flag, and starts the single Wait goroutine. Its stdout and stderr go to logger and,
+// when output is non-nil, are also kept in output. With limits set the process starts
+// inside a new cgroup enforcing them, removed by the Wait goroutine once it exits.
+func startProcess(
+	binaryPath, configPath string, extraArgs []string, limits cgroupLimits, logger io.Writer, output *outputBuffer,
+) (*process, error) {
+	if output != nil {
+		logger = io.MultiWriter(logger, output)
+	}
+
 	//nolint:noctx // lifecycle managed via SIGTERM/SIGKILL, not context
-	cmd := exec.Command(binaryPath, "server", "--config-file="+configPath)
+	cmd := exec.Command(binaryPath, append([]string{"server", "--config-file=" + configPath}, extraArgs...)...)
 	cmd.Stdout = logger
 	cmd.Stderr = logger
 	// Set process group so we can kill the whole group on stop.
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	if err := cmd.Start(); err != nil {
+	var cg *cgroup
+
+	if limits.isSet() {
+		var err error
+		if cg, err = createCgroup(limits); err != nil {
+			return nil, err
+		}
+
+		cg.attach(cmd.SysProcAttr)
+	}
+
+	err := cmd.Start()
+	cg.closeFD()
+
+	if err != nil {
+		cg.remove()
+
+		if platformErr := execFormatError(binaryPath, err); platformErr != nil {
+			return nil, platformErr
+		}
+
 		return nil, fmt.Errorf("embedded-clickhouse: start process: %w", err)
 	}
 
@@ -102,15 +339,38 @@ func startProcess(binaryPath, configPath string, logger io.Writer) (*process, er
 
 	go func() {
 		proc.waitErr = cmd.Wait()
+		cg.remove()
 		close(proc.done)
 	}()
 
 	return proc, nil
 }
 
+// execFormatError returns err wrapped with ErrUnsupportedPlatform and the host's
+// GOOS/GOARCH when it is an exec format error (ENOEXEC) and the header of the binary at
+// path names another OS or architecture, e.g. a BinaryPath or cache copied from another
+// machine. It returns nil for any other error, including ENOEXEC from a truncated or
+// corrupt binary of this platform, which the caller reports as is.
+func execFormatError(path string, err error) error {
+	if !errors.Is(err, syscall.ENOEXEC) {
+		return nil
+	}
+
+	goos, goarch, ok := binaryPlatform(path)
+	if !ok || (goos == runtime.GOOS && goarch == runtime.GOARCH) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s is a %s/%s binary, not one for this host (%s/%s): %w",
+		ErrUnsupportedPlatform, path, goos, goarch, runtime.GOOS, runtime.GOARCH, err)
+}
+
 // stopProcess sends SIGTERM and waits for graceful shutdown, then SIGKILL if needed.
 // It never calls cmd.Wait() — that is owned by the goroutine started in startProcess.
-// Instead it observes completion via proc.done and classifies proc.waitErr.
+// Instead it observes completion via proc.done and classifies proc.waitErr into one of
+// the shutdown outcomes: graceful (nil), timed out and killed (ErrStopTimeout), exited
+// abnormally after SIGTERM (ErrUncleanShutdown) or already dead before the stop
+// (ErrServerCrashed).
 func stopProcess(proc *process, timeout time.Duration) error {
 	if proc == nil || proc.cmd == nil || proc.cmd.Process == nil {
 		return nil
@@ -121,7 +381,7 @@ func stopProcess(proc *process, timeout time.Duration) error {
 	// and could be recycled to an unrelated process group.
 	select {
 	case <-proc.done:
-		return classifyWaitErr(proc.waitErr)
+		return classifyEarlyExit(proc.waitErr)
 	default:
 	}
 
@@ -133,7 +393,7 @@ func stopProcess(proc *process, timeout time.Duration) error {
 		// rather than masking a recorded abnormal exit with a nil return.
 		<-proc.done
 
-		return classifyWaitErr(proc.waitErr)
+		return classifyEarlyExit(proc.waitErr)
 	}
 
 	_ = syscall.Kill(-pgid, syscall.SIGTERM)
@@ -144,7 +404,7 @@ func stopProcess(proc *process, timeout time.Duration) error {
 		// classification over a timeout.
 		select {
 		case <-proc.done:
-			return classifyWaitErr(proc.waitErr)
+			return classifyShutdownExit(proc.waitErr)
 		default:
 		}
 
@@ -155,26 +415,45 @@ func stopProcess(proc *process, timeout time.Duration) error {
 
 		return ErrStopTimeout
 	case <-proc.done:
-		return classifyWaitErr(proc.waitErr)
+		return classifyShutdownExit(proc.waitErr)
 	}
 }
 
-// classifyWaitErr maps cmd.Wait()'s error to a stop result. An exit caused by our
-// SIGTERM/SIGKILL (exit code -1 for signals, or 143 = 128+SIGTERM) is expected and
-// reported as success; any other exit or I/O error is surfaced.
-func classifyWaitErr(err error) error {
+// classifyShutdownExit maps cmd.Wait()'s error after our SIGTERM to a stop result. An
+// exit caused by SIGTERM/SIGKILL (directly, or exit code 143 = 128+SIGTERM from a
+// wrapper) is expected and reported as success; any other exit status or signal (e.g.
+// SIGSEGV while flushing) wraps ErrUncleanShutdown, and I/O errors are surfaced as is.
+func classifyShutdownExit(err error) error {
 	if err == nil {
 		return nil
 	}
 
 	var exitErr *exec.ExitError
-	if errors.As(err, &exitErr) {
-		if exitErr.ExitCode() == -1 || exitErr.ExitCode() == 143 {
+	if !errors.As(err, &exitErr) {
+		// Non-ExitError (e.g., I/O error waiting on process): surface it.
+		return err
+	}
+
+	if exitErr.ExitCode() == exitCodeSIGTERM {
+		return nil
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		if sig := status.Signal(); sig == syscall.SIGTERM || sig == syscall.SIGKILL {
 			return nil
 		}
+	}
 
-		return err
+	return fmt.Errorf("%w: %w", ErrUncleanShutdown, exitErr)
+}
+
+// classifyEarlyExit maps cmd.Wait()'s error for a process that exited before Stop
+// signaled it. A clean exit is not an error; any failure (non-zero status, or a signal
+// such as an OOM kill) wraps ErrServerCrashed.
+func classifyEarlyExit(err error) error {
+	if err == nil {
+		return nil
 	}
-	// Non-ExitError (e.g., I/O error waiting on process): surface it.
-	return err
+
+	return fmt.Errorf("%w: %w", ErrServerCrashed, err)
 }
@@ -1,12 +1,19 @@
 package embeddedclickhouse
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
 	"errors"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -17,6 +24,14 @@ import (
 func writeFakeBinary(t *testing.T, exitCode int) string {
 	t.Helper()
 
+	return writeFakeScript(t, "exit "+itoa(exitCode)+"\n")
+}
+
+// writeFakeScript writes an executable /bin/sh script with the given body to
+// t.TempDir(), skipping the test where /bin/sh is unavailable.
+func writeFakeScript(t *testing.T, body string) string {
+	t.Helper()
+
 	if runtime.GOOS == "windows" {
 		t.Skip("fake /bin/sh binary not supported on windows")
 	}
@@ -27,8 +42,7 @@ func writeFakeBinary(t *testing.T, exitCode int) string {
 
 	path := filepath.Join(t.TempDir(), "fake-clickhouse.sh")
 
-	script := "#!/bin/sh\nexit " + itoa(exitCode) + "\n"
-	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
 		t.Fatal(err)
 	}
 
@@ -66,7 +80,7 @@ func itoa(num int) string {
 func TestAllocatePort(t *testing.T) {
 	t.Parallel()
 
-	port, err := allocatePort()
+	port, err := allocatePort(portRange{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,20 +100,255 @@ func TestAllocatePort_Unique(t *testing.T) {
 	ports := make(map[uint32]bool)
 
 	for range 10 {
-		port, err := allocatePort()
+		port, err := allocatePort(portRange{})
 		if err != nil {
 			t.Fatal(err)
 		}
 
+		// Claimed ports are never handed out again before they are released.
 		if ports[port] {
-			// Port reuse is technically possible but unlikely in 10 allocations.
-			t.Logf("warning: port %d was allocated twice", port)
+			t.Errorf("port %d was allocated twice", port)
 		}
 
 		ports[port] = true
 	}
 }
 
+func TestAllocatePort_Range(t *testing.T) {
+	t.Parallel()
+
+	free, err := allocatePort(portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimedPorts.release(free)
+
+	port, err := allocatePort(portRange{min: free, max: free})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port != free {
+		t.Errorf("port = %d, want %d", port, free)
+	}
+}
+
+func TestAllocatePort_RangeExhausted(t *testing.T) {
+	t.Parallel()
+
+	l, err := listenFree(portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	busy := uint32(l.Addr().(*net.TCPAddr).Port) //nolint:forcetypeassert // tcp listener
+
+	_, err = allocatePort(portRange{min: busy, max: busy})
+	if !errors.Is(err, ErrNoFreePort) {
+		t.Errorf("err = %v, want ErrNoFreePort", err)
+	}
+}
+
+func TestReservePorts_HeldUntilReleased(t *testing.T) {
+	t.Parallel()
+
+	free, err := allocatePort(portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimedPorts.release(free)
+
+	// The first port stays bound while the second is probed, so a one-port range
+	// cannot satisfy two allocations.
+	_, _, err = reservePorts(2, portRange{min: free, max: free})
+	if !errors.Is(err, ErrNoFreePort) {
+		t.Errorf("err = %v, want ErrNoFreePort", err)
+	}
+
+	// Reserved ports stay bound until released.
+	ports, release, err := reservePorts(1, portRange{min: free, max: free})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := allocatePort(portRange{min: free, max: free}); !errors.Is(err, ErrNoFreePort) {
+		t.Errorf("reserved port %d was handed out again: err = %v", ports[0], err)
+	}
+
+	release()
+
+	// Closing the listeners leaves the port claimed until its owner releases it.
+	if _, err := allocatePort(portRange{min: free, max: free}); !errors.Is(err, ErrNoFreePort) {
+		t.Errorf("claimed port %d was handed out again: err = %v", ports[0], err)
+	}
+
+	claimedPorts.release(ports...)
+
+	if _, err := allocatePort(portRange{min: free, max: free}); err != nil {
+		t.Errorf("released port: %v", err)
+	}
+}
+
+func TestClaimPorts(t *testing.T) {
+	t.Parallel()
+
+	ports, release, err := reservePorts(2, portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release()
+
+	// Ports another Start of this process holds are not claimed twice.
+	if err := claimPorts(ports); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("claimed ports: err = %v, want ErrPortInUse", err)
+	}
+
+	claimedPorts.release(ports...)
+
+	if err := claimPorts(ports); err != nil {
+		t.Fatalf("free ports: %v", err)
+	}
+
+	claimedPorts.release(ports...)
+
+	// A port bound by anyone fails the claim and leaves none of the ports claimed.
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", itoa(int(ports[1]))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	if err := claimPorts(ports); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("bound port: err = %v, want ErrPortInUse", err)
+	}
+
+	if !claimedPorts.claim(ports[0]) {
+		t.Errorf("port %d still claimed after a failed claim", ports[0])
+	}
+
+	claimedPorts.release(ports[0])
+}
+
+func TestListenFree_SkipsClaimedPorts(t *testing.T) {
+	t.Parallel()
+
+	// Claim every port of a small range but the last, as if other Starts of this process
+	// were still between allocation and bind.
+	first, err := allocatePort(portRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimedPorts.release(first)
+
+	r := portRange{min: first, max: min(first+2, maxPort)}
+
+	for port := r.min; port < r.max; port++ {
+		if !claimedPorts.claim(port) {
+			t.Skipf("port %d already claimed by another test", port)
+		}
+	}
+
+	t.Cleanup(func() {
+		for port := r.min; port < r.max; port++ {
+			claimedPorts.release(port)
+		}
+	})
+
+	port, err := allocatePort(r)
+	if err != nil {
+		t.Skipf("port %d unavailable: %v", r.max, err)
+	}
+
+	defer claimedPorts.release(port)
+
+	if port != r.max {
+		t.Errorf("port = %d, want the only unclaimed port %d", port, r.max)
+	}
+}
+
+func TestReserveClusterPorts_ConcurrentClustersDistinct(t *testing.T) {
+	t.Parallel()
+
+	// Two clusters allocating at once, each releasing its listeners right away as
+	// Cluster.Start does before launching: the claims alone must keep them apart.
+	const clusters = 2
+
+	results := make([][]ClusterNodePorts, clusters)
+	errs := make([]error, clusters)
+
+	var wg sync.WaitGroup
+
+	for i := range clusters {
+		wg.Go(func() {
+			ports, release, err := reserveClusterPorts(2, portRange{})
+			if err == nil {
+				release()
+			}
+
+			results[i], errs[i] = ports, err
+		})
+	}
+
+	wg.Wait()
+
+	seen := make(map[uint32]int)
+
+	for i, ports := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		for _, p := range ports {
+			for _, port := range []uint32{p.TCP, p.HTTP, p.Interserver, p.Keeper, p.KeeperRaft} {
+				if prev, ok := seen[port]; ok {
+					t.Errorf("port %d handed to cluster %d and cluster %d", port, prev, i)
+				}
+
+				seen[port] = i
+				claimedPorts.release(port)
+			}
+		}
+	}
+
+	if len(seen) != clusters*2*portsPerClusterNode {
+		t.Errorf("got %d distinct ports, want %d", len(seen), clusters*2*portsPerClusterNode)
+	}
+}
+
+func TestPortRange_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		r       portRange
+		wantErr bool
+	}{
+		{"unset", portRange{}, false},
+		{"single", portRange{min: 30000, max: 30000}, false},
+		{"full", portRange{min: 1, max: 65535}, false},
+		{"zero min", portRange{min: 0, max: 100}, true},
+		{"inverted", portRange{min: 30010, max: 30000}, true},
+		{"above 65535", portRange{min: 65000, max: 70000}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.r.validate()
+			if got := errors.Is(err, ErrInvalidPortRange); got != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestStopProcess_NilCmd(t *testing.T) {
 	t.Parallel()
 
@@ -118,7 +367,7 @@ func TestStartProcess_ExitErrorCaptured(t *testing.T) {
 
 	fake := writeFakeBinary(t, 3)
 
-	proc, err := startProcess(fake, "ignored-config", io.Discard)
+	proc, err := startProcess(fake, "ignored-config", nil, cgroupLimits{}, io.Discard, nil)
 	if err != nil {
 		t.Fatalf("startProcess: %v", err)
 	}
@@ -136,8 +385,8 @@ func TestStartProcess_ExitErrorCaptured(t *testing.T) {
 	}
 
 	// stopProcess on an already-exited (and reaped) process must not call Wait again
-	// and must return promptly. Once the process is gone, Getpgid fails and stop is a
-	// no-op (nil); the important guarantee is that it does not hang on a second Wait.
+	// and must return promptly. The important guarantee is that it does not hang on a
+	// second Wait; the early exit itself is reported as ErrServerCrashed.
 	stopDone := make(chan error, 1)
 
 	go func() { stopDone <- stopProcess(proc, time.Second) }()
@@ -148,3 +397,296 @@ func TestStartProcess_ExitErrorCaptured(t *testing.T) {
 		t.Fatal("stopProcess hung; likely a second cmd.Wait or single-delivery deadlock")
 	}
 }
+
+func TestStartProcess_ExtraArgs(t *testing.T) {
+	t.Parallel()
+
+	argv := filepath.Join(t.TempDir(), "argv")
+	fake := writeFakeScript(t, `printf '%s\n' "$@" > `+argv+"\n")
+
+	proc, err := startProcess(fake, "/tmp/config.xml", []string{"--", "--logger.level=trace"}, cgroupLimits{}, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("startProcess: %v", err)
+	}
+
+	<-proc.done
+
+	got, err := os.ReadFile(argv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "server\n--config-file=/tmp/config.xml\n--\n--logger.level=trace\n"
+	if string(got) != want {
+		t.Errorf("argv = %q, want %q", got, want)
+	}
+}
+
+func TestValidateExtraArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"--pidfile=/tmp/ch.pid"}, false},
+		{[]string{"--", "--config-file=x"}, false}, // an override, not a flag
+		{[]string{"--config-file=/etc/ch.xml"}, true},
+		{[]string{"--config-file", "/etc/ch.xml"}, true},
+		{[]string{"--config=/etc/ch.xml"}, true},
+		{[]string{"-C", "/etc/ch.xml"}, true},
+		{[]string{"-C/etc/ch.xml"}, true},
+	}
+
+	for _, tt := range tests {
+		err := validateExtraArgs(tt.args)
+		if got := errors.Is(err, ErrInvalidExtraArgs); got != tt.wantErr {
+			t.Errorf("validateExtraArgs(%q) = %v, wantErr %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+// startFakeServer starts a fake server script whose body runs after a ready marker is
+// written, and waits for the marker so signals are not delivered before traps are set.
+func startFakeServer(t *testing.T, body string) *process {
+	t.Helper()
+
+	return startFakeServerWithConfig(t, body, "ignored-config")
+}
+
+// startFakeServerWithConfig is startFakeServer launched with --config-file=configPath.
+func startFakeServerWithConfig(t *testing.T, body, configPath string) *process {
+	t.Helper()
+
+	marker := filepath.Join(t.TempDir(), "ready")
+	fake := writeFakeScript(t, body+"touch "+marker+"\nwhile :; do sleep 0.05; done\n")
+
+	proc, err := startProcess(fake, configPath, nil, cgroupLimits{}, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("startProcess: %v", err)
+	}
+
+	t.Cleanup(func() { stopProcess(proc, 0) }) //nolint:errcheck
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(marker); err == nil {
+			return proc
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("fake server did not become ready")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopProcess_Outcomes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "graceful", body: "", timeout: 5 * time.Second, wantErr: nil},
+		{name: "unclean exit on SIGTERM", body: "trap 'exit 7' TERM\n", timeout: 5 * time.Second, wantErr: ErrUncleanShutdown},
+		{name: "ignores SIGTERM", body: "trap '' TERM\n", timeout: 300 * time.Millisecond, wantErr: ErrStopTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			proc := startFakeServer(t, tt.body)
+
+			err := stopProcess(proc, tt.timeout)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("stopProcess = %v, want nil", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("stopProcess = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeELFHeader writes an executable holding only the ELF header of a 64-bit
+// little-endian Linux binary for machine, and returns its path.
+func writeELFHeader(t *testing.T, machine elf.Machine) string {
+	t.Helper()
+
+	hdr := elf.Header64{
+		Type:    uint16(elf.ET_EXEC),
+		Machine: uint16(machine),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  64,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "clickhouse")
+	if err := os.WriteFile(path, buf.Bytes(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestStartProcess_ForeignBinary(t *testing.T) {
+	t.Parallel()
+
+	// A binary of another architecture, which the kernel rejects.
+	machine, arch := elf.EM_S390, "s390x"
+	if runtime.GOARCH == arch {
+		machine, arch = elf.EM_X86_64, archAMD64
+	}
+
+	foreign := writeELFHeader(t, machine)
+
+	_, err := startProcess(foreign, "ignored-config", nil, cgroupLimits{}, io.Discard, nil)
+	if !errors.Is(err, ErrUnsupportedPlatform) || !errors.Is(err, syscall.ENOEXEC) {
+		t.Fatalf("startProcess = %v, want ErrUnsupportedPlatform wrapping ENOEXEC", err)
+	}
+
+	for _, platform := range []string{runtime.GOOS + "/" + runtime.GOARCH, "linux/" + arch} {
+		if !strings.Contains(err.Error(), platform) {
+			t.Errorf("startProcess = %v, want the platform %s in the message", err, platform)
+		}
+	}
+}
+
+func TestStartProcess_TruncatedBinary(t *testing.T) {
+	t.Parallel()
+
+	// A truncated ELF header names no platform: the binary is corrupt, not foreign.
+	truncated := filepath.Join(t.TempDir(), "clickhouse")
+	if err := os.WriteFile(truncated, []byte("\x7fELF\x02\x01"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := startProcess(truncated, "ignored-config", nil, cgroupLimits{}, io.Discard, nil)
+	if !errors.Is(err, syscall.ENOEXEC) || errors.Is(err, ErrUnsupportedPlatform) {
+		t.Fatalf("startProcess = %v, want ENOEXEC without ErrUnsupportedPlatform", err)
+	}
+}
+
+func TestCgroupLimitsValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		limits  cgroupLimits
+		wantErr bool
+	}{
+		{cgroupLimits{}, false},
+		{cgroupLimits{memBytes: 1 << 30}, false},
+		{cgroupLimits{cpus: 0.5}, false},
+		{cgroupLimits{memBytes: 512 << 20, cpus: 2}, false},
+		{cgroupLimits{memBytes: -1}, true},
+		{cgroupLimits{cpus: -1}, true},
+		{cgroupLimits{cpus: 0.001}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.limits.validate()
+		if got := errors.Is(err, ErrInvalidCgroupLimits); got != tt.wantErr {
+			t.Errorf("%+v.validate() = %v, wantErr %v", tt.limits, err, tt.wantErr)
+		}
+	}
+
+	if err := NewServer(DefaultConfig().Cgroup(-1, 0)).Start(); !errors.Is(err, ErrInvalidCgroupLimits) {
+		t.Errorf("Start with a negative limit = %v, want ErrInvalidCgroupLimits", err)
+	}
+}
+
+func TestStartProcess_Cgroup(t *testing.T) {
+	t.Parallel()
+
+	fake := writeFakeScript(t, "exec sleep 30\n")
+
+	proc, err := startProcess(fake, "ignored-config", nil, cgroupLimits{memBytes: 256 << 20, cpus: 0.5}, io.Discard, nil)
+	if errors.Is(err, ErrCgroupUnavailable) {
+		t.Skipf("cgroups unavailable here: %v", err)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	membership, err := os.ReadFile(filepath.Join("/proc", itoa(proc.cmd.Process.Pid), "cgroup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, path, ok := strings.Cut(strings.TrimSpace(string(membership)), "0::")
+	if !ok || !strings.Contains(path, "embedded-clickhouse-") {
+		t.Fatalf("process cgroup = %q, want an embedded-clickhouse-* cgroup", membership)
+	}
+
+	dir := filepath.Join("/sys/fs/cgroup", path)
+
+	for file, want := range map[string]string{"memory.max": "268435456", "cpu.max": "50000 100000"} {
+		if got, err := os.ReadFile(filepath.Join(dir, file)); err != nil || strings.TrimSpace(string(got)) != want {
+			t.Errorf("%s = %q (%v), want %q", file, got, err, want)
+		}
+	}
+
+	if err := stopProcess(proc, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cgroup %s left behind after stop: %v", dir, err)
+	}
+}
+
+func TestStopProcess_CrashedBeforeStop(t *testing.T) {
+	t.Parallel()
+
+	proc, err := startProcess(writeFakeBinary(t, 3), "ignored-config", nil, cgroupLimits{}, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("startProcess: %v", err)
+	}
+
+	<-proc.done
+
+	err = stopProcess(proc, time.Second)
+	if !errors.Is(err, ErrServerCrashed) {
+		t.Fatalf("stopProcess = %v, want ErrServerCrashed", err)
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("stopProcess = %v, want the exit status 3 to be wrapped", err)
+	}
+}
+
+func TestStopProcess_CleanExitBeforeStop(t *testing.T) {
+	t.Parallel()
+
+	proc, err := startProcess(writeFakeBinary(t, 0), "ignored-config", nil, cgroupLimits{}, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("startProcess: %v", err)
+	}
+
+	<-proc.done
+
+	if err := stopProcess(proc, time.Second); err != nil {
+		t.Errorf("stopProcess = %v, want nil for a clean exit", err)
+	}
+}
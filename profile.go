@@ -0,0 +1,136 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runtimeProfileFile is the config.d fragment SetProfileSetting writes into each node's
+// directory. Stop removes it, so runtime settings do not outlive the cluster run.
+const runtimeProfileFile = "embedded-clickhouse-profile.xml"
+
+// quorumProfileSettings returns the default-profile settings Config.QuorumInserts enables.
+// select_sequential_consistency does not work with parallel quorum inserts, so those are off.
+func quorumProfileSettings(timeout time.Duration) map[string]string {
+	settings := map[string]string{
+		"insert_quorum":                 "auto",
+		"insert_quorum_parallel":        "0",
+		"select_sequential_consistency": "1",
+	}
+
+	if timeout > 0 {
+		settings["insert_quorum_timeout"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+	}
+
+	return settings
+}
+
+// SetProfileSetting changes a setting of the default profile on every node while the
+// cluster runs, e.g. to turn insert_quorum or select_sequential_consistency on or off
+// between the steps of a replica-failure test. A SET statement would only last for its
+// HTTP request or connection; this writes the setting, with the ones set before it, to a
+// config.d fragment in each node's directory (users.d with a UsersConfig, which then
+// holds the profiles) and reloads the config, so every new query and session uses it
+// (open sessions keep the settings they started with). It overrides ProfileSettings and
+// lasts until Stop. The fragment is written to every node before any
+// is reloaded; a node that fails to reload is reported by index. Returns
+// ErrInvalidSettingKey for a malformed key, and ErrSharedInstance on a Shared cluster.
+func (c *Cluster) SetProfileSetting(ctx context.Context, key, value string) error {
+	if !validSettingKey.MatchString(key) {
+		return fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidSettingKey, key)
+	}
+
+	c.mu.Lock()
+
+	if !c.started {
+		c.mu.Unlock()
+		return ErrClusterNotStarted
+	}
+
+	if c.shared {
+		c.mu.Unlock()
+		return ErrSharedInstance
+	}
+
+	if c.runtimeProfile == nil {
+		c.runtimeProfile = make(map[string]string)
+	}
+
+	c.runtimeProfile[key] = value
+	nodes := c.nodes
+
+	profile, err := profileEntries(c.runtimeProfile)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	fragment := profileFragment(profile)
+
+	for i, node := range nodes {
+		dir := filepath.Join(node.tmpDir, runtimeProfileDir(c.config))
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			c.mu.Unlock()
+			return fmt.Errorf("embedded-clickhouse: node %d: create config.d: %w", i, err)
+		}
+
+		if err := writeConfigFragment(filepath.Join(dir, runtimeProfileFile), fragment); err != nil {
+			c.mu.Unlock()
+			return fmt.Errorf("embedded-clickhouse: node %d: %w", i, err)
+		}
+	}
+
+	c.mu.Unlock()
+
+	var errs []error
+
+	for i, node := range nodes {
+		if err := node.ReloadConfig(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("embedded-clickhouse: node %d: %w", i, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// runtimeProfileDir is the directory, relative to a node's, SetProfileSetting writes its
+// fragment into: config.d, or users.d when a UsersConfig holds the profiles instead.
+func runtimeProfileDir(cfg Config) string {
+	if cfg.usersConfig != nil {
+		return "users.d"
+	}
+
+	return "config.d"
+}
+
+// profileFragment renders settings, validated and sorted, as a config fragment extending
+// the default profile.
+func profileFragment(settings []settingEntry) []byte {
+	var b strings.Builder
+
+	b.WriteString("<clickhouse>\n    <profiles>\n        <default>\n")
+
+	for _, e := range settings {
+		fmt.Fprintf(&b, "            <%s>%s</%s>\n", e.Key, xmlEscapeString(e.Value), e.Key)
+	}
+
+	b.WriteString("        </default>\n    </profiles>\n</clickhouse>\n")
+
+	return []byte(b.String())
+}
+
+// removeRuntimeProfile deletes the fragment SetProfileSetting wrote into a node's dir, if any.
+func removeRuntimeProfile(dir string, cfg Config) error {
+	err := os.Remove(filepath.Join(dir, runtimeProfileDir(cfg), runtimeProfileFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("embedded-clickhouse: remove runtime profile: %w", err)
+	}
+
+	return nil
+}
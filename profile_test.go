@@ -0,0 +1,170 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCluster_SetProfileSetting(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		reloads int
+	)
+
+	port := fakeQueryServer(t, func(_ http.ResponseWriter, query string) {
+		if query == "SYSTEM RELOAD CONFIG" {
+			mu.Lock()
+			reloads++
+			mu.Unlock()
+		}
+	})
+
+	dirs := []string{t.TempDir(), t.TempDir()}
+	cl := &Cluster{
+		started: true,
+		nodes: []*EmbeddedClickHouse{
+			{started: true, httpPort: port, tmpDir: dirs[0]},
+			{started: true, httpPort: port, tmpDir: dirs[1]},
+		},
+	}
+
+	ctx := context.Background()
+
+	require.NoError(t, cl.SetProfileSetting(ctx, "insert_quorum", "2"))
+	require.NoError(t, cl.SetProfileSetting(ctx, "insert_quorum_timeout", "1000"))
+	assert.Equal(t, 4, reloads)
+
+	want := "<clickhouse>\n    <profiles>\n        <default>\n" +
+		"            <insert_quorum>2</insert_quorum>\n" +
+		"            <insert_quorum_timeout>1000</insert_quorum_timeout>\n" +
+		"        </default>\n    </profiles>\n</clickhouse>\n"
+
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "config.d", runtimeProfileFile))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+
+		require.NoError(t, removeRuntimeProfile(dir, cl.config))
+		require.NoError(t, removeRuntimeProfile(dir, cl.config), "removing a missing fragment is not an error")
+		assert.NoFileExists(t, filepath.Join(dir, "config.d", runtimeProfileFile))
+	}
+}
+
+func TestCluster_SetProfileSetting_UsersConfig(t *testing.T) {
+	t.Parallel()
+
+	port := fakeQueryServer(t, func(http.ResponseWriter, string) {})
+	dir := t.TempDir()
+	cl := &Cluster{
+		config:  DefaultConfig().UsersConfig([]byte("<clickhouse/>")),
+		started: true,
+		nodes:   []*EmbeddedClickHouse{{started: true, httpPort: port, tmpDir: dir}},
+	}
+
+	// Profiles live in the users config, so the setting goes to users.d instead of config.d.
+	require.NoError(t, cl.SetProfileSetting(context.Background(), "insert_quorum", "2"))
+	assert.FileExists(t, filepath.Join(dir, "users.d", runtimeProfileFile))
+	assert.NoDirExists(t, filepath.Join(dir, "config.d"))
+
+	require.NoError(t, removeRuntimeProfile(dir, cl.config))
+	assert.NoFileExists(t, filepath.Join(dir, "users.d", runtimeProfileFile))
+}
+
+func TestCluster_SetProfileSetting_ReportsNode(t *testing.T) {
+	t.Parallel()
+
+	failing := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Code: 36. DB::Exception: bad config")
+	})
+	ok := fakeQueryServer(t, func(http.ResponseWriter, string) {})
+
+	cl := &Cluster{
+		started: true,
+		nodes: []*EmbeddedClickHouse{
+			{started: true, httpPort: ok, tmpDir: t.TempDir()},
+			{started: true, httpPort: failing, tmpDir: t.TempDir()},
+		},
+	}
+
+	err := cl.SetProfileSetting(context.Background(), "insert_quorum", "2")
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "node 1:")
+	assert.NotContains(t, err.Error(), "node 0:")
+}
+
+func TestCluster_SetProfileSetting_Guards(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	require.ErrorIs(t, NewCluster(2).SetProfileSetting(ctx, "bad key", "1"), ErrInvalidSettingKey)
+	require.ErrorIs(t, NewCluster(2).SetProfileSetting(ctx, "insert_quorum", "2"), ErrClusterNotStarted)
+
+	shared := &Cluster{started: true, shared: true}
+	require.ErrorIs(t, shared.SetProfileSetting(ctx, "insert_quorum", "2"), ErrSharedInstance)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_ClusterQuorumInserts(t *testing.T) { //nolint:paralleltest // cluster tests run serially to avoid OOM on CI
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	cl := NewClusterForTest(t, 3, DefaultConfig().QuorumInserts(2*time.Second).Logger(io.Discard))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	db, err := cl.NodeDB(0)
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE test_quorum ON CLUSTER 'test_cluster' (
+			id UInt64
+		) ENGINE = ReplicatedMergeTree('/clickhouse/tables/{shard}/test_quorum', '{replica}')
+		ORDER BY id
+	`)
+	require.NoError(t, err)
+
+	// All replicas up: the majority acknowledges the insert.
+	_, err = db.ExecContext(ctx, "INSERT INTO test_quorum VALUES (1)")
+	require.NoError(t, err)
+
+	// Require every replica, then lose one: the insert can no longer reach the quorum.
+	require.NoError(t, cl.SetProfileSetting(ctx, "insert_quorum", "3"))
+
+	for _, node := range cl.Nodes() {
+		quorum, err := node.ScalarHTTP(ctx, "SELECT getSetting('insert_quorum')")
+		require.NoError(t, err)
+		assert.Equal(t, "3", quorum)
+	}
+
+	require.NoError(t, stopProcess(cl.Node(2).proc, 10*time.Second))
+
+	// The pool may hold connections opened before the reload, with the old settings.
+	fresh, err := sql.Open("clickhouse", cl.Node(0).DSN())
+	require.NoError(t, err)
+
+	defer fresh.Close()
+
+	_, err = fresh.ExecContext(ctx, "INSERT INTO test_quorum VALUES (2)")
+	require.ErrorContains(t, err, "quorum")
+
+	var count int
+	require.NoError(t, fresh.QueryRowContext(ctx, "SELECT count() FROM test_quorum").Scan(&count))
+	assert.Equal(t, 1, count, "sequentially consistent read should only see the quorum-written row")
+}
@@ -0,0 +1,291 @@
+package embeddedclickhouse
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrQueryFailed is returned when the ClickHouse HTTP interface answers a query with a non-200 status.
+// The wrapping error carries the status code and ClickHouse's error text.
+var ErrQueryFailed = errors.New("embedded-clickhouse: query failed")
+
+// ErrNotScalar is returned by ScalarHTTP and ScalarInt when the query does not return
+// exactly one row with one column.
+var ErrNotScalar = errors.New("embedded-clickhouse: query did not return a single value")
+
+// ErrQueryNotSatisfied is returned by WaitForQuery when the predicate does not accept the
+// query's value in time.
+var ErrQueryNotSatisfied = errors.New("embedded-clickhouse: query condition not met")
+
+const (
+	queryWaitPollInterval   = 200 * time.Millisecond
+	defaultQueryWaitTimeout = 60 * time.Second
+)
+
+// ExecHTTP runs query through the server's HTTP interface and returns the raw response
+// body. It needs no SQL driver, which makes it handy for one-off setup and teardown
+// statements such as CREATE DATABASE. On a non-200 response the returned error wraps
+// ErrQueryFailed and includes the error body sent by ClickHouse.
+func (e *EmbeddedClickHouse) ExecHTTP(ctx context.Context, query string) (string, error) {
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return "", err
+	}
+
+	return execHTTP(ctx, httpPort, query)
+}
+
+// ExecMulti runs a multi-statement SQL script (e.g. a schema or fixture file) over the
+// HTTP interface, one statement at a time. The script is split on top-level semicolons;
+// semicolons inside quoted strings and comments are ignored. Execution stops at the
+// first failing statement, and the error names its 0-based index and a prefix of its
+// text and wraps ErrQueryFailed with the server's exception.
+func (e *EmbeddedClickHouse) ExecMulti(ctx context.Context, script string) error {
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return err
+	}
+
+	for i, stmt := range splitSQLStatements(script) {
+		if _, err := execHTTP(ctx, httpPort, stmt); err != nil {
+			return fmt.Errorf("embedded-clickhouse: statement %d (%s): %w", i, statementPreview(stmt), err)
+		}
+	}
+
+	return nil
+}
+
+// ScalarHTTP runs query through the HTTP interface and returns its single value, for
+// assertions such as SELECT count() or gating on system tables without a SQL driver.
+// The query must return exactly one row with one column, otherwise the error wraps
+// ErrNotScalar; it must not carry a FORMAT clause. Escape sequences are decoded, and a
+// NULL is returned as ClickHouse's \N.
+func (e *EmbeddedClickHouse) ScalarHTTP(ctx context.Context, query string) (string, error) {
+	body, err := e.ExecHTTP(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return parseScalar(body)
+}
+
+// ScalarInt is ScalarHTTP for a value that parses as an int64, such as a count().
+func (e *EmbeddedClickHouse) ScalarInt(ctx context.Context, query string) (int64, error) {
+	value, err := e.ScalarHTTP(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("embedded-clickhouse: scalar %q is not an integer: %w", value, err)
+	}
+
+	return n, nil
+}
+
+// WaitForQuery polls query through ScalarHTTP until predicate accepts its value, for
+// data-dependent gates such as a dictionary finishing its load or a materialized view
+// catching up:
+//
+//	ch.WaitForQuery(ctx, "SELECT status FROM system.dictionaries WHERE name = 'geo'",
+//		func(v string) bool { return v == "LOADED" })
+//
+// Query errors, e.g. from a table that does not exist yet, and results that are not a
+// single value count as not ready. The wait is bounded by ctx, or by 60 seconds when ctx
+// has no deadline; on timeout the error wraps ErrQueryNotSatisfied and reports the last
+// value or error.
+func (e *EmbeddedClickHouse) WaitForQuery(ctx context.Context, query string, predicate func(string) bool) error {
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, defaultQueryWaitTimeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(queryWaitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var last string
+
+		body, err := execHTTP(ctx, httpPort, query)
+		if err == nil {
+			body, err = parseScalar(body)
+		}
+
+		switch {
+		case err != nil:
+			last = "last error: " + err.Error()
+		case predicate(body):
+			return nil
+		default:
+			last = fmt.Sprintf("last value %q", body)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s: %s: %w", ErrQueryNotSatisfied, statementPreview(query), last, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseScalar extracts the single value of a TabSeparated response.
+func parseScalar(body string) (string, error) {
+	rows := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if body == "" || len(rows) != 1 {
+		return "", fmt.Errorf("%w: got %d rows", ErrNotScalar, strings.Count(body, "\n"))
+	}
+
+	if cols := strings.Count(rows[0], "\t") + 1; cols != 1 {
+		return "", fmt.Errorf("%w: got %d columns", ErrNotScalar, cols)
+	}
+
+	return unescapeTSV(rows[0]), nil
+}
+
+// tsvEscapes maps the character after a backslash in TabSeparated output to the
+// character it stands for.
+//
+//nolint:gochecknoglobals // lookup table
+var tsvEscapes = map[byte]byte{
+	'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', '0': 0, '\'': '\'', '\\': '\\',
+}
+
+// unescapeTSV decodes the escape sequences of a TabSeparated value.
+func unescapeTSV(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			if c, ok := tsvEscapes[value[i+1]]; ok {
+				b.WriteByte(c)
+
+				i++
+
+				continue
+			}
+		}
+
+		b.WriteByte(value[i])
+	}
+
+	return b.String()
+}
+
+// statementPreviewLen caps how much of a failing statement ExecMulti quotes in its error.
+const statementPreviewLen = 60
+
+// statementPreview returns the statement on one line, truncated for error messages.
+func statementPreview(stmt string) string {
+	oneLine := []rune(strings.Join(strings.Fields(stmt), " "))
+	if len(oneLine) <= statementPreviewLen {
+		return string(oneLine)
+	}
+
+	return string(oneLine[:statementPreviewLen]) + "..."
+}
+
+// queryPort returns the HTTP port of a started server, or ErrServerNotStarted.
+func (e *EmbeddedClickHouse) queryPort() (uint32, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.started {
+		return 0, ErrServerNotStarted
+	}
+
+	return e.httpPort, nil
+}
+
+// execHTTP POSTs query to the HTTP interface on httpPort and returns the response body.
+func execHTTP(ctx context.Context, httpPort uint32, query string) (string, error) {
+	return execHTTPWithSettings(ctx, httpPort, query, nil)
+}
+
+// execHTTPWithSettings is execHTTP with per-query ClickHouse settings passed as URL parameters.
+func execHTTPWithSettings(ctx context.Context, httpPort uint32, query string, settings url.Values) (string, error) {
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/", httpPort)
+	if len(settings) > 0 {
+		endpoint += "?" + settings.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(query))
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: build query request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	// Asked for explicitly (rather than left to the transport) so a server with
+	// EnableHTTPCompression answers through its compressed path; the body is decoded in
+	// readQueryResponse. Servers without it ignore the header.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: send query: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readQueryResponse(resp)
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: read query response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: HTTP %d: %s", ErrQueryFailed, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return string(body), nil
+}
+
+// readQueryResponse reads the body of a query response, decoding gzip.
+func readQueryResponse(resp *http.Response) ([]byte, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return io.ReadAll(resp.Body) //nolint:wrapcheck // wrapped by execHTTPWithSettings
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by execHTTPWithSettings
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr) //nolint:wrapcheck // wrapped by execHTTPWithSettings
+}
+
+// FlushLogs issues SYSTEM FLUSH LOGS so that system log tables such as query_log
+// contain every entry buffered so far.
+func (e *EmbeddedClickHouse) FlushLogs(ctx context.Context) error {
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return err
+	}
+
+	return flushLogs(ctx, httpPort)
+}
+
+// flushLogs issues SYSTEM FLUSH LOGS tagged as an internal query, so QueryLog hides it.
+func flushLogs(ctx context.Context, httpPort uint32) error {
+	_, err := execHTTPWithSettings(ctx, httpPort, "SYSTEM FLUSH LOGS", internalQuerySettings())
+
+	return err
+}
@@ -0,0 +1,373 @@
+package embeddedclickhouse
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueryServer starts an httptest server that hands each POSTed query body to
+// handle and returns the HTTP port it listens on.
+func fakeQueryServer(t *testing.T, handle func(w http.ResponseWriter, query string)) uint32 {
+	t.Helper()
+
+	return fakeQueryServerWithURL(t, func(w http.ResponseWriter, _ url.Values, query string) {
+		handle(w, query)
+	})
+}
+
+// fakeQueryServerWithURL is fakeQueryServer that also passes the request's URL parameters
+// (per-query ClickHouse settings) to handle.
+func fakeQueryServerWithURL(t *testing.T, handle func(w http.ResponseWriter, params url.Values, query string)) uint32 {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		handle(w, r.URL.Query(), string(body))
+	}))
+	t.Cleanup(ts.Close)
+
+	return uint32(ts.Listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestExecHTTP_Success(t *testing.T) {
+	t.Parallel()
+
+	var got string
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		got = query
+
+		io.WriteString(w, "1\n")
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	body, err := s.ExecHTTP(context.Background(), "SELECT 1")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", body)
+	assert.Equal(t, "SELECT 1", got)
+}
+
+func TestExecHTTP_ErrorBody(t *testing.T) {
+	t.Parallel()
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Code: 62. DB::Exception: Syntax error\n")
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	body, err := s.ExecHTTP(context.Background(), "SELEC 1")
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Empty(t, body)
+	assert.Contains(t, err.Error(), "Syntax error", "error should carry the ClickHouse message")
+	assert.Contains(t, err.Error(), "HTTP 400")
+}
+
+func TestExecHTTP_GzipResponse(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			io.WriteString(w, "uncompressed\n")
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, "compressed\n")
+		zw.Close()
+	}))
+	t.Cleanup(ts.Close)
+
+	port := uint32(ts.Listener.Addr().(*net.TCPAddr).Port)
+
+	body, err := execHTTP(context.Background(), port, "SELECT 'compressed'")
+	require.NoError(t, err)
+	assert.Equal(t, "compressed\n", body)
+}
+
+func TestExecHTTP_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewServer().ExecHTTP(context.Background(), "SELECT 1")
+	require.ErrorIs(t, err, ErrServerNotStarted)
+}
+
+func TestExecMulti(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		got = append(got, query)
+
+		if strings.Contains(query, "bad") {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "Code: 60. DB::Exception: Unknown table bad")
+		}
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	require.NoError(t, s.ExecMulti(context.Background(), "CREATE TABLE a (x String) ENGINE = Memory;\nINSERT INTO a VALUES ('1;2');"))
+	assert.Equal(t, []string{"CREATE TABLE a (x String) ENGINE = Memory", "INSERT INTO a VALUES ('1;2')"}, got)
+
+	got = nil
+
+	err := s.ExecMulti(context.Background(), "SELECT 1;\nSELECT * FROM bad;\nSELECT 3;")
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "statement 1 (SELECT * FROM bad)")
+	assert.Contains(t, err.Error(), "Unknown table bad")
+	assert.Len(t, got, 2, "statements after the failure must not run")
+}
+
+func TestExecMulti_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	require.ErrorIs(t, NewServer().ExecMulti(context.Background(), "SELECT 1"), ErrServerNotStarted)
+}
+
+func TestStatementPreview(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "SELECT 1 FROM t", statementPreview("SELECT 1\n  FROM t"))
+
+	long := strings.Repeat("é", statementPreviewLen+10)
+	assert.Equal(t, strings.Repeat("é", statementPreviewLen)+"...", statementPreview(long))
+}
+
+func TestFlushLogs(t *testing.T) {
+	t.Parallel()
+
+	var got string
+
+	port := fakeQueryServer(t, func(_ http.ResponseWriter, query string) {
+		got = query
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	require.NoError(t, s.FlushLogs(context.Background()))
+	assert.Equal(t, "SYSTEM FLUSH LOGS", got)
+}
+
+func TestParseScalar(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"value", "42\n", "42", false},
+		{"no trailing newline", "42", "42", false},
+		{"escapes", `a\tb\nc\\d\'e` + "\n", "a\tb\nc\\d'e", false},
+		{"null", `\N` + "\n", `\N`, false},
+		{"empty string value", "\n", "", false},
+		{"no rows", "", "", true},
+		{"two rows", "1\n2\n", "", true},
+		{"two columns", "1\t2\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseScalar(tt.body)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrNotScalar)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScalarInt(t *testing.T) {
+	t.Parallel()
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		if strings.Contains(query, "count()") {
+			io.WriteString(w, "3\n")
+		} else {
+			io.WriteString(w, "abc\n")
+		}
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	n, err := s.ScalarInt(context.Background(), "SELECT count() FROM t")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	_, err = s.ScalarInt(context.Background(), "SELECT name FROM t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not an integer")
+}
+
+func TestWaitForQuery(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	// The first poll fails as for a missing table, the second is not ready yet.
+	port := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "Code: 60. DB::Exception: Unknown table")
+		case 2:
+			io.WriteString(w, "LOADING\n")
+		default:
+			io.WriteString(w, "LOADED\n")
+		}
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.WaitForQuery(ctx, "SELECT status FROM system.dictionaries", func(v string) bool { return v == "LOADED" })
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWaitForQuery_Timeout(t *testing.T) {
+	t.Parallel()
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		io.WriteString(w, "0\n")
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	err := s.WaitForQuery(ctx, "SELECT count() FROM mv", func(v string) bool { return v != "0" })
+	require.ErrorIs(t, err, ErrQueryNotSatisfied)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), `last value "0"`)
+}
+
+func TestWaitForQuery_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	err := NewServer().WaitForQuery(context.Background(), "SELECT 1", func(string) bool { return true })
+	require.ErrorIs(t, err, ErrServerNotStarted)
+}
+
+func TestScalarHTTP_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewServer().ScalarHTTP(context.Background(), "SELECT 1")
+	require.ErrorIs(t, err, ErrServerNotStarted)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_ExecHTTP(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	ctx := context.Background()
+
+	_, err := s.ExecHTTP(ctx, "CREATE DATABASE fixtures")
+	require.NoError(t, err)
+
+	body, err := s.ExecHTTP(ctx, "SELECT count() FROM system.databases WHERE name = 'fixtures'")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", body)
+
+	_, err = s.ExecHTTP(ctx, "SELECT * FROM no_such_table")
+	require.ErrorIs(t, err, ErrQueryFailed)
+
+	n, err := s.ScalarInt(ctx, "SELECT count() FROM system.databases WHERE name = 'fixtures'")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	value, err := s.ScalarHTTP(ctx, "SELECT value FROM system.settings WHERE name = 'max_threads'")
+	require.NoError(t, err)
+	assert.NotEmpty(t, value)
+}
+
+func TestIntegration_HTTPCompression(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).EnableHTTPCompression(true).Logger(io.Discard))
+
+	ctx := context.Background()
+
+	n, err := s.ScalarInt(ctx, "SELECT count() FROM numbers(100000)")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100000), n)
+
+	// The server must honor the other encodings clients negotiate, too.
+	for _, encoding := range []string{"zstd", "lz4"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.HTTPURL()+"/", strings.NewReader("SELECT 1"))
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", encoding)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, encoding, resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestIntegration_QueryLogFlush(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).EnableQueryLog(true).Logger(io.Discard))
+
+	ctx := context.Background()
+
+	_, err := s.ExecHTTP(ctx, "SELECT 'query-log-marker'")
+	require.NoError(t, err)
+
+	require.NoError(t, s.FlushLogs(ctx))
+
+	body, err := s.ExecHTTP(ctx, "SELECT count() FROM system.query_log "+
+		"WHERE type = 'QueryFinish' AND query = 'SELECT \\'query-log-marker\\''")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", body)
+}
@@ -0,0 +1,81 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// internalLogComment tags queries issued by this package (flushes, QueryLog itself) so
+// they can be told apart from the queries made by the code under test.
+const internalLogComment = "embedded-clickhouse-internal"
+
+// queryLogQuery reads the query log in execution order, skipping internal queries.
+const queryLogQuery = `SELECT query, type, query_duration_ms, exception
+FROM system.query_log
+WHERE log_comment != '` + internalLogComment + `'
+ORDER BY event_time_microseconds, type
+FORMAT JSONEachRow`
+
+// QueryLogEntry is one row of system.query_log.
+type QueryLogEntry struct {
+	// Query is the query text as received by the server.
+	Query string `json:"query"`
+	// Type is the event type: QueryStart, QueryFinish, ExceptionBeforeStart or
+	// ExceptionWhileProcessing.
+	Type string `json:"type"`
+	// QueryDurationMS is the execution time in milliseconds.
+	QueryDurationMS uint64 `json:"query_duration_ms"` //nolint:tagliatelle // ClickHouse column name
+	// Exception is the error message for failed queries, empty otherwise.
+	Exception string `json:"exception"`
+}
+
+// internalQuerySettings returns the per-query settings that mark a query as internal.
+func internalQuerySettings() url.Values {
+	return url.Values{"log_comment": {internalLogComment}}
+}
+
+// QueryLog flushes the server's logs and returns every entry of system.query_log in
+// execution order, so a test can assert on the exact SQL its code issued. Queries made
+// by this package (FlushLogs, QueryLog) are excluded. Requires EnableQueryLog(true);
+// otherwise the table does not exist and the returned error wraps ErrQueryFailed.
+func (e *EmbeddedClickHouse) QueryLog(ctx context.Context) ([]QueryLogEntry, error) {
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flushLogs(ctx, httpPort); err != nil {
+		return nil, err
+	}
+
+	settings := internalQuerySettings()
+	settings.Set("output_format_json_quote_64bit_integers", "0")
+
+	body, err := execHTTPWithSettings(ctx, httpPort, queryLogQuery, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseQueryLog(body)
+}
+
+// parseQueryLog decodes JSONEachRow output into QueryLogEntry values.
+func parseQueryLog(body string) ([]QueryLogEntry, error) {
+	var entries []QueryLogEntry
+
+	dec := json.NewDecoder(strings.NewReader(body))
+
+	for dec.More() {
+		var entry QueryLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("embedded-clickhouse: decode query_log row: %w", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
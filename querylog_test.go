@@ -0,0 +1,134 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueryLog(t *testing.T) {
+	t.Parallel()
+
+	body := `{"query":"SELECT 1","type":"QueryStart","query_duration_ms":0,"exception":""}
+{"query":"SELECT 1","type":"QueryFinish","query_duration_ms":3,"exception":""}
+{"query":"SELEC 1","type":"ExceptionBeforeStart","query_duration_ms":0,"exception":"Code: 62. Syntax error"}
+`
+
+	entries, err := parseQueryLog(body)
+	require.NoError(t, err)
+	assert.Equal(t, []QueryLogEntry{
+		{Query: "SELECT 1", Type: "QueryStart"},
+		{Query: "SELECT 1", Type: "QueryFinish", QueryDurationMS: 3},
+		{Query: "SELEC 1", Type: "ExceptionBeforeStart", Exception: "Code: 62. Syntax error"},
+	}, entries)
+}
+
+func TestParseQueryLog_Empty(t *testing.T) {
+	t.Parallel()
+
+	entries, err := parseQueryLog("")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestParseQueryLog_Malformed(t *testing.T) {
+	t.Parallel()
+
+	_, err := parseQueryLog(`{"query":`)
+	require.Error(t, err)
+}
+
+func TestQueryLog_FlushesThenReads(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu       sync.Mutex
+		queries  []string
+		comments []string
+	)
+
+	ts := fakeQueryServerWithURL(t, func(w http.ResponseWriter, params url.Values, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queries = append(queries, query)
+		comments = append(comments, params.Get("log_comment"))
+
+		if strings.HasPrefix(query, "SELECT") {
+			io.WriteString(w, `{"query":"INSERT INTO t VALUES","type":"QueryFinish","query_duration_ms":1,"exception":""}`+"\n")
+		}
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: ts}
+
+	entries, err := s.QueryLog(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "INSERT INTO t VALUES", entries[0].Query)
+
+	require.Len(t, queries, 2)
+	assert.Equal(t, "SYSTEM FLUSH LOGS", queries[0])
+	assert.Contains(t, queries[1], "FROM system.query_log")
+	assert.Equal(t, []string{internalLogComment, internalLogComment}, comments,
+		"internal queries must be tagged so QueryLog can hide them")
+}
+
+func TestQueryLog_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewServer().QueryLog(context.Background())
+	require.ErrorIs(t, err, ErrServerNotStarted)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_QueryLog(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).EnableQueryLog(true).Logger(io.Discard))
+
+	ctx := context.Background()
+
+	for _, q := range []string{
+		"CREATE TABLE logged (id UInt64) ENGINE = MergeTree ORDER BY id",
+		"INSERT INTO logged VALUES (1)",
+	} {
+		_, err := s.ExecHTTP(ctx, q)
+		require.NoError(t, err)
+	}
+
+	_, err := s.ExecHTTP(ctx, "SELECT * FROM missing_table")
+	require.ErrorIs(t, err, ErrQueryFailed)
+
+	entries, err := s.QueryLog(ctx)
+	require.NoError(t, err)
+
+	var finished, failed []string
+
+	for _, e := range entries {
+		switch e.Type {
+		case "QueryFinish":
+			finished = append(finished, e.Query)
+		case "ExceptionBeforeStart", "ExceptionWhileProcessing":
+			failed = append(failed, e.Query)
+			assert.NotEmpty(t, e.Exception)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"CREATE TABLE logged (id UInt64) ENGINE = MergeTree ORDER BY id",
+		"INSERT INTO logged VALUES (1)",
+	}, finished)
+	assert.Equal(t, []string{"SELECT * FROM missing_table"}, failed)
+}
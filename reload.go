@@ -0,0 +1,47 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"time"
+)
+
+// reloadConfigWait bounds how long ReloadConfig waits for the server to answer /ping
+// again after the reload.
+const reloadConfigWait = 5 * time.Second
+
+// ConfigPath returns the path of the config.xml Start generated for the server. ClickHouse
+// also merges every *.xml file in a config.d directory next to it, so tests can drop
+// fragments there and apply them with ReloadConfig. It is empty while not started and
+// for handles attached to a Shared instance.
+func (e *EmbeddedClickHouse) ConfigPath() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.started || e.tmpDir == "" {
+		return ""
+	}
+
+	return configPathIn(e.tmpDir)
+}
+
+// ReloadConfig issues SYSTEM RELOAD CONFIG, so edits to the server's config files (see
+// ConfigPath) take effect without a restart, then waits briefly for the server to answer
+// /ping. Only hot-reloadable parts apply: users, profiles and quotas, remote_servers,
+// dictionaries, the logger level, and the server settings marked changeable_without_restart
+// in system.server_settings (max_server_memory_usage, max_concurrent_queries, cache
+// sizes, ...). Ports, paths and the other server settings need Stop and Start.
+func (e *EmbeddedClickHouse) ReloadConfig(ctx context.Context) error {
+	httpPort, err := e.queryPort()
+	if err != nil {
+		return err
+	}
+
+	if _, err := execHTTPWithSettings(ctx, httpPort, "SYSTEM RELOAD CONFIG", internalQuerySettings()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reloadConfigWait)
+	defer cancel()
+
+	return waitForReady(ctx, httpPort, e.config)
+}
@@ -0,0 +1,77 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadConfig(t *testing.T) {
+	t.Parallel()
+
+	var queries []string
+
+	port := fakeQueryServer(t, func(_ http.ResponseWriter, query string) {
+		if query != "" { // the /ping after the reload has no body
+			queries = append(queries, query)
+		}
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	require.NoError(t, s.ReloadConfig(context.Background()))
+	assert.Equal(t, []string{"SYSTEM RELOAD CONFIG"}, queries)
+}
+
+func TestReloadConfig_Failure(t *testing.T) {
+	t.Parallel()
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Code: 36. DB::Exception: bad config")
+	})
+
+	s := &EmbeddedClickHouse{started: true, httpPort: port}
+
+	err := s.ReloadConfig(context.Background())
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "bad config")
+}
+
+func TestReloadConfig_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	assert.ErrorIs(t, NewServer().ReloadConfig(context.Background()), ErrServerNotStarted)
+	assert.Empty(t, NewServer().ConfigPath())
+}
+
+func TestIntegration_ReloadConfig(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+	ctx := context.Background()
+
+	configPath := s.ConfigPath()
+	require.FileExists(t, configPath)
+
+	overlay := filepath.Join(filepath.Dir(configPath), "config.d")
+	require.NoError(t, os.MkdirAll(overlay, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(overlay, "limits.xml"),
+		[]byte("<clickhouse><max_concurrent_queries>77</max_concurrent_queries></clickhouse>"), 0o600))
+
+	require.NoError(t, s.ReloadConfig(ctx))
+
+	v, err := s.ScalarHTTP(ctx, "SELECT value FROM system.server_settings WHERE name = 'max_concurrent_queries'")
+	require.NoError(t, err)
+	assert.Equal(t, "77", v)
+}
@@ -0,0 +1,106 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	replicaPollInterval       = 200 * time.Millisecond
+	defaultReplicaWaitTimeout = 60 * time.Second
+)
+
+// ErrReplicasNotReady is returned by WaitForReplicas when the table does not reach the
+// requested number of active replicas in time.
+var ErrReplicasNotReady = errors.New("embedded-clickhouse: replicas not ready")
+
+// activeReplicasQuery reads a table's active replica count; the database defaults to the
+// current one when param_db is empty.
+const activeReplicasQuery = `SELECT active_replicas FROM system.replicas
+WHERE database = if({db:String} = '', currentDatabase(), {db:String}) AND table = {table:String}
+FORMAT TabSeparated`
+
+// WaitForReplicas polls system.replicas on every node until each of them reports at
+// least n active replicas for table ("table" in the default database, or "db.table").
+// It replaces sleeps between an insert on one node and a read on another. The wait is
+// bounded by ctx, or by 60 seconds when ctx has no deadline; on timeout the error wraps
+// ErrReplicasNotReady and names the first node that fell short and its last count.
+func (c *Cluster) WaitForReplicas(ctx context.Context, table string, n int) error {
+	c.mu.RLock()
+
+	if !c.started {
+		c.mu.RUnlock()
+		return ErrClusterNotStarted
+	}
+
+	ports := make([]uint32, len(c.nodes))
+	for i, node := range c.nodes {
+		ports[i] = node.httpPort
+	}
+
+	c.mu.RUnlock()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, defaultReplicaWaitTimeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(replicaPollInterval)
+	defer ticker.Stop()
+
+	for {
+		status := replicasStatus(ctx, ports, table, n)
+		if status == "" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s: %s: %w", ErrReplicasNotReady, table, status, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicasStatus returns "" once every node reports at least n active replicas for
+// table, or else a description of the first node that does not.
+func replicasStatus(ctx context.Context, ports []uint32, table string, n int) string {
+	settings := internalQuerySettings()
+
+	db, name, ok := strings.Cut(table, ".")
+	if !ok {
+		db, name = "", table
+	}
+
+	settings.Set("param_db", db)
+	settings.Set("param_table", name)
+
+	for i, port := range ports {
+		body, err := execHTTPWithSettings(ctx, port, activeReplicasQuery, settings)
+		if err != nil {
+			return fmt.Sprintf("node %d: %v", i, err)
+		}
+
+		body = strings.TrimSpace(body)
+		if body == "" {
+			return fmt.Sprintf("node %d: table not found in system.replicas", i)
+		}
+
+		active, err := strconv.Atoi(body)
+		if err != nil {
+			return fmt.Sprintf("node %d: unexpected active_replicas %q", i, body)
+		}
+
+		if active < n {
+			return fmt.Sprintf("node %d has %d/%d active replicas", i, active, n)
+		}
+	}
+
+	return ""
+}
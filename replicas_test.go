@@ -0,0 +1,65 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCluster_WaitForReplicasNotStarted(t *testing.T) {
+	t.Parallel()
+
+	err := NewCluster(2).WaitForReplicas(context.Background(), "events", 2)
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
+
+func TestCluster_WaitForReplicas(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+
+	port := fakeQueryServerWithURL(t, func(w http.ResponseWriter, params url.Values, _ string) {
+		assert.Equal(t, "db", params.Get("param_db"))
+		assert.Equal(t, "events", params.Get("param_table"))
+
+		// One replica on the first poll, both afterwards.
+		if polls.Add(1) == 1 {
+			io.WriteString(w, "1\n")
+			return
+		}
+
+		io.WriteString(w, "2\n")
+	})
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{httpPort: port}}}
+
+	require.NoError(t, cl.WaitForReplicas(context.Background(), "db.events", 2))
+	assert.Equal(t, int32(2), polls.Load())
+}
+
+func TestCluster_WaitForReplicasTimeout(t *testing.T) {
+	t.Parallel()
+
+	ready := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		io.WriteString(w, "2\n")
+	})
+	missing := fakeQueryServerWithURL(t, func(w http.ResponseWriter, params url.Values, _ string) {
+		assert.Empty(t, params.Get("param_db"))
+	})
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{httpPort: ready}, {httpPort: missing}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	err := cl.WaitForReplicas(ctx, "events", 2)
+	require.ErrorIs(t, err, ErrReplicasNotReady)
+	assert.Contains(t, err.Error(), "node 1: table not found")
+}
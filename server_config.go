@@ -2,12 +2,17 @@ package embeddedclickhouse
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 	"text/template"
 )
 
@@ -17,14 +22,38 @@ const configTemplate = `<?xml version="1.0"?>
         <level>warning</level>
         <console>1</console>
     </logger>
+{{- if not .Telemetry}}
+    <send_crash_reports>
+        <enabled>false</enabled>
+    </send_crash_reports>
+{{- end}}
 
     <tcp_port>{{.TCPPort}}</tcp_port>
     <http_port>{{.HTTPPort}}</http_port>
+{{- if .GRPCPort}}
+    <grpc_port>{{.GRPCPort}}</grpc_port>
+    <grpc>
+        <enable_ssl>false</enable_ssl>
+        <transport_compression_type>none</transport_compression_type>
+        <verbose_logs>false</verbose_logs>
+    </grpc>
+{{- end}}
 
     <path>{{xmlEscape .DataDir}}/</path>
     <tmp_path>{{xmlEscape .TmpDir}}/</tmp_path>
     <user_files_path>{{xmlEscape .UserFilesDir}}/</user_files_path>
     <format_schema_path>{{xmlEscape .FormatSchemaDir}}/</format_schema_path>
+    <user_scripts_path>{{xmlEscape .UserScriptsDir}}/</user_scripts_path>
+{{- if .UDFConfigPath}}
+    <user_defined_executable_functions_config>{{xmlEscape .UDFConfigPath}}</user_defined_executable_functions_config>
+{{- end}}
+{{- if .DictionariesConfigPath}}
+    <dictionaries_config>{{xmlEscape .DictionariesConfigPath}}</dictionaries_config>
+{{- end}}
+{{- if .UsersConfigPath}}
+
+    <users_config>{{xmlEscape .UsersConfigPath}}</users_config>
+{{- else}}
 
     <users>
         <default>
@@ -35,25 +64,50 @@ const configTemplate = `<?xml version="1.0"?>
             </networks>
             <profile>default</profile>
             <quota>default</quota>
-            <access_management>1</access_management>
+            <access_management>{{if .AccessManagement}}1{{else}}0{{end}}</access_management>
         </default>
     </users>
 
     <profiles>
-        <default/>
+        <default>
+{{- range .Profile}}
+            <{{.Key}}>{{xmlEscape .Value}}</{{.Key}}>
+{{- end}}
+        </default>
     </profiles>
 
     <quotas>
         <default/>
     </quotas>
+{{- end}}
+{{- if .QueryLog}}
+
+    <query_log>
+        <database>system</database>
+        <table>query_log</table>
+        <flush_interval_milliseconds>{{.QueryLogFlushMS}}</flush_interval_milliseconds>
+    </query_log>
+{{- end}}
+{{- if .Macros}}
+
+    <macros>
+{{- range .Macros}}
+        <{{.Key}}>{{xmlEscape .Value}}</{{.Key}}>
+{{- end}}
+    </macros>
+{{- end}}
 {{range $key, $value := .Settings}}
     <{{$key}}>{{xmlEscape $value}}</{{$key}}>
 {{end}}
 </clickhouse>
 `
 
+// queryLogFlushIntervalMS is the query_log flush interval used by EnableQueryLog. It is
+// short so rows appear within a fraction of a second; FlushLogs forces them immediately.
+const queryLogFlushIntervalMS = 100
+
 // defaultServerSettings returns settings baked into every generated config.
-// User-supplied Settings override these values; any key not overridden
+// User-supplied ServerSettings override these values; any key not overridden
 // keeps its default.
 func defaultServerSettings() map[string]string {
 	return map[string]string{}
@@ -70,9 +124,340 @@ func mergeSettings(user map[string]string) map[string]string {
 	return merged
 }
 
+// maxServerMemoryUsageKey is the server setting that caps the memory of a whole server.
+const maxServerMemoryUsageKey = "max_server_memory_usage"
+
+// lowMemorySettings returns the server settings applied by LowMemory: a 1 GiB memory
+// cap, small mark and uncompressed caches, and few background threads. The mutation and
+// merge checks of MergeTree require background_pool_size *
+// background_merges_mutations_concurrency_ratio to reach their free-entry thresholds
+// (up to 25 by default), so the ratio is raised to keep tables creatable with two
+// merge threads.
+func lowMemorySettings() map[string]string {
+	return map[string]string{
+		maxServerMemoryUsageKey:                         "1073741824", // 1 GiB
+		"mark_cache_size":                               "67108864",   // 64 MiB
+		"uncompressed_cache_size":                       "67108864",   // 64 MiB
+		"background_pool_size":                          "2",
+		"background_merges_mutations_concurrency_ratio": "16",
+		"background_common_pool_size":                   "2",
+		"background_fetches_pool_size":                  "2",
+		"background_move_pool_size":                     "1",
+		"background_schedule_pool_size":                 "16",
+		"background_buffer_flush_schedule_pool_size":    "1",
+		"background_distributed_schedule_pool_size":     "2",
+		"background_message_broker_schedule_pool_size":  "1",
+	}
+}
+
+// serverSettingsFor returns the settings written to cfg's config: the defaults, then the
+// LowMemory preset if enabled, then the user's ServerSettings, each overriding the previous.
+func serverSettingsFor(cfg Config) map[string]string {
+	if !cfg.lowMemory {
+		return mergeSettings(cfg.settings)
+	}
+
+	settings := lowMemorySettings()
+	maps.Copy(settings, cfg.settings)
+
+	return mergeSettings(settings)
+}
+
 // validSettingKey matches safe XML element names for ClickHouse settings.
 var validSettingKey = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
 
+// macroEntries validates macro names and returns the macros sorted by name, so the
+// generated <macros> block is deterministic.
+func macroEntries(macros map[string]string) ([]settingEntry, error) {
+	entries := make([]settingEntry, 0, len(macros))
+
+	for _, k := range slices.Sorted(maps.Keys(macros)) {
+		if !validSettingKey.MatchString(k) {
+			return nil, fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidMacroKey, k)
+		}
+
+		entries = append(entries, settingEntry{Key: k, Value: macros[k]})
+	}
+
+	return entries, nil
+}
+
+// profileSettingsFor returns the settings written to the default profile of cfg's config:
+// those implied by its options (database engine, query log, HTTP compression, quorum
+// inserts, Ephemeral), then the user's ProfileSettings, overriding them.
+func profileSettingsFor(cfg Config) map[string]string {
+	profile := map[string]string{"allow_experimental_database_replicated": "1"}
+
+	if cfg.defaultDatabaseEngine != "" {
+		profile["default_database_engine"] = cfg.defaultDatabaseEngine
+	}
+
+	if cfg.defaultDatabaseEngine == "Ordinary" {
+		profile["allow_deprecated_database_ordinary"] = "1"
+	}
+
+	if cfg.queryLog {
+		profile["log_queries"] = "1"
+	}
+
+	if cfg.httpCompression {
+		profile["enable_http_compression"] = "1"
+	}
+
+	if cfg.quorumInserts {
+		maps.Copy(profile, quorumProfileSettings(cfg.quorumInsertTimeout))
+	}
+
+	if cfg.ephemeral {
+		profile["fsync_metadata"] = "0"
+	}
+
+	maps.Copy(profile, cfg.profile)
+
+	return profile
+}
+
+// profileEntries validates profile setting names and returns the settings sorted by name.
+func profileEntries(profile map[string]string) ([]settingEntry, error) {
+	entries := make([]settingEntry, 0, len(profile))
+
+	for _, k := range slices.Sorted(maps.Keys(profile)) {
+		if !validSettingKey.MatchString(k) {
+			return nil, fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidSettingKey, k)
+		}
+
+		entries = append(entries, settingEntry{Key: k, Value: profile[k]})
+	}
+
+	return entries, nil
+}
+
+// configFileName is the name of the generated server config in a server's directory.
+const configFileName = "config.xml"
+
+// configPathIn returns the path of the generated server config in the server directory dir.
+func configPathIn(dir string) string {
+	return filepath.Join(dir, configFileName)
+}
+
+// Names of the optional config fragments written next to the generated server config.
+const (
+	udfConfigFile          = "udf_function.xml"
+	dictionariesConfigFile = "dictionaries.xml"
+	usersConfigFile        = "users.xml"
+	// usersProfileFile carries the generated default-profile settings into users.d
+	// when a UsersConfig replaces the inline users, profiles and quotas.
+	usersProfileFile = "embedded-clickhouse-defaults.xml"
+)
+
+// auxFiles are the optional directories and config fragments shared by the single-node
+// and cluster config generators.
+type auxFiles struct {
+	UserFilesPath   string
+	UserScriptsPath string
+	UDFConfig       []byte
+	Dictionaries    []byte
+	UsersConfig     []byte
+	FormatSchemas   map[string][]byte
+}
+
+// auxFilesFor extracts the auxFiles options from cfg.
+func auxFilesFor(cfg Config) auxFiles {
+	return auxFiles{
+		UserFilesPath:   cfg.userFilesPath,
+		UserScriptsPath: cfg.userScriptsPath,
+		UDFConfig:       cfg.udfConfig,
+		Dictionaries:    cfg.dictionaries,
+		UsersConfig:     cfg.usersConfig,
+		FormatSchemas:   cfg.formatSchemas,
+	}
+}
+
+// auxPaths are the resolved locations referenced from the generated config. The config
+// paths are empty when the matching fragment is not configured.
+type auxPaths struct {
+	UserFilesDir           string
+	UserScriptsDir         string
+	UDFConfigPath          string
+	DictionariesConfigPath string
+	UsersConfigPath        string
+}
+
+// planAuxPaths resolves where the auxiliary files live for a config rooted at dir: the
+// configured user files and user scripts directories, or ones under dir, and dir/<name>
+// for each configured fragment.
+func planAuxPaths(dir string, aux auxFiles) auxPaths {
+	paths := auxPaths{
+		UserFilesDir:           cmp.Or(aux.UserFilesPath, filepath.Join(dir, "user_files")),
+		UserScriptsDir:         cmp.Or(aux.UserScriptsPath, filepath.Join(dir, "user_scripts")),
+		UDFConfigPath:          "",
+		DictionariesConfigPath: "",
+		UsersConfigPath:        "",
+	}
+
+	if aux.UDFConfig != nil {
+		paths.UDFConfigPath = filepath.Join(dir, udfConfigFile)
+	}
+
+	if aux.Dictionaries != nil {
+		paths.DictionariesConfigPath = filepath.Join(dir, dictionariesConfigFile)
+	}
+
+	if aux.UsersConfig != nil {
+		paths.UsersConfigPath = filepath.Join(dir, usersConfigFile)
+	}
+
+	return paths
+}
+
+// writeAuxFiles creates the user files and user scripts directories under dir (unless
+// configured elsewhere), writes the configured fragments into dir and seeds
+// dir/format_schemas with the FormatSchemas files.
+func writeAuxFiles(dir string, aux auxFiles) (auxPaths, error) {
+	paths := planAuxPaths(dir, aux)
+
+	if aux.UserFilesPath == "" {
+		if err := makeDirs(paths.UserFilesDir); err != nil {
+			return auxPaths{}, err
+		}
+	}
+
+	if aux.UserScriptsPath == "" {
+		if err := makeDirs(paths.UserScriptsDir); err != nil {
+			return auxPaths{}, err
+		}
+	}
+
+	if err := writeConfigFragment(paths.UDFConfigPath, aux.UDFConfig); err != nil {
+		return auxPaths{}, err
+	}
+
+	if err := writeConfigFragment(paths.DictionariesConfigPath, aux.Dictionaries); err != nil {
+		return auxPaths{}, err
+	}
+
+	if err := writeConfigFragment(paths.UsersConfigPath, aux.UsersConfig); err != nil {
+		return auxPaths{}, err
+	}
+
+	if err := writeFormatSchemas(filepath.Join(dir, "format_schemas"), aux.FormatSchemas); err != nil {
+		return auxPaths{}, err
+	}
+
+	return paths, nil
+}
+
+// writeUsersProfile writes profile as a users.d fragment next to usersConfigPath, so the
+// generated default-profile settings still apply with a UsersConfig, which makes the
+// server ignore the inline profiles. It does nothing when usersConfigPath is "".
+func writeUsersProfile(usersConfigPath string, profile []settingEntry) error {
+	if usersConfigPath == "" {
+		return nil
+	}
+
+	dir := filepath.Join(filepath.Dir(usersConfigPath), "users.d")
+	if err := makeDirs(dir); err != nil {
+		return err
+	}
+
+	return writeConfigFragment(filepath.Join(dir, usersProfileFile), profileFragment(profile))
+}
+
+// validateUsersConfig checks that a UsersConfig is a well-formed XML document, so a typo
+// fails Start with ErrInvalidUsersConfig instead of a server that exits on startup. Nil
+// (not configured) is valid.
+func validateUsersConfig(definition []byte) error {
+	if definition == nil {
+		return nil
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(definition))
+	root := false
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidUsersConfig, err)
+		}
+
+		if _, ok := tok.(xml.StartElement); ok {
+			root = true
+		}
+	}
+
+	if !root {
+		return fmt.Errorf("%w: no root element", ErrInvalidUsersConfig)
+	}
+
+	return nil
+}
+
+// writeFormatSchemas writes each of files to its name under dir, creating subdirectories.
+// A name that is not a local path (absolute, empty or escaping dir) is rejected with
+// ErrInvalidFormatSchemaName before anything is written.
+func writeFormatSchemas(dir string, files map[string][]byte) error {
+	for name := range files {
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidFormatSchemaName, name)
+		}
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := makeDirs(filepath.Dir(path)); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			return fmt.Errorf("embedded-clickhouse: write format schema %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// cloneFiles returns a deep copy of files, nil for nil.
+func cloneFiles(files map[string][]byte) map[string][]byte {
+	if files == nil {
+		return nil
+	}
+
+	clone := make(map[string][]byte, len(files))
+	for name, content := range files {
+		clone[name] = slices.Clone(content)
+	}
+
+	return clone
+}
+
+// makeDirs creates each of dirs, with parents.
+func makeDirs(dirs ...string) error {
+	for _, d := range dirs {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return fmt.Errorf("embedded-clickhouse: create dir %s: %w", d, err)
+		}
+	}
+
+	return nil
+}
+
+// writeConfigFragment writes content to path, or does nothing when path is "".
+func writeConfigFragment(path string, content []byte) error {
+	if path == "" {
+		return nil
+	}
+
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return fmt.Errorf("embedded-clickhouse: write %s: %w", filepath.Base(path), err)
+	}
+
+	return nil
+}
+
 // xmlEscapeString escapes a string so it is safe to embed in an XML text node.
 func xmlEscapeString(s string) string {
 	var buf bytes.Buffer
@@ -82,58 +467,149 @@ func xmlEscapeString(s string) string {
 	return buf.String()
 }
 
+// templateFuncs returns the functions available to config templates.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{"xmlEscape": xmlEscapeString}
+}
+
 //nolint:gochecknoglobals // compile once, reuse
-var configTmpl = template.Must(template.New("config").Funcs(template.FuncMap{
-	"xmlEscape": xmlEscapeString,
-}).Parse(configTemplate))
+var configTmpl = template.Must(template.New("config").Funcs(templateFuncs()).Parse(configTemplate))
+
+// serverConfigTemplate returns the template a server config is rendered with: cfg's
+// ConfigTemplate when set, otherwise the built-in one.
+func serverConfigTemplate(cfg Config) (*template.Template, error) {
+	if cfg.configTemplate == "" {
+		return configTmpl, nil
+	}
+
+	tmpl, err := template.New("config").Funcs(templateFuncs()).Parse(cfg.configTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfigTemplate, err)
+	}
+
+	return tmpl, nil
+}
 
 type serverConfigData struct {
-	TCPPort         uint32
-	HTTPPort        uint32
-	DataDir         string
-	TmpDir          string
-	UserFilesDir    string
-	FormatSchemaDir string
-	Settings        map[string]string
-}
-
-// writeServerConfig generates a ClickHouse XML config file in the given directory.
-func writeServerConfig(dir string, tcpPort, httpPort uint32, settings map[string]string) (string, error) {
-	for k := range settings {
+	TCPPort               uint32
+	HTTPPort              uint32
+	GRPCPort              uint32
+	DataDir               string
+	TmpDir                string
+	FormatSchemaDir       string
+	DefaultDatabaseEngine string
+	QueryLog              bool
+	QueryLogFlushMS       int
+	HTTPCompression       bool
+	Telemetry             bool
+	Ephemeral             bool
+	AccessManagement      bool
+	Macros                []settingEntry
+	Profile               []settingEntry
+	Settings              map[string]string
+	auxPaths
+}
+
+// renderDir stands in for the per-start temp directory in the paths of configs produced
+// by RenderServerConfig and RenderClusterNodeConfig when no DataPath is set.
+const renderDir = "/tmp/embedded-clickhouse"
+
+// RenderServerConfig returns the XML config Start would generate for cfg and the given
+// ports, without creating any files or launching ClickHouse, e.g. for golden-file tests.
+// Paths are rooted at cfg's DataPath, or at /tmp/embedded-clickhouse in place of the
+// temp directory Start would create.
+func RenderServerConfig(cfg Config, tcpPort, httpPort uint32) (string, error) {
+	tmpl, err := serverConfigTemplate(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := serverConfigFor(cmp.Or(cfg.dataPath, renderDir), tcpPort, httpPort, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: render config: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// serverConfigFor validates cfg's server options and builds the template data of a
+// server rooted at dir.
+func serverConfigFor(dir string, tcpPort, httpPort uint32, cfg Config) (serverConfigData, error) {
+	for k := range cfg.settings {
 		if !validSettingKey.MatchString(k) {
-			return "", fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidSettingKey, k)
+			return serverConfigData{}, fmt.Errorf("%w: %q (must match [a-zA-Z][a-zA-Z0-9_]*)", ErrInvalidSettingKey, k)
 		}
 	}
 
-	dataDir := filepath.Join(dir, "data")
-	tmpDir := filepath.Join(dir, "tmp")
-	userFilesDir := filepath.Join(dir, "user_files")
-	formatSchemaDir := filepath.Join(dir, "format_schemas")
+	macros, err := macroEntries(cfg.macros)
+	if err != nil {
+		return serverConfigData{}, err
+	}
 
-	for _, d := range []string{dataDir, tmpDir, userFilesDir, formatSchemaDir} {
-		if err := os.MkdirAll(d, 0o755); err != nil {
-			return "", fmt.Errorf("embedded-clickhouse: create dir %s: %w", d, err)
-		}
+	profile, err := profileEntries(profileSettingsFor(cfg))
+	if err != nil {
+		return serverConfigData{}, err
 	}
 
-	configPath := filepath.Join(dir, "config.xml")
+	return serverConfigData{
+		TCPPort:               tcpPort,
+		HTTPPort:              httpPort,
+		GRPCPort:              cfg.grpcPort,
+		DataDir:               filepath.Join(dir, "data"),
+		TmpDir:                filepath.Join(dir, "tmp"),
+		FormatSchemaDir:       filepath.Join(dir, "format_schemas"),
+		Macros:                macros,
+		Profile:               profile,
+		Settings:              serverSettingsFor(cfg),
+		DefaultDatabaseEngine: cfg.defaultDatabaseEngine,
+		QueryLog:              cfg.queryLog,
+		QueryLogFlushMS:       queryLogFlushIntervalMS,
+		HTTPCompression:       cfg.httpCompression,
+		Telemetry:             cfg.allowTelemetry,
+		Ephemeral:             cfg.ephemeral,
+		AccessManagement:      !cfg.noAccessManagement,
+		auxPaths:              planAuxPaths(dir, auxFilesFor(cfg)),
+	}, nil
+}
 
-	f, err := os.Create(configPath)
+// writeServerConfig generates a ClickHouse XML config file in the given directory
+// from the ports and the config's server options (settings, macros, default database engine, UDFs, dictionaries).
+func writeServerConfig(dir string, tcpPort, httpPort uint32, cfg Config) (string, error) {
+	tmpl, err := serverConfigTemplate(cfg)
 	if err != nil {
-		return "", fmt.Errorf("embedded-clickhouse: create config: %w", err)
+		return "", err
+	}
+
+	data, err := serverConfigFor(dir, tcpPort, httpPort, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	if err := makeDirs(data.DataDir, data.TmpDir, data.FormatSchemaDir); err != nil {
+		return "", err
 	}
 
-	data := serverConfigData{
-		TCPPort:         tcpPort,
-		HTTPPort:        httpPort,
-		DataDir:         dataDir,
-		TmpDir:          tmpDir,
-		UserFilesDir:    userFilesDir,
-		FormatSchemaDir: formatSchemaDir,
-		Settings:        mergeSettings(settings),
+	if _, err := writeAuxFiles(dir, auxFilesFor(cfg)); err != nil {
+		return "", err
+	}
+
+	if err := writeUsersProfile(data.UsersConfigPath, data.Profile); err != nil {
+		return "", err
+	}
+
+	configPath := configPathIn(dir)
+
+	f, err := os.Create(configPath)
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: create config: %w", err)
 	}
 
-	if err := configTmpl.Execute(f, data); err != nil {
+	if err := tmpl.Execute(f, data); err != nil {
 		f.Close()
 		return "", fmt.Errorf("embedded-clickhouse: write config: %w", err)
 	}
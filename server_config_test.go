@@ -1,8 +1,10 @@
 package embeddedclickhouse
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -11,9 +13,9 @@ func TestWriteServerConfig(t *testing.T) {
 	t.Parallel()
 
 	dir := t.TempDir()
-	settings := map[string]string{"max_threads": "4"}
+	settings := map[string]string{"max_concurrent_queries": "4"}
 
-	configPath, err := writeServerConfig(dir, 19000, 18123, settings)
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().ServerSettings(settings))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -32,7 +34,7 @@ func TestWriteServerConfig(t *testing.T) {
 	checks := []string{
 		"<tcp_port>19000</tcp_port>",
 		"<http_port>18123</http_port>",
-		"<max_threads>4</max_threads>",
+		"<max_concurrent_queries>4</max_concurrent_queries>",
 		"<password></password>",
 	}
 
@@ -48,7 +50,7 @@ func TestWriteServerConfig_CreatesSubdirs(t *testing.T) {
 
 	dir := t.TempDir()
 
-	_, err := writeServerConfig(dir, 19000, 18123, nil)
+	_, err := writeServerConfig(dir, 19000, 18123, DefaultConfig())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -74,7 +76,7 @@ func TestWriteServerConfig_OverrideMaxMemory(t *testing.T) {
 	override := "2147483648" // 2 GiB
 	settings := map[string]string{testKeyMaxServerMemoryUsage: override}
 
-	configPath, err := writeServerConfig(dir, 19000, 18123, settings)
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().ServerSettings(settings))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -120,19 +122,66 @@ func TestMergeSettings(t *testing.T) {
 	t.Run("additive keys preserved", func(t *testing.T) {
 		t.Parallel()
 
-		got := mergeSettings(map[string]string{"max_threads": "4"})
-		if got["max_threads"] != "4" {
-			t.Errorf("expected max_threads=4, got %q", got["max_threads"])
+		got := mergeSettings(map[string]string{"max_concurrent_queries": "4"})
+		if got["max_concurrent_queries"] != "4" {
+			t.Errorf("expected max_concurrent_queries=4, got %q", got["max_concurrent_queries"])
 		}
 	})
 }
 
+func TestServerSettingsFor_LowMemory(t *testing.T) {
+	t.Parallel()
+
+	if got := serverSettingsFor(DefaultConfig()); len(got) != 0 {
+		t.Errorf("expected no settings without LowMemory, got %v", got)
+	}
+
+	// Settings wins over the preset regardless of call order.
+	cfgs := []Config{
+		DefaultConfig().LowMemory().ServerSettings(map[string]string{testKeyMaxServerMemoryUsage: "2147483648"}),
+		DefaultConfig().ServerSettings(map[string]string{testKeyMaxServerMemoryUsage: "2147483648"}).LowMemory(),
+	}
+
+	for i, cfg := range cfgs {
+		got := serverSettingsFor(cfg)
+		if got[testKeyMaxServerMemoryUsage] != "2147483648" {
+			t.Errorf("cfg %d: max_server_memory_usage = %q, want user value", i, got[testKeyMaxServerMemoryUsage])
+		}
+
+		if got["mark_cache_size"] != "67108864" {
+			t.Errorf("cfg %d: mark_cache_size = %q, want preset value", i, got["mark_cache_size"])
+		}
+	}
+}
+
+func TestLowMemorySettings_MergeTreeThresholds(t *testing.T) {
+	t.Parallel()
+
+	s := lowMemorySettings()
+
+	pool, err := strconv.Atoi(s["background_pool_size"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ratio, err := strconv.Atoi(s["background_merges_mutations_concurrency_ratio"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ClickHouse refuses to create MergeTree tables when the merge pool is smaller than
+	// number_of_free_entries_in_pool_to_execute_optimize_entire_partition (25).
+	if pool*ratio < 25 {
+		t.Errorf("background_pool_size * ratio = %d, below MergeTree threshold 25", pool*ratio)
+	}
+}
+
 func TestWriteServerConfig_NoSettings(t *testing.T) {
 	t.Parallel()
 
 	dir := t.TempDir()
 
-	configPath, err := writeServerConfig(dir, 9000, 8123, nil)
+	configPath, err := writeServerConfig(dir, 9000, 8123, DefaultConfig())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -146,3 +195,712 @@ func TestWriteServerConfig_NoSettings(t *testing.T) {
 		t.Error("config missing tcp_port")
 	}
 }
+
+func TestWriteServerConfig_Macros(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := DefaultConfig().Macros(map[string]string{"layer": "l<1>", "cluster": "prod"})
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xml := string(content)
+
+	for _, check := range []string{"<macros>", "<layer>l&lt;1&gt;</layer>", "<cluster>prod</cluster>"} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("config missing %q", check)
+		}
+	}
+
+	if strings.Index(xml, "<cluster>") > strings.Index(xml, "<layer>") {
+		t.Error("macros are not sorted by name")
+	}
+}
+
+func TestWriteServerConfig_NoMacros(t *testing.T) {
+	t.Parallel()
+
+	configPath, err := writeServerConfig(t.TempDir(), 19000, 18123, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(content), "<macros>") {
+		t.Error("macros section should be omitted when no macros are configured")
+	}
+}
+
+func TestWriteServerConfig_InvalidMacroKey(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().Macros(map[string]string{"bad key": "x"})
+
+	_, err := writeServerConfig(t.TempDir(), 19000, 18123, cfg)
+	if !errors.Is(err, ErrInvalidMacroKey) {
+		t.Fatalf("err = %v, want ErrInvalidMacroKey", err)
+	}
+}
+
+func TestWriteServerConfig_DefaultDatabaseEngine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		engine  string
+		present []string
+		absent  []string
+	}{
+		{
+			engine:  "",
+			present: []string{"<allow_experimental_database_replicated>1</allow_experimental_database_replicated>"},
+			absent:  []string{"<default_database_engine>", "<allow_deprecated_database_ordinary>"},
+		},
+		{
+			engine:  "Atomic",
+			present: []string{"<default_database_engine>Atomic</default_database_engine>"},
+			absent:  []string{"<allow_deprecated_database_ordinary>"},
+		},
+		{
+			engine: "Ordinary",
+			present: []string{
+				"<default_database_engine>Ordinary</default_database_engine>",
+				"<allow_deprecated_database_ordinary>1</allow_deprecated_database_ordinary>",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("engine="+tt.engine, func(t *testing.T) {
+			t.Parallel()
+
+			configPath, err := writeServerConfig(t.TempDir(), 19000, 18123, DefaultConfig().DefaultDatabaseEngine(tt.engine))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			xml := string(content)
+
+			for _, check := range tt.present {
+				if !strings.Contains(xml, check) {
+					t.Errorf("config missing %q", check)
+				}
+			}
+
+			for _, check := range tt.absent {
+				if strings.Contains(xml, check) {
+					t.Errorf("config should not contain %q", check)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteServerConfig_QueryLog(t *testing.T) {
+	t.Parallel()
+
+	read := func(cfg Config) string {
+		t.Helper()
+
+		configPath, err := writeServerConfig(t.TempDir(), 19000, 18123, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(content)
+	}
+
+	xml := read(DefaultConfig().EnableQueryLog(true))
+
+	for _, check := range []string{
+		"<query_log>",
+		"<flush_interval_milliseconds>100</flush_interval_milliseconds>",
+		"<log_queries>1</log_queries>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("config missing %q", check)
+		}
+	}
+
+	if xml := read(DefaultConfig()); strings.Contains(xml, "<query_log>") {
+		t.Error("query_log section should be omitted unless EnableQueryLog is set")
+	}
+}
+
+func TestRenderServerConfig_HTTPCompression(t *testing.T) {
+	t.Parallel()
+
+	const setting = "<enable_http_compression>1</enable_http_compression>"
+
+	for _, enable := range []bool{true, false} {
+		xml, err := RenderServerConfig(DefaultConfig().EnableHTTPCompression(enable), 19000, 18123)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(xml, setting); got != enable {
+			t.Errorf("EnableHTTPCompression(%v): config contains %s = %v", enable, setting, got)
+		}
+	}
+}
+
+func TestRenderServerConfig_Profile(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().
+		EnableQueryLog(true).
+		ProfileSettings(map[string]string{"async_insert": "1", "async_insert_busy_timeout_ms": "200", "log_queries": "0"})
+
+	xml, err := RenderServerConfig(cfg, 19000, 18123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, profiles, _ := strings.Cut(xml, "<profiles>")
+	profiles, _, _ = strings.Cut(profiles, "</profiles>")
+
+	for _, want := range []string{
+		"<async_insert>1</async_insert>",
+		"<async_insert_busy_timeout_ms>200</async_insert_busy_timeout_ms>",
+		"<log_queries>0</log_queries>",
+		"<allow_experimental_database_replicated>1</allow_experimental_database_replicated>",
+	} {
+		if !strings.Contains(profiles, want) {
+			t.Errorf("default profile missing %s", want)
+		}
+	}
+
+	if strings.Contains(xml, "<log_queries>1</log_queries>") {
+		t.Error("Profile should override the log_queries implied by EnableQueryLog")
+	}
+
+	if strings.Count(xml, "<async_insert>") != 1 {
+		t.Error("profile settings should not be written at the root")
+	}
+}
+
+func TestRenderServerConfig_InvalidProfileKey(t *testing.T) {
+	t.Parallel()
+
+	_, err := RenderServerConfig(DefaultConfig().ProfileSettings(map[string]string{"bad key": "1"}), 19000, 18123)
+	if !errors.Is(err, ErrInvalidSettingKey) {
+		t.Errorf("err = %v, want ErrInvalidSettingKey", err)
+	}
+}
+
+func TestRenderServerConfig_Ephemeral(t *testing.T) {
+	t.Parallel()
+
+	const setting = "<fsync_metadata>0</fsync_metadata>"
+
+	for _, enable := range []bool{true, false} {
+		xml, err := RenderServerConfig(DefaultConfig().Ephemeral(enable), 19000, 18123)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(xml, setting); got != enable {
+			t.Errorf("Ephemeral(%v): config contains %s = %v", enable, setting, got)
+		}
+	}
+
+	// ProfileSettings can turn metadata fsyncs back on.
+	cfg := DefaultConfig().Ephemeral(true).ProfileSettings(map[string]string{"fsync_metadata": "1"})
+
+	xml, err := RenderServerConfig(cfg, 19000, 18123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(xml, "<fsync_metadata>1</fsync_metadata>") || strings.Contains(xml, setting) {
+		t.Error("ProfileSettings should override the fsync_metadata implied by Ephemeral")
+	}
+}
+
+func TestRenderServerConfig_Telemetry(t *testing.T) {
+	t.Parallel()
+
+	const block = "<send_crash_reports>\n        <enabled>false</enabled>\n    </send_crash_reports>"
+
+	for _, allow := range []bool{false, true} {
+		xml, err := RenderServerConfig(DefaultConfig().AllowTelemetry(allow), 19000, 18123)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(xml, block); got == allow {
+			t.Errorf("AllowTelemetry(%v): config disables crash reports = %v", allow, got)
+		}
+	}
+}
+
+func TestRenderServerConfig_AccessManagement(t *testing.T) {
+	t.Parallel()
+
+	for _, enable := range []bool{true, false} {
+		xml, err := RenderServerConfig(DefaultConfig().AccessManagement(enable), 19000, 18123)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "<access_management>0</access_management>"
+		if enable {
+			want = "<access_management>1</access_management>"
+		}
+
+		if !strings.Contains(xml, want) {
+			t.Errorf("AccessManagement(%v): config missing %s", enable, want)
+		}
+	}
+}
+
+func TestRenderServerConfig_GRPCPort(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{"off", DefaultConfig(), false},
+		{"explicit", DefaultConfig().GRPCPort(19100), true},
+		{"auto", DefaultConfig().GRPCPort(0), false}, // allocated by Start
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			xml, err := RenderServerConfig(tt.cfg, 19000, 18123)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Contains(xml, "<grpc_port>19100</grpc_port>"); got != tt.want {
+				t.Errorf("config contains grpc_port = %v, want %v", got, tt.want)
+			}
+
+			if got := strings.Contains(xml, "<grpc>"); got != tt.want {
+				t.Errorf("config contains <grpc> = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteServerConfig_UDFConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	definition := []byte("<functions><function><name>double</name></function></functions>")
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().UDFConfig(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udfPath := filepath.Join(dir, udfConfigFile)
+
+	written, err := os.ReadFile(udfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != string(definition) {
+		t.Errorf("UDF config = %q, want %q", written, definition)
+	}
+
+	xml := string(content)
+
+	for _, check := range []string{
+		"<user_defined_executable_functions_config>" + udfPath + "</user_defined_executable_functions_config>",
+		"<user_scripts_path>" + filepath.Join(dir, "user_scripts") + "/</user_scripts_path>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("config missing %q", check)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "user_scripts")); err != nil {
+		t.Errorf("user_scripts dir not created: %v", err)
+	}
+}
+
+func TestWriteServerConfig_UserScriptsPath(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	scripts := t.TempDir()
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().UserScriptsPath(scripts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xml := string(content)
+
+	if !strings.Contains(xml, "<user_scripts_path>"+scripts+"/</user_scripts_path>") {
+		t.Error("config should point user_scripts_path at the configured directory")
+	}
+
+	if strings.Contains(xml, "<user_defined_executable_functions_config>") {
+		t.Error("UDF config reference should be omitted without UDFConfig")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "user_scripts")); !os.IsNotExist(err) {
+		t.Errorf("default user_scripts dir should not be created, stat err = %v", err)
+	}
+}
+
+func TestWriteServerConfig_Dictionaries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	userFiles := t.TempDir()
+	definition := []byte("<dictionaries><dictionary><name>countries</name></dictionary></dictionaries>")
+
+	cfg := DefaultConfig().Dictionaries(definition).UserFilesPath(userFiles)
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dictPath := filepath.Join(dir, dictionariesConfigFile)
+
+	written, err := os.ReadFile(dictPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != string(definition) {
+		t.Errorf("dictionaries config = %q, want %q", written, definition)
+	}
+
+	xml := string(content)
+
+	for _, check := range []string{
+		"<dictionaries_config>" + dictPath + "</dictionaries_config>",
+		"<user_files_path>" + userFiles + "/</user_files_path>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("config missing %q", check)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "user_files")); !os.IsNotExist(err) {
+		t.Errorf("default user_files dir should not be created, stat err = %v", err)
+	}
+}
+
+func TestWriteServerConfig_NoDictionaries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(content), "<dictionaries_config>") {
+		t.Error("dictionaries_config should be omitted without Dictionaries")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, dictionariesConfigFile)); !os.IsNotExist(err) {
+		t.Errorf("dictionaries.xml should not be written, stat err = %v", err)
+	}
+}
+
+func TestWriteServerConfig_UsersConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	definition := []byte("<clickhouse><users><default><password/></default><alice/></users></clickhouse>")
+
+	cfg := DefaultConfig().UsersConfig(definition).ProfileSettings(map[string]string{"max_threads": "2"})
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usersPath := filepath.Join(dir, usersConfigFile)
+
+	written, err := os.ReadFile(usersPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != string(definition) {
+		t.Errorf("users config = %q, want %q", written, definition)
+	}
+
+	xml := string(content)
+
+	if !strings.Contains(xml, "<users_config>"+usersPath+"</users_config>") {
+		t.Error("config should reference users.xml")
+	}
+
+	for _, inline := range []string{"<users>", "<profiles>", "<quotas>"} {
+		if strings.Contains(xml, inline) {
+			t.Errorf("config should not contain an inline %s block", inline)
+		}
+	}
+
+	// The generated profile settings move to users.d, where they extend the file.
+	profile, err := os.ReadFile(filepath.Join(dir, "users.d", usersProfileFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<max_threads>2</max_threads>",
+		"<allow_experimental_database_replicated>1</allow_experimental_database_replicated>",
+	} {
+		if !strings.Contains(string(profile), want) {
+			t.Errorf("users.d profile missing %s", want)
+		}
+	}
+}
+
+func TestWriteServerConfig_NoUsersConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(content), "<users_config>") || !strings.Contains(string(content), "<users>") {
+		t.Error("config should define the default user inline without UsersConfig")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users.d")); !os.IsNotExist(err) {
+		t.Errorf("users.d should not be created, stat err = %v", err)
+	}
+}
+
+func TestValidateUsersConfig(t *testing.T) {
+	t.Parallel()
+
+	for _, valid := range [][]byte{nil, []byte("<clickhouse/>"), []byte("<?xml version=\"1.0\"?>\n<clickhouse><users/></clickhouse>")} {
+		if err := validateUsersConfig(valid); err != nil {
+			t.Errorf("validateUsersConfig(%q) = %v, want nil", valid, err)
+		}
+	}
+
+	for _, invalid := range [][]byte{{}, []byte("  "), []byte("<clickhouse><users></clickhouse>"), []byte("<clickhouse>")} {
+		if err := validateUsersConfig(invalid); !errors.Is(err, ErrInvalidUsersConfig) {
+			t.Errorf("validateUsersConfig(%q) = %v, want ErrInvalidUsersConfig", invalid, err)
+		}
+	}
+
+	if err := NewServer(DefaultConfig().UsersConfig([]byte("<clickhouse>"))).Start(); !errors.Is(err, ErrInvalidUsersConfig) {
+		t.Errorf("Start = %v, want ErrInvalidUsersConfig", err)
+	}
+
+	if err := NewCluster(2, DefaultConfig().UsersConfig([]byte("<clickhouse>"))).Start(); !errors.Is(err, ErrInvalidUsersConfig) {
+		t.Errorf("Cluster.Start = %v, want ErrInvalidUsersConfig", err)
+	}
+}
+
+func TestWriteServerConfig_FormatSchemas(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"message.proto":      []byte(`syntax = "proto3"; message Msg { uint64 id = 1; }`),
+		"capnp/schema.capnp": []byte("@0xbf5147cbbecf40c1; struct Msg { id @0 :UInt64; }"),
+	}
+
+	if _, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().FormatSchemas(files)); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, "format_schemas", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != string(want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWriteServerConfig_FormatSchemasInvalidName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"", "/etc/message.proto", "../message.proto", "a/../../message.proto"} {
+		cfg := DefaultConfig().FormatSchemas(map[string][]byte{name: []byte("x")})
+
+		if _, err := writeServerConfig(t.TempDir(), 19000, 18123, cfg); !errors.Is(err, ErrInvalidFormatSchemaName) {
+			t.Errorf("FormatSchemas(%q): err = %v, want ErrInvalidFormatSchemaName", name, err)
+		}
+	}
+}
+
+func TestRenderServerConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := DefaultConfig().ServerSettings(map[string]string{"max_concurrent_queries": "4"}).UDFConfig([]byte("<functions/>"))
+
+	rendered, err := RenderServerConfig(cfg, 19000, 18123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range []string{
+		"<tcp_port>19000</tcp_port>",
+		"<max_concurrent_queries>4</max_concurrent_queries>",
+		"<path>/tmp/embedded-clickhouse/data/</path>",
+		"/tmp/embedded-clickhouse/" + udfConfigFile,
+	} {
+		if !strings.Contains(rendered, check) {
+			t.Errorf("rendered config missing %q", check)
+		}
+	}
+
+	// Rendering matches what Start writes for the same directory.
+	dir := t.TempDir()
+
+	written, err := RenderServerConfig(cfg.DataPath(dir), 19000, 18123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if written != string(content) {
+		t.Errorf("rendered config differs from written config:\n%s\n---\n%s", written, content)
+	}
+}
+
+func TestRenderServerConfig_InvalidSettingKey(t *testing.T) {
+	t.Parallel()
+
+	_, err := RenderServerConfig(DefaultConfig().ServerSettings(map[string]string{"bad key": "1"}), 19000, 18123)
+	if !errors.Is(err, ErrInvalidSettingKey) {
+		t.Errorf("err = %v, want ErrInvalidSettingKey", err)
+	}
+}
+
+func TestWriteServerConfig_ConfigTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl := `<clickhouse><tcp_port>{{.TCPPort}}</tcp_port><path>{{xmlEscape .DataDir}}/</path>` +
+		`<remote_servers><x><shard><replica><host>a&amp;b</host></replica></shard></x></remote_servers></clickhouse>`
+
+	dir := t.TempDir()
+
+	configPath, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().ConfigTemplate(tmpl))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<clickhouse><tcp_port>19000</tcp_port><path>` + filepath.Join(dir, "data") + `/</path>` +
+		`<remote_servers><x><shard><replica><host>a&amp;b</host></replica></shard></x></remote_servers></clickhouse>`
+	if string(content) != want {
+		t.Errorf("config = %s, want %s", content, want)
+	}
+
+	// Directories are still created for the custom layout.
+	if _, err := os.Stat(filepath.Join(dir, "data")); err != nil {
+		t.Errorf("data dir not created: %v", err)
+	}
+}
+
+func TestWriteServerConfig_InvalidConfigTemplate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	_, err := writeServerConfig(dir, 19000, 18123, DefaultConfig().ConfigTemplate("<clickhouse>{{.TCPPort</clickhouse>"))
+	if !errors.Is(err, ErrInvalidConfigTemplate) {
+		t.Errorf("err = %v, want ErrInvalidConfigTemplate", err)
+	}
+
+	if _, err := os.Stat(configPathIn(dir)); !os.IsNotExist(err) {
+		t.Errorf("config.xml written despite invalid template: %v", err)
+	}
+}
+
+func TestRenderServerConfig_ConfigTemplate(t *testing.T) {
+	t.Parallel()
+
+	got, err := RenderServerConfig(DefaultConfig().ConfigTemplate("http={{.HTTPPort}}"), 19000, 18123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "http=18123" {
+		t.Errorf("rendered = %q, want %q", got, "http=18123")
+	}
+}
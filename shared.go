@@ -0,0 +1,503 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+const (
+	sharedSubdir       = "embedded-clickhouse-shared"
+	sharedPollInterval = 50 * time.Millisecond
+)
+
+// ErrInvalidSharedName is returned by Start when the Shared name is not a plain file name.
+var ErrInvalidSharedName = errors.New("embedded-clickhouse: invalid shared instance name")
+
+// ErrSharedMismatch is returned by Start when the advertised instance has a different
+// shape (a server where a cluster is wanted, or another replica count).
+var ErrSharedMismatch = errors.New("embedded-clickhouse: shared instance does not match the requested topology")
+
+// ErrSharedInstance is returned by Snapshot, Restore and Reset on a shared server, and by
+// Cluster.SetProfileSetting on a shared cluster: they would pull the server, its data or
+// its settings out from under the other attached test binaries.
+var ErrSharedInstance = errors.New("embedded-clickhouse: operation not allowed on a shared instance")
+
+// validSharedName keeps Shared names usable as file names.
+var validSharedName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// sharedNode is one running server of a shared instance.
+type sharedNode struct {
+	PID      int    `json:"pid"`
+	TCPPort  uint32 `json:"tcpPort"`
+	HTTPPort uint32 `json:"httpPort"`
+	GRPCPort uint32 `json:"grpcPort,omitempty"`
+}
+
+// sharedState is the metadata file advertising a shared instance. Refs counts the
+// attached handles, the starter included; the handle that drops it to zero stops the
+// nodes and removes Dirs.
+type sharedState struct {
+	Refs    int               `json:"refs"`
+	Cluster string            `json:"cluster,omitempty"`
+	BinPath string            `json:"binPath"`
+	Version ClickHouseVersion `json:"version,omitempty"`
+	Dirs    []string          `json:"dirs,omitempty"`
+	Nodes   []sharedNode      `json:"nodes"`
+}
+
+// sharedSession holds the cross-process lock of one shared instance name. Every read
+// and write of the metadata happens while it is held.
+type sharedSession struct {
+	lock      *fileLock
+	statePath string
+	logPath   string
+}
+
+// openShared validates name and locks its metadata in the well-known shared directory
+// under os.TempDir.
+func openShared(name string) (*sharedSession, error) {
+	if !validSharedName.MatchString(name) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSharedName, name)
+	}
+
+	root := filepath.Join(os.TempDir(), sharedSubdir)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: create dir %s: %w", root, err)
+	}
+
+	lock, err := acquireLock(filepath.Join(root, name+".lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sharedSession{
+		lock:      lock,
+		statePath: filepath.Join(root, name+".json"),
+		logPath:   filepath.Join(root, name+".log"),
+	}, nil
+}
+
+// close releases the lock.
+func (s *sharedSession) close() {
+	_ = s.lock.release()
+}
+
+// load returns the advertised instance, or false when there is none or it is no longer
+// answering (its starter was killed, or it crashed). A stale file is simply overwritten
+// by the next save.
+func (s *sharedSession) load() (sharedState, bool, error) {
+	data, err := os.ReadFile(s.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return sharedState{}, false, nil
+	}
+
+	if err != nil {
+		return sharedState{}, false, fmt.Errorf("embedded-clickhouse: read %s: %w", s.statePath, err)
+	}
+
+	var st sharedState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return sharedState{}, false, fmt.Errorf("embedded-clickhouse: parse %s: %w", s.statePath, err)
+	}
+
+	return st, st.alive(), nil
+}
+
+// save writes st as the advertised instance.
+func (s *sharedSession) save(st sharedState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: encode shared state: %w", err)
+	}
+
+	if err := os.WriteFile(s.statePath, data, 0o600); err != nil {
+		return fmt.Errorf("embedded-clickhouse: write %s: %w", s.statePath, err)
+	}
+
+	return nil
+}
+
+// remove withdraws the advertisement.
+func (s *sharedSession) remove() error {
+	if err := os.Remove(s.statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("embedded-clickhouse: remove %s: %w", s.statePath, err)
+	}
+
+	return nil
+}
+
+// openLog truncates and opens the log file that receives a shared instance's output.
+// The server outlives the test binary that started it, so it cannot write to that
+// binary's Logger.
+func (s *sharedSession) openLog() (*os.File, error) {
+	f, err := os.Create(s.logPath)
+	if err != nil {
+		return nil, fmt.Errorf("embedded-clickhouse: create %s: %w", s.logPath, err)
+	}
+
+	return f, nil
+}
+
+// alive reports whether every node of st answers /ping.
+func (st sharedState) alive() bool {
+	if len(st.Nodes) == 0 {
+		return false
+	}
+
+	client := &http.Client{Timeout: healthRequestTimeout}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthRequestTimeout)
+	defer cancel()
+
+	for _, n := range st.Nodes {
+		if !ping(ctx, client, fmt.Sprintf("http://127.0.0.1:%d/ping", n.HTTPPort)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sharedNodeFor records a started node.
+func sharedNodeFor(proc *process, tcpPort, httpPort uint32) sharedNode {
+	return sharedNode{PID: proc.cmd.Process.Pid, TCPPort: tcpPort, HTTPPort: httpPort, GRPCPort: 0}
+}
+
+// stopSharedNode stops a node started by another process. It cannot be waited on, so
+// SIGTERM goes to its process group (the node leads it, see startProcess) and the PID
+// is polled until it is gone, with SIGKILL after timeout.
+func stopSharedNode(pid int, timeout time.Duration) error {
+	_ = syscall.Kill(-pid, syscall.SIGTERM)
+
+	if waitPIDGone(pid, timeout) {
+		return nil
+	}
+
+	_ = syscall.Kill(-pid, syscall.SIGKILL)
+	waitPIDGone(pid, timeout)
+
+	return ErrStopTimeout
+}
+
+// waitPIDGone polls until pid no longer exists or timeout elapses.
+func waitPIDGone(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(sharedPollInterval)
+	}
+}
+
+// stopSharedNodes stops every node of st: through procs where this process started
+// them (procs[i] is nil otherwise), by PID for the rest.
+func stopSharedNodes(st sharedState, procs []*process, timeout time.Duration) []error {
+	var errs []error
+
+	for i, n := range st.Nodes {
+		var err error
+		if i < len(procs) && procs[i] != nil {
+			err = stopProcess(procs[i], timeout)
+		} else {
+			err = stopSharedNode(n.PID, timeout)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+		}
+	}
+
+	return errs
+}
+
+// removeSharedDirs removes the directories of a stopped shared instance.
+func removeSharedDirs(dirs []string) []error {
+	var errs []error
+
+	for _, d := range dirs {
+		if err := os.RemoveAll(d); err != nil {
+			errs = append(errs, fmt.Errorf("embedded-clickhouse: remove temp dir: %w", err))
+		}
+	}
+
+	return errs
+}
+
+// startShared attaches to the instance advertised under the Shared name, or starts one
+// with startLocked and advertises it. Caller must hold e.mu.
+func (e *EmbeddedClickHouse) startShared(ctx context.Context) error {
+	sess, err := openShared(e.config.sharedName)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	st, ok, err := sess.load()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		if st.Cluster != "" || len(st.Nodes) != 1 {
+			return fmt.Errorf("%w: %q is a cluster", ErrSharedMismatch, e.config.sharedName)
+		}
+
+		st.Refs++
+		if err := sess.save(st); err != nil {
+			return err
+		}
+
+		e.binPath = st.BinPath
+		e.version = st.Version
+		e.tcpPort = st.Nodes[0].TCPPort
+		e.httpPort = st.Nodes[0].HTTPPort
+		e.grpcPort = st.Nodes[0].GRPCPort
+		e.shared = true
+		e.started = true
+
+		return nil
+	}
+
+	logFile, err := sess.openLog()
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	logger := e.config.logger
+	e.config.logger = logFile
+
+	err = e.startLocked(ctx)
+	e.config.logger = logger
+
+	if err != nil {
+		return err
+	}
+
+	node := sharedNodeFor(e.proc, e.tcpPort, e.httpPort)
+	node.GRPCPort = e.grpcPort
+
+	st = sharedState{
+		Refs:    1,
+		BinPath: e.binPath,
+		Version: e.version,
+		Nodes:   []sharedNode{node},
+	}
+	if e.config.dataPath == "" {
+		st.Dirs = []string{e.tmpDir}
+	}
+
+	if err := sess.save(st); err != nil {
+		// removeTmpDir keeps a DataPath, which is the user's data rather than a temp dir.
+		err = errors.Join(err, stopProcess(e.proc, e.config.stopTimeout), e.removeTmpDir())
+		claimedPorts.release(e.claimedPorts...)
+
+		e.started = false
+		e.proc = nil
+		e.claimedPorts = nil
+
+		return err
+	}
+
+	e.shared = true
+
+	return nil
+}
+
+// stopShared detaches from the shared instance and stops it if this was the last
+// handle. Caller must hold e.mu.
+func (e *EmbeddedClickHouse) stopShared() error {
+	sess, err := openShared(e.config.sharedName)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	st, _, err := sess.load()
+	if err != nil {
+		return err
+	}
+
+	claimedPorts.release(e.claimedPorts...)
+
+	e.started = false
+	e.shared = false
+	e.tcpPort = 0
+	e.httpPort = 0
+	e.grpcPort = 0
+	e.claimedPorts = nil
+
+	proc := e.proc
+	e.proc = nil
+
+	if len(st.Nodes) == 0 {
+		// The advertisement is gone (removed by hand); stop only what this handle owns.
+		return errors.Join(stopProcess(proc, e.config.stopTimeout), e.removeTmpDir())
+	}
+
+	st.Refs--
+	if st.Refs > 0 {
+		return sess.save(st)
+	}
+
+	var errs []error
+
+	if err := beforeStop(st.Nodes[0].HTTPPort, e.config); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, stopSharedNodes(st, []*process{proc}, e.config.stopTimeout)...)
+	errs = append(errs, removeSharedDirs(st.Dirs)...)
+	errs = append(errs, sess.remove())
+
+	return errors.Join(errs...)
+}
+
+// startShared attaches to the cluster advertised under the Shared name, or starts one
+// with startLocked and advertises it. Caller must hold c.mu.
+func (c *Cluster) startShared(ctx context.Context) error {
+	sess, err := openShared(c.config.sharedName)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	st, ok, err := sess.load()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		if st.Cluster != c.ClusterName() || len(st.Nodes) != c.replicas {
+			return fmt.Errorf("%w: %q has %d node(s), want a %d-replica cluster",
+				ErrSharedMismatch, c.config.sharedName, len(st.Nodes), c.replicas)
+		}
+
+		st.Refs++
+		if err := sess.save(st); err != nil {
+			return err
+		}
+
+		c.nodes = make([]*EmbeddedClickHouse, len(st.Nodes))
+		for i, n := range st.Nodes {
+			c.nodes[i] = &EmbeddedClickHouse{
+				config:         c.config,
+				started:        true,
+				binPath:        st.BinPath,
+				version:        st.Version,
+				tcpPort:        n.TCPPort,
+				httpPort:       n.HTTPPort,
+				clusterManaged: true,
+			}
+		}
+
+		c.binPath = st.BinPath
+		c.shared = true
+		c.started = true
+
+		return nil
+	}
+
+	logFile, err := sess.openLog()
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	logger := c.config.logger
+	c.config.logger = logFile
+
+	err = c.startLocked(ctx)
+	c.config.logger = logger
+
+	if err != nil {
+		return err
+	}
+
+	st = sharedState{Refs: 1, Cluster: c.ClusterName(), BinPath: c.nodes[0].binPath, Version: c.nodes[0].version}
+
+	for _, node := range c.nodes {
+		st.Nodes = append(st.Nodes, sharedNodeFor(node.proc, node.tcpPort, node.httpPort))
+		if c.config.dataPath == "" {
+			st.Dirs = append(st.Dirs, node.tmpDir)
+		}
+	}
+
+	if err := sess.save(st); err != nil {
+		c.shared = false
+
+		return errors.Join(err, c.stopLocked())
+	}
+
+	c.shared = true
+
+	return nil
+}
+
+// stopShared detaches from the shared cluster and stops it if this was the last
+// handle. Caller must hold c.mu.
+func (c *Cluster) stopShared() error {
+	sess, err := openShared(c.config.sharedName)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+
+	st, _, err := sess.load()
+	if err != nil {
+		return err
+	}
+
+	if len(st.Nodes) == 0 {
+		// The advertisement is gone (removed by hand); stop only what this handle owns.
+		return c.stopLocked()
+	}
+
+	dbErr := c.closeNodeDBs()
+
+	procs := make([]*process, len(c.nodes))
+	for i, node := range c.nodes {
+		procs[i] = node.proc
+		node.started = false
+		node.proc = nil
+	}
+
+	c.nodes = nil
+	c.started = false
+	c.shared = false
+	c.releaseClaimedPorts()
+
+	st.Refs--
+	if st.Refs > 0 {
+		return errors.Join(dbErr, sess.save(st))
+	}
+
+	errs := []error{dbErr}
+
+	for i, n := range st.Nodes {
+		if err := beforeStop(n.HTTPPort, c.config); err != nil {
+			errs = append(errs, fmt.Errorf("node %d: %w", i, err))
+		}
+	}
+
+	errs = append(errs, stopSharedNodes(st, procs, c.config.stopTimeout)...)
+	errs = append(errs, removeSharedDirs(st.Dirs)...)
+	errs = append(errs, sess.remove())
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,171 @@
+package embeddedclickhouse
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// advertiseShared writes a shared instance named name backed by a fake server process
+// (for the PID) and a fake HTTP endpoint (for /ping), with refs already attached.
+func advertiseShared(t *testing.T, name string, refs int) (sharedState, *process) {
+	t.Helper()
+
+	proc := startFakeServer(t, "")
+	httpPort := fakeQueryServer(t, func(w http.ResponseWriter, _ string) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	dir := t.TempDir()
+	st := sharedState{
+		Refs:    refs,
+		BinPath: "/opt/clickhouse",
+		Dirs:    []string{dir},
+		Nodes:   []sharedNode{{PID: proc.cmd.Process.Pid, TCPPort: 19000, HTTPPort: httpPort}},
+	}
+
+	sess, err := openShared(name)
+	require.NoError(t, err)
+	require.NoError(t, sess.save(st))
+	sess.close()
+
+	return st, proc
+}
+
+// loadShared reads the metadata of name, reporting whether it exists.
+func loadShared(t *testing.T, name string) (sharedState, bool) {
+	t.Helper()
+
+	sess, err := openShared(name)
+	require.NoError(t, err)
+
+	defer sess.close()
+
+	if _, err := os.Stat(sess.statePath); errors.Is(err, os.ErrNotExist) {
+		return sharedState{}, false
+	}
+
+	st, _, err := sess.load()
+	require.NoError(t, err)
+
+	return st, true
+}
+
+func TestShared_InvalidName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"../escape", "a/b", ".hidden"} {
+		err := NewServer(DefaultConfig().Shared(name).BinaryPath("/nonexistent")).Start()
+		require.ErrorIs(t, err, ErrInvalidSharedName, "name %q", name)
+	}
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestShared_AttachAndDetach(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	st, proc := advertiseShared(t, "suite", 1)
+
+	s := NewServer(DefaultConfig().Shared("suite"))
+	require.NoError(t, s.Start())
+
+	assert.Equal(t, "127.0.0.1:19000", s.TCPAddr())
+	assert.Equal(t, st.BinPath, s.binPath)
+
+	got, _ := loadShared(t, "suite")
+	assert.Equal(t, 2, got.Refs)
+
+	_, err := s.Snapshot()
+	require.ErrorIs(t, err, ErrSharedInstance)
+
+	// Detaching while the starter is still attached leaves the server running.
+	require.NoError(t, s.Stop())
+
+	got, _ = loadShared(t, "suite")
+	assert.Equal(t, 1, got.Refs)
+
+	select {
+	case <-proc.done:
+		t.Fatal("shared server stopped while still referenced")
+	default:
+	}
+
+	assert.DirExists(t, st.Dirs[0])
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestShared_LastDetacherStops(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// Refs 0: the starter has already detached, so this handle is the last one.
+	st, proc := advertiseShared(t, "suite", 0)
+
+	s := NewServer(DefaultConfig().Shared("suite"))
+	require.NoError(t, s.Start())
+	require.NoError(t, s.Stop())
+
+	<-proc.done
+
+	assert.NoDirExists(t, st.Dirs[0])
+
+	_, ok := loadShared(t, "suite")
+	assert.False(t, ok, "metadata should be removed by the last detacher")
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestShared_ClusterMismatch(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	advertiseShared(t, "suite", 1)
+
+	err := NewCluster(2, DefaultConfig().Shared("suite")).Start()
+	require.ErrorIs(t, err, ErrSharedMismatch)
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestShared_OutputGoesToLogFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	fake := writeFakeScript(t, "echo 'fatal: bad config' >&2\nexit 70\n")
+
+	s := NewServer(DefaultConfig().Shared("suite").BinaryPath(fake).StartTimeout(5 * time.Second))
+	require.Error(t, s.Start())
+
+	// No tee: the server writes straight to the log file, which outlives this process.
+	assert.Nil(t, s.LastOutput(10))
+
+	data, err := os.ReadFile(filepath.Join(os.TempDir(), sharedSubdir, "suite.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "fatal: bad config")
+}
+
+func TestStopSharedNode(t *testing.T) {
+	t.Parallel()
+
+	proc := startFakeServer(t, "")
+
+	require.NoError(t, stopSharedNode(proc.cmd.Process.Pid, 5*time.Second))
+	<-proc.done
+
+	err := syscall.Kill(proc.cmd.Process.Pid, 0)
+	assert.ErrorIs(t, err, syscall.ESRCH)
+}
+
+func TestSharedState_AliveStale(t *testing.T) {
+	t.Parallel()
+
+	port, err := allocatePort(portRange{})
+	require.NoError(t, err)
+
+	// Nothing listens on port any more: the advertised instance is stale.
+	st := sharedState{Nodes: []sharedNode{{HTTPPort: port}}}
+	assert.False(t, st.alive())
+	assert.False(t, sharedState{}.alive())
+}
@@ -0,0 +1,220 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// snapshotsSubdir is the directory, next to the server's data dir, that holds snapshots.
+const snapshotsSubdir = "snapshots"
+
+// ErrSnapshotNotFound is returned by Restore when the token does not name a snapshot of this server.
+var ErrSnapshotNotFound = errors.New("embedded-clickhouse: snapshot not found")
+
+// SnapshotToken identifies a data directory snapshot taken by Snapshot.
+// It is opaque and only meaningful to the server that produced it.
+type SnapshotToken string
+
+// Snapshot copies the server's data directory to a sibling location and returns a token
+// that Restore can later roll back to. The server is stopped for the duration of the copy
+// so the snapshot is consistent, then restarted on the same ports. Snapshots live under
+// the server's root directory, so they are removed by Stop unless DataPath is set.
+func (e *EmbeddedClickHouse) Snapshot() (SnapshotToken, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.clusterManaged {
+		return "", ErrClusterManaged
+	}
+
+	if !e.started {
+		return "", ErrServerNotStarted
+	}
+
+	if e.shared {
+		return "", ErrSharedInstance
+	}
+
+	root := filepath.Join(e.tmpDir, snapshotsSubdir)
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: create snapshot dir: %w", err)
+	}
+
+	dst, err := os.MkdirTemp(root, "snapshot-*")
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: create snapshot dir: %w", err)
+	}
+
+	if err := e.restartLocked(func() error {
+		return copyDir(filepath.Join(e.tmpDir, "data"), dst)
+	}); err != nil {
+		os.RemoveAll(dst)
+		return "", err
+	}
+
+	return SnapshotToken(filepath.Base(dst)), nil
+}
+
+// Restore wipes the server's data directory, replaces it with the snapshot identified by
+// token, and restarts the server on the same ports. The snapshot itself is kept, so the
+// same token can be restored repeatedly (e.g. once per test case).
+func (e *EmbeddedClickHouse) Restore(token SnapshotToken) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.clusterManaged {
+		return ErrClusterManaged
+	}
+
+	if !e.started {
+		return ErrServerNotStarted
+	}
+
+	if e.shared {
+		return ErrSharedInstance
+	}
+
+	name := string(token)
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("%w: %q", ErrSnapshotNotFound, name)
+	}
+
+	src := filepath.Join(e.tmpDir, snapshotsSubdir, name)
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return fmt.Errorf("%w: %q", ErrSnapshotNotFound, name)
+	}
+
+	dataDir := filepath.Join(e.tmpDir, "data")
+
+	return e.restartLocked(func() error {
+		if err := os.RemoveAll(dataDir); err != nil {
+			return fmt.Errorf("embedded-clickhouse: remove data dir: %w", err)
+		}
+
+		return copyDir(src, dataDir)
+	})
+}
+
+// restartLocked stops the server process, runs between while it is down, and starts it
+// again with the same config and ports. between is skipped if the stop itself failed.
+// If the restart fails the server stays marked as started with no process, so a later
+// Stop still removes its directories. Caller must hold e.mu.
+func (e *EmbeddedClickHouse) restartLocked(between func() error) error {
+	stopErr := stopProcess(e.proc, e.config.stopTimeout)
+	e.proc = nil
+
+	var opErr error
+	if stopErr == nil {
+		opErr = between()
+	}
+
+	configPath := configPathIn(e.tmpDir)
+
+	proc, startErr := startAndWait(context.Background(), e.binPath, configPath, e.httpPort, e.tcpPort, e.config, e.output)
+	if startErr == nil {
+		e.proc = proc
+		startErr = writeMetadata(e.config, e.tmpDir, proc, e.tcpPort, e.httpPort, e.version, "")
+	}
+
+	return errors.Join(stopErr, opErr, startErr)
+}
+
+// copyDir recursively copies src into dst, creating dst if needed. Regular files keep
+// their permission bits and are reflinked where the filesystem allows (see cloneFile).
+// Symlinks are recreated as symlinks (ClickHouse links database directories into
+// store/); an absolute link that points inside src is rebased onto dst so the copy never
+// refers back to the original tree. Other file types are skipped.
+func copyDir(src, dst string) error {
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped once below
+		}
+
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped once below
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err //nolint:wrapcheck // wrapped once below
+			}
+
+			return os.Symlink(rebaseLink(link, src, dst), target)
+		case d.Type().IsRegular():
+			return cloneFile(path, target, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("embedded-clickhouse: copy %s: %w", src, err)
+	}
+
+	return nil
+}
+
+// rebaseLink rewrites an absolute symlink target under src to the same location under
+// dst. Relative targets and targets outside src are returned unchanged.
+func rebaseLink(link, src, dst string) string {
+	if !filepath.IsAbs(link) {
+		return link
+	}
+
+	rel, err := filepath.Rel(src, link)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return link
+	}
+
+	return filepath.Join(dst, rel)
+}
+
+// cloneFile creates dst as a copy-on-write clone of src when the filesystem supports it
+// (btrfs, XFS, APFS), making large data dirs nearly free to duplicate, and falls back to
+// a byte-for-byte copy otherwise.
+func cloneFile(src, dst string, perm fs.FileMode) error {
+	if err := reflinkFile(src, dst, perm); err == nil {
+		return nil
+	}
+
+	return copyFile(src, dst, perm)
+}
+
+// copyFile copies the regular file src to dst with the given permissions.
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by copyDir
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by copyDir
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err //nolint:wrapcheck // wrapped by copyDir
+	}
+
+	return out.Close() //nolint:wrapcheck // wrapped by copyDir
+}
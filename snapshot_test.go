@@ -0,0 +1,216 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyDir(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "store", "abc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "store", "abc", "data.bin"), []byte("payload"), 0o640))
+	require.NoError(t, os.Symlink(filepath.Join("store", "abc"), filepath.Join(src, "db")))
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, copyDir(src, dst))
+
+	got, err := os.ReadFile(filepath.Join(dst, "store", "abc", "data.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(got))
+
+	info, err := os.Stat(filepath.Join(dst, "store", "abc", "data.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dst, "db"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("store", "abc"), link)
+}
+
+func TestCopyDir_RebasesAbsoluteLinks(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "store", "uuid"), 0o755))
+	require.NoError(t, os.Symlink(filepath.Join(src, "store", "uuid"), filepath.Join(src, "inside")))
+	require.NoError(t, os.Symlink("/var/lib/elsewhere", filepath.Join(src, "outside")))
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	require.NoError(t, copyDir(src, dst))
+
+	inside, err := os.Readlink(filepath.Join(dst, "inside"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dst, "store", "uuid"), inside)
+
+	outside, err := os.Readlink(filepath.Join(dst, "outside"))
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/elsewhere", outside)
+}
+
+func TestRebaseLink(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{name: "relative unchanged", link: "../store/abc", want: "../store/abc"},
+		{name: "inside src rebased", link: "/src/store/abc", want: "/dst/store/abc"},
+		{name: "src itself rebased", link: "/src", want: "/dst"},
+		{name: "outside src unchanged", link: "/other/store", want: "/other/store"},
+		{name: "sibling prefix unchanged", link: "/src2/store", want: "/src2/store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, rebaseLink(tt.link, "/src", "/dst"))
+		})
+	}
+}
+
+func TestStart_TemplateWithDataPath(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(DefaultConfig().TemplateDataPath(t.TempDir()).DataPath(t.TempDir()))
+	require.ErrorIs(t, s.Start(), ErrTemplateWithDataPath)
+}
+
+func TestSnapshot_NotStarted(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer()
+
+	_, err := s.Snapshot()
+	require.ErrorIs(t, err, ErrServerNotStarted)
+	require.ErrorIs(t, s.Restore("snapshot-1"), ErrServerNotStarted)
+}
+
+func TestSnapshot_ClusterManaged(t *testing.T) {
+	t.Parallel()
+
+	node := &EmbeddedClickHouse{clusterManaged: true}
+
+	_, err := node.Snapshot()
+	require.ErrorIs(t, err, ErrClusterManaged)
+	require.ErrorIs(t, node.Restore("snapshot-1"), ErrClusterManaged)
+}
+
+func TestRestore_UnknownToken(t *testing.T) {
+	t.Parallel()
+
+	// A started server with no process: Restore must reject the token before stopping
+	// or touching anything.
+	s := &EmbeddedClickHouse{started: true, tmpDir: t.TempDir()}
+
+	for _, token := range []SnapshotToken{"", "missing", "..", "../escape"} {
+		require.ErrorIs(t, s.Restore(token), ErrSnapshotNotFound, "token %q", token)
+	}
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	ctx := context.Background()
+
+	exec := func(query string) {
+		t.Helper()
+
+		db, err := sql.Open("clickhouse", s.DSN())
+		require.NoError(t, err)
+
+		defer db.Close()
+
+		_, err = db.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	count := func() int {
+		t.Helper()
+
+		db, err := sql.Open("clickhouse", s.DSN())
+		require.NoError(t, err)
+
+		defer db.Close()
+
+		var n int
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT count() FROM snap").Scan(&n))
+
+		return n
+	}
+
+	exec("CREATE TABLE snap (id UInt64) ENGINE = MergeTree ORDER BY id")
+	exec("INSERT INTO snap VALUES (1), (2)")
+
+	token, err := s.Snapshot()
+	require.NoError(t, err)
+
+	exec("INSERT INTO snap VALUES (3), (4), (5)")
+	assert.Equal(t, 5, count())
+
+	require.NoError(t, s.Restore(token))
+	assert.Equal(t, 2, count())
+}
+
+func TestIntegration_TemplateDataPath(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	golden := t.TempDir()
+
+	// Prepare the template once.
+	seed := NewServer(DefaultConfig().Version(V25_3).DataPath(golden).Logger(io.Discard))
+	require.NoError(t, seed.Start())
+
+	db, err := sql.Open("clickhouse", seed.DSN())
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE fixture (id UInt64) ENGINE = MergeTree ORDER BY id")
+	require.NoError(t, err)
+
+	_, err = db.ExecContext(ctx, "INSERT INTO fixture VALUES (1), (2), (3)")
+	require.NoError(t, err)
+
+	db.Close()
+	require.NoError(t, seed.Stop())
+
+	// Each clone sees the seed data, and writes stay isolated.
+	for i := range 2 {
+		s := NewServerForTest(t, DefaultConfig().Version(V25_3).TemplateDataPath(golden).Logger(io.Discard))
+
+		cdb, err := sql.Open("clickhouse", s.DSN())
+		require.NoError(t, err)
+
+		_, err = cdb.ExecContext(ctx, "INSERT INTO fixture VALUES (100)")
+		require.NoError(t, err)
+
+		var n int
+		require.NoError(t, cdb.QueryRowContext(ctx, "SELECT count() FROM fixture").Scan(&n))
+		assert.Equal(t, 4, n, "clone %d", i)
+
+		cdb.Close()
+	}
+}
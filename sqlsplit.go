@@ -0,0 +1,100 @@
+package embeddedclickhouse
+
+import "strings"
+
+// splitSQLStatements splits a script into statements on top-level semicolons. Semicolons
+// inside quoted strings or identifiers ('...', "...", `...`, with backslash escapes and
+// doubled quotes) and inside comments (-- line, # line and /* block */) do not split.
+// Statements are trimmed; empty and comment-only statements are dropped.
+func splitSQLStatements(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		hasCode    bool // current holds something besides whitespace and comments
+	)
+
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+
+		current.Reset()
+
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == ';':
+			flush()
+
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(script, i)
+			current.WriteString(script[i:end])
+
+			hasCode = true
+			i = end - 1
+
+			continue
+		case strings.HasPrefix(script[i:], "--") || c == '#':
+			end := strings.IndexByte(script[i:], '\n')
+			if end == -1 {
+				end = len(script) - i
+			}
+
+			current.WriteString(script[i : i+end])
+			i += end - 1
+
+			continue
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end == -1 {
+				end = len(script) - i
+			} else {
+				end += 4
+			}
+
+			current.WriteString(script[i : i+end])
+			i += end - 1
+
+			continue
+		}
+
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			hasCode = true
+		}
+
+		current.WriteByte(c)
+	}
+
+	flush()
+
+	return statements
+}
+
+// quotedEnd returns the index just past the quoted token that starts at script[start].
+// A backslash escapes the next byte and a doubled quote is a literal quote. An
+// unterminated token runs to the end of the script.
+func quotedEnd(script string, start int) int {
+	quote := script[start]
+
+	for i := start + 1; i < len(script); i++ {
+		switch script[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(script) && script[i+1] == quote {
+				i++
+
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return len(script)
+}
@@ -0,0 +1,71 @@
+package embeddedclickhouse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "simple",
+			script: "CREATE TABLE t (id UInt8) ENGINE = Memory;\nINSERT INTO t VALUES (1);",
+			want:   []string{"CREATE TABLE t (id UInt8) ENGINE = Memory", "INSERT INTO t VALUES (1)"},
+		},
+		{
+			name:   "no trailing semicolon",
+			script: "SELECT 1; SELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "semicolons in strings and identifiers",
+			script: `INSERT INTO t VALUES ('a;b', "c;d"); SELECT ` + "`we;ird`" + ` FROM t`,
+			want:   []string{`INSERT INTO t VALUES ('a;b', "c;d")`, "SELECT `we;ird` FROM t"},
+		},
+		{
+			name:   "escaped and doubled quotes",
+			script: `SELECT 'it\'s;' ; SELECT 'it''s;'`,
+			want:   []string{`SELECT 'it\'s;'`, `SELECT 'it''s;'`},
+		},
+		{
+			name:   "line comments",
+			script: "-- setup; not a split\nSELECT 1; # also; a comment\nSELECT 2",
+			want:   []string{"-- setup; not a split\nSELECT 1", "# also; a comment\nSELECT 2"},
+		},
+		{
+			name:   "block comment",
+			script: "SELECT /* a; b */ 1;",
+			want:   []string{"SELECT /* a; b */ 1"},
+		},
+		{
+			name:   "empty and comment-only statements dropped",
+			script: ";;\n-- only a comment;\n;  ;\nSELECT 1;\n/* trailing */",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "unterminated string runs to the end",
+			script: "SELECT 'oops; SELECT 2",
+			want:   []string{"SELECT 'oops; SELECT 2"},
+		},
+		{
+			name:   "empty script",
+			script: "  \n",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, splitSQLStatements(tt.script))
+		})
+	}
+}
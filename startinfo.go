@@ -0,0 +1,64 @@
+package embeddedclickhouse
+
+import (
+	"time"
+)
+
+// StartInfo describes a running server in one value, for tooling that would otherwise
+// call the accessors one by one. It marshals to JSON with camelCase keys;
+// StartDuration is in nanoseconds.
+type StartInfo struct {
+	// BinaryPath is the ClickHouse binary the server runs, see BinaryPath.
+	BinaryPath string `json:"binaryPath"`
+	// Version is the ClickHouse version of BinaryPath, see Version.
+	Version ClickHouseVersion `json:"version"`
+	// TCPPort is the native-protocol port.
+	TCPPort uint32 `json:"tcpPort"`
+	// HTTPPort is the HTTP interface port.
+	HTTPPort uint32 `json:"httpPort"`
+	// PID is the server process ID.
+	PID int `json:"pid"`
+	// DataDir is the server's working directory: the temp dir, or the DataPath.
+	DataDir string `json:"dataDir"`
+	// ConfigPath is the generated config.xml, see ConfigPath.
+	ConfigPath string `json:"configPath"`
+	// Downloaded reports whether this process downloaded BinaryPath, see DownloadedThisRun.
+	Downloaded bool `json:"downloaded"`
+	// StartDuration is how long Start took, from resolving the binary to the server
+	// being ready. For a cluster node it is the whole Cluster.Start.
+	StartDuration time.Duration `json:"startDuration"`
+}
+
+// RuntimeInfo returns the StartInfo of the server the last Start launched, or
+// ErrServerNotStarted. For a handle attached to a Shared instance PID, DataDir and
+// ConfigPath are zero and StartDuration is the time taken to attach.
+func (e *EmbeddedClickHouse) RuntimeInfo() (StartInfo, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if !e.started {
+		return StartInfo{}, ErrServerNotStarted
+	}
+
+	info := StartInfo{
+		BinaryPath:    e.binPath,
+		Version:       e.version,
+		TCPPort:       e.tcpPort,
+		HTTPPort:      e.httpPort,
+		PID:           0,
+		DataDir:       e.tmpDir,
+		ConfigPath:    "",
+		Downloaded:    e.downloaded,
+		StartDuration: e.startDuration,
+	}
+
+	if e.proc != nil {
+		info.PID = e.proc.cmd.Process.Pid
+	}
+
+	if e.tmpDir != "" {
+		info.ConfigPath = configPathIn(e.tmpDir)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,85 @@
+package embeddedclickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeInfo(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewServer().RuntimeInfo()
+	require.ErrorIs(t, err, ErrServerNotStarted)
+
+	s := &EmbeddedClickHouse{
+		started:       true,
+		tmpDir:        "/tmp/embedded-clickhouse-1",
+		binPath:       "/cache/clickhouse",
+		version:       V25_3,
+		downloaded:    true,
+		tcpPort:       19000,
+		httpPort:      18123,
+		startDuration: 3 * time.Second,
+	}
+
+	info, err := s.RuntimeInfo()
+	require.NoError(t, err)
+	assert.Equal(t, StartInfo{
+		BinaryPath:    "/cache/clickhouse",
+		Version:       V25_3,
+		TCPPort:       19000,
+		HTTPPort:      18123,
+		PID:           0,
+		DataDir:       "/tmp/embedded-clickhouse-1",
+		ConfigPath:    "/tmp/embedded-clickhouse-1/config.xml",
+		Downloaded:    true,
+		StartDuration: 3 * time.Second,
+	}, info)
+
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"binaryPath": "/cache/clickhouse", "version": "`+string(V25_3)+`",
+		"tcpPort": 19000, "httpPort": 18123, "pid": 0,
+		"dataDir": "/tmp/embedded-clickhouse-1", "configPath": "/tmp/embedded-clickhouse-1/config.xml",
+		"downloaded": true, "startDuration": 3000000000
+	}`, string(data))
+
+	// A handle attached to a Shared instance has no process or directory of its own.
+	info, err = (&EmbeddedClickHouse{started: true, shared: true, tcpPort: 19000}).RuntimeInfo()
+	require.NoError(t, err)
+	assert.Empty(t, info.ConfigPath)
+	assert.Zero(t, info.PID)
+}
+
+// --- Integration tests (skipped in short mode) ---
+
+func TestIntegration_RuntimeInfo(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := NewServerForTest(t, DefaultConfig().Version(V25_3).Logger(io.Discard))
+
+	info, err := s.RuntimeInfo()
+	require.NoError(t, err)
+
+	assert.Equal(t, s.BinaryPath(), info.BinaryPath)
+	assert.Equal(t, s.Version(), info.Version)
+	assert.Equal(t, s.ConfigPath(), info.ConfigPath)
+	assert.Equal(t, s.DownloadedThisRun(), info.Downloaded)
+	assert.Equal(t, filepath.Dir(s.MetadataPath()), info.DataDir)
+	assert.Equal(t, s.TCPAddr(), fmt.Sprintf("127.0.0.1:%d", info.TCPPort))
+	assert.True(t, pidAlive(info.PID), "pid %d not running", info.PID)
+	assert.Positive(t, info.StartDuration)
+	assert.FileExists(t, info.ConfigPath)
+}
@@ -0,0 +1,111 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"time"
+)
+
+// systemBinaryName is the executable UseSystemBinary looks up on PATH.
+const systemBinaryName = "clickhouse"
+
+// systemVersionTimeout bounds `clickhouse --version`, so a wedged binary cannot
+// hang the resolution.
+const systemVersionTimeout = 10 * time.Second
+
+// errSystemVersionUnknown means `clickhouse --version` printed no version. It is only
+// logged: systemBinary falls back to the download instead of failing.
+var errSystemVersionUnknown = errors.New("embedded-clickhouse: cannot parse clickhouse --version output")
+
+// systemVersionPattern finds the version in `clickhouse --version` output, e.g.
+// "ClickHouse local version 25.3.2.39 (official build)."
+var systemVersionPattern = regexp.MustCompile(`version (\d+(?:\.\d+)+)`)
+
+// systemBinary returns the clickhouse on PATH if it may serve cfg. Any problem (not
+// found, version unknown or different) is logged and reported as false, so the caller
+// falls back to the regular download.
+func systemBinary(ctx context.Context, cfg Config) (string, bool) {
+	path, err := exec.LookPath(systemBinaryName)
+	if err != nil {
+		return "", false
+	}
+
+	if cfg.skipVersionCheck {
+		logf(cfg.logger, "Using system ClickHouse %s (version not checked)\n", path)
+		return path, true
+	}
+
+	got, err := systemBinaryVersion(ctx, path)
+	if err != nil {
+		logf(cfg.logger, "Ignoring system ClickHouse %s: %v\n", path, err)
+		return "", false
+	}
+
+	if want := numericVersion(cfg.version); got != want {
+		logf(cfg.logger, "Ignoring system ClickHouse %s: version %s, want %s\n", path, got, want)
+		return "", false
+	}
+
+	logf(cfg.logger, "Using system ClickHouse %s (v%s)\n", path, got)
+
+	return path, true
+}
+
+// binaryVersion returns the version of the binary at path for Version: what `path
+// --version` reports when the config does not pin it (UseSystemBinary, BinaryPath), else
+// the configured version, which is also the fallback if the probe fails.
+func binaryVersion(ctx context.Context, cfg Config, path string) ClickHouseVersion {
+	if !cfg.useSystemBinary && cfg.binaryPath == "" {
+		return cfg.version
+	}
+
+	v, err := systemBinaryVersion(ctx, path)
+	if err != nil {
+		return cfg.version
+	}
+
+	return ClickHouseVersion(v)
+}
+
+// checkBinaryRuns implements VerifyBinaryRuns: it runs `path --version` and fails with
+// ErrBinaryNotExecutable if that does not work. A version other than the configured one
+// is only logged, since BinaryPath and custom archives need not match it.
+func checkBinaryRuns(ctx context.Context, cfg Config, path string) error {
+	got, err := systemBinaryVersion(ctx, path)
+	if err != nil {
+		if platformErr := execFormatError(path, err); platformErr != nil {
+			err = platformErr
+		}
+
+		return fmt.Errorf("%w: %w", ErrBinaryNotExecutable, err)
+	}
+
+	if want := numericVersion(cfg.version); got != want {
+		logf(cfg.logger, "ClickHouse %s runs, but reports version %s, want %s\n", path, got, want)
+	} else {
+		logf(cfg.logger, "ClickHouse %s runs (v%s)\n", path, got)
+	}
+
+	return nil
+}
+
+// systemBinaryVersion runs `path --version` and returns the numeric version it reports.
+func systemBinaryVersion(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, systemVersionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("embedded-clickhouse: %s --version: %w", path, err)
+	}
+
+	m := systemVersionPattern.FindSubmatch(out)
+	if m == nil {
+		return "", fmt.Errorf("%w: %q", errSystemVersionUnknown, out)
+	}
+
+	return string(m[1]), nil
+}
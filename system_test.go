@@ -0,0 +1,98 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSystemClickHouse puts a clickhouse on PATH that prints versionLine for --version
+// and returns its path.
+func fakeSystemClickHouse(t *testing.T, versionLine string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, systemBinaryName)
+
+	script := "#!/bin/sh\necho '" + versionLine + "'\n"
+	require.NoError(t, os.WriteFile(bin, []byte(script), 0o755))
+
+	t.Setenv("PATH", dir)
+
+	return bin
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestResolveBinary_UseSystemBinary(t *testing.T) {
+	bin := fakeSystemClickHouse(t, "ClickHouse local version 25.3.2.39 (official build).")
+
+	// An unreachable mirror proves nothing is downloaded.
+	cfg := DefaultConfig().
+		Version("25.3.2.39-lts").
+		CachePath(t.TempDir()).
+		BinaryRepositoryURL("http://127.0.0.1:1").
+		UseSystemBinary(true).
+		Logger(io.Discard)
+
+	got, _, err := resolveBinary(context.Background(), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, bin, got)
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestSystemBinary_VersionMismatch(t *testing.T) {
+	bin := fakeSystemClickHouse(t, "ClickHouse local version 24.8.4.13 (official build).")
+
+	cfg := DefaultConfig().Version("25.3.2.39-lts").UseSystemBinary(true).Logger(io.Discard)
+
+	_, ok := systemBinary(context.Background(), cfg)
+	assert.False(t, ok, "a different version must fall back to the download")
+
+	got, ok := systemBinary(context.Background(), cfg.SkipVersionCheck(true))
+	assert.True(t, ok)
+	assert.Equal(t, bin, got)
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestSystemBinary_UnparsableVersion(t *testing.T) {
+	fakeSystemClickHouse(t, "something else entirely")
+
+	_, ok := systemBinary(context.Background(), DefaultConfig().Version("25.3.2.39-lts").Logger(io.Discard))
+	assert.False(t, ok)
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestSystemBinary_NotOnPath(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, ok := systemBinary(context.Background(), DefaultConfig().SkipVersionCheck(true).Logger(io.Discard))
+	assert.False(t, ok)
+}
+
+func TestBinaryKeyFor_UseSystemBinary(t *testing.T) {
+	t.Parallel()
+
+	assert.NotEqual(t, binaryKeyFor(DefaultConfig()), binaryKeyFor(DefaultConfig().UseSystemBinary(true)))
+}
+
+//nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+func TestBinaryVersion(t *testing.T) {
+	bin := fakeSystemClickHouse(t, "ClickHouse local version 24.8.4.13 (official build).")
+	ctx := context.Background()
+	cfg := DefaultConfig().Version("25.3.2.39-lts")
+
+	// A downloaded binary is the configured version; it is not probed.
+	assert.Equal(t, ClickHouseVersion("25.3.2.39-lts"), binaryVersion(ctx, cfg, bin))
+
+	// A system binary reports what --version prints, even with the check skipped.
+	assert.Equal(t, ClickHouseVersion("24.8.4.13"), binaryVersion(ctx, cfg.UseSystemBinary(true).SkipVersionCheck(true), bin))
+	assert.Equal(t, ClickHouseVersion("24.8.4.13"), binaryVersion(ctx, cfg.BinaryPath(bin), bin))
+
+	// A binary that cannot be probed falls back to the configured version.
+	assert.Equal(t, ClickHouseVersion("25.3.2.39-lts"), binaryVersion(ctx, cfg.UseSystemBinary(true), "/does/not/exist"))
+}
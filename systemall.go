@@ -0,0 +1,62 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SystemOnAll runs a SYSTEM statement on every node concurrently over HTTP, e.g.
+// SystemOnAll(ctx, "SYNC REPLICA events") after an insert, or "FLUSH LOGS" before
+// reading system log tables. The leading SYSTEM keyword is optional. Every node runs
+// the statement even if others fail; the errors of the failing nodes, prefixed with
+// their index, are joined in node order.
+func (c *Cluster) SystemOnAll(ctx context.Context, command string) error {
+	c.mu.RLock()
+
+	if !c.started {
+		c.mu.RUnlock()
+		return ErrClusterNotStarted
+	}
+
+	ports := make([]uint32, len(c.nodes))
+	for i, node := range c.nodes {
+		ports[i] = node.httpPort
+	}
+
+	c.mu.RUnlock()
+
+	stmt := systemStatement(command)
+	errs := make([]error, len(ports))
+
+	var wg sync.WaitGroup
+
+	for i, port := range ports {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := execHTTP(ctx, port, stmt); err != nil {
+				errs[i] = fmt.Errorf("embedded-clickhouse: node %d: %w", i, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// systemStatement prefixes command with the SYSTEM keyword unless it already starts with it.
+func systemStatement(command string) string {
+	command = strings.TrimSpace(command)
+
+	if keyword, _, _ := strings.Cut(command, " "); strings.EqualFold(keyword, "SYSTEM") {
+		return command
+	}
+
+	return "SYSTEM " + command
+}
@@ -0,0 +1,68 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCluster_SystemOnAllNotStarted(t *testing.T) {
+	t.Parallel()
+
+	err := NewCluster(2).SystemOnAll(context.Background(), "FLUSH LOGS")
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
+
+func TestCluster_SystemOnAll(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+
+	ok := func(_ http.ResponseWriter, query string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		queries = append(queries, query)
+	}
+	failing := func(w http.ResponseWriter, _ string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Code: 60. DB::Exception: Table default.events does not exist")
+	}
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{
+		{httpPort: fakeQueryServer(t, ok)},
+		{httpPort: fakeQueryServer(t, failing)},
+		{httpPort: fakeQueryServer(t, ok)},
+	}}
+
+	err := cl.SystemOnAll(context.Background(), "SYNC REPLICA events")
+	require.ErrorIs(t, err, ErrQueryFailed)
+	assert.Contains(t, err.Error(), "node 1: ")
+	assert.NotContains(t, err.Error(), "node 0")
+	assert.NotContains(t, err.Error(), "node 2")
+
+	// The healthy nodes ran the statement despite the failure.
+	assert.Equal(t, []string{"SYSTEM SYNC REPLICA events", "SYSTEM SYNC REPLICA events"}, queries)
+}
+
+func TestSystemStatement(t *testing.T) {
+	t.Parallel()
+
+	for command, want := range map[string]string{
+		"FLUSH LOGS":                    "SYSTEM FLUSH LOGS",
+		"  SYNC REPLICA db.events  ":    "SYSTEM SYNC REPLICA db.events",
+		"SYSTEM DROP REPLICA 'r2'":      "SYSTEM DROP REPLICA 'r2'",
+		"system reload config":          "system reload config",
+		"SYSTEMS_ARE_NOT_THE_KEYWORD x": "SYSTEM SYSTEMS_ARE_NOT_THE_KEYWORD x",
+	} {
+		assert.Equal(t, want, systemStatement(command), command)
+	}
+}
@@ -0,0 +1,46 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// timingKey is the context key of the OnTiming recorder.
+type timingKey struct{}
+
+// timingRecorder serializes calls to the OnTiming callback, so cluster nodes starting
+// in parallel never invoke it concurrently.
+type timingRecorder struct {
+	mu sync.Mutex
+	fn func(phase string, d time.Duration)
+}
+
+// withTiming returns ctx carrying fn as the OnTiming callback; a nil fn leaves ctx as is.
+func withTiming(ctx context.Context, fn func(phase string, d time.Duration)) context.Context {
+	if fn == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, timingKey{}, &timingRecorder{fn: fn})
+}
+
+// timePhase starts timing phase and returns the func that reports it to the callback in
+// ctx, if any. Phases are reported whether or not they succeeded.
+func timePhase(ctx context.Context, phase string) func() {
+	r, ok := ctx.Value(timingKey{}).(*timingRecorder)
+	if !ok {
+		return func() {}
+	}
+
+	start := time.Now()
+
+	return func() {
+		d := time.Since(start)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.fn(phase, d)
+	}
+}
@@ -0,0 +1,77 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// phaseRecorder collects the phases reported to an OnTiming callback.
+type phaseRecorder struct {
+	mu     sync.Mutex
+	phases []string
+}
+
+func (r *phaseRecorder) record(phase string, _ time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.phases = append(r.phases, phase)
+}
+
+func (r *phaseRecorder) got() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.phases...)
+}
+
+func TestTimePhase(t *testing.T) {
+	t.Parallel()
+
+	var gotPhase string
+
+	var gotDuration time.Duration
+
+	ctx := withTiming(context.Background(), func(phase string, d time.Duration) {
+		gotPhase, gotDuration = phase, d
+	})
+
+	done := timePhase(ctx, "extract")
+
+	time.Sleep(10 * time.Millisecond)
+	done()
+
+	assert.Equal(t, "extract", gotPhase)
+	assert.GreaterOrEqual(t, gotDuration, 10*time.Millisecond)
+}
+
+func TestTimePhase_NoCallback(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, context.Background(), withTiming(context.Background(), nil))
+
+	// Without a callback the returned func is a no-op.
+	timePhase(context.Background(), "download")()
+}
+
+func TestOnTiming_ReportsStartPhases(t *testing.T) {
+	t.Parallel()
+
+	var rec phaseRecorder
+
+	// The fake binary exits at once, so readiness fails but every phase up to it runs.
+	s := NewServer(DefaultConfig().
+		BinaryPath(writeFakeBinary(t, 3)).
+		Logger(io.Discard).
+		StartTimeout(5 * time.Second).
+		OnTiming(rec.record))
+
+	require.Error(t, s.Start())
+	assert.Equal(t, []string{"config", "process-start", "wait-ready"}, rec.got())
+}
@@ -0,0 +1,68 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// topologyQuery lists every cluster the server knows, in layout order.
+const topologyQuery = `SELECT cluster, shard_num, replica_num, host_name, port
+FROM system.clusters
+ORDER BY cluster, shard_num, replica_num
+FORMAT JSONEachRow`
+
+// ClusterRow is one row of system.clusters: a replica as the server sees it in <remote_servers>.
+type ClusterRow struct {
+	// Cluster is the cluster name, e.g. "test_cluster".
+	Cluster string `json:"cluster"`
+	// ShardNum is the 1-based shard number.
+	ShardNum uint32 `json:"shard_num"` //nolint:tagliatelle // ClickHouse column name
+	// ReplicaNum is the 1-based replica number within the shard.
+	ReplicaNum uint32 `json:"replica_num"` //nolint:tagliatelle // ClickHouse column name
+	// HostName is the replica's host as configured.
+	HostName string `json:"host_name"` //nolint:tagliatelle // ClickHouse column name
+	// Port is the replica's native protocol port.
+	Port uint16 `json:"port"`
+}
+
+// Topology returns system.clusters as seen by node 0, ordered by cluster, shard and
+// replica, so a test can check the generated <remote_servers> layout (e.g. that
+// test_cluster has one shard with a replica per node on the nodes' TCP ports).
+func (c *Cluster) Topology(ctx context.Context) ([]ClusterRow, error) {
+	c.mu.RLock()
+
+	if !c.started {
+		c.mu.RUnlock()
+		return nil, ErrClusterNotStarted
+	}
+
+	httpPort := c.nodes[0].httpPort
+	c.mu.RUnlock()
+
+	body, err := execHTTPWithSettings(ctx, httpPort, topologyQuery, internalQuerySettings())
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClusterRows(body)
+}
+
+// parseClusterRows decodes JSONEachRow output into ClusterRow values.
+func parseClusterRows(body string) ([]ClusterRow, error) {
+	var rows []ClusterRow
+
+	dec := json.NewDecoder(strings.NewReader(body))
+
+	for dec.More() {
+		var row ClusterRow
+		if err := dec.Decode(&row); err != nil {
+			return nil, fmt.Errorf("embedded-clickhouse: decode system.clusters row: %w", err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
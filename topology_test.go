@@ -0,0 +1,61 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClusterRows(t *testing.T) {
+	t.Parallel()
+
+	body := `{"cluster":"test_cluster","shard_num":1,"replica_num":1,"host_name":"127.0.0.1","port":19000}
+{"cluster":"test_cluster","shard_num":1,"replica_num":2,"host_name":"127.0.0.1","port":19005}
+`
+
+	rows, err := parseClusterRows(body)
+	require.NoError(t, err)
+	assert.Equal(t, []ClusterRow{
+		{Cluster: "test_cluster", ShardNum: 1, ReplicaNum: 1, HostName: "127.0.0.1", Port: 19000},
+		{Cluster: "test_cluster", ShardNum: 1, ReplicaNum: 2, HostName: "127.0.0.1", Port: 19005},
+	}, rows)
+}
+
+func TestParseClusterRows_Malformed(t *testing.T) {
+	t.Parallel()
+
+	_, err := parseClusterRows(`{"cluster":`)
+	require.Error(t, err)
+}
+
+func TestCluster_TopologyNotStarted(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCluster(2).Topology(context.Background())
+	require.ErrorIs(t, err, ErrClusterNotStarted)
+}
+
+func TestCluster_TopologyQueriesNodeZero(t *testing.T) {
+	t.Parallel()
+
+	var got string
+
+	port := fakeQueryServer(t, func(w http.ResponseWriter, query string) {
+		got = query
+
+		io.WriteString(w, `{"cluster":"test_cluster","shard_num":1,"replica_num":1,"host_name":"127.0.0.1","port":19000}`+"\n")
+	})
+
+	cl := &Cluster{started: true, nodes: []*EmbeddedClickHouse{{httpPort: port}}}
+
+	rows, err := cl.Topology(context.Background())
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, uint16(19000), rows[0].Port)
+	assert.True(t, strings.Contains(got, "FROM system.clusters"), "query = %q", got)
+}
@@ -0,0 +1,58 @@
+package embeddedclickhouse
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans emitted by this package.
+const tracerName = "github.com/franchb/embedded-clickhouse"
+
+// Span attribute keys.
+const (
+	attrVersion  = attribute.Key("clickhouse.version")
+	attrURL      = attribute.Key("url.full")
+	attrBytes    = attribute.Key("clickhouse.bytes")
+	attrTCPPort  = attribute.Key("clickhouse.tcp_port")
+	attrHTTPPort = attribute.Key("clickhouse.http_port")
+	attrNode     = attribute.Key("clickhouse.node")
+)
+
+// rootSpan starts a top-level span under ctx with the configured Tracer. Without one it
+// returns ctx carrying a no-op span, which makes every startSpan below it a no-op even
+// when the caller's ctx holds a span of its own.
+func (c Config) rootSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		span := trace.SpanFromContext(context.Background())
+
+		return trace.ContextWithSpan(ctx, span), span
+	}
+
+	return c.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startSpan starts a child of the span in ctx, using that span's tracer provider, so
+// helpers deep in the call tree need no Config to be traced.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err (if any) on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// portAttrs returns the port attributes of a server.
+func portAttrs(tcpPort, httpPort uint32) []attribute.KeyValue {
+	return []attribute.KeyValue{attrTCPPort.Int64(int64(tcpPort)), attrHTTPPort.Int64(int64(httpPort))}
+}
@@ -0,0 +1,140 @@
+package embeddedclickhouse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingProvider is a minimal in-memory TracerProvider: it records the name and
+// attributes of every ended span.
+type recordingProvider struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	ended []*recordedSpan
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{p: p}
+}
+
+// span returns the ended span called name, or nil.
+func (p *recordingProvider) span(name string) *recordedSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.ended {
+		if s.name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+
+	p *recordingProvider
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	s := &recordedSpan{p: t.p, name: name, attrs: cfg.Attributes()}
+
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type recordedSpan struct {
+	noop.Span
+
+	p     *recordingProvider
+	name  string
+	attrs []attribute.KeyValue
+	err   error
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) { s.attrs = append(s.attrs, kv...) }
+
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) { s.err = err }
+
+func (s *recordedSpan) TracerProvider() trace.TracerProvider { return s.p }
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+
+	s.p.ended = append(s.p.ended, s)
+}
+
+// attr returns the value of the attribute key, or an invalid Value.
+func (s *recordedSpan) attr(key attribute.Key) attribute.Value {
+	for _, kv := range s.attrs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+
+	return attribute.Value{}
+}
+
+func TestTracing_DownloadSpans(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	t.Cleanup(ts.Close)
+
+	provider := &recordingProvider{}
+	cfg := DefaultConfig().Tracer(provider.Tracer(""))
+
+	ctx, root := cfg.rootSpan(context.Background(), "embedded-clickhouse.Start")
+	require.NoError(t, downloadFile(ctx, ts.URL+"/archive.tgz", filepath.Join(t.TempDir(), "archive.tgz")))
+	endSpan(root, nil)
+
+	span := provider.span("embedded-clickhouse.downloadFile")
+	require.NotNil(t, span, "downloadFile span not recorded")
+	assert.Equal(t, int64(10), span.attr(attrBytes).AsInt64())
+	assert.Equal(t, ts.URL+"/archive.tgz", span.attr(attrURL).AsString())
+	assert.NotNil(t, provider.span("embedded-clickhouse.Start"))
+}
+
+func TestTracing_EnsureBinaryRecordsError(t *testing.T) {
+	t.Parallel()
+
+	provider := &recordingProvider{}
+	cfg := DefaultConfig().Tracer(provider.Tracer("")).BinaryPath("/nonexistent/clickhouse")
+
+	ctx, root := cfg.rootSpan(context.Background(), "embedded-clickhouse.Start")
+	_, _, err := ensureBinary(ctx, cfg)
+	endSpan(root, err)
+
+	require.Error(t, err)
+
+	span := provider.span("embedded-clickhouse.ensureBinary")
+	require.NotNil(t, span)
+	assert.Equal(t, string(DefaultVersion), span.attr(attrVersion).AsString())
+	require.ErrorIs(t, span.err, err)
+}
+
+func TestTracing_NoTracerIsNoop(t *testing.T) {
+	t.Parallel()
+
+	ctx, span := DefaultConfig().rootSpan(context.Background(), "embedded-clickhouse.Start")
+	assert.False(t, span.IsRecording())
+
+	_, child := startSpan(ctx, "child")
+	assert.False(t, child.IsRecording())
+}